@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+const (
+	// defaultTruncationRate is the truncation rate raising the maximum number of tokens when
+	// AdaptiveMaxTokensConfig.TruncationRate is unset.
+	defaultTruncationRate = 0.1
+	// adaptiveMinCalls is the number of calls observed at a maximum number of tokens before it is raised again.
+	adaptiveMinCalls = 10
+	// adaptiveGrowth is the factor the maximum number of tokens is raised by.
+	adaptiveGrowth = 1.5
+)
+
+// AdaptiveMaxTokensConfig holds the settings of the adaptive maximum number of tokens, see
+// ExtractInsights.WithAdaptiveMaxTokens.
+type AdaptiveMaxTokensConfig struct {
+	// Ceiling is the maximum number of tokens the budget is raised to, 0 disables the adaptation.
+	Ceiling int `yaml:"ceiling"`
+	// TruncationRate is the fraction of truncated responses over which the budget is raised,
+	// defaultTruncationRate when unset.
+	TruncationRate float64 `yaml:"truncation_rate"`
+}
+
+/*
+adaptiveMaxTokens is the maximum number of tokens of the calls to a model, raised by
+adaptiveGrowth, up to a ceiling, whenever more than a given fraction of the responses of the
+last calls (at least adaptiveMinCalls of them) were truncated. The truncations observed at the
+previous budget are forgotten once it is raised.
+*/
+type adaptiveMaxTokens struct {
+	mu          sync.Mutex
+	maxTokens   int
+	ceiling     int
+	threshold   float64
+	truncations *errorRate
+}
+
+// current returns the maximum number of tokens of the next calls.
+func (a *adaptiveMaxTokens) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.maxTokens
+}
+
+// record records whether a call at the current budget was truncated, raising the budget
+// when too many were.
+func (a *adaptiveMaxTokens) record(truncated bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.truncations.record(truncated)
+	if a.maxTokens >= a.ceiling || a.truncations.calls < adaptiveMinCalls || a.truncations.rate() <= a.threshold {
+		return
+	}
+	raised := min(int(float64(a.maxTokens)*adaptiveGrowth), a.ceiling)
+	log.Printf("%.0f%% of the last %d responses were truncated, raising the max tokens from %d to %d", a.truncations.rate()*100, a.truncations.calls, a.maxTokens, raised)
+	a.maxTokens = raised
+	a.truncations = &errorRate{}
+}
+
+// adaptiveBudgets holds the adaptive maximum number of tokens of every model called by the
+// worker, shared by its ExtractInsights like providerErrorRates.
+var adaptiveBudgets = struct {
+	sync.Mutex
+	budgets map[string]*adaptiveMaxTokens
+}{budgets: make(map[string]*adaptiveMaxTokens)}
+
+/*
+WithAdaptiveMaxTokens lets the maximum number of tokens of the calls adapt to the truncation
+rate observed by the worker: starting from the configured maximum, it is raised by half
+whenever more than truncationRate of the responses of the last calls were truncated, up to
+ceiling (itself capped by the model's limit). Truncated responses are still retried with twice
+the tokens; only the first attempts are observed. A ceiling of 0 disables the adaptation.
+*/
+func (ei *ExtractInsights) WithAdaptiveMaxTokens(ceiling int, truncationRate float64) *ExtractInsights {
+	ei.AdaptiveMaxTokens = AdaptiveMaxTokensConfig{Ceiling: ceiling, TruncationRate: truncationRate}
+	return ei
+}
+
+// adaptiveBudget returns the adaptive maximum number of tokens of the configured model, created
+// on first use, nil when the adaptation is disabled.
+func (ei *ExtractInsights) adaptiveBudget() *adaptiveMaxTokens {
+	if ei.AdaptiveMaxTokens.Ceiling <= 0 {
+		return nil
+	}
+
+	active := ei.activeModel()
+	key := active.cfg.Provider + "/" + active.cfg.Model
+	adaptiveBudgets.Lock()
+	defer adaptiveBudgets.Unlock()
+
+	budget, ok := adaptiveBudgets.budgets[key]
+	if !ok {
+		start := active.cfg.MaxTokens
+		if start == 0 {
+			start = defaultMaxTokens
+		}
+		threshold := ei.AdaptiveMaxTokens.TruncationRate
+		if threshold <= 0 {
+			threshold = defaultTruncationRate
+		}
+		budget = &adaptiveMaxTokens{
+			maxTokens:   start,
+			ceiling:     max(llm.ClampMaxTokens(active.cfg.Provider, active.cfg.Model, ei.AdaptiveMaxTokens.Ceiling), start),
+			threshold:   threshold,
+			truncations: &errorRate{},
+		}
+		adaptiveBudgets.budgets[key] = budget
+	}
+	return budget
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAdaptiveMaxTokens(t *testing.T) {
+	budget := &adaptiveMaxTokens{maxTokens: 1000, ceiling: 2000, threshold: 0.1, truncations: &errorRate{}}
+
+	// Under the threshold, the budget is kept
+	for i := 0; i < adaptiveMinCalls*2; i++ {
+		budget.record(false)
+	}
+	budget.record(true)
+	budget.record(true)
+	assert.Equal(t, 1000, budget.current())
+
+	// Over it, the budget is raised by half
+	budget.record(true)
+	assert.Equal(t, 1500, budget.current())
+
+	// The truncations at the new budget are observed over enough calls first, then up to the ceiling
+	for i := 0; i < adaptiveMinCalls-1; i++ {
+		budget.record(true)
+	}
+	assert.Equal(t, 1500, budget.current())
+	budget.record(true)
+	assert.Equal(t, 2000, budget.current())
+
+	for i := 0; i < adaptiveMinCalls; i++ {
+		budget.record(true)
+	}
+	assert.Equal(t, 2000, budget.current())
+}
+
+func TestExtractInsights_AdaptiveMaxTokens(t *testing.T) {
+	defer delete(adaptiveBudgets.budgets, "gemini/gemini-adaptive-test")
+
+	mockLLM := new(MockMetadataLanguageModel)
+	ei := &ExtractInsights{
+		model:          mockLLM,
+		InsightsSchema: `{"type": "object"}`,
+		MaxRetries:     1,
+		maxTokens:      1000,
+		LLM:            llm.LLMConfig{Model: "gemini-adaptive-test"},
+	}
+	ei.WithAdaptiveMaxTokens(4000, 0.1)
+
+	var maxTokens []int
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			maxTokens = append(maxTokens, args.Get(2).(*llm.GenerateOptions).MaxTokens)
+		}).
+		Return(`{"overall_assessment": "Cut`, llm.ResponseMeta{FinishReason: "MAX_TOKENS", Reason: llm.FinishReasonLength}, nil)
+
+	// Every response is truncated, so the budget is raised every adaptiveMinCalls calls
+	for i := 0; i < adaptiveMinCalls*2+1; i++ {
+		_, err := ei.extract(context.Background(), Assessment{Result: "User performance data."})
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, 1000, maxTokens[0])
+	assert.Equal(t, 1500, maxTokens[adaptiveMinCalls])
+	assert.Equal(t, 2250, maxTokens[adaptiveMinCalls*2])
+}
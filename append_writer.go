@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn2x1[context.Context, string, error](&appendJSONLFn{})
+}
+
+// defaultSyncInterval is the interval the appended JSON lines are synced to disk at when
+// OutputConfig.SyncInterval is unset.
+const defaultSyncInterval = time.Second
+
+// syncWriter is a file the JSON lines are appended to, e.g. an *os.File.
+type syncWriter interface {
+	io.Writer
+	// Sync commits the lines written so far to stable storage.
+	Sync() error
+	Close() error
+}
+
+/*
+jsonlAppender appends JSON lines to a file as they come, each with a single unbuffered write,
+so completed elements reach the file right away, and syncs the file to disk at most every
+syncInterval: a crash of the machine loses at most the lines of the last interval, a crash of
+the process none.
+*/
+type jsonlAppender struct {
+	mu           sync.Mutex
+	file         syncWriter
+	syncInterval time.Duration
+	lastSync     time.Time
+	dirty        bool
+	now          func() time.Time
+}
+
+// newJSONLAppender opens (or creates) the local file at path, appending the lines to it and
+// syncing it every syncInterval.
+func newJSONLAppender(path string, syncInterval time.Duration) (*jsonlAppender, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening output file: %w", err)
+	}
+	return newJSONLAppenderTo(file, syncInterval), nil
+}
+
+// newJSONLAppenderTo creates a jsonlAppender writing to file.
+func newJSONLAppenderTo(file syncWriter, syncInterval time.Duration) *jsonlAppender {
+	return &jsonlAppender{
+		file:         file,
+		syncInterval: syncInterval,
+		lastSync:     time.Now(),
+		now:          time.Now,
+	}
+}
+
+// Append writes the line to the file, then syncs it if the sync interval has elapsed.
+func (a *jsonlAppender) Append(line string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// A single write per line keeps lines whole when several appenders share the file
+	if _, err := a.file.Write([]byte(line + "\n")); err != nil {
+		return fmt.Errorf("error appending to output file: %w", err)
+	}
+	a.dirty = true
+
+	if a.now().Sub(a.lastSync) >= a.syncInterval {
+		return a.sync()
+	}
+	return nil
+}
+
+// Sync syncs the lines appended since the last sync to disk, if any.
+func (a *jsonlAppender) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sync()
+}
+
+func (a *jsonlAppender) sync() error {
+	if !a.dirty {
+		return nil
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing output file: %w", err)
+	}
+	a.lastSync = a.now()
+	a.dirty = false
+	return nil
+}
+
+// Close syncs the remaining lines and closes the file.
+func (a *jsonlAppender) Close() error {
+	if err := a.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// appendJSONLFn is a DoFn appending each JSON line to the local file at Path as soon as it is
+// processed, synced every SyncInterval and at the end of every bundle.
+type appendJSONLFn struct {
+	Path         string
+	SyncInterval time.Duration
+	appender     *jsonlAppender
+}
+
+func (fn *appendJSONLFn) Setup() error {
+	syncInterval := fn.SyncInterval
+	if syncInterval <= 0 {
+		syncInterval = defaultSyncInterval
+	}
+	appender, err := newJSONLAppender(fn.Path, syncInterval)
+	if err != nil {
+		return err
+	}
+	fn.appender = appender
+	return nil
+}
+
+func (fn *appendJSONLFn) ProcessElement(_ context.Context, line string) error {
+	return fn.appender.Append(line)
+}
+
+func (fn *appendJSONLFn) FinishBundle(_ context.Context) error {
+	return fn.appender.Sync()
+}
+
+func (fn *appendJSONLFn) Teardown() error {
+	if fn.appender == nil {
+		return nil
+	}
+	return fn.appender.Close()
+}
+
+// appendJSONL appends the JSON lines to the local file at path as they are processed, without
+// windowing, so it suits streaming jobs on a single machine (e.g. the direct runner).
+func appendJSONL(scope beam.Scope, path string, syncInterval time.Duration, lines beam.PCollection) {
+	beam.ParDo0(scope.Scope("appendJSONL"), &appendJSONLFn{Path: path, SyncInterval: syncInterval}, lines)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncRecordingFile is a syncWriter recording what was synced.
+type syncRecordingFile struct {
+	bytes.Buffer
+	// synced holds the contents at every sync.
+	synced []string
+	closed bool
+}
+
+func (f *syncRecordingFile) Sync() error {
+	f.synced = append(f.synced, f.String())
+	return nil
+}
+
+func (f *syncRecordingFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestJSONLAppender(t *testing.T) {
+	file := &syncRecordingFile{}
+	appender := newJSONLAppenderTo(file, 10*time.Second)
+	clock := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	appender.now = func() time.Time { return clock }
+	appender.lastSync = clock
+
+	// Every line is appended right away, the file is only synced once the interval elapsed
+	assert.NoError(t, appender.Append(`{"assessment_id":"a"}`))
+	assert.Equal(t, "{\"assessment_id\":\"a\"}\n", file.String())
+	clock = clock.Add(5 * time.Second)
+	assert.NoError(t, appender.Append(`{"assessment_id":"b"}`))
+	assert.Equal(t, "{\"assessment_id\":\"a\"}\n{\"assessment_id\":\"b\"}\n", file.String())
+	assert.Empty(t, file.synced)
+
+	clock = clock.Add(5 * time.Second)
+	assert.NoError(t, appender.Append(`{"assessment_id":"c"}`))
+	assert.Equal(t, []string{"{\"assessment_id\":\"a\"}\n{\"assessment_id\":\"b\"}\n{\"assessment_id\":\"c\"}\n"}, file.synced)
+
+	// The next interval starts from the last sync
+	clock = clock.Add(9 * time.Second)
+	assert.NoError(t, appender.Append(`{"assessment_id":"d"}`))
+	assert.Len(t, file.synced, 1)
+
+	// Closing syncs the remaining lines, a sync without new lines is skipped
+	assert.NoError(t, appender.Close())
+	assert.Len(t, file.synced, 2)
+	assert.True(t, file.closed)
+	assert.NoError(t, appender.Sync())
+	assert.Len(t, file.synced, 2)
+}
+
+func TestAppendJSONLFn(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "processed.jsonl")
+	fn := &appendJSONLFn{Path: path}
+	if !assert.NoError(t, fn.Setup()) {
+		return
+	}
+	assert.Equal(t, defaultSyncInterval, fn.appender.syncInterval)
+
+	// Lines are in the file as soon as they are processed, before the bundle finishes
+	assert.NoError(t, fn.ProcessElement(ctx, `{"assessment_id":"a"}`))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"assessment_id\":\"a\"}\n", string(data))
+
+	assert.NoError(t, fn.ProcessElement(ctx, `{"assessment_id":"b"}`))
+	assert.NoError(t, fn.FinishBundle(ctx))
+	assert.NoError(t, fn.Teardown())
+
+	// A restarted worker appends to the existing file
+	fn = &appendJSONLFn{Path: path}
+	assert.NoError(t, fn.Setup())
+	assert.NoError(t, fn.ProcessElement(ctx, `{"assessment_id":"c"}`))
+	assert.NoError(t, fn.Teardown())
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"assessment_id\":\"a\"}\n{\"assessment_id\":\"b\"}\n{\"assessment_id\":\"c\"}\n", string(data))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn5x1[state.Provider, timers.Provider, string, Assessment, func([]Assessment), error](&deadlineBatchFn{})
+	register.Emitter1[[]Assessment]()
+}
+
+/*
+deadlineBatchFn is a stateful DoFn batching the assessments of each key, flushing a batch
+once it holds MaxSize assessments or MaxWait after its first assessment was buffered,
+whichever comes first, so that the latency of a batch stays bounded in streaming mode when
+assessments trickle in.
+
+	MaxSize: The number of assessments of a full batch.
+
+	MaxWait: The longest time an assessment waits in a batch, in processing time.
+
+	Buffer, Size: The assessments of the pending batch and their count, per key.
+
+	Deadline: The processing-time timer flushing the pending batch.
+*/
+type deadlineBatchFn struct {
+	MaxSize  int
+	MaxWait  time.Duration
+	Buffer   state.Bag[Assessment]
+	Size     state.Value[int]
+	Deadline timers.ProcessingTime
+
+	// now returns the processing time the deadline is counted from, overridden in tests.
+	now func() time.Time
+}
+
+// newDeadlineBatchFn creates a deadlineBatchFn flushing batches of maxSize assessments, or
+// after maxWait.
+func newDeadlineBatchFn(maxSize int, maxWait time.Duration) *deadlineBatchFn {
+	return &deadlineBatchFn{
+		MaxSize:  maxSize,
+		MaxWait:  maxWait,
+		Buffer:   state.MakeBagState[Assessment]("buffer"),
+		Size:     state.MakeValueState[int]("size"),
+		Deadline: timers.InProcessingTime("deadline"),
+	}
+}
+
+func (fn *deadlineBatchFn) Setup() {
+	if fn.now == nil {
+		fn.now = time.Now
+	}
+}
+
+// ProcessElement buffers the assessment, setting the deadline of a new batch and flushing a full one.
+func (fn *deadlineBatchFn) ProcessElement(sp state.Provider, tp timers.Provider, _ string, assessment Assessment, emit func([]Assessment)) error {
+	size, _, err := fn.Size.Read(sp)
+	if err != nil {
+		return fmt.Errorf("error reading the batch size: %w", err)
+	}
+	if size == 0 {
+		fn.Deadline.Set(tp, fn.now().Add(fn.MaxWait))
+	}
+	if err := fn.Buffer.Add(sp, assessment); err != nil {
+		return fmt.Errorf("error buffering the assessment: %w", err)
+	}
+	size++
+	if size >= fn.MaxSize {
+		fn.Deadline.Clear(tp)
+		return fn.flush(sp, emit)
+	}
+	if err := fn.Size.Write(sp, size); err != nil {
+		return fmt.Errorf("error writing the batch size: %w", err)
+	}
+	return nil
+}
+
+// OnTimer flushes the pending batch once its deadline expires.
+func (fn *deadlineBatchFn) OnTimer(_ context.Context, sp state.Provider, _ timers.Provider, _ string, timer timers.Context, emit func([]Assessment)) error {
+	if timer.Family != fn.Deadline.Family {
+		return nil
+	}
+	return fn.flush(sp, emit)
+}
+
+// flush emits the pending batch, if any, and clears it.
+func (fn *deadlineBatchFn) flush(sp state.Provider, emit func([]Assessment)) error {
+	batch, ok, err := fn.Buffer.Read(sp)
+	if err != nil {
+		return fmt.Errorf("error reading the batch: %w", err)
+	}
+	if ok {
+		emit(batch)
+	}
+	if err := fn.Buffer.Clear(sp); err != nil {
+		return fmt.Errorf("error clearing the batch: %w", err)
+	}
+	if err := fn.Size.Clear(sp); err != nil {
+		return fmt.Errorf("error clearing the batch size: %w", err)
+	}
+	return nil
+}
+
+/*
+batchWithDeadline batches the keyed assessments, a PCollection<KV<string, Assessment>> (e.g.
+from keyAssessments), into a PCollection<[]Assessment> of batches of the same key, flushed once
+they hold maxSize assessments or maxWait after their first assessment, whichever comes first.
+Batches are per key, as state and timers are, so keys should be coarse enough to fill them.
+*/
+func batchWithDeadline(scope beam.Scope, maxSize int, maxWait time.Duration, keyed beam.PCollection) beam.PCollection {
+	return beam.ParDo(scope.Scope("BatchWithDeadline"), newDeadlineBatchFn(maxSize, maxWait), keyed)
+}
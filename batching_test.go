@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStateProvider is a state.Provider keeping the value and bag states of a single key in memory.
+type fakeStateProvider struct {
+	state.Provider
+	values map[string]any
+	bags   map[string][]any
+}
+
+func newFakeStateProvider() *fakeStateProvider {
+	return &fakeStateProvider{values: make(map[string]any), bags: make(map[string][]any)}
+}
+
+func (p *fakeStateProvider) ReadValueState(id string) (any, []state.Transaction, error) {
+	return p.values[id], nil, nil
+}
+
+func (p *fakeStateProvider) WriteValueState(val state.Transaction) error {
+	p.values[val.Key] = val.Val
+	return nil
+}
+
+func (p *fakeStateProvider) ClearValueState(val state.Transaction) error {
+	delete(p.values, val.Key)
+	return nil
+}
+
+func (p *fakeStateProvider) ReadBagState(id string) ([]any, []state.Transaction, error) {
+	return p.bags[id], nil, nil
+}
+
+func (p *fakeStateProvider) WriteBagState(val state.Transaction) error {
+	p.bags[val.Key] = append(p.bags[val.Key], val.Val)
+	return nil
+}
+
+func (p *fakeStateProvider) ClearBagState(val state.Transaction) error {
+	delete(p.bags, val.Key)
+	return nil
+}
+
+// fakeTimerProvider is a timers.Provider recording the timers set and cleared.
+type fakeTimerProvider struct {
+	timers []timers.TimerMap
+}
+
+func (p *fakeTimerProvider) Set(t timers.TimerMap) {
+	p.timers = append(p.timers, t)
+}
+
+func TestDeadlineBatchFn(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	assessments := []Assessment{{Result: "a"}, {Result: "b"}, {Result: "c"}}
+
+	t.Run("Flush on size", func(t *testing.T) {
+		fn := newDeadlineBatchFn(2, time.Minute)
+		fn.now = func() time.Time { return now }
+		fn.Setup()
+		sp, tp := newFakeStateProvider(), &fakeTimerProvider{}
+		var batches [][]Assessment
+		emit := func(batch []Assessment) { batches = append(batches, batch) }
+
+		for _, assessment := range assessments {
+			assert.NoError(t, fn.ProcessElement(sp, tp, "key", assessment, emit))
+		}
+
+		// The first two assessments fill a batch, the third one starts the next batch
+		assert.Equal(t, [][]Assessment{{{Result: "a"}, {Result: "b"}}}, batches)
+		assert.Equal(t, []timers.TimerMap{
+			{Family: "deadline", FireTimestamp: mtime.FromTime(now.Add(time.Minute)), HoldTimestamp: mtime.FromTime(now.Add(time.Minute))},
+			{Family: "deadline", Clear: true},
+			{Family: "deadline", FireTimestamp: mtime.FromTime(now.Add(time.Minute)), HoldTimestamp: mtime.FromTime(now.Add(time.Minute))},
+		}, tp.timers)
+		assert.Len(t, sp.bags["buffer"], 1)
+	})
+
+	t.Run("Flush on timer expiry", func(t *testing.T) {
+		fn := newDeadlineBatchFn(10, time.Minute)
+		fn.now = func() time.Time { return now }
+		fn.Setup()
+		sp, tp := newFakeStateProvider(), &fakeTimerProvider{}
+		var batches [][]Assessment
+		emit := func(batch []Assessment) { batches = append(batches, batch) }
+
+		for _, assessment := range assessments[:2] {
+			assert.NoError(t, fn.ProcessElement(sp, tp, "key", assessment, emit))
+		}
+		assert.Empty(t, batches)
+
+		// A single deadline is set for the batch, a minute after its first assessment
+		assert.Equal(t, []timers.TimerMap{
+			{Family: "deadline", FireTimestamp: mtime.FromTime(now.Add(time.Minute)), HoldTimestamp: mtime.FromTime(now.Add(time.Minute))},
+		}, tp.timers)
+
+		// The partial batch is flushed once the deadline expires
+		assert.NoError(t, fn.OnTimer(context.Background(), sp, tp, "key", timers.Context{Family: "deadline"}, emit))
+		assert.Equal(t, [][]Assessment{{{Result: "a"}, {Result: "b"}}}, batches)
+		assert.Empty(t, sp.bags)
+		assert.Empty(t, sp.values)
+
+		// An expired deadline without a pending batch emits nothing
+		assert.NoError(t, fn.OnTimer(context.Background(), sp, tp, "key", timers.Context{Family: "deadline"}, emit))
+		assert.Len(t, batches, 1)
+	})
+}
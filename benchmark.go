@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+func init() {
+	register.DoFn3x0[context.Context, Assessment, func(ProviderComparison)](&benchmarkFn{})
+	register.Emitter1[ProviderComparison]()
+	beam.RegisterType(reflect.TypeOf((*ProviderComparison)(nil)).Elem())
+	beam.RegisterFunction(comparisonToJSON)
+}
+
+// benchmarkPath is where the provider comparisons are written in benchmark mode.
+const benchmarkPath = "benchmark.jsonl"
+
+// BenchmarkProvider is a provider compared in benchmark mode, with the prices of a million of
+// its input and output tokens, from which the cost of its calls is computed.
+type BenchmarkProvider struct {
+	LLM             llm.LLMConfig `yaml:"llm"`
+	InputTokenCost  float64       `yaml:"input_token_cost"`
+	OutputTokenCost float64       `yaml:"output_token_cost"`
+}
+
+// ProviderComparison compares the extractions of an assessment by every benchmarked provider.
+type ProviderComparison struct {
+	AssessmentID string              `json:"assessment_id,omitempty"`
+	Providers    []ProviderBenchmark `json:"providers"`
+	// ValidJSONRate is the fraction of the providers whose response was valid JSON.
+	ValidJSONRate float64 `json:"valid_json_rate"`
+	// AgreeOnCorrectAnswers is set when every provider extracted valid insights, all with the
+	// same number of questions answered correctly.
+	AgreeOnCorrectAnswers bool `json:"agree_on_correct_answers"`
+}
+
+// ProviderBenchmark is the extraction of an assessment by one provider, in a ProviderComparison.
+type ProviderBenchmark struct {
+	Provider     string `json:"provider"`
+	Model        string `json:"model,omitempty"`
+	LatencyMs    int64  `json:"latency_ms"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	// Cost is computed from the token counts, with the prices of the BenchmarkProvider.
+	Cost      float64 `json:"cost"`
+	ValidJSON bool    `json:"valid_json"`
+	// CorrectAnswers is the number of questions answered correctly according to the insights.
+	CorrectAnswers int `json:"questions_answered_correctly"`
+	// Error is why the call failed, or its insights were invalid.
+	Error string `json:"error,omitempty"`
+}
+
+/*
+benchmarkFn is a DoFn extracting the insights of each assessment with every one of Providers,
+once, and emitting how they compare. Each provider gets the prompt ExtractInsights sends,
+with the rubric if any, and its response is parsed and validated the same way.
+
+The models are created in Setup, a failing provider failing the benchmark.
+*/
+type benchmarkFn struct {
+	Providers          []BenchmarkProvider
+	Timeout            time.Duration
+	MaxAssessmentChars int
+	Truncation         TruncationStrategy
+	Rubric             string
+	extractors         []*ExtractInsights
+}
+
+func (fn *benchmarkFn) Setup(ctx context.Context) error {
+	fn.extractors = make([]*ExtractInsights, 0, len(fn.Providers))
+	for _, provider := range fn.Providers {
+		ei := &ExtractInsights{MaxRetries: 1, Timeout: fn.Timeout, LLM: provider.LLM}
+		if err := ei.Setup(ctx); err != nil {
+			return fmt.Errorf("error setting up benchmarked provider %q: %w", provider.LLM.Provider, err)
+		}
+		ei.rubric, ei.rubricRead = fn.Rubric, true
+		fn.extractors = append(fn.extractors, ei)
+	}
+	return nil
+}
+
+func (fn *benchmarkFn) Teardown() error {
+	var errs []error
+	for _, ei := range fn.extractors {
+		errs = append(errs, ei.Teardown())
+	}
+	return errors.Join(errs...)
+}
+
+func (fn *benchmarkFn) ProcessElement(ctx context.Context, assessment Assessment, emit func(ProviderComparison)) {
+	assessment.Result = truncateAssessment(assessment.Result, fn.MaxAssessmentChars, fn.Truncation)
+
+	comparison := ProviderComparison{AssessmentID: assessment.ID, AgreeOnCorrectAnswers: true}
+	validJSON := 0
+	for i, ei := range fn.extractors {
+		result := fn.run(ctx, ei, fn.Providers[i], assessment)
+		comparison.Providers = append(comparison.Providers, result)
+
+		if result.ValidJSON {
+			validJSON++
+		}
+		if result.Error != "" || result.CorrectAnswers != comparison.Providers[0].CorrectAnswers {
+			comparison.AgreeOnCorrectAnswers = false
+		}
+	}
+	if len(fn.extractors) > 0 {
+		comparison.ValidJSONRate = float64(validJSON) / float64(len(fn.extractors))
+	}
+	emit(comparison)
+}
+
+// run extracts the insights of the assessment in a single call to the model of ei, recording
+// its latency, usage, cost and outcome.
+func (fn *benchmarkFn) run(ctx context.Context, ei *ExtractInsights, provider BenchmarkProvider, assessment Assessment) ProviderBenchmark {
+	result := ProviderBenchmark{Provider: ei.provider(), Model: provider.LLM.Model}
+
+	prompt, err := ei.prompt(assessment, "", "")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	timeout := ei.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	text, meta, err := llm.GenerateTextWithMetadata(ctx, ei.model, prompt, &llm.GenerateOptions{ResponseMIMEType: "application/json"})
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.InputTokens, result.OutputTokens = meta.InputTokens, meta.OutputTokens
+	result.Cost = (float64(meta.InputTokens)*provider.InputTokenCost + float64(meta.OutputTokens)*provider.OutputTokenCost) / 1e6
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ValidJSON = json.Valid([]byte(text))
+	insights, err := ei.parseInsights(text, meta)
+	result.CorrectAnswers = insights.CorrectAnswers
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// comparisonToJSON converts a ProviderComparison to a JSON string
+func comparisonToJSON(comparison ProviderComparison) string {
+	jsonBytes, err := json.Marshal(comparison)
+	if err != nil {
+		log.Printf("Error marshaling provider comparison to JSON: %v", err)
+		return ""
+	}
+	return string(jsonBytes)
+}
+
+// benchmarkProviders runs every benchmarked provider of cfg on each assessment, with the
+// timeout and truncation of the extraction, and returns how they compare.
+func benchmarkProviders(scope beam.Scope, cfg Config, rubric string, assessments beam.PCollection) beam.PCollection {
+	return beam.ParDo(scope.Scope("BenchmarkProviders"), &benchmarkFn{
+		Providers:          cfg.Benchmark,
+		Timeout:            cfg.Timeout,
+		MaxAssessmentChars: cfg.MaxAssessmentChars,
+		Truncation:         cfg.Truncation,
+		Rubric:             rubric,
+	}, assessments)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBenchmarkFn(t *testing.T) {
+	gemini := new(MockMetadataLanguageModel)
+	gemini.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good", "questions_answered_correctly": 7}`, llm.ResponseMeta{InputTokens: 1000, OutputTokens: 200}, nil)
+	anthropic := new(MockLanguageModel)
+	anthropic.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Solid", "questions_answered_correctly": 7}`, nil)
+	mistral := new(MockLanguageModel)
+	mistral.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`Here are the insights: {"overall_assessment": "Good"}`, nil)
+
+	providers := []BenchmarkProvider{
+		{LLM: llm.LLMConfig{Provider: llm.ProviderGemini, Model: "gemini-1.5-pro-002"}, InputTokenCost: 1.25, OutputTokenCost: 5},
+		{LLM: llm.LLMConfig{Provider: llm.ProviderAnthropic}},
+		{LLM: llm.LLMConfig{Provider: llm.ProviderMistral}},
+	}
+	fn := &benchmarkFn{Providers: providers}
+	for i, model := range []llm.LanguageModel{gemini, anthropic, mistral} {
+		fn.extractors = append(fn.extractors, &ExtractInsights{model: model, MaxRetries: 1, LLM: providers[i].LLM})
+	}
+
+	var comparisons []ProviderComparison
+	for _, assessment := range []Assessment{{ID: "a", Result: "7 of 10 correct"}, {ID: "b", Result: "8 of 10 correct"}} {
+		fn.ProcessElement(context.Background(), assessment, func(comparison ProviderComparison) {
+			comparisons = append(comparisons, comparison)
+		})
+	}
+
+	// One comparison per assessment, with every provider called once for each
+	if !assert.Len(t, comparisons, 2) {
+		return
+	}
+	assert.Equal(t, "a", comparisons[0].AssessmentID)
+	assert.Equal(t, "b", comparisons[1].AssessmentID)
+	gemini.AssertNumberOfCalls(t, "GenerateTextWithMetadata", 2)
+	anthropic.AssertNumberOfCalls(t, "GenerateText", 2)
+	mistral.AssertNumberOfCalls(t, "GenerateText", 2)
+
+	comparison := comparisons[0]
+	if !assert.Len(t, comparison.Providers, 3) {
+		return
+	}
+	assert.InDelta(t, 2.0/3, comparison.ValidJSONRate, 1e-9)
+	assert.False(t, comparison.AgreeOnCorrectAnswers)
+
+	geminiResult := comparison.Providers[0]
+	assert.Equal(t, llm.ProviderGemini, geminiResult.Provider)
+	assert.Equal(t, "gemini-1.5-pro-002", geminiResult.Model)
+	assert.Equal(t, 1000, geminiResult.InputTokens)
+	assert.Equal(t, 200, geminiResult.OutputTokens)
+	assert.InDelta(t, 0.00225, geminiResult.Cost, 1e-12)
+	assert.True(t, geminiResult.ValidJSON)
+	assert.Equal(t, 7, geminiResult.CorrectAnswers)
+	assert.Empty(t, geminiResult.Error)
+	assert.GreaterOrEqual(t, geminiResult.LatencyMs, int64(0))
+
+	assert.Equal(t, llm.ProviderAnthropic, comparison.Providers[1].Provider)
+	assert.True(t, comparison.Providers[1].ValidJSON)
+	assert.Equal(t, 7, comparison.Providers[1].CorrectAnswers)
+
+	assert.Equal(t, llm.ProviderMistral, comparison.Providers[2].Provider)
+	assert.False(t, comparison.Providers[2].ValidJSON)
+	assert.Contains(t, comparison.Providers[2].Error, "error unmarshaling insights")
+
+	// The providers agree once they all extract the same number of correct answers
+	fn.extractors, fn.Providers = fn.extractors[:2], providers[:2]
+	comparisons = nil
+	fn.ProcessElement(context.Background(), Assessment{ID: "c", Result: "7 of 10 correct"}, func(comparison ProviderComparison) {
+		comparisons = append(comparisons, comparison)
+	})
+	if assert.Len(t, comparisons, 1) {
+		assert.True(t, comparisons[0].AgreeOnCorrectAnswers)
+		assert.Equal(t, 1.0, comparisons[0].ValidJSONRate)
+	}
+
+	// The benchmark is wired into the pipeline
+	_, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, Assessment{ID: "a"})
+	assert.NotPanics(t, func() { benchmarkProviders(scope, Config{Benchmark: providers}, "", assessments) })
+}
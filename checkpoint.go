@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"google.golang.org/api/iterator"
+)
+
+func init() {
+	register.DoFn3x0[context.Context, Assessment, func(Assessment)](&skipCheckpointedFn{})
+	register.DoFn2x1[context.Context, InsightsResult, error](&recordCheckpointFn{})
+}
+
+const (
+	// firestoreCheckpointScheme prefixes the checkpoint locations that are Firestore collections.
+	firestoreCheckpointScheme = "firestore://"
+	// defaultCheckpointFlushEvery is the number of processed IDs buffered before they are persisted.
+	defaultCheckpointFlushEvery = 100
+)
+
+/*
+CheckpointStore persists the keys (see checkpointKey) of the assessments processed by a run, so a run resumed
+after a failure skips them. Stores are created by newCheckpointStore from the checkpoint
+location: a Firestore collection ("firestore://<collection>") or a directory of any Beam
+filesystem, e.g. "gs://bucket/checkpoints/run".
+*/
+type CheckpointStore interface {
+	// Load returns the keys recorded so far, by every worker.
+	Load(ctx context.Context) ([]string, error)
+	// Add records the keys of newly processed assessments.
+	Add(ctx context.Context, ids []string) error
+	Close() error
+}
+
+// checkpointKey is the key an assessment is recorded with in the checkpoint, its ID prefixed by
+// its database, as the documents of two databases may have the same ID.
+func checkpointKey(database, id string) string {
+	if database == "" {
+		database = firestore.DefaultDatabaseID
+	}
+	return database + "/" + id
+}
+
+// newFirestoreDatabaseClient creates the Firestore client of a named database, replaced in tests.
+var newFirestoreDatabaseClient = firestore.NewClientWithDatabase
+
+// newCheckpointStore creates the CheckpointStore of the location, the Firestore collections
+// being in the given database of the project, the default one when empty.
+func newCheckpointStore(ctx context.Context, project, database, location string) (CheckpointStore, error) {
+	if collection, ok := strings.CutPrefix(location, firestoreCheckpointScheme); ok {
+		if database == "" {
+			database = firestore.DefaultDatabaseID
+		}
+		client, err := newFirestoreDatabaseClient(ctx, project, database)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing Firestore client: %w", err)
+		}
+		return &firestoreCheckpointStore{client: client, collection: client.Collection(collection)}, nil
+	}
+
+	fs, err := filesystem.New(ctx, location)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing filesystem: %w", err)
+	}
+	return newFileCheckpointStore(fs, location), nil
+}
+
+// fileCheckpointStore is a CheckpointStore writing the keys of every Add to a new file of its
+// directory, "<dir>/<shard>-NNNNN.ids" with one key per line, as objects can't be appended to.
+type fileCheckpointStore struct {
+	fs    filesystem.Interface
+	dir   string
+	shard string
+	parts int
+}
+
+// newFileCheckpointStore creates a fileCheckpointStore in dir, with a shard of its own so
+// that workers never write the same files.
+func newFileCheckpointStore(fs filesystem.Interface, dir string) *fileCheckpointStore {
+	return &fileCheckpointStore{
+		fs:    fs,
+		dir:   strings.TrimSuffix(dir, "/"),
+		shard: strconv.FormatInt(rand.Int63(), 36),
+	}
+}
+
+func (s *fileCheckpointStore) Load(ctx context.Context) ([]string, error) {
+	files, err := s.fs.List(ctx, s.dir+"/*.ids")
+	if err != nil {
+		return nil, fmt.Errorf("error listing checkpoint files: %w", err)
+	}
+
+	var ids []string
+	for _, file := range files {
+		data, err := filesystem.Read(ctx, s.fs, file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading checkpoint file %s: %w", file, err)
+		}
+		ids = append(ids, strings.Fields(string(data))...)
+	}
+	return ids, nil
+}
+
+func (s *fileCheckpointStore) Add(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	file := fmt.Sprintf("%s/%s-%05d.ids", s.dir, s.shard, s.parts)
+	if err := filesystem.Write(ctx, s.fs, file, []byte(strings.Join(ids, "\n")+"\n")); err != nil {
+		return fmt.Errorf("error writing checkpoint file %s: %w", file, err)
+	}
+	s.parts++
+	return nil
+}
+
+func (s *fileCheckpointStore) Close() error {
+	return s.fs.Close()
+}
+
+// firestoreCheckpointStore is a CheckpointStore keeping one document per processed assessment,
+// named after its key, escaped as document IDs can't contain slashes.
+type firestoreCheckpointStore struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+}
+
+func (s *firestoreCheckpointStore) Load(ctx context.Context) ([]string, error) {
+	var ids []string
+	refs := s.collection.DocumentRefs(ctx)
+	for {
+		ref, err := refs.Next()
+		if errors.Is(err, iterator.Done) {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing checkpoint documents: %w", err)
+		}
+		id, err := url.PathUnescape(ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding checkpoint document %s: %w", ref.ID, err)
+		}
+		ids = append(ids, id)
+	}
+}
+
+func (s *firestoreCheckpointStore) Add(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	writer := s.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(ids))
+	processedAt := time.Now().UTC()
+	for _, id := range ids {
+		job, err := writer.Set(s.collection.Doc(url.PathEscape(id)), map[string]any{"processed_at": processedAt})
+		if err != nil {
+			writer.End()
+			return fmt.Errorf("error recording checkpoint %s: %w", id, err)
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return fmt.Errorf("error recording checkpoint %s: %w", ids[i], err)
+		}
+	}
+	return nil
+}
+
+func (s *firestoreCheckpointStore) Close() error {
+	return s.client.Close()
+}
+
+// skipCheckpointedFn is a DoFn dropping the assessments recorded in the checkpoint at Location,
+// loaded once per worker in Setup.
+type skipCheckpointedFn struct {
+	Project   string
+	Database  string
+	Location  string
+	processed map[string]bool
+}
+
+func (fn *skipCheckpointedFn) Setup(ctx context.Context) error {
+	store, err := newCheckpointStore(ctx, fn.Project, fn.Database, fn.Location)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ids, err := store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading checkpoint: %w", err)
+	}
+	fn.processed = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		fn.processed[id] = true
+	}
+	return nil
+}
+
+func (fn *skipCheckpointedFn) ProcessElement(_ context.Context, assessment Assessment, emit func(Assessment)) {
+	if assessment.ID != "" && fn.processed[checkpointKey(assessment.Database, assessment.ID)] {
+		return
+	}
+	emit(assessment)
+}
+
+// recordCheckpointFn is a DoFn recording the assessments of the insights in the checkpoint at
+// Location, every FlushEvery IDs and at the end of every bundle. The assessments of degraded
+// insights are not recorded.
+type recordCheckpointFn struct {
+	Project    string
+	Database   string
+	Location   string
+	FlushEvery int
+	store      CheckpointStore
+	ids        []string
+}
+
+func (fn *recordCheckpointFn) Setup(ctx context.Context) error {
+	store, err := newCheckpointStore(ctx, fn.Project, fn.Database, fn.Location)
+	if err != nil {
+		return err
+	}
+	fn.store = store
+	return nil
+}
+
+func (fn *recordCheckpointFn) ProcessElement(ctx context.Context, insights InsightsResult) error {
+	// Degraded insights are a fallback for a failed extraction, which a resumed run retries
+	if insights.AssessmentID == "" || insights.Degraded {
+		return nil
+	}
+	fn.ids = append(fn.ids, checkpointKey(insights.Database, insights.AssessmentID))
+	if len(fn.ids) >= fn.FlushEvery {
+		return fn.flush(ctx)
+	}
+	return nil
+}
+
+func (fn *recordCheckpointFn) FinishBundle(ctx context.Context) error {
+	return fn.flush(ctx)
+}
+
+func (fn *recordCheckpointFn) Teardown() error {
+	if fn.store == nil {
+		return nil
+	}
+	if err := fn.store.Close(); err != nil {
+		return fmt.Errorf("error closing checkpoint store: %w", err)
+	}
+	return nil
+}
+
+// flush persists the buffered keys, once each, as an assessment may be seen twice in a bundle
+// and a Firestore bulk writer rejects a second write of a document.
+func (fn *recordCheckpointFn) flush(ctx context.Context) error {
+	slices.Sort(fn.ids)
+	if err := fn.store.Add(ctx, slices.Compact(fn.ids)); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	fn.ids = nil
+	return nil
+}
+
+// skipCheckpointed drops the assessments already processed according to the checkpoint, so a
+// resumed run only processes the remaining ones.
+func skipCheckpointed(scope beam.Scope, project string, checkpoint CheckpointConfig, assessments beam.PCollection) beam.PCollection {
+	return beam.ParDo(scope.Scope("SkipCheckpointed"), &skipCheckpointedFn{Project: project, Database: checkpoint.Database, Location: checkpoint.Location}, assessments)
+}
+
+// recordCheckpoint records the assessments of the insights in the checkpoint as they are processed.
+// The output must be written as the insights are extracted too (see OutputConfig.durable), or
+// the insights of a failed run would be lost while a resumed run skips their assessments.
+func recordCheckpoint(scope beam.Scope, project string, checkpoint CheckpointConfig, insights beam.PCollection) {
+	flushEvery := checkpoint.FlushEvery
+	if flushEvery <= 0 {
+		flushEvery = defaultCheckpointFlushEvery
+	}
+	beam.ParDo0(scope.Scope("RecordCheckpoint"), &recordCheckpointFn{Project: project, Database: checkpoint.Database, Location: checkpoint.Location, FlushEvery: flushEvery}, insights)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	_ "github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestCheckpoint_Resume(t *testing.T) {
+	ctx := context.Background()
+	location := "memfs://checkpoint/resume"
+
+	// The first run records the assessments it processed, every two and at the end of the bundle
+	record := &recordCheckpointFn{Location: location, FlushEvery: 2}
+	assert.NoError(t, record.Setup(ctx))
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, record.ProcessElement(ctx, InsightsResult{AssessmentID: id}))
+	}
+	assert.NoError(t, record.ProcessElement(ctx, InsightsResult{}))
+	assert.NoError(t, record.ProcessElement(ctx, InsightsResult{AssessmentID: "e", Degraded: true}))
+	assert.NoError(t, record.FinishBundle(ctx))
+	assert.NoError(t, record.Teardown())
+
+	// The resumed run skips them, but retries the degraded one
+	skip := &skipCheckpointedFn{Location: location}
+	assert.NoError(t, skip.Setup(ctx))
+	var resumed []Assessment
+	for _, assessment := range []Assessment{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}, {Result: "No ID"}} {
+		skip.ProcessElement(ctx, assessment, func(a Assessment) { resumed = append(resumed, a) })
+	}
+	assert.Equal(t, []Assessment{{ID: "d"}, {ID: "e"}, {Result: "No ID"}}, resumed)
+}
+
+func TestCheckpoint_SameIDInTwoDatabases(t *testing.T) {
+	ctx := context.Background()
+	location := "memfs://checkpoint/databases"
+
+	record := &recordCheckpointFn{Location: location, FlushEvery: 10}
+	assert.NoError(t, record.Setup(ctx))
+	assert.NoError(t, record.ProcessElement(ctx, InsightsResult{AssessmentID: "a", Database: "assessments-eu"}))
+	assert.NoError(t, record.FinishBundle(ctx))
+	assert.NoError(t, record.Teardown())
+
+	// Only the assessment of the database it was recorded for is skipped
+	skip := &skipCheckpointedFn{Location: location}
+	assert.NoError(t, skip.Setup(ctx))
+	var resumed []Assessment
+	for _, assessment := range []Assessment{{ID: "a", Database: "assessments-eu"}, {ID: "a", Database: "assessments-us"}, {ID: "a"}} {
+		skip.ProcessElement(ctx, assessment, func(a Assessment) { resumed = append(resumed, a) })
+	}
+	assert.Equal(t, []Assessment{{ID: "a", Database: "assessments-us"}, {ID: "a"}}, resumed)
+}
+
+func TestCheckpoint_DuplicateInBundle(t *testing.T) {
+	ctx := context.Background()
+	store := &recordingCheckpointStore{}
+	record := &recordCheckpointFn{FlushEvery: 10, store: store}
+	for _, id := range []string{"b", "a", "b"} {
+		assert.NoError(t, record.ProcessElement(ctx, InsightsResult{AssessmentID: id}))
+	}
+	assert.NoError(t, record.FinishBundle(ctx))
+	assert.Equal(t, [][]string{{checkpointKey("", "a"), checkpointKey("", "b")}}, store.adds)
+}
+
+// recordingCheckpointStore is a CheckpointStore recording the keys of every Add.
+type recordingCheckpointStore struct {
+	adds [][]string
+}
+
+func (s *recordingCheckpointStore) Load(context.Context) ([]string, error) { return nil, nil }
+
+func (s *recordingCheckpointStore) Add(_ context.Context, ids []string) error {
+	s.adds = append(s.adds, slices.Clone(ids))
+	return nil
+}
+
+func (s *recordingCheckpointStore) Close() error { return nil }
+
+func TestCheckpoint_Empty(t *testing.T) {
+	ctx := context.Background()
+
+	// Every assessment is processed without a previous run
+	skip := &skipCheckpointedFn{Location: "memfs://checkpoint/empty"}
+	assert.NoError(t, skip.Setup(ctx))
+	var processed []Assessment
+	skip.ProcessElement(ctx, Assessment{ID: "a"}, func(a Assessment) { processed = append(processed, a) })
+	assert.Equal(t, []Assessment{{ID: "a"}}, processed)
+}
+
+func TestCheckpoint_ResumeAfterPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	location := "memfs://checkpoint/partial"
+	path := filepath.Join(t.TempDir(), "processed.jsonl")
+
+	// The first run appends and records a and b, then fails before c is written
+	write := &appendJSONLFn{Path: path}
+	record := &recordCheckpointFn{Location: location, FlushEvery: 1}
+	assert.NoError(t, write.Setup())
+	assert.NoError(t, record.Setup(ctx))
+	for _, id := range []string{"a", "b"} {
+		assert.NoError(t, write.ProcessElement(ctx, fmt.Sprintf(`{"assessment_id":%q}`, id)))
+		assert.NoError(t, record.ProcessElement(ctx, InsightsResult{AssessmentID: id}))
+	}
+	assert.NoError(t, write.Teardown())
+	assert.NoError(t, record.Teardown())
+
+	// The resumed run only processes c, and the output holds every assessment once
+	skip := &skipCheckpointedFn{Location: location}
+	assert.NoError(t, skip.Setup(ctx))
+	write = &appendJSONLFn{Path: path}
+	assert.NoError(t, write.Setup())
+	for _, assessment := range []Assessment{{ID: "a"}, {ID: "b"}, {ID: "c"}} {
+		skip.ProcessElement(ctx, assessment, func(a Assessment) {
+			assert.NoError(t, write.ProcessElement(ctx, fmt.Sprintf(`{"assessment_id":%q}`, a.ID)))
+		})
+	}
+	assert.NoError(t, write.Teardown())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"assessment_id\":\"a\"}\n{\"assessment_id\":\"b\"}\n{\"assessment_id\":\"c\"}\n", string(data))
+
+	// An output written at the end of the run would have lost a and b, it is rejected
+	assert.False(t, OutputConfig{Path: path}.durable())
+	assert.True(t, OutputConfig{Path: path, Append: true}.durable())
+}
+
+func TestNewCheckpointStore_Database(t *testing.T) {
+	// Real clients talk to the emulator address, which is never dialed by newCheckpointStore
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:8080")
+
+	defaultNewFirestoreDatabaseClient := newFirestoreDatabaseClient
+	t.Cleanup(func() { newFirestoreDatabaseClient = defaultNewFirestoreDatabaseClient })
+
+	var gotDatabase string
+	newFirestoreDatabaseClient = func(ctx context.Context, project, database string, opts ...option.ClientOption) (*firestore.Client, error) {
+		gotDatabase = database
+		return defaultNewFirestoreDatabaseClient(ctx, project, database, opts...)
+	}
+
+	tests := []struct {
+		name     string
+		database string
+		want     string
+	}{
+		{name: "Named database", database: "assessments-eu", want: "assessments-eu"},
+		{name: "Default database", want: firestore.DefaultDatabaseID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := newCheckpointStore(context.Background(), "test-project", tt.database, "firestore://checkpoints")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, gotDatabase)
+			assert.NoError(t, store.Close())
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// chunkText splits text into chunks of at most size characters, each one starting
+// with the last overlap characters of the previous chunk.
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(text)
+	if size <= 0 || len(runes) <= size {
+		return []string{text}
+	}
+	overlap = chunkOverlap(size, overlap)
+
+	var chunks []string
+	for start := 0; ; start += size - overlap {
+		end := start + size
+		if end >= len(runes) {
+			chunks = append(chunks, string(runes[start:]))
+			return chunks
+		}
+		chunks = append(chunks, string(runes[start:end]))
+	}
+}
+
+// chunkOverlap returns the overlap actually repeated between chunks of size characters,
+// 0 when it is negative or not smaller than the chunk.
+func chunkOverlap(size, overlap int) int {
+	if overlap < 0 || overlap >= size {
+		return 0
+	}
+	return overlap
+}
+
+// markOverlap separates the first overlap characters of a chunk, repeated from the previous
+// chunk, from the rest, so the answers in them are read for context but not counted twice.
+func markOverlap(chunk string, overlap int) string {
+	runes := []rune(chunk)
+	if overlap <= 0 || len(runes) <= overlap {
+		return chunk
+	}
+	return fmt.Sprintf("Context repeated from the previous part, already graded (do not count its answers):\n%s\nPart to grade:\n%s",
+		string(runes[:overlap]), string(runes[overlap:]))
+}
+
+// severityRank orders skill gap severities, so merged gaps keep the highest one.
+var severityRank = map[SkillGapSeverity]int{
+	SeverityLow:    1,
+	SeverityMedium: 2,
+	SeverityHigh:   3,
+}
+
+// mergeInsights reduces the partial insights of an assessment's chunks into one InsightsResult.
+// Assessments are concatenated, correct answers summed, lists deduplicated in order, ranked
+// weaknesses merged by topic keeping the highest severity, feedback maps merged, skill gaps
+// deduplicated by skill keeping the highest severity and study plans merged, keeping the
+// first plan of each weakness.
+func mergeInsights(partials []InsightsResult) InsightsResult {
+	var (
+		merged      InsightsResult
+		assessments []string
+		gaps        = make(map[string]int)
+	)
+
+	for _, partial := range partials {
+		if partial.OverallAssessment != "" {
+			assessments = append(assessments, partial.OverallAssessment)
+		}
+		merged.CorrectAnswers += partial.CorrectAnswers
+		merged.Strengths = appendUnique(merged.Strengths, partial.Strengths...)
+		merged.Weaknesses = appendUnique(merged.Weaknesses, partial.Weaknesses...)
+		merged.RankedWeaknesses = mergeRankedWeaknesses(merged.RankedWeaknesses, partial.RankedWeaknesses)
+		merged.ActionableFeedback = mergeFeedback(merged.ActionableFeedback, partial.ActionableFeedback)
+		merged.BusinessImpact = mergeFeedback(merged.BusinessImpact, partial.BusinessImpact)
+
+		for _, gap := range partial.SkillGaps {
+			i, ok := gaps[gap.Skill]
+			if !ok {
+				gaps[gap.Skill] = len(merged.SkillGaps)
+				merged.SkillGaps = append(merged.SkillGaps, gap)
+				continue
+			}
+			if severityRank[gap.Severity] > severityRank[merged.SkillGaps[i].Severity] {
+				merged.SkillGaps[i] = gap
+			}
+		}
+
+		for weakness, plan := range partial.StudyPlans {
+			if _, ok := merged.StudyPlans[weakness]; ok {
+				continue
+			}
+			if merged.StudyPlans == nil {
+				merged.StudyPlans = make(map[string]StudyPlan, len(partial.StudyPlans))
+			}
+			merged.StudyPlans[weakness] = plan
+		}
+
+		merged.Degraded = merged.Degraded || partial.Degraded
+		merged.AssessmentID = partial.AssessmentID
+		merged.Database = partial.Database
+		if partial.CompletedAt.After(merged.CompletedAt) {
+			merged.CompletedAt = partial.CompletedAt
+		}
+		if partial.GeneratedAt.After(merged.GeneratedAt) {
+			merged.GeneratedAt = partial.GeneratedAt
+		}
+	}
+
+	merged.OverallAssessment = strings.Join(assessments, " ")
+	return merged
+}
+
+// mergeRankedWeaknesses merges ranked weaknesses by topic, keeping the highest severity of
+// each topic, ranked again by descending severity.
+func mergeRankedWeaknesses(merged, weaknesses []RankedWeakness) []RankedWeakness {
+	for _, weakness := range weaknesses {
+		i := slices.IndexFunc(merged, func(w RankedWeakness) bool { return w.Topic == weakness.Topic })
+		if i < 0 {
+			merged = append(merged, weakness)
+		} else if weakness.Severity > merged[i].Severity {
+			merged[i] = weakness
+		}
+	}
+	slices.SortStableFunc(merged, func(a, b RankedWeakness) int {
+		return cmp.Compare(b.Severity, a.Severity)
+	})
+	return merged
+}
+
+// appendUnique appends the values not already in list, keeping their order.
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// mergeFeedback merges the feedback of src into dst, joining the values of shared keys.
+func mergeFeedback(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for key, value := range src {
+		if existing, ok := dst[key]; ok && existing != value {
+			value = existing + " " + value
+		}
+		dst[key] = value
+	}
+	return dst
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChunkText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		size     int
+		overlap  int
+		expected []string
+	}{
+		{
+			name:     "Shorter than a chunk",
+			text:     "abc",
+			size:     5,
+			expected: []string{"abc"},
+		},
+		{
+			name:     "Without overlap",
+			text:     "abcdefghij",
+			size:     4,
+			expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:     "With overlap",
+			text:     "abcdefghij",
+			size:     4,
+			overlap:  2,
+			expected: []string{"abcd", "cdef", "efgh", "ghij"},
+		},
+		{
+			name:     "Overlap as large as the chunk is ignored",
+			text:     "abcdef",
+			size:     3,
+			overlap:  3,
+			expected: []string{"abc", "def"},
+		},
+		{
+			name:     "Multi-byte characters",
+			text:     "ñandú",
+			size:     2,
+			expected: []string{"ña", "nd", "ú"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, chunkText(tc.text, tc.size, tc.overlap))
+		})
+	}
+}
+
+func TestMergeInsights(t *testing.T) {
+	partials := []InsightsResult{
+		{
+			OverallAssessment:  "Strong on storage.",
+			CorrectAnswers:     4,
+			Strengths:          []string{"BigQuery", "Cloud Storage"},
+			Weaknesses:         []string{"IAM"},
+			RankedWeaknesses:   []RankedWeakness{{Topic: "IAM", Severity: 0.3}},
+			ActionableFeedback: map[string]string{"security": "Review IAM roles."},
+			SkillGaps:          []SkillGap{{Skill: "IAM", Severity: SeverityLow, RecommendedResource: "IAM overview"}},
+			StudyPlans:         map[string]StudyPlan{"IAM": {Topic: "IAM roles", EstimatedHours: 2}},
+		},
+		{
+			OverallAssessment:  "Weak on streaming.",
+			CorrectAnswers:     2,
+			Strengths:          []string{"BigQuery"},
+			Weaknesses:         []string{"Pub/Sub"},
+			RankedWeaknesses:   []RankedWeakness{{Topic: "IAM", Severity: 0.8}, {Topic: "Pub/Sub", Severity: 0.5}},
+			ActionableFeedback: map[string]string{"security": "Practice VPC Service Controls.", "streaming": "Build a Dataflow job."},
+			BusinessImpact:     map[string]string{"latency": "Slower dashboards."},
+			SkillGaps:          []SkillGap{{Skill: "IAM", Severity: SeverityHigh, RecommendedResource: "IAM deep dive"}},
+			StudyPlans: map[string]StudyPlan{
+				"IAM":     {Topic: "IAM conditions", EstimatedHours: 3},
+				"Pub/Sub": {Topic: "Pub/Sub delivery", EstimatedHours: 1},
+			},
+		},
+	}
+
+	expected := InsightsResult{
+		OverallAssessment: "Strong on storage. Weak on streaming.",
+		CorrectAnswers:    6,
+		Strengths:         []string{"BigQuery", "Cloud Storage"},
+		Weaknesses:        []string{"IAM", "Pub/Sub"},
+		RankedWeaknesses:  []RankedWeakness{{Topic: "IAM", Severity: 0.8}, {Topic: "Pub/Sub", Severity: 0.5}},
+		ActionableFeedback: map[string]string{
+			"security":  "Review IAM roles. Practice VPC Service Controls.",
+			"streaming": "Build a Dataflow job.",
+		},
+		BusinessImpact: map[string]string{"latency": "Slower dashboards."},
+		SkillGaps:      []SkillGap{{Skill: "IAM", Severity: SeverityHigh, RecommendedResource: "IAM deep dive"}},
+		StudyPlans: map[string]StudyPlan{
+			"IAM":     {Topic: "IAM roles", EstimatedHours: 2},
+			"Pub/Sub": {Topic: "Pub/Sub delivery", EstimatedHours: 1},
+		},
+	}
+
+	assert.Equal(t, expected, mergeInsights(partials))
+}
+
+func TestExtractInsights_ChunkedExtract(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:      mockLLM,
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+		ChunkSize:  10,
+	}
+
+	promptContains := func(chunk string) interface{} {
+		return mock.MatchedBy(func(prompt string) bool { return strings.Contains(prompt, "\n"+chunk+"\n") })
+	}
+	mockLLM.On("GenerateText", mock.Anything, promptContains("Question 1"), mock.Anything).
+		Return(`{"overall_assessment": "Good start.", "questions_answered_correctly": 1, "strengths": ["SQL"]}`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, promptContains(": correct"), mock.Anything).
+		Return(`{"overall_assessment": "Good finish.", "questions_answered_correctly": 1, "strengths": ["SQL", "ETL"]}`, nil).Once()
+
+	var results []InsightsResult
+	ei.ProcessElement(context.Background(), Assessment{Result: "Question 1: correct"}, noRubric, func(insights InsightsResult) {
+		results = append(results, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	assert.Equal(t, []InsightsResult{{
+		OverallAssessment: "Good start. Good finish.",
+		CorrectAnswers:    2,
+		Strengths:         []string{"SQL", "ETL"},
+	}}, results)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_ChunkedExtractOverlap(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:        mockLLM,
+		MaxRetries:   1,
+		RetryDelay:   time.Millisecond,
+		ChunkSize:    10,
+		ChunkOverlap: 3,
+	}
+
+	// The overlap of the second chunk is marked as context, so its answer isn't counted again
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, "\nQ1: ok. Q2\n")
+	}), mock.Anything).
+		Return(`{"overall_assessment": "Good start.", "questions_answered_correctly": 1}`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, "(do not count its answers):\n Q2\nPart to grade:\n: ok.\n")
+	}), mock.Anything).
+		Return(`{"overall_assessment": "Good finish.", "questions_answered_correctly": 1}`, nil).Once()
+
+	var results []InsightsResult
+	ei.ProcessElement(context.Background(), Assessment{Result: "Q1: ok. Q2: ok."}, noRubric, func(insights InsightsResult) {
+		results = append(results, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	assert.Equal(t, []InsightsResult{{
+		OverallAssessment: "Good start. Good finish.",
+		CorrectAnswers:    2,
+	}}, results)
+	mockLLM.AssertExpectations(t)
+}
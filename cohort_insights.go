@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window/trigger"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.Combiner3[insightsAccumulator, InsightsResult, CohortInsights](&CombineInsights{})
+	beam.RegisterType(reflect.TypeOf((*CohortInsights)(nil)).Elem())
+	beam.RegisterFunction(cohortToJSON)
+}
+
+// CohortInsights aggregates the insights of a cohort of assessments.
+type CohortInsights struct {
+	Assessments           int            `json:"assessments"`
+	AverageCorrectAnswers float64        `json:"average_questions_answered_correctly"`
+	Strengths             []WeightedTerm `json:"strengths"`
+	Weaknesses            []WeightedTerm `json:"weaknesses"`
+}
+
+// WeightedTerm is a strength or weakness with its share of the cohort's total weight.
+type WeightedTerm struct {
+	Term   string  `json:"term"`
+	Weight float64 `json:"weight"`
+}
+
+// insightsAccumulator carries the weighted sums of the insights combined so far.
+type insightsAccumulator struct {
+	Count           int
+	TotalWeight     float64
+	WeightedCorrect float64
+	Strengths       map[string]float64
+	Weaknesses      map[string]float64
+}
+
+// CombineInsights is a CombineFn that aggregates cohort strengths and weaknesses.
+// Each insight is weighted with an exponential time decay, so that an assessment
+// completed HalfLife before Reference counts half as much as one completed at Reference.
+// A zero HalfLife disables the decay, and insights without CompletedAt are not decayed.
+type CombineInsights struct {
+	HalfLife  time.Duration
+	Reference time.Time
+	// Trigger fires the cohort aggregate of the global window early and late, see
+	// WithGlobalWindowTrigger. The default trigger, firing once all the input is read, when nil.
+	Trigger *GlobalWindowTrigger
+}
+
+// CohortConfig configures the cohort aggregate, written when HalfLife is set, and the
+// snapshots of the running cohort counts.
+type CohortConfig struct {
+	// HalfLife weights the insights by recency in the aggregate, see CombineInsights.HalfLife.
+	// The aggregate is written when it is set, 0 disabling the decay, and not when nil.
+	HalfLife *time.Duration `yaml:"half_life"`
+	// Trigger fires the aggregate of a streaming job in panes, rather than once all the input
+	// is read, when set.
+	Trigger *GlobalWindowTrigger `yaml:"trigger"`
+	// SnapshotInterval is the shortest time between two snapshots of the running cohort counts,
+	// pushed while the insights are extracted (see pushCohortSnapshots). 0 disables them.
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	// SnapshotPushURL is the Prometheus Pushgateway the snapshots are pushed to, none when empty.
+	SnapshotPushURL string `yaml:"snapshot_push_url"`
+}
+
+// GlobalWindowTrigger configures the panes of the cohort aggregate of a streaming job, computed
+// over the global window: speculative panes while the assessments arrive, the final pane when
+// the watermark passes the end of the window, then late panes for the late assessments.
+type GlobalWindowTrigger struct {
+	// EarlyFiring is the processing time between the speculative panes, e.g. a minute.
+	// 0 disables them.
+	EarlyFiring time.Duration `yaml:"early_firing"`
+	// AllowedLateness is how long after the watermark late assessments are still aggregated,
+	// firing a late pane each. 0 drops them.
+	AllowedLateness time.Duration `yaml:"allowed_lateness"`
+	// Accumulating makes every pane aggregate all the assessments of the window so far, rather
+	// than only those since the previous pane.
+	Accumulating bool `yaml:"accumulating"`
+}
+
+// trigger returns the trigger of the panes: on the watermark, with the early and late firings.
+func (t GlobalWindowTrigger) trigger() trigger.Trigger {
+	tr := trigger.AfterEndOfWindow()
+	if t.EarlyFiring > 0 {
+		tr = tr.EarlyFiring(trigger.Repeat(trigger.AfterProcessingTime().PlusDelay(t.EarlyFiring)))
+	}
+	if t.AllowedLateness > 0 {
+		tr = tr.LateFiring(trigger.Always())
+	}
+	return tr
+}
+
+// windowInto applies the trigger to the global window of the insights.
+func (t GlobalWindowTrigger) windowInto(scope beam.Scope, insights beam.PCollection) beam.PCollection {
+	panes := beam.PanesDiscard()
+	if t.Accumulating {
+		panes = beam.PanesAccumulate()
+	}
+	return beam.WindowInto(scope, window.NewGlobalWindows(), insights,
+		beam.Trigger(t.trigger()), beam.AllowedLateness(t.AllowedLateness), panes)
+}
+
+// NewCombineInsights creates a CombineInsights decaying with the given half-life from now.
+func NewCombineInsights(halfLife time.Duration) *CombineInsights {
+	return &CombineInsights{
+		HalfLife:  halfLife,
+		Reference: time.Now().UTC(),
+	}
+}
+
+/*
+WithGlobalWindowTrigger fires the cohort aggregate of the global window with the trigger, for
+streaming jobs whose aggregate would otherwise only be emitted once the input ends: e.g. a
+speculative pane every minute, the final pane on the watermark and, within the allowed
+lateness, a late pane for each late assessment. Accumulating panes hold the whole cohort so
+far, so the latest pane is always the current aggregate.
+*/
+func (c *CombineInsights) WithGlobalWindowTrigger(t GlobalWindowTrigger) *CombineInsights {
+	c.Trigger = &t
+	return c
+}
+
+func (c *CombineInsights) CreateAccumulator() insightsAccumulator {
+	return insightsAccumulator{
+		Strengths:  make(map[string]float64),
+		Weaknesses: make(map[string]float64),
+	}
+}
+
+func (c *CombineInsights) AddInput(acc insightsAccumulator, insights InsightsResult) insightsAccumulator {
+	weight := c.weight(insights.CompletedAt)
+
+	acc.Count++
+	acc.TotalWeight += weight
+	acc.WeightedCorrect += weight * float64(insights.CorrectAnswers)
+	for _, strength := range insights.Strengths {
+		acc.Strengths[strength] += weight
+	}
+	for _, weakness := range insights.Weaknesses {
+		acc.Weaknesses[weakness] += weight
+	}
+	return acc
+}
+
+func (c *CombineInsights) MergeAccumulators(a, b insightsAccumulator) insightsAccumulator {
+	a.Count += b.Count
+	a.TotalWeight += b.TotalWeight
+	a.WeightedCorrect += b.WeightedCorrect
+	for term, weight := range b.Strengths {
+		a.Strengths[term] += weight
+	}
+	for term, weight := range b.Weaknesses {
+		a.Weaknesses[term] += weight
+	}
+	return a
+}
+
+func (c *CombineInsights) ExtractOutput(acc insightsAccumulator) CohortInsights {
+	cohort := CohortInsights{
+		Assessments: acc.Count,
+		Strengths:   weightedTerms(acc.Strengths, acc.TotalWeight),
+		Weaknesses:  weightedTerms(acc.Weaknesses, acc.TotalWeight),
+	}
+	if acc.TotalWeight > 0 {
+		cohort.AverageCorrectAnswers = acc.WeightedCorrect / acc.TotalWeight
+	}
+	return cohort
+}
+
+// weight returns the decay weight of an assessment completed at completedAt.
+func (c *CombineInsights) weight(completedAt time.Time) float64 {
+	if c.HalfLife <= 0 || completedAt.IsZero() {
+		return 1
+	}
+
+	// Assessments completed after the reference time are not boosted
+	age := c.Reference.Sub(completedAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(c.HalfLife))
+}
+
+// weightedTerms normalizes the term weights by the total weight, sorted by descending weight.
+func weightedTerms(weights map[string]float64, total float64) []WeightedTerm {
+	terms := make([]WeightedTerm, 0, len(weights))
+	for term, weight := range weights {
+		if total > 0 {
+			weight /= total
+		}
+		terms = append(terms, WeightedTerm{Term: term, Weight: weight})
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	return terms
+}
+
+// combineCohortInsights aggregates all the insights into a single CohortInsights with combine,
+// in the panes of its trigger, if any.
+func combineCohortInsights(scope beam.Scope, combine *CombineInsights, insights beam.PCollection) beam.PCollection {
+	scope = scope.Scope("combineCohortInsights")
+	if combine.Trigger != nil {
+		insights = combine.Trigger.windowInto(scope, insights)
+	}
+	return beam.Combine(scope, combine, insights)
+}
+
+// cohortToJSON converts CohortInsights to JSON string
+func cohortToJSON(cohort CohortInsights) string {
+	jsonBytes, err := json.Marshal(cohort)
+	if err != nil {
+		log.Printf("Error marshaling cohort insights to JSON: %v", err)
+		return ""
+	}
+	return string(jsonBytes)
+}
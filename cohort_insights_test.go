@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCombineInsights_RecencyWeighting(t *testing.T) {
+	reference := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	combiner := &CombineInsights{HalfLife: 24 * time.Hour, Reference: reference}
+
+	recent := InsightsResult{
+		CorrectAnswers: 9,
+		Strengths:      []string{"BigQuery"},
+		Weaknesses:     []string{"Dataflow"},
+		CompletedAt:    reference,
+	}
+	old := InsightsResult{
+		CorrectAnswers: 3,
+		Strengths:      []string{"Dataflow"},
+		Weaknesses:     []string{"BigQuery"},
+		CompletedAt:    reference.Add(-72 * time.Hour),
+	}
+
+	// Two old assessments against a single recent one
+	acc := combiner.CreateAccumulator()
+	acc = combiner.AddInput(acc, old)
+	acc = combiner.AddInput(acc, old)
+	acc = combiner.AddInput(acc, recent)
+	cohort := combiner.ExtractOutput(acc)
+
+	assert.Equal(t, 3, cohort.Assessments)
+	// Weights are 1 for the recent assessment and 1/8 for each old one
+	assert.InDelta(t, (9+2*3.0/8)/1.25, cohort.AverageCorrectAnswers, 1e-9)
+	assert.Equal(t, "BigQuery", cohort.Strengths[0].Term)
+	assert.InDelta(t, 1/1.25, cohort.Strengths[0].Weight, 1e-9)
+	assert.Equal(t, "Dataflow", cohort.Weaknesses[0].Term)
+}
+
+func TestCombineInsights_MergeAccumulators(t *testing.T) {
+	reference := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	combiner := &CombineInsights{HalfLife: 24 * time.Hour, Reference: reference}
+
+	inputs := []InsightsResult{
+		{CorrectAnswers: 8, Strengths: []string{"SQL"}, CompletedAt: reference.Add(-time.Hour)},
+		{CorrectAnswers: 4, Weaknesses: []string{"IAM"}, CompletedAt: reference.Add(-48 * time.Hour)},
+		{CorrectAnswers: 6, Strengths: []string{"SQL"}, CompletedAt: reference.Add(-12 * time.Hour)},
+	}
+
+	single := combiner.CreateAccumulator()
+	for _, input := range inputs {
+		single = combiner.AddInput(single, input)
+	}
+
+	left := combiner.AddInput(combiner.CreateAccumulator(), inputs[0])
+	right := combiner.CreateAccumulator()
+	for _, input := range inputs[1:] {
+		right = combiner.AddInput(right, input)
+	}
+	merged := combiner.MergeAccumulators(left, right)
+
+	assert.Equal(t, single.Count, merged.Count)
+	assert.InDelta(t, single.TotalWeight, merged.TotalWeight, 1e-9)
+	assert.InDelta(t, single.WeightedCorrect, merged.WeightedCorrect, 1e-9)
+	assert.InDelta(t, single.Strengths["SQL"], merged.Strengths["SQL"], 1e-9)
+	assert.InDelta(t, single.Weaknesses["IAM"], merged.Weaknesses["IAM"], 1e-9)
+}
+
+func TestCombineInsights_weight(t *testing.T) {
+	reference := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		halfLife    time.Duration
+		completedAt time.Time
+		expected    float64
+	}{
+		{"At reference", time.Hour, reference, 1},
+		{"One half-life old", time.Hour, reference.Add(-time.Hour), 0.5},
+		{"Two half-lives old", time.Hour, reference.Add(-2 * time.Hour), 0.25},
+		{"After reference", time.Hour, reference.Add(time.Hour), 1},
+		{"Decay disabled", 0, reference.Add(-100 * time.Hour), 1},
+		{"Missing completion time", time.Hour, time.Time{}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			combiner := &CombineInsights{HalfLife: tc.halfLife, Reference: reference}
+			weight := combiner.weight(tc.completedAt)
+			if math.Abs(weight-tc.expected) > 1e-9 {
+				t.Errorf("Expected weight %v, got %v", tc.expected, weight)
+			}
+		})
+	}
+}
+
+// cohortWindowingStrategy returns the windowing strategy of the cohort aggregate of combine.
+func cohortWindowingStrategy(t *testing.T, combine *CombineInsights) *window.WindowingStrategy {
+	t.Helper()
+	p, scope := beam.NewPipelineWithRoot()
+	insights := beam.Create(scope, InsightsResult{Strengths: []string{"SQL"}})
+	combineCohortInsights(scope, combine, insights)
+
+	_, nodes, err := p.Build()
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+	// The cohort aggregate is the last collection of the pipeline
+	return nodes[len(nodes)-1].WindowingStrategy()
+}
+
+func TestCombineInsights_WithGlobalWindowTrigger(t *testing.T) {
+	combine := NewCombineInsights(0).WithGlobalWindowTrigger(GlobalWindowTrigger{
+		EarlyFiring:     time.Minute,
+		AllowedLateness: 10 * time.Minute,
+		Accumulating:    true,
+	})
+	ws := cohortWindowingStrategy(t, combine)
+
+	// Speculative panes every minute, the on-time pane on the watermark and a late pane per late assessment
+	want := trigger.AfterEndOfWindow().
+		EarlyFiring(trigger.Repeat(trigger.AfterProcessingTime().PlusDelay(time.Minute))).
+		LateFiring(trigger.Always())
+	assert.Equal(t, want, ws.Trigger)
+	assert.Equal(t, window.Accumulating, ws.AccumulationMode)
+	assert.Equal(t, int((10 * time.Minute).Milliseconds()), ws.AllowedLateness)
+	assert.Equal(t, window.GlobalWindows, ws.Fn.Kind)
+
+	// Without a trigger the aggregate is fired once, as before
+	ws = cohortWindowingStrategy(t, NewCombineInsights(0))
+	assert.Equal(t, trigger.Default(), ws.Trigger)
+
+	/*
+		The local runner of the SDK rejects non-default triggers, so the panes are produced here
+		as a runner does in accumulating mode: the early pane aggregates the assessments arrived
+		so far, the on-time pane all of them, the early ones included.
+	*/
+	acc := combine.AddInput(combine.CreateAccumulator(), InsightsResult{CorrectAnswers: 8, Strengths: []string{"SQL"}})
+	early := combine.ExtractOutput(acc)
+	acc = combine.AddInput(acc, InsightsResult{CorrectAnswers: 4, Weaknesses: []string{"IAM"}})
+	onTime := combine.ExtractOutput(acc)
+
+	assert.Equal(t, 1, early.Assessments)
+	assert.Equal(t, 2, onTime.Assessments)
+	assert.InDelta(t, 6, onTime.AverageCorrectAnswers, 1e-9)
+	assert.Equal(t, []WeightedTerm{{Term: "SQL", Weight: 0.5}}, onTime.Strengths)
+}
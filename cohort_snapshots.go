@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn5x1[state.Provider, timers.Provider, string, InsightsResult, func(CohortSnapshot), error](&cohortSnapshotFn{})
+	register.DoFn2x1[context.Context, CohortSnapshot, error](&pushCohortSnapshotFn{})
+	register.Function1x2(cohortKey)
+	register.Emitter1[CohortSnapshot]()
+	beam.RegisterType(reflect.TypeOf((*CohortSnapshot)(nil)).Elem())
+	beam.RegisterType(reflect.TypeOf((*cohortCounts)(nil)).Elem())
+}
+
+// Beam gauges of the latest cohort snapshot, reported live by the runner (e.g. in the Dataflow UI).
+var (
+	cohortProcessedGauge = beam.NewGauge("cohort", "processed")
+	// cohortAverageScoreGauge is the average score, in thousandths, as gauges are integers.
+	cohortAverageScoreGauge = beam.NewGauge("cohort", "average_score_milli")
+)
+
+// CohortSnapshot holds the running counts of the cohort while the insights are extracted.
+type CohortSnapshot struct {
+	// At is the processing time the snapshot was taken at.
+	At time.Time `json:"at"`
+	// Processed is the number of assessments whose insights were extracted so far.
+	Processed int `json:"processed"`
+	// AverageScore is the average number of questions answered correctly.
+	AverageScore float64 `json:"average_score"`
+	// TopWeakness is the most frequent weakness so far, and TopWeaknessCount its count.
+	TopWeakness      string `json:"top_weakness,omitempty"`
+	TopWeaknessCount int    `json:"top_weakness_count,omitempty"`
+}
+
+// cohortCounts are the running counts of the cohort, kept in the state of cohortSnapshotFn.
+type cohortCounts struct {
+	Processed  int
+	ScoreSum   int
+	Weaknesses map[string]int
+}
+
+// snapshot returns the snapshot of the counts taken at.
+func (c cohortCounts) snapshot(at time.Time) CohortSnapshot {
+	snapshot := CohortSnapshot{At: at, Processed: c.Processed}
+	if c.Processed > 0 {
+		snapshot.AverageScore = float64(c.ScoreSum) / float64(c.Processed)
+	}
+	// Ties go to the first weakness in alphabetical order, so snapshots are reproducible
+	weaknesses := make([]string, 0, len(c.Weaknesses))
+	for weakness := range c.Weaknesses {
+		weaknesses = append(weaknesses, weakness)
+	}
+	sort.Strings(weaknesses)
+	for _, weakness := range weaknesses {
+		if c.Weaknesses[weakness] > snapshot.TopWeaknessCount {
+			snapshot.TopWeakness, snapshot.TopWeaknessCount = weakness, c.Weaknesses[weakness]
+		}
+	}
+	return snapshot
+}
+
+/*
+cohortSnapshotFn is a stateful DoFn counting the insights of the cohort as they are extracted,
+emitting a CohortSnapshot of the running counts at most every Interval, so live dashboards
+follow a long run rather than waiting for its end. A snapshot is due Interval after the first
+insights counted since the previous one; no snapshot is taken while no insights arrive.
+
+	Interval: The shortest time between two snapshots, in processing time.
+
+	Counts: The running counts of the cohort.
+
+	Scheduled: Set while a snapshot is due.
+
+	Snapshot: The processing-time timer emitting the snapshot.
+*/
+type cohortSnapshotFn struct {
+	Interval  time.Duration
+	Counts    state.Value[cohortCounts]
+	Scheduled state.Value[bool]
+	Snapshot  timers.ProcessingTime
+
+	// now returns the processing time snapshots are scheduled and taken at, overridden in tests.
+	now func() time.Time
+}
+
+// newCohortSnapshotFn creates a cohortSnapshotFn emitting a snapshot at most every interval.
+func newCohortSnapshotFn(interval time.Duration) *cohortSnapshotFn {
+	return &cohortSnapshotFn{
+		Interval:  interval,
+		Counts:    state.MakeValueState[cohortCounts]("counts"),
+		Scheduled: state.MakeValueState[bool]("scheduled"),
+		Snapshot:  timers.InProcessingTime("snapshot"),
+	}
+}
+
+func (fn *cohortSnapshotFn) Setup() {
+	if fn.now == nil {
+		fn.now = time.Now
+	}
+}
+
+// ProcessElement counts the insights, scheduling a snapshot unless one is due already.
+// Snapshots are only emitted by OnTimer.
+func (fn *cohortSnapshotFn) ProcessElement(sp state.Provider, tp timers.Provider, _ string, insights InsightsResult, _ func(CohortSnapshot)) error {
+	counts, _, err := fn.Counts.Read(sp)
+	if err != nil {
+		return fmt.Errorf("error reading the cohort counts: %w", err)
+	}
+	if counts.Weaknesses == nil {
+		counts.Weaknesses = make(map[string]int)
+	}
+	counts.Processed++
+	counts.ScoreSum += insights.CorrectAnswers
+	for _, weakness := range insights.Weaknesses {
+		counts.Weaknesses[weakness]++
+	}
+	if err := fn.Counts.Write(sp, counts); err != nil {
+		return fmt.Errorf("error writing the cohort counts: %w", err)
+	}
+
+	scheduled, _, err := fn.Scheduled.Read(sp)
+	if err != nil {
+		return fmt.Errorf("error reading the snapshot schedule: %w", err)
+	}
+	if scheduled {
+		return nil
+	}
+	fn.Snapshot.Set(tp, fn.now().Add(fn.Interval))
+	if err := fn.Scheduled.Write(sp, true); err != nil {
+		return fmt.Errorf("error writing the snapshot schedule: %w", err)
+	}
+	return nil
+}
+
+// OnTimer emits the snapshot of the running counts once it is due.
+func (fn *cohortSnapshotFn) OnTimer(_ context.Context, sp state.Provider, _ timers.Provider, _ string, timer timers.Context, emit func(CohortSnapshot)) error {
+	if timer.Family != fn.Snapshot.Family {
+		return nil
+	}
+	counts, _, err := fn.Counts.Read(sp)
+	if err != nil {
+		return fmt.Errorf("error reading the cohort counts: %w", err)
+	}
+	emit(counts.snapshot(fn.now()))
+	if err := fn.Scheduled.Clear(sp); err != nil {
+		return fmt.Errorf("error clearing the snapshot schedule: %w", err)
+	}
+	return nil
+}
+
+// cohortKey keys all the insights with the same key, as the state of the running counts is per key.
+func cohortKey(insights InsightsResult) (string, InsightsResult) {
+	return "cohort", insights
+}
+
+/*
+pushCohortSnapshotFn is a DoFn pushing the cohort snapshots to the metrics backend: the cohort
+gauges of the runner and, when URL is set, a Prometheus Pushgateway, e.g.
+http://pushgateway:9091/metrics/job/assessment_pipeline, in its text format. Pushes failing are
+logged and skipped, the next snapshot superseding them.
+*/
+type pushCohortSnapshotFn struct {
+	URL    string
+	client *http.Client
+}
+
+func (fn *pushCohortSnapshotFn) Setup() {
+	if fn.client == nil {
+		fn.client = &http.Client{Timeout: 10 * time.Second}
+	}
+}
+
+func (fn *pushCohortSnapshotFn) ProcessElement(ctx context.Context, snapshot CohortSnapshot) error {
+	cohortProcessedGauge.Set(ctx, int64(snapshot.Processed))
+	cohortAverageScoreGauge.Set(ctx, int64(snapshot.AverageScore*1000))
+	if fn.URL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fn.URL, strings.NewReader(snapshot.prometheusText()))
+	if err != nil {
+		return fmt.Errorf("error creating the cohort snapshot push: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := fn.client.Do(req)
+	if err != nil {
+		log.Printf("Error pushing the cohort snapshot: %v", err)
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Error pushing the cohort snapshot: %s", resp.Status)
+	}
+	return nil
+}
+
+// prometheusLabelEscaper escapes the label values of the Prometheus text format.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusText returns the snapshot as gauges in the Prometheus text format.
+func (s CohortSnapshot) prometheusText() string {
+	var b strings.Builder
+	gauge := func(name, help, sample string) {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n# HELP %s %s\n%s%s\n", name, name, help, name, sample)
+	}
+	gauge("assessment_cohort_processed", "Assessments whose insights were extracted so far.", fmt.Sprintf(" %d", s.Processed))
+	gauge("assessment_cohort_average_score", "Average number of questions answered correctly.", " "+strconv.FormatFloat(s.AverageScore, 'g', -1, 64))
+	if s.TopWeakness != "" {
+		gauge("assessment_cohort_top_weakness", "Count of the most frequent weakness so far.",
+			fmt.Sprintf(`{weakness="%s"} %d`, prometheusLabelEscaper.Replace(s.TopWeakness), s.TopWeaknessCount))
+	}
+	return b.String()
+}
+
+// pushCohortSnapshots pushes snapshots of the running cohort counts of the insights to the
+// metrics backend, at most every interval, see cohortSnapshotFn and pushCohortSnapshotFn.
+func pushCohortSnapshots(scope beam.Scope, interval time.Duration, url string, insights beam.PCollection) {
+	scope = scope.Scope("CohortSnapshots")
+	keyed := beam.ParDo(scope, cohortKey, insights)
+	snapshots := beam.ParDo(scope, newCohortSnapshotFn(interval), keyed)
+	beam.ParDo0(scope, &pushCohortSnapshotFn{URL: url}, snapshots)
+}
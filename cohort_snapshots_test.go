@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCohortSnapshotFn(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	fn := newCohortSnapshotFn(30 * time.Second)
+	fn.now = func() time.Time { return now }
+	fn.Setup()
+	sp, tp := newFakeStateProvider(), &fakeTimerProvider{}
+	var snapshots []CohortSnapshot
+	emit := func(snapshot CohortSnapshot) { snapshots = append(snapshots, snapshot) }
+	due := func() timers.TimerMap {
+		return timers.TimerMap{Family: "snapshot", FireTimestamp: mtime.FromTime(now.Add(30 * time.Second)), HoldTimestamp: mtime.FromTime(now.Add(30 * time.Second))}
+	}
+
+	// A single snapshot is scheduled for the insights counted until it is due
+	for _, insights := range []InsightsResult{
+		{CorrectAnswers: 6, Weaknesses: []string{"IAM", "Networking"}},
+		{CorrectAnswers: 9, Weaknesses: []string{"Networking"}},
+	} {
+		assert.NoError(t, fn.ProcessElement(sp, tp, "cohort", insights, emit))
+	}
+	assert.Empty(t, snapshots)
+	assert.Equal(t, []timers.TimerMap{due()}, tp.timers)
+
+	// The snapshot holds the running counts
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, fn.OnTimer(context.Background(), sp, tp, "cohort", timers.Context{Family: "snapshot"}, emit))
+	assert.Equal(t, []CohortSnapshot{{At: now, Processed: 2, AverageScore: 7.5, TopWeakness: "Networking", TopWeaknessCount: 2}}, snapshots)
+
+	// The next insights schedule the next snapshot, which adds up to the previous counts
+	assert.NoError(t, fn.ProcessElement(sp, tp, "cohort", InsightsResult{CorrectAnswers: 3, Weaknesses: []string{"IAM"}}, emit))
+	assert.Equal(t, []timers.TimerMap{tp.timers[0], due()}, tp.timers)
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, fn.OnTimer(context.Background(), sp, tp, "cohort", timers.Context{Family: "snapshot"}, emit))
+	if assert.Len(t, snapshots, 2) {
+		// IAM and Networking are tied, IAM comes first
+		assert.Equal(t, CohortSnapshot{At: now, Processed: 3, AverageScore: 6, TopWeakness: "IAM", TopWeaknessCount: 2}, snapshots[1])
+	}
+}
+
+func TestPushCohortSnapshotFn(t *testing.T) {
+	var pushed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushed = append(pushed, string(body))
+	}))
+	defer server.Close()
+
+	fn := &pushCohortSnapshotFn{URL: server.URL + "/metrics/job/assessment_pipeline"}
+	fn.Setup()
+	assert.NoError(t, fn.ProcessElement(context.Background(), CohortSnapshot{Processed: 2, AverageScore: 7.5, TopWeakness: `Say "hi"`, TopWeaknessCount: 2}))
+	assert.Equal(t, []string{`# TYPE assessment_cohort_processed gauge
+# HELP assessment_cohort_processed Assessments whose insights were extracted so far.
+assessment_cohort_processed 2
+# TYPE assessment_cohort_average_score gauge
+# HELP assessment_cohort_average_score Average number of questions answered correctly.
+assessment_cohort_average_score 7.5
+# TYPE assessment_cohort_top_weakness gauge
+# HELP assessment_cohort_top_weakness Count of the most frequent weakness so far.
+assessment_cohort_top_weakness{weakness="Say \"hi\""} 2
+`}, pushed)
+
+	// A backend that is down doesn't fail the pipeline
+	server.Close()
+	assert.NoError(t, fn.ProcessElement(context.Background(), CohortSnapshot{Processed: 3}))
+}
+
+func TestPushCohortSnapshots(t *testing.T) {
+	// The stateful DoFn and its timer are accepted by the pipeline
+	p, scope := beam.NewPipelineWithRoot()
+	pushCohortSnapshots(scope, time.Minute, "", beam.Create(scope, InsightsResult{CorrectAnswers: 7}))
+	if _, _, err := p.Build(); err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the configuration file loaded when CONFIG_FILE is not set.
+const defaultConfigFile = "config.yaml"
+
+// Config holds the pipeline configuration, loaded from a YAML file and overridden by env vars.
+type Config struct {
+	Project    string   `yaml:"project"`
+	Collection string   `yaml:"collection"`
+	Databases  []string `yaml:"databases"`
+	// Watch tails the collection changes instead of reading it once, running as a streaming job.
+	Watch      bool          `yaml:"watch"`
+	Output     OutputConfig  `yaml:"output"`
+	MaxRetries int           `yaml:"max_retries"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+	// MaxValidationRetries and MaxTransientRetries bound the retries of the attempts failing
+	// schema validation and of the ones failing transiently apart, within MaxRetries. 0 leaves
+	// them bounded by MaxRetries only.
+	MaxValidationRetries int `yaml:"max_validation_retries"`
+	MaxTransientRetries  int `yaml:"max_transient_retries"`
+	// RetryJitter randomizes each retry delay by up to this fraction of RetryDelay, 0 disables it.
+	RetryJitter float64 `yaml:"retry_jitter"`
+	// RetryPredicate names the registered predicate deciding which failed attempts are retried,
+	// in place of the default policy. None when empty.
+	RetryPredicate string `yaml:"retry_predicate"`
+	// ErrorRateBackoff scales each retry delay by 1 + ErrorRateBackoff × the rolling error rate
+	// of the provider, backing off harder from a degraded provider. 0 disables it.
+	ErrorRateBackoff float64       `yaml:"error_rate_backoff"`
+	Timeout          time.Duration `yaml:"timeout"`
+	// MaxTotalCalls caps the model calls of each worker, 0 disables the cap.
+	MaxTotalCalls int `yaml:"max_total_calls"`
+	// MaxCost caps the estimated cost of the model calls of each worker, priced with the metrics
+	// token costs, 0 disables the cap.
+	MaxCost float64 `yaml:"max_cost"`
+	// SampleRate is the fraction of the assessments processed, picked by hashing their IDs with
+	// SampleSeed so reruns process the same subset. Every assessment is processed when 0.
+	SampleRate float64 `yaml:"sample_rate"`
+	SampleSeed int     `yaml:"sample_seed"`
+	// MaxAssessmentChars truncates longer assessments with the Truncation strategy:
+	// head, tail or middle (the default). 0 disables truncation.
+	MaxAssessmentChars int                `yaml:"max_assessment_chars"`
+	Truncation         TruncationStrategy `yaml:"truncation"`
+	// ChunkSize splits the assessments longer than ChunkSize characters into chunks extracted
+	// apart and merged, each one repeating the last ChunkOverlap characters of the previous one
+	// for context. 0 disables chunking.
+	ChunkSize    int `yaml:"chunk_size"`
+	ChunkOverlap int `yaml:"chunk_overlap"`
+	// Rubric is the official rubric document every extraction is compared to, none when empty.
+	Rubric string `yaml:"rubric"`
+	// HistoryTable is the BigQuery table of past insights, as project.dataset.table, the history
+	// of each user is summarized from into the prompts. No enrichment when empty.
+	HistoryTable string `yaml:"history_table"`
+	// DedupePrompts extracts the insights of textually identical assessments (same result and
+	// preferred model) with a single model call, fanning them out to all of them. Batch reads only.
+	DedupePrompts bool `yaml:"dedupe_prompts"`
+	// DedupeSimilarity also collapses the near-duplicate assessments, whose results are at least
+	// this similar (normalized edit similarity, e.g. 0.95), into one model call. 0 disables it.
+	DedupeSimilarity float64 `yaml:"dedupe_similarity"`
+	// Checkpoint records the IDs of the processed assessments, so that a run resumed after a
+	// failure skips them. Batch reads only.
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+	// Benchmark compares these providers on the assessments, writing the latency, cost, JSON
+	// validity and agreement of their extractions to benchmark.jsonl, instead of extracting the
+	// insights. Disabled when empty.
+	Benchmark []BenchmarkProvider `yaml:"benchmark"`
+	// Manifest is where the manifest of the run is written once it completes: the assessments
+	// read, insights extracted and failures, the tokens and cost, the providers and models, the
+	// start and end times and the hash of the configuration. Not written when empty.
+	Manifest string `yaml:"manifest"`
+	// SmokeTest processes a single document end to end and exits, to validate the configuration.
+	SmokeTest bool `yaml:"smoke_test"`
+	// ValidateAssessments writes the assessment documents that don't match the Assessment shape
+	// to malformed_assessments.jsonl, with their raw data, instead of failing the read.
+	ValidateAssessments bool `yaml:"validate_assessments"`
+	// Prioritize processes the assessments flagged "priority: high" ahead of the others of their bundle.
+	Prioritize bool `yaml:"prioritize"`
+	// PromptCompressor names the registered compressor applied to prompts, none when empty.
+	PromptCompressor string `yaml:"prompt_compressor"`
+	// PostProcessors name the registered post-processors transforming the parsed insights, in order,
+	// before they are validated. None when empty.
+	PostProcessors []string `yaml:"post_processors"`
+	// QualityScorer names the registered scorer of the quality of the insights, "heuristic" when empty.
+	QualityScorer string `yaml:"quality_scorer"`
+	// Recitation is how responses blocked for reproducing training data are handled:
+	// refuse, output (to recitation.jsonl) or rephrase.
+	Recitation RecitationPolicy `yaml:"recitation"`
+	// Eval writes the prompt, raw response and parsed insights of every model call to eval.jsonl.
+	// Disabled by default, as it writes the assessments and responses in clear.
+	Eval bool `yaml:"eval"`
+	// RawFailures writes the raw responses that failed to parse, with the ID of their assessment,
+	// to raw_failures.jsonl for manual repair.
+	RawFailures bool `yaml:"raw_failures"`
+	// EmitRaw also writes the insights as parsed, before post-processing, to raw_insights.jsonl.
+	EmitRaw bool `yaml:"emit_raw"`
+	// CacheResponses answers the repeated model calls of a worker from an in-memory cache,
+	// keyed with the fingerprint of the insights schema so a schema change misses older responses.
+	CacheResponses bool `yaml:"cache_responses"`
+	// CacheNegativeTTL also caches, for this long, the calls failing the same way every time
+	// (refusals, recitations, invalid requests), apart from the responses. 0 disables it.
+	CacheNegativeTTL time.Duration `yaml:"cache_negative_ttl"`
+	// RepairFields re-asks the model for the single invalid field of an otherwise valid response
+	// instead of retrying the whole extraction.
+	RepairFields bool `yaml:"repair_fields"`
+	// GeminiResponseSchema constrains the Gemini responses to the schema derived from InsightsResult.
+	GeminiResponseSchema bool `yaml:"gemini_response_schema"`
+	// CacheSchema caches the insights schema server-side (Gemini context caching), referencing it
+	// by handle in every call, and sends it inline when the model can't cache content.
+	CacheSchema bool `yaml:"cache_schema"`
+	// EmitDegraded emits a minimal InsightsResult flagged as degraded, holding whatever could be
+	// parsed from the last response, for the assessments failing all their retries.
+	EmitDegraded bool `yaml:"emit_degraded"`
+	// DeferFailures retries the assessments failing all their retries once more at the end of their
+	// bundle, giving transient provider errors time to clear.
+	DeferFailures bool `yaml:"defer_failures"`
+	// RetryOnEmptyResponse retries the empty responses, which are transient, without using up one
+	// of the max_retries attempts. Up to max_retries empty responses are retried.
+	RetryOnEmptyResponse bool `yaml:"retry_on_empty_response"`
+	// RecordResponseMeta attaches the model version and finish reason of the response to the
+	// insights, when the model reports them.
+	RecordResponseMeta bool `yaml:"record_response_meta"`
+	// StructuredTools forces the model to answer through a tool whose input schema is the insights
+	// schema, instead of asking for JSON in the prompt. Only Anthropic can be forced to call a tool.
+	StructuredTools bool `yaml:"structured_tools"`
+	// MinAvgLogprob retries the responses whose average log probability is below it. Only
+	// Gemini reports it, other providers are rejected. 0 disables the gate.
+	MinAvgLogprob float64 `yaml:"min_avg_logprob"`
+	// PreferredModels are the models of the LLM provider assessments may select with their
+	// preferred_model field. Assessments naming another model use the configured one.
+	PreferredModels []string        `yaml:"preferred_models"`
+	LLM             llm.LLMConfig   `yaml:"llm"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit"`
+	Audit           AuditConfig     `yaml:"audit"`
+	Metrics         MetricsConfig   `yaml:"metrics"`
+	// AdaptiveMaxTokens raises llm.max_tokens, up to a ceiling, as responses are truncated.
+	AdaptiveMaxTokens AdaptiveMaxTokensConfig `yaml:"adaptive_max_tokens"`
+	// HealthGate switches the bundles to a fallback model while the provider is unhealthy.
+	HealthGate HealthGateConfig `yaml:"health_gate"`
+	// TransportRetries retries the HTTP requests of the model calls failing with a connection
+	// error or a 5xx status, below the retries of the extraction.
+	TransportRetries TransportRetriesConfig `yaml:"transport_retries"`
+	// Cohort configures the cohort aggregate.
+	Cohort CohortConfig `yaml:"cohort"`
+}
+
+// OutputConfig holds the settings of the JSON Lines output.
+type OutputConfig struct {
+	Path string `yaml:"path"`
+	// Partitioned writes the insights under Path as date-partitioned JSON Lines files,
+	// "<path>/dt=YYYY-MM-DD/part-*.jsonl", by the date they were generated at.
+	Partitioned bool `yaml:"partitioned"`
+	// FlushEvery writes the output incrementally every FlushEvery lines, 0 writes it at the end.
+	FlushEvery int           `yaml:"flush_every"`
+	Window     time.Duration `yaml:"window"`
+	// FirestoreCollection is a Firestore collection the insights are also written to, in the
+	// database of their assessment, one document per assessment, skipping the documents whose
+	// content is unchanged. Not written when empty.
+	FirestoreCollection string `yaml:"firestore_collection"`
+	// Format is the format of the insights written to Path: json (the default) for JSON Lines,
+	// proto for files of length-prefixed InsightsResult records (see insights.proto), one per
+	// bundle, or the name of a serializer registered with RegisterInsightsSerializer.
+	Format string `yaml:"format"`
+	// Locale localizes the JSON keys of the insights written to Path with the key map registered
+	// for it (e.g. es, see RegisterOutputLocale), English when empty. Not supported with proto.
+	Locale string `yaml:"locale"`
+	// Append appends each insight to the local file at Path as soon as it is extracted, syncing
+	// the file to disk every SyncInterval (1s when unset), so a crash loses at most the insights
+	// of the last interval.
+	Append       bool          `yaml:"append"`
+	SyncInterval time.Duration `yaml:"sync_interval"`
+}
+
+// durable reports whether the insights are written as they are extracted, rather than at the
+// end of the run, so the ones of a failed run are kept, as the checkpoint requires.
+func (o OutputConfig) durable() bool {
+	if o.FirestoreCollection != "" {
+		return true
+	}
+	// Proto and partitioned outputs take precedence over append and flush_every, see loadDataIntoDestination
+	return o.Format != OutputFormatProto && !o.Partitioned && (o.Append || o.FlushEvery > 0)
+}
+
+// RateLimitConfig holds the cluster-wide rate limit of the model calls, shared by every worker.
+type RateLimitConfig struct {
+	// RequestsPerSecond bounds the model calls of all the workers together, 0 disables the limit.
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+	// Collection is the Firestore collection holding the shared token buckets, one per provider.
+	Collection string `yaml:"collection"`
+	// Database is the Firestore database of Collection, by default the one of Databases when there
+	// is a single one, (default) otherwise.
+	Database string `yaml:"database"`
+	// Shards is the number of documents each bucket is split into, so that the workers don't all
+	// contend for a single document. There are never more shards than Burst.
+	Shards int `yaml:"shards"`
+}
+
+// AuditConfig holds the settings of the audit log of every model interaction.
+type AuditConfig struct {
+	// Path is the JSON Lines audit log, no audit log is written when empty.
+	Path string `yaml:"path"`
+	// Prompts is how prompts are logged: plain, hash or redact.
+	Prompts llm.AuditPromptMode `yaml:"prompts"`
+}
+
+// MetricsConfig holds the settings of the OpenMetrics file summarizing the run, for
+// deployments without a Prometheus scrape endpoint.
+type MetricsConfig struct {
+	// Path is the OpenMetrics text file, rewritten at the end of every bundle. None when empty.
+	Path string `yaml:"path"`
+	// InputTokenCost and OutputTokenCost are the prices of a million input and output tokens,
+	// from which the total cost is computed.
+	InputTokenCost  float64 `yaml:"input_token_cost"`
+	OutputTokenCost float64 `yaml:"output_token_cost"`
+}
+
+// CheckpointConfig holds the settings of the checkpoint of the processed assessments.
+type CheckpointConfig struct {
+	// Location is a directory (e.g. "gs://bucket/checkpoints/run") or a Firestore collection
+	// ("firestore://<collection>") the processed IDs are recorded in. No checkpoint when empty.
+	Location string `yaml:"location"`
+	// FlushEvery persists the processed IDs every FlushEvery assessments, and at the end of every
+	// bundle. Defaults to 100 when 0.
+	FlushEvery int `yaml:"flush_every"`
+	// Database is the Firestore database of a firestore:// checkpoint. Defaults to the database
+	// the assessments are read from when there is a single one, the (default) database otherwise.
+	Database string `yaml:"database"`
+}
+
+// defaultConfig returns the configuration used for the settings missing from the file and env vars.
+func defaultConfig() Config {
+	return Config{
+		Output: OutputConfig{
+			Path:   "processed.jsonl",
+			Window: time.Minute,
+		},
+		MaxRetries: 3,
+		RetryDelay: 10 * time.Second,
+		Timeout:    30 * time.Second,
+		LLM: llm.LLMConfig{
+			Provider:  llm.ProviderGemini,
+			MaxTokens: 8192,
+		},
+		RateLimit: RateLimitConfig{
+			Burst:      1,
+			Collection: "rate_limits",
+			Shards:     8,
+		},
+	}
+}
+
+// loadConfig loads the configuration from the YAML file at path (defaultConfigFile when empty,
+// in which case the file is optional), applies the env var overrides and validates the result.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	optional := path == ""
+	if optional {
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	case optional && errors.Is(err, os.ErrNotExist):
+	default:
+		return Config{}, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	// A Firestore checkpoint is kept along with the assessments, in a project that may have no (default) database
+	if strings.HasPrefix(cfg.Checkpoint.Location, firestoreCheckpointScheme) && cfg.Checkpoint.Database == "" && len(cfg.Databases) == 1 {
+		cfg.Checkpoint.Database = cfg.Databases[0]
+	}
+	// So are the token buckets of the rate limit
+	if cfg.RateLimit.RequestsPerSecond > 0 && cfg.RateLimit.Database == "" && len(cfg.Databases) == 1 {
+		cfg.RateLimit.Database = cfg.Databases[0]
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the env vars that are set,
+// returning all the invalid values at once.
+func (cfg *Config) applyEnv() error {
+	var errs []error
+
+	setString := func(name string, field *string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+	setInt := func(name string, field *int) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s value %q: %w", name, value, err))
+				return
+			}
+			*field = parsed
+		}
+	}
+	setFloat := func(name string, field *float64) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s value %q: %w", name, value, err))
+				return
+			}
+			*field = parsed
+		}
+	}
+	setBool := func(name string, field *bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s value %q: %w", name, value, err))
+				return
+			}
+			*field = parsed
+		}
+	}
+	setDuration := func(name string, field *time.Duration) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s value %q: %w", name, value, err))
+				return
+			}
+			*field = parsed
+		}
+	}
+
+	setString("GOOGLE_CLOUD_PROJECT", &cfg.Project)
+	setString("ASSESSMENT_COLLECTION", &cfg.Collection)
+	if value, ok := os.LookupEnv("ASSESSMENT_DATABASES"); ok {
+		cfg.Databases = splitList(value)
+	}
+	setBool("ASSESSMENT_WATCH", &cfg.Watch)
+	setBool("SMOKE_TEST", &cfg.SmokeTest)
+	setBool("VALIDATE_ASSESSMENTS", &cfg.ValidateAssessments)
+	setString("OUTPUT_PATH", &cfg.Output.Path)
+	setBool("OUTPUT_PARTITIONED", &cfg.Output.Partitioned)
+	setInt("OUTPUT_FLUSH_EVERY", &cfg.Output.FlushEvery)
+	setDuration("OUTPUT_WINDOW", &cfg.Output.Window)
+	setString("OUTPUT_FIRESTORE_COLLECTION", &cfg.Output.FirestoreCollection)
+	setString("OUTPUT_FORMAT", &cfg.Output.Format)
+	setString("OUTPUT_LOCALE", &cfg.Output.Locale)
+	setBool("OUTPUT_APPEND", &cfg.Output.Append)
+	setDuration("OUTPUT_SYNC_INTERVAL", &cfg.Output.SyncInterval)
+	setInt("MAX_RETRIES", &cfg.MaxRetries)
+	setInt("MAX_VALIDATION_RETRIES", &cfg.MaxValidationRetries)
+	setInt("MAX_TRANSIENT_RETRIES", &cfg.MaxTransientRetries)
+	setDuration("RETRY_DELAY", &cfg.RetryDelay)
+	setFloat("RETRY_JITTER", &cfg.RetryJitter)
+	setString("RETRY_PREDICATE", &cfg.RetryPredicate)
+	setFloat("ERROR_RATE_BACKOFF", &cfg.ErrorRateBackoff)
+	setDuration("REQUEST_TIMEOUT", &cfg.Timeout)
+	setInt("MAX_TOTAL_CALLS", &cfg.MaxTotalCalls)
+	setFloat("MAX_COST", &cfg.MaxCost)
+	setFloat("SAMPLE_RATE", &cfg.SampleRate)
+	setInt("SAMPLE_SEED", &cfg.SampleSeed)
+	setBool("PRIORITIZE_ASSESSMENTS", &cfg.Prioritize)
+	setString("PROMPT_COMPRESSOR", &cfg.PromptCompressor)
+	if value, ok := os.LookupEnv("POST_PROCESSORS"); ok {
+		cfg.PostProcessors = splitList(value)
+	}
+	setString("QUALITY_SCORER", &cfg.QualityScorer)
+	setBool("DEDUPE_PROMPTS", &cfg.DedupePrompts)
+	setFloat("DEDUPE_SIMILARITY", &cfg.DedupeSimilarity)
+	setString("CHECKPOINT_LOCATION", &cfg.Checkpoint.Location)
+	setInt("CHECKPOINT_FLUSH_EVERY", &cfg.Checkpoint.FlushEvery)
+	setString("CHECKPOINT_DATABASE", &cfg.Checkpoint.Database)
+	setString("RUN_MANIFEST", &cfg.Manifest)
+	if value, ok := os.LookupEnv("BENCHMARK_PROVIDERS"); ok {
+		cfg.Benchmark = nil
+		for _, provider := range splitList(value) {
+			cfg.Benchmark = append(cfg.Benchmark, BenchmarkProvider{LLM: llm.LLMConfig{Provider: provider}})
+		}
+	}
+	setString("RUBRIC_FILE", &cfg.Rubric)
+	setString("HISTORY_TABLE", &cfg.HistoryTable)
+	setInt("MAX_ASSESSMENT_CHARS", &cfg.MaxAssessmentChars)
+	if value, ok := os.LookupEnv("TRUNCATION_STRATEGY"); ok {
+		cfg.Truncation = TruncationStrategy(value)
+	}
+	setInt("CHUNK_SIZE", &cfg.ChunkSize)
+	setInt("CHUNK_OVERLAP", &cfg.ChunkOverlap)
+	if value, ok := os.LookupEnv("RECITATION_POLICY"); ok {
+		cfg.Recitation = RecitationPolicy(value)
+	}
+	setBool("EVAL_MODE", &cfg.Eval)
+	setBool("RAW_FAILURES", &cfg.RawFailures)
+	setBool("EMIT_RAW_INSIGHTS", &cfg.EmitRaw)
+	setBool("CACHE_RESPONSES", &cfg.CacheResponses)
+	setBool("REPAIR_FIELDS", &cfg.RepairFields)
+	setBool("GEMINI_RESPONSE_SCHEMA", &cfg.GeminiResponseSchema)
+	setBool("CACHE_SCHEMA", &cfg.CacheSchema)
+	setBool("EMIT_DEGRADED", &cfg.EmitDegraded)
+	setBool("DEFER_FAILURES", &cfg.DeferFailures)
+	setBool("RETRY_ON_EMPTY_RESPONSE", &cfg.RetryOnEmptyResponse)
+	setBool("RECORD_RESPONSE_META", &cfg.RecordResponseMeta)
+	setBool("STRUCTURED_TOOLS", &cfg.StructuredTools)
+	setFloat("MIN_AVG_LOGPROB", &cfg.MinAvgLogprob)
+	if value, ok := os.LookupEnv("PREFERRED_MODELS"); ok {
+		cfg.PreferredModels = splitList(value)
+	}
+	setString("LLM_PROVIDER", &cfg.LLM.Provider)
+	setString("LLM_MODEL", &cfg.LLM.Model)
+	setFloat("LLM_TEMPERATURE", &cfg.LLM.Temperature)
+	setInt("LLM_MAX_TOKENS", &cfg.LLM.MaxTokens)
+	setFloat("LLM_TOP_P", &cfg.LLM.TopP)
+	setInt("LLM_TOP_K", &cfg.LLM.TopK)
+	setFloat("RATE_LIMIT_RPS", &cfg.RateLimit.RequestsPerSecond)
+	setInt("RATE_LIMIT_BURST", &cfg.RateLimit.Burst)
+	setString("RATE_LIMIT_COLLECTION", &cfg.RateLimit.Collection)
+	setString("RATE_LIMIT_DATABASE", &cfg.RateLimit.Database)
+	setInt("RATE_LIMIT_SHARDS", &cfg.RateLimit.Shards)
+	setInt("ADAPTIVE_MAX_TOKENS_CEILING", &cfg.AdaptiveMaxTokens.Ceiling)
+	setFloat("ADAPTIVE_MAX_TOKENS_TRUNCATION_RATE", &cfg.AdaptiveMaxTokens.TruncationRate)
+	setString("HEALTH_GATE_FALLBACK_PROVIDER", &cfg.HealthGate.Fallback.Provider)
+	setString("HEALTH_GATE_FALLBACK_MODEL", &cfg.HealthGate.Fallback.Model)
+	setDuration("HEALTH_GATE_TIMEOUT", &cfg.HealthGate.Timeout)
+	setInt("TRANSPORT_MAX_RETRIES", &cfg.TransportRetries.MaxRetries)
+	setDuration("TRANSPORT_RETRY_BACKOFF", &cfg.TransportRetries.Backoff)
+	setDuration("CACHE_NEGATIVE_TTL", &cfg.CacheNegativeTTL)
+	for _, name := range []string{"COHORT_EARLY_FIRING", "COHORT_ALLOWED_LATENESS", "COHORT_ACCUMULATING"} {
+		if _, ok := os.LookupEnv(name); ok && cfg.Cohort.Trigger == nil {
+			cfg.Cohort.Trigger = &GlobalWindowTrigger{}
+		}
+	}
+	if _, ok := os.LookupEnv("COHORT_HALF_LIFE"); ok && cfg.Cohort.HalfLife == nil {
+		cfg.Cohort.HalfLife = new(time.Duration)
+	}
+	if cfg.Cohort.HalfLife != nil {
+		setDuration("COHORT_HALF_LIFE", cfg.Cohort.HalfLife)
+	}
+	setDuration("COHORT_SNAPSHOT_INTERVAL", &cfg.Cohort.SnapshotInterval)
+	setString("COHORT_SNAPSHOT_PUSH_URL", &cfg.Cohort.SnapshotPushURL)
+	if trigger := cfg.Cohort.Trigger; trigger != nil {
+		setDuration("COHORT_EARLY_FIRING", &trigger.EarlyFiring)
+		setDuration("COHORT_ALLOWED_LATENESS", &trigger.AllowedLateness)
+		setBool("COHORT_ACCUMULATING", &trigger.Accumulating)
+	}
+	setString("AUDIT_LOG", &cfg.Audit.Path)
+	if value, ok := os.LookupEnv("AUDIT_PROMPTS"); ok {
+		cfg.Audit.Prompts = llm.AuditPromptMode(value)
+	}
+	setString("METRICS_FILE", &cfg.Metrics.Path)
+	setFloat("METRICS_INPUT_TOKEN_COST", &cfg.Metrics.InputTokenCost)
+	setFloat("METRICS_OUTPUT_TOKEN_COST", &cfg.Metrics.OutputTokenCost)
+
+	return errors.Join(errs...)
+}
+
+// validate checks the configuration, listing every missing required field in a single error.
+func (cfg *Config) validate() error {
+	var missing []string
+	if cfg.Project == "" {
+		missing = append(missing, "project (GOOGLE_CLOUD_PROJECT)")
+	}
+	if cfg.Collection == "" {
+		missing = append(missing, "collection (ASSESSMENT_COLLECTION)")
+	}
+	if cfg.Output.Path == "" {
+		missing = append(missing, "output.path (OUTPUT_PATH)")
+	}
+
+	var errs []error
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing required config: %s", strings.Join(missing, ", ")))
+	}
+	if cfg.MaxRetries < 1 {
+		errs = append(errs, fmt.Errorf("max_retries must be at least 1, got %d", cfg.MaxRetries))
+	}
+	if cfg.MaxValidationRetries < 0 || cfg.MaxTransientRetries < 0 {
+		errs = append(errs, fmt.Errorf("max_validation_retries and max_transient_retries must not be negative, got %d and %d", cfg.MaxValidationRetries, cfg.MaxTransientRetries))
+	}
+	if cfg.Watch && !cfg.Output.Partitioned && cfg.Output.FlushEvery <= 0 && cfg.Output.Format != OutputFormatProto && !cfg.Output.Append {
+		errs = append(errs, errors.New("watch requires output.flush_every, output.partitioned, output.append or output.format proto, the output of a streaming job is never complete"))
+	}
+	if cfg.Output.Append && (cfg.Output.Partitioned || cfg.Output.FlushEvery > 0 || cfg.Output.Format == OutputFormatProto) {
+		errs = append(errs, errors.New("output.append is not supported with output.partitioned, output.flush_every or output.format proto"))
+	}
+	if cfg.HistoryTable != "" && !historyTablePattern.MatchString(cfg.HistoryTable) {
+		errs = append(errs, fmt.Errorf("invalid history_table %q, expected project.dataset.table", cfg.HistoryTable))
+	}
+	if cfg.Output.SyncInterval < 0 {
+		errs = append(errs, fmt.Errorf("output.sync_interval must not be negative, got %v", cfg.Output.SyncInterval))
+	}
+	if cfg.Output.Format == OutputFormatProto && (cfg.Output.Partitioned || cfg.Output.FlushEvery > 0) {
+		errs = append(errs, errors.New("output.format proto is not supported with output.partitioned or output.flush_every"))
+	}
+	if cfg.Watch && cfg.SmokeTest {
+		errs = append(errs, errors.New("smoke_test is not supported with watch, a streaming job never finishes"))
+	}
+	if cfg.Watch && cfg.ValidateAssessments {
+		errs = append(errs, errors.New("validate_assessments is not supported with watch"))
+	}
+	if cfg.Watch && cfg.DedupePrompts {
+		errs = append(errs, errors.New("dedupe_prompts is not supported with watch, identical assessments can't be grouped in an unbounded read"))
+	}
+	if cfg.DedupeSimilarity < 0 || cfg.DedupeSimilarity > 1 {
+		errs = append(errs, fmt.Errorf("dedupe_similarity must be between 0 and 1, got %v", cfg.DedupeSimilarity))
+	}
+	if cfg.Watch && cfg.DedupeSimilarity > 0 {
+		errs = append(errs, errors.New("dedupe_similarity is not supported with watch, near-duplicates can't be clustered in an unbounded read"))
+	}
+	if cfg.Watch && cfg.Checkpoint.Location != "" {
+		errs = append(errs, errors.New("checkpoint is not supported with watch, updated assessments would be skipped"))
+	}
+	if cfg.Checkpoint.FlushEvery < 0 {
+		errs = append(errs, fmt.Errorf("checkpoint.flush_every must not be negative, got %d", cfg.Checkpoint.FlushEvery))
+	}
+	if cfg.Checkpoint.Location != "" && !cfg.Output.durable() {
+		errs = append(errs, errors.New("checkpoint requires output.append, output.flush_every or output.firestore_collection, the output of a failed run is otherwise lost while its assessments are skipped on resume"))
+	}
+	if cfg.Watch && cfg.Manifest != "" {
+		errs = append(errs, errors.New("manifest is not supported with watch, a streaming job never completes"))
+	}
+	if cfg.Watch && len(cfg.Benchmark) > 0 {
+		errs = append(errs, errors.New("benchmark is not supported with watch, the comparisons of a streaming job are never complete"))
+	}
+	for i, provider := range cfg.Benchmark {
+		switch provider.LLM.Provider {
+		case llm.ProviderGemini, llm.ProviderAnthropic, llm.ProviderMistral, llm.ProviderOpenAI:
+		default:
+			errs = append(errs, fmt.Errorf("unknown benchmark[%d].llm.provider %q", i, provider.LLM.Provider))
+		}
+		if provider.InputTokenCost < 0 || provider.OutputTokenCost < 0 {
+			errs = append(errs, fmt.Errorf("benchmark[%d] token costs must not be negative", i))
+		}
+	}
+	if cfg.MaxTotalCalls < 0 {
+		errs = append(errs, fmt.Errorf("max_total_calls must not be negative, got %d", cfg.MaxTotalCalls))
+	}
+	if cfg.MaxCost < 0 {
+		errs = append(errs, fmt.Errorf("max_cost must not be negative, got %v", cfg.MaxCost))
+	}
+	if cfg.MaxCost > 0 && cfg.Metrics.InputTokenCost == 0 && cfg.Metrics.OutputTokenCost == 0 {
+		errs = append(errs, errors.New("max_cost requires the metrics token costs to estimate the cost of the calls"))
+	}
+	if cfg.RetryJitter < 0 || cfg.RetryJitter > 1 {
+		errs = append(errs, fmt.Errorf("retry_jitter must be between 0 and 1, got %v", cfg.RetryJitter))
+	}
+	if _, ok := retryPredicates[cfg.RetryPredicate]; cfg.RetryPredicate != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown retry_predicate %q", cfg.RetryPredicate))
+	}
+	if cfg.ErrorRateBackoff < 0 {
+		errs = append(errs, fmt.Errorf("error_rate_backoff must not be negative, got %v", cfg.ErrorRateBackoff))
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("sample_rate must be between 0 and 1, got %v", cfg.SampleRate))
+	}
+	if cfg.Metrics.InputTokenCost < 0 || cfg.Metrics.OutputTokenCost < 0 {
+		errs = append(errs, errors.New("metrics token costs must not be negative"))
+	}
+	if cfg.MinAvgLogprob > 0 {
+		errs = append(errs, fmt.Errorf("min_avg_logprob must not be positive, got %v", cfg.MinAvgLogprob))
+	}
+	if cfg.MinAvgLogprob < 0 && cfg.LLM.Provider != "" && cfg.LLM.Provider != llm.ProviderGemini {
+		errs = append(errs, fmt.Errorf("min_avg_logprob requires the gemini provider, %s doesn't report log probabilities", cfg.LLM.Provider))
+	}
+	if cfg.StructuredTools && (cfg.LLM.Provider != llm.ProviderAnthropic || (cfg.HealthGate.Fallback.Provider != "" && cfg.HealthGate.Fallback.Provider != llm.ProviderAnthropic)) {
+		errs = append(errs, errors.New("structured_tools requires the anthropic provider, including for health_gate.fallback, others can't be forced to call a tool"))
+	}
+	if _, ok := promptCompressors[cfg.PromptCompressor]; cfg.PromptCompressor != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown prompt_compressor %q", cfg.PromptCompressor))
+	}
+	for _, name := range cfg.PostProcessors {
+		if _, ok := postProcessors[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown post_processors entry %q", name))
+		}
+	}
+	if _, ok := qualityScorers[cfg.QualityScorer]; cfg.QualityScorer != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown quality_scorer %q", cfg.QualityScorer))
+	}
+	if cfg.AdaptiveMaxTokens.Ceiling < 0 {
+		errs = append(errs, fmt.Errorf("adaptive_max_tokens.ceiling must not be negative, got %d", cfg.AdaptiveMaxTokens.Ceiling))
+	}
+	if cfg.AdaptiveMaxTokens.TruncationRate < 0 || cfg.AdaptiveMaxTokens.TruncationRate >= 1 {
+		errs = append(errs, fmt.Errorf("adaptive_max_tokens.truncation_rate must be between 0 and 1, got %v", cfg.AdaptiveMaxTokens.TruncationRate))
+	}
+	switch cfg.HealthGate.Fallback.Provider {
+	case "", llm.ProviderGemini, llm.ProviderAnthropic, llm.ProviderMistral, llm.ProviderOpenAI:
+	default:
+		errs = append(errs, fmt.Errorf("unknown health_gate.fallback.provider %q", cfg.HealthGate.Fallback.Provider))
+	}
+	if cfg.HealthGate.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("health_gate.timeout must not be negative, got %v", cfg.HealthGate.Timeout))
+	}
+	if cfg.TransportRetries.MaxRetries < 0 || cfg.TransportRetries.Backoff < 0 {
+		errs = append(errs, fmt.Errorf("transport_retries.max_retries and backoff must not be negative, got %d and %v", cfg.TransportRetries.MaxRetries, cfg.TransportRetries.Backoff))
+	}
+	if cfg.CacheNegativeTTL < 0 {
+		errs = append(errs, fmt.Errorf("cache_negative_ttl must not be negative, got %v", cfg.CacheNegativeTTL))
+	}
+	if cfg.CacheNegativeTTL > 0 && !cfg.CacheResponses {
+		errs = append(errs, errors.New("cache_negative_ttl requires cache_responses"))
+	}
+	if trigger := cfg.Cohort.Trigger; trigger != nil && (trigger.EarlyFiring < 0 || trigger.AllowedLateness < 0) {
+		errs = append(errs, fmt.Errorf("cohort.trigger.early_firing and allowed_lateness must not be negative, got %v and %v", trigger.EarlyFiring, trigger.AllowedLateness))
+	}
+	if cfg.Cohort.HalfLife != nil && *cfg.Cohort.HalfLife < 0 {
+		errs = append(errs, fmt.Errorf("cohort.half_life must not be negative, got %v", *cfg.Cohort.HalfLife))
+	}
+	if cfg.Cohort.SnapshotInterval < 0 {
+		errs = append(errs, fmt.Errorf("cohort.snapshot_interval must not be negative, got %v", cfg.Cohort.SnapshotInterval))
+	}
+	if cfg.Cohort.SnapshotPushURL != "" {
+		if cfg.Cohort.SnapshotInterval == 0 {
+			errs = append(errs, errors.New("cohort.snapshot_push_url requires cohort.snapshot_interval"))
+		}
+		if u, err := url.Parse(cfg.Cohort.SnapshotPushURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid cohort.snapshot_push_url %q, expected an http or https URL", cfg.Cohort.SnapshotPushURL))
+		}
+	}
+	if cfg.RateLimit.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.requests_per_second must not be negative, got %v", cfg.RateLimit.RequestsPerSecond))
+	}
+	if cfg.RateLimit.Shards < 1 {
+		errs = append(errs, fmt.Errorf("rate_limit.shards must be at least 1, got %d", cfg.RateLimit.Shards))
+	}
+	if cfg.MaxAssessmentChars < 0 {
+		errs = append(errs, fmt.Errorf("max_assessment_chars must not be negative, got %d", cfg.MaxAssessmentChars))
+	}
+	if cfg.ChunkSize < 0 || cfg.ChunkOverlap < 0 {
+		errs = append(errs, fmt.Errorf("chunk_size and chunk_overlap must not be negative, got %d and %d", cfg.ChunkSize, cfg.ChunkOverlap))
+	}
+	if cfg.ChunkOverlap > 0 && cfg.ChunkOverlap >= cfg.ChunkSize {
+		errs = append(errs, fmt.Errorf("chunk_overlap must be smaller than chunk_size, got %d and %d", cfg.ChunkOverlap, cfg.ChunkSize))
+	}
+	if _, err := insightsSerializer(cfg.Output.Format); err != nil {
+		errs = append(errs, fmt.Errorf("unknown output.format %q", cfg.Output.Format))
+	}
+	if _, ok := outputKeyMaps[cfg.Output.Locale]; cfg.Output.Locale != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown output.locale %q", cfg.Output.Locale))
+	}
+	if cfg.Output.Locale != "" && cfg.Output.Format == OutputFormatProto {
+		errs = append(errs, errors.New("output.locale is not supported with output.format proto"))
+	}
+	switch cfg.Truncation {
+	case "", TruncateHead, TruncateTail, TruncateMiddle:
+	default:
+		errs = append(errs, fmt.Errorf("unknown truncation %q", cfg.Truncation))
+	}
+	switch cfg.Recitation {
+	case "", RecitationRefuse, RecitationOutput, RecitationRephrase:
+	default:
+		errs = append(errs, fmt.Errorf("unknown recitation %q", cfg.Recitation))
+	}
+	switch cfg.Audit.Prompts {
+	case "", llm.AuditPromptPlain, llm.AuditPromptHash, llm.AuditPromptRedact:
+	default:
+		errs = append(errs, fmt.Errorf("unknown audit.prompts %q", cfg.Audit.Prompts))
+	}
+	switch cfg.LLM.Provider {
+	case llm.ProviderGemini, llm.ProviderAnthropic, llm.ProviderMistral, llm.ProviderOpenAI:
+	default:
+		errs = append(errs, fmt.Errorf("unknown llm.provider %q", cfg.LLM.Provider))
+	}
+
+	return errors.Join(errs...)
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
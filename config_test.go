@@ -0,0 +1,590 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// configEnvVars are the env vars read by loadConfig, cleared so the host environment can't leak in.
+var configEnvVars = []string{
+	"GOOGLE_CLOUD_PROJECT", "ASSESSMENT_COLLECTION", "ASSESSMENT_DATABASES", "ASSESSMENT_WATCH", "SMOKE_TEST", "VALIDATE_ASSESSMENTS",
+	"OUTPUT_PATH", "OUTPUT_PARTITIONED", "OUTPUT_FLUSH_EVERY", "OUTPUT_WINDOW", "OUTPUT_FIRESTORE_COLLECTION", "OUTPUT_FORMAT", "OUTPUT_LOCALE", "OUTPUT_APPEND", "OUTPUT_SYNC_INTERVAL",
+	"MAX_RETRIES", "MAX_VALIDATION_RETRIES", "MAX_TRANSIENT_RETRIES", "RETRY_DELAY", "RETRY_JITTER", "RETRY_PREDICATE", "ERROR_RATE_BACKOFF", "REQUEST_TIMEOUT", "MAX_TOTAL_CALLS", "MAX_COST", "TRANSPORT_MAX_RETRIES", "TRANSPORT_RETRY_BACKOFF", "SAMPLE_RATE", "SAMPLE_SEED", "DEDUPE_PROMPTS", "DEDUPE_SIMILARITY", "CHECKPOINT_LOCATION", "CHECKPOINT_FLUSH_EVERY", "CHECKPOINT_DATABASE", "BENCHMARK_PROVIDERS", "RUN_MANIFEST", "PRIORITIZE_ASSESSMENTS", "PROMPT_COMPRESSOR", "POST_PROCESSORS", "QUALITY_SCORER", "RUBRIC_FILE", "HISTORY_TABLE", "MAX_ASSESSMENT_CHARS", "TRUNCATION_STRATEGY", "CHUNK_SIZE", "CHUNK_OVERLAP", "RECITATION_POLICY", "EVAL_MODE", "RAW_FAILURES", "EMIT_RAW_INSIGHTS", "CACHE_RESPONSES", "CACHE_NEGATIVE_TTL", "REPAIR_FIELDS", "GEMINI_RESPONSE_SCHEMA", "CACHE_SCHEMA", "EMIT_DEGRADED", "DEFER_FAILURES", "RETRY_ON_EMPTY_RESPONSE", "RECORD_RESPONSE_META", "STRUCTURED_TOOLS", "MIN_AVG_LOGPROB", "PREFERRED_MODELS",
+	"LLM_PROVIDER", "LLM_MODEL", "LLM_TEMPERATURE", "LLM_MAX_TOKENS", "LLM_TOP_P", "LLM_TOP_K",
+	"RATE_LIMIT_RPS", "RATE_LIMIT_BURST", "RATE_LIMIT_COLLECTION", "RATE_LIMIT_DATABASE", "RATE_LIMIT_SHARDS", "ADAPTIVE_MAX_TOKENS_CEILING", "ADAPTIVE_MAX_TOKENS_TRUNCATION_RATE", "HEALTH_GATE_FALLBACK_PROVIDER", "HEALTH_GATE_FALLBACK_MODEL", "HEALTH_GATE_TIMEOUT", "COHORT_HALF_LIFE", "COHORT_EARLY_FIRING", "COHORT_ALLOWED_LATENESS", "COHORT_ACCUMULATING", "COHORT_SNAPSHOT_INTERVAL", "COHORT_SNAPSHOT_PUSH_URL", "AUDIT_LOG", "AUDIT_PROMPTS",
+	"METRICS_FILE", "METRICS_INPUT_TOKEN_COST", "METRICS_OUTPUT_TOKEN_COST",
+}
+
+func clearConfigEnv(t *testing.T) {
+	for _, name := range configEnvVars {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+const testConfigFile = `
+project: file-project
+collection: assessments
+databases: [assessments-us]
+output:
+  path: out/insights.jsonl
+  flush_every: 100
+max_retries: 5
+retry_delay: 2s
+timeout: 45s
+llm:
+  provider: anthropic
+  model: claude-3-5-sonnet-20240620
+  temperature: 0.2
+  max_tokens: 4096
+rate_limit:
+  requests_per_second: 10
+  burst: 20
+`
+
+func TestLoadConfig(t *testing.T) {
+	clearConfigEnv(t)
+
+	cfg, err := loadConfig(writeConfigFile(t, testConfigFile))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+
+	expected := Config{
+		Project:    "file-project",
+		Collection: "assessments",
+		Databases:  []string{"assessments-us"},
+		Output:     OutputConfig{Path: "out/insights.jsonl", FlushEvery: 100, Window: time.Minute},
+		MaxRetries: 5,
+		RetryDelay: 2 * time.Second,
+		Timeout:    45 * time.Second,
+		LLM: llm.LLMConfig{
+			Provider:    llm.ProviderAnthropic,
+			Model:       "claude-3-5-sonnet-20240620",
+			Temperature: 0.2,
+			MaxTokens:   4096,
+		},
+		RateLimit: RateLimitConfig{RequestsPerSecond: 10, Burst: 20, Collection: "rate_limits", Database: "assessments-us", Shards: 8},
+	}
+	if diff := cmp.Diff(expected, cfg); diff != "" {
+		t.Errorf("loadConfig() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadConfig_EnvOverridesFile(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_DATABASES", "assessments-us, assessments-eu,,")
+	t.Setenv("MAX_RETRIES", "2")
+	t.Setenv("LLM_PROVIDER", "mistral")
+	t.Setenv("LLM_TOP_P", "0.9")
+	t.Setenv("PREFERRED_MODELS", "mistral-small-latest,mistral-large-latest")
+	t.Setenv("BENCHMARK_PROVIDERS", "gemini, anthropic")
+
+	cfg, err := loadConfig(writeConfigFile(t, testConfigFile))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+
+	if cfg.Project != "env-project" {
+		t.Errorf("Expected project from env, got %s", cfg.Project)
+	}
+	if diff := cmp.Diff([]string{"assessments-us", "assessments-eu"}, cfg.Databases); diff != "" {
+		t.Errorf("Databases mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"mistral-small-latest", "mistral-large-latest"}, cfg.PreferredModels); diff != "" {
+		t.Errorf("PreferredModels mismatch (-want +got):\n%s", diff)
+	}
+	benchmark := []BenchmarkProvider{{LLM: llm.LLMConfig{Provider: llm.ProviderGemini}}, {LLM: llm.LLMConfig{Provider: llm.ProviderAnthropic}}}
+	if diff := cmp.Diff(benchmark, cfg.Benchmark); diff != "" {
+		t.Errorf("Benchmark mismatch (-want +got):\n%s", diff)
+	}
+	if cfg.MaxRetries != 2 || cfg.LLM.Provider != llm.ProviderMistral || cfg.LLM.TopP != 0.9 {
+		t.Errorf("Expected env overrides to be applied, got %+v", cfg)
+	}
+	// Settings without env vars keep the file values
+	if cfg.Collection != "assessments" || cfg.LLM.Model != "claude-3-5-sonnet-20240620" {
+		t.Errorf("Expected file values to be kept, got %+v", cfg)
+	}
+}
+
+func TestLoadConfig_DefaultsWithoutFile(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+
+	// Run from an empty directory, without a config.yaml
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+
+	expected := defaultConfig()
+	expected.Project = "env-project"
+	expected.Collection = "assessments"
+	if diff := cmp.Diff(expected, cfg); diff != "" {
+		t.Errorf("loadConfig() mismatch (-want +got):\n%s", diff)
+	}
+
+	// An explicit config file must exist
+	if _, err := loadConfig("missing.yaml"); err == nil {
+		t.Errorf("Expected error for a missing config file, got nil")
+	}
+}
+
+func TestLoadConfig_ValidationErrors(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("OUTPUT_WINDOW", "soon")
+	t.Setenv("LLM_PROVIDER", "cohere")
+	t.Setenv("SAMPLE_RATE", "1.5")
+	t.Setenv("RETRY_JITTER", "-0.1")
+	t.Setenv("ERROR_RATE_BACKOFF", "-1")
+	t.Setenv("ASSESSMENT_WATCH", "true")
+	t.Setenv("DEDUPE_PROMPTS", "true")
+	t.Setenv("DEDUPE_SIMILARITY", "0.9")
+	t.Setenv("SMOKE_TEST", "true")
+	t.Setenv("VALIDATE_ASSESSMENTS", "true")
+	t.Setenv("CHECKPOINT_LOCATION", "gs://bucket/checkpoints")
+	t.Setenv("CHECKPOINT_FLUSH_EVERY", "-1")
+	t.Setenv("BENCHMARK_PROVIDERS", "gemini,cohere")
+	t.Setenv("RUN_MANIFEST", "manifest.json")
+	t.Setenv("RECITATION_POLICY", "ignore")
+	t.Setenv("MIN_AVG_LOGPROB", "0.5")
+	t.Setenv("TRUNCATION_STRATEGY", "start")
+	t.Setenv("OUTPUT_FORMAT", "avro")
+	t.Setenv("OUTPUT_LOCALE", "tlh")
+	t.Setenv("OUTPUT_SYNC_INTERVAL", "-1s")
+	t.Setenv("HISTORY_TABLE", "dataset.history")
+	t.Setenv("QUALITY_SCORER", "stars")
+	t.Setenv("ADAPTIVE_MAX_TOKENS_TRUNCATION_RATE", "1.5")
+	t.Setenv("HEALTH_GATE_FALLBACK_PROVIDER", "cohere")
+	t.Setenv("HEALTH_GATE_TIMEOUT", "-1s")
+	t.Setenv("RATE_LIMIT_SHARDS", "0")
+	t.Setenv("MAX_COST", "5")
+	t.Setenv("MAX_TRANSIENT_RETRIES", "-1")
+	t.Setenv("TRANSPORT_MAX_RETRIES", "-1")
+	t.Setenv("CACHE_NEGATIVE_TTL", "5m")
+	t.Setenv("COHORT_ALLOWED_LATENESS", "-1m")
+	t.Setenv("COHORT_SNAPSHOT_INTERVAL", "-30s")
+	t.Setenv("COHORT_SNAPSHOT_PUSH_URL", "pushgateway:9091")
+
+	// Invalid env values are all reported together
+	_, err := loadConfig(writeConfigFile(t, "max_retries: 0\n"))
+	if err == nil || !strings.Contains(err.Error(), "OUTPUT_WINDOW") {
+		t.Fatalf("Expected invalid OUTPUT_WINDOW error, got %v", err)
+	}
+
+	// Every missing field is listed in a single error
+	t.Setenv("OUTPUT_WINDOW", "1m")
+	_, err = loadConfig(writeConfigFile(t, "max_retries: 0\n"))
+	if err == nil {
+		t.Fatalf("Expected validation error, got nil")
+	}
+	for _, want := range []string{
+		"missing required config: project (GOOGLE_CLOUD_PROJECT), collection (ASSESSMENT_COLLECTION)",
+		"max_retries must be at least 1",
+		"max_validation_retries and max_transient_retries must not be negative",
+		"sample_rate must be between 0 and 1",
+		"retry_jitter must be between 0 and 1",
+		"error_rate_backoff must not be negative",
+		"dedupe_prompts is not supported with watch",
+		"dedupe_similarity is not supported with watch",
+		"smoke_test is not supported with watch",
+		"validate_assessments is not supported with watch",
+		"checkpoint is not supported with watch",
+		"checkpoint.flush_every must not be negative",
+		"checkpoint requires output.append, output.flush_every or output.firestore_collection",
+		"manifest is not supported with watch",
+		"benchmark is not supported with watch",
+		`unknown benchmark[1].llm.provider "cohere"`,
+		"min_avg_logprob must not be positive",
+		`unknown recitation "ignore"`,
+		`unknown truncation "start"`,
+		`unknown output.format "avro"`,
+		`unknown output.locale "tlh"`,
+		"output.sync_interval must not be negative",
+		`invalid history_table "dataset.history"`,
+		`unknown quality_scorer "stars"`,
+		"adaptive_max_tokens.truncation_rate must be between 0 and 1",
+		`unknown health_gate.fallback.provider "cohere"`,
+		"health_gate.timeout must not be negative",
+		"rate_limit.shards must be at least 1",
+		"max_cost requires the metrics token costs",
+		"transport_retries.max_retries and backoff must not be negative",
+		"cache_negative_ttl requires cache_responses",
+		"cohort.trigger.early_firing and allowed_lateness must not be negative",
+		"cohort.snapshot_interval must not be negative",
+		`invalid cohort.snapshot_push_url "pushgateway:9091"`,
+		`unknown llm.provider "cohere"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfig_Example(t *testing.T) {
+	clearConfigEnv(t)
+
+	if _, err := loadConfig("config.example.yaml"); err != nil {
+		t.Errorf("loadConfig() returned error for the example config: %v", err)
+	}
+}
+
+func TestLoadConfig_MinAvgLogprob(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("MIN_AVG_LOGPROB", "-0.5")
+
+	// Only Gemini reports the log probabilities the gate needs
+	if _, err := loadConfig(writeConfigFile(t, "llm:\n  provider: gemini\n")); err != nil {
+		t.Errorf("loadConfig() returned error with gemini: %v", err)
+	}
+	_, err := loadConfig(writeConfigFile(t, "llm:\n  provider: openai\n"))
+	if err == nil || !strings.Contains(err.Error(), "min_avg_logprob requires the gemini provider") {
+		t.Errorf("Expected min_avg_logprob provider error, got %v", err)
+	}
+}
+
+func TestLoadConfig_StructuredTools(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("STRUCTURED_TOOLS", "true")
+
+	cfg, err := loadConfig(writeConfigFile(t, "llm:\n  provider: anthropic\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error with anthropic: %v", err)
+	}
+	if !cfg.StructuredTools {
+		t.Errorf("Expected structured tools from STRUCTURED_TOOLS")
+	}
+
+	// Only Anthropic can be forced to call the insights tool, by the primary and fallback models alike
+	for _, content := range []string{
+		"llm:\n  provider: gemini\n",
+		"llm:\n  provider: anthropic\nhealth_gate:\n  fallback:\n    provider: mistral\n",
+	} {
+		_, err := loadConfig(writeConfigFile(t, content))
+		if err == nil || !strings.Contains(err.Error(), "structured_tools requires the anthropic provider") {
+			t.Errorf("Expected structured_tools provider error, got %v", err)
+		}
+	}
+}
+
+func TestLoadConfig_RetryPredicate(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	RegisterRetryPredicate("test-never", func(error, int) bool { return false })
+
+	cfg, err := loadConfig(writeConfigFile(t, "retry_predicate: test-never\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if cfg.RetryPredicate != "test-never" {
+		t.Errorf("Expected retry predicate test-never, got %q", cfg.RetryPredicate)
+	}
+
+	// Only registered predicates can be referenced
+	t.Setenv("RETRY_PREDICATE", "missing")
+	_, err = loadConfig(writeConfigFile(t, "retry_predicate: test-never\n"))
+	if err == nil || !strings.Contains(err.Error(), `unknown retry_predicate "missing"`) {
+		t.Errorf("Expected unknown retry predicate error, got %v", err)
+	}
+}
+
+func TestLoadConfig_PostProcessors(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+
+	cfg, err := loadConfig(writeConfigFile(t, "post_processors: [test-shout]\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"test-shout"}, cfg.PostProcessors); diff != "" {
+		t.Errorf("Post-processors mismatch (-want +got):\n%s", diff)
+	}
+
+	// Only registered post-processors can be referenced
+	t.Setenv("POST_PROCESSORS", "test-shout, missing")
+	_, err = loadConfig(writeConfigFile(t, "max_retries: 1\n"))
+	if err == nil || !strings.Contains(err.Error(), `unknown post_processors entry "missing"`) {
+		t.Errorf("Expected unknown post-processor error, got %v", err)
+	}
+}
+
+func TestLoadConfig_Chunking(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("CHUNK_OVERLAP", "200")
+
+	cfg, err := loadConfig(writeConfigFile(t, "chunk_size: 4000\nchunk_overlap: 100\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if cfg.ChunkSize != 4000 || cfg.ChunkOverlap != 200 {
+		t.Errorf("Expected chunks of 4000 overlapping by 200, got %d and %d", cfg.ChunkSize, cfg.ChunkOverlap)
+	}
+
+	// The overlap repeats part of the previous chunk, so it must be shorter than a chunk
+	_, err = loadConfig(writeConfigFile(t, "chunk_size: 200\n"))
+	if err == nil || !strings.Contains(err.Error(), "chunk_overlap must be smaller than chunk_size") {
+		t.Errorf("Expected chunk_overlap error, got %v", err)
+	}
+}
+
+func TestLoadConfig_ExtractionFlags(t *testing.T) {
+	tests := []struct {
+		env   string
+		key   string
+		value func(Config) bool
+	}{
+		{env: "CACHE_SCHEMA", key: "cache_schema", value: func(cfg Config) bool { return cfg.CacheSchema }},
+		{env: "EMIT_DEGRADED", key: "emit_degraded", value: func(cfg Config) bool { return cfg.EmitDegraded }},
+		{env: "DEFER_FAILURES", key: "defer_failures", value: func(cfg Config) bool { return cfg.DeferFailures }},
+		{env: "RETRY_ON_EMPTY_RESPONSE", key: "retry_on_empty_response", value: func(cfg Config) bool { return cfg.RetryOnEmptyResponse }},
+		{env: "RECORD_RESPONSE_META", key: "record_response_meta", value: func(cfg Config) bool { return cfg.RecordResponseMeta }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			clearConfigEnv(t)
+			t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+			t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+
+			cfg, err := loadConfig(writeConfigFile(t, tt.key+": true\n"))
+			if err != nil {
+				t.Fatalf("loadConfig() returned error: %v", err)
+			}
+			if !tt.value(cfg) {
+				t.Errorf("Expected %s from the file", tt.key)
+			}
+
+			// The env var overrides the file
+			t.Setenv(tt.env, "false")
+			if cfg, err = loadConfig(writeConfigFile(t, tt.key+": true\n")); err != nil {
+				t.Fatalf("loadConfig() returned error: %v", err)
+			}
+			if tt.value(cfg) {
+				t.Errorf("Expected %s overridden by %s", tt.key, tt.env)
+			}
+
+			t.Setenv(tt.env, "maybe")
+			if _, err := loadConfig(writeConfigFile(t, "")); err == nil || !strings.Contains(err.Error(), "invalid "+tt.env+" value") {
+				t.Errorf("Expected invalid %s error, got %v", tt.env, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_CohortHalfLife(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+
+	// Unset, the aggregate isn't written
+	cfg, err := loadConfig(writeConfigFile(t, "max_retries: 1\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if cfg.Cohort.HalfLife != nil {
+		t.Errorf("Expected no cohort half-life, got %v", *cfg.Cohort.HalfLife)
+	}
+
+	// 0 writes it without decay
+	cfg, err = loadConfig(writeConfigFile(t, "cohort:\n  half_life: 0s\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if cfg.Cohort.HalfLife == nil || *cfg.Cohort.HalfLife != 0 {
+		t.Errorf("Expected a cohort half-life of 0, got %v", cfg.Cohort.HalfLife)
+	}
+
+	// The env var overrides the file, or sets the half-life on its own
+	t.Setenv("COHORT_HALF_LIFE", "720h")
+	for _, content := range []string{"cohort:\n  half_life: 24h\n", "max_retries: 1\n"} {
+		cfg, err := loadConfig(writeConfigFile(t, content))
+		if err != nil {
+			t.Fatalf("loadConfig() returned error: %v", err)
+		}
+		if cfg.Cohort.HalfLife == nil || *cfg.Cohort.HalfLife != 720*time.Hour {
+			t.Errorf("Expected a cohort half-life of 720h, got %v", cfg.Cohort.HalfLife)
+		}
+	}
+
+	t.Setenv("COHORT_HALF_LIFE", "-1h")
+	_, err = loadConfig(writeConfigFile(t, "max_retries: 1\n"))
+	if err == nil || !strings.Contains(err.Error(), "cohort.half_life must not be negative") {
+		t.Errorf("Expected cohort.half_life error, got %v", err)
+	}
+}
+
+func TestLoadConfig_CohortTrigger(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+
+	// Unset, the aggregate fires once
+	cfg, err := loadConfig(writeConfigFile(t, "max_retries: 1\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if cfg.Cohort.Trigger != nil {
+		t.Errorf("Expected no cohort trigger, got %+v", *cfg.Cohort.Trigger)
+	}
+
+	// The env vars override the file, or set the trigger on their own
+	t.Setenv("COHORT_ACCUMULATING", "true")
+	for content, want := range map[string]GlobalWindowTrigger{
+		"cohort:\n  trigger:\n    early_firing: 1m\n    allowed_lateness: 10m\n": {EarlyFiring: time.Minute, AllowedLateness: 10 * time.Minute, Accumulating: true},
+		"max_retries: 1\n": {Accumulating: true},
+	} {
+		cfg, err := loadConfig(writeConfigFile(t, content))
+		if err != nil {
+			t.Fatalf("loadConfig() returned error: %v", err)
+		}
+		if cfg.Cohort.Trigger == nil || *cfg.Cohort.Trigger != want {
+			t.Errorf("Expected cohort trigger %+v, got %+v", want, cfg.Cohort.Trigger)
+		}
+	}
+}
+
+func TestLoadConfig_CohortSnapshots(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("COHORT_SNAPSHOT_PUSH_URL", "http://pushgateway:9091/metrics/job/assessment_pipeline")
+
+	// The snapshots are only pushed while they are taken
+	_, err := loadConfig(writeConfigFile(t, "max_retries: 1\n"))
+	if err == nil || !strings.Contains(err.Error(), "cohort.snapshot_push_url requires cohort.snapshot_interval") {
+		t.Errorf("Expected snapshot interval error, got %v", err)
+	}
+
+	t.Setenv("COHORT_SNAPSHOT_INTERVAL", "30s")
+	cfg, err := loadConfig(writeConfigFile(t, "cohort:\n  snapshot_interval: 1m\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if cfg.Cohort.SnapshotInterval != 30*time.Second || cfg.Cohort.SnapshotPushURL != "http://pushgateway:9091/metrics/job/assessment_pipeline" {
+		t.Errorf("Expected the env snapshot settings, got %v and %q", cfg.Cohort.SnapshotInterval, cfg.Cohort.SnapshotPushURL)
+	}
+}
+
+func TestLoadConfig_CheckpointDatabase(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("CHECKPOINT_LOCATION", "firestore://checkpoints")
+	t.Setenv("OUTPUT_APPEND", "true")
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "Single database", content: "databases: [assessments-eu]\n", want: "assessments-eu"},
+		{name: "Several databases", content: "databases: [assessments-eu, assessments-us]\n", want: ""},
+		{name: "Explicit database", content: "databases: [assessments-eu]\ncheckpoint:\n  database: checkpoints\n", want: "checkpoints"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(writeConfigFile(t, tt.content))
+			if err != nil {
+				t.Fatalf("loadConfig() returned error: %v", err)
+			}
+			if cfg.Checkpoint.Database != tt.want {
+				t.Errorf("Expected checkpoint database %q, got %q", tt.want, cfg.Checkpoint.Database)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_RateLimitDatabase(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("RATE_LIMIT_RPS", "10")
+
+	tests := []struct {
+		name    string
+		content string
+		env     string
+		want    string
+	}{
+		{name: "Single database", content: "databases: [assessments-eu]\n", want: "assessments-eu"},
+		{name: "Several databases", content: "databases: [assessments-eu, assessments-us]\n", want: ""},
+		{name: "Explicit database", content: "databases: [assessments-eu]\nrate_limit:\n  database: limits\n", want: "limits"},
+		{name: "Env database", content: "databases: [assessments-eu]\n", env: "limits", want: "limits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("RATE_LIMIT_DATABASE", tt.env)
+			}
+			cfg, err := loadConfig(writeConfigFile(t, tt.content))
+			if err != nil {
+				t.Fatalf("loadConfig() returned error: %v", err)
+			}
+			if cfg.RateLimit.Database != tt.want {
+				t.Errorf("Expected rate limit database %q, got %q", tt.want, cfg.RateLimit.Database)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Watch(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+	t.Setenv("ASSESSMENT_COLLECTION", "assessments")
+	t.Setenv("ASSESSMENT_WATCH", "true")
+
+	// A streaming job needs an output written as it goes
+	_, err := loadConfig(writeConfigFile(t, "output:\n  path: processed.jsonl\n"))
+	if err == nil || !strings.Contains(err.Error(), "watch requires output.flush_every, output.partitioned, output.append or output.format proto") {
+		t.Fatalf("Expected watch output error, got %v", err)
+	}
+
+	cfg, err := loadConfig(writeConfigFile(t, "output:\n  path: processed.jsonl\n  flush_every: 100\n"))
+	if err != nil {
+		t.Fatalf("loadConfig() returned error: %v", err)
+	}
+	if !cfg.Watch {
+		t.Errorf("Expected watch from ASSESSMENT_WATCH")
+	}
+
+	// Appending to a local file suits a streaming job too
+	t.Setenv("OUTPUT_APPEND", "true")
+	if _, err := loadConfig(writeConfigFile(t, "output:\n  path: processed.jsonl\n")); err != nil {
+		t.Errorf("loadConfig() returned error with output.append: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// errCostBudgetExhausted is returned when the estimated cost of the model calls already
+// reached MaxCost. It is a budget exhaustion, so the assessments are skipped the same way.
+var errCostBudgetExhausted = fmt.Errorf("%w: estimated cost over the budget", errBudgetExhausted)
+
+// totalCost accumulates the estimated cost of the model calls made by every ExtractInsights
+// of the worker, for MaxCost, like totalCalls.
+var totalCost costAccumulator
+
+// costAccumulator is a cumulative cost, safe for concurrent use.
+type costAccumulator struct {
+	mu   sync.Mutex
+	cost float64
+}
+
+func (c *costAccumulator) add(cost float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cost += cost
+}
+
+func (c *costAccumulator) load() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cost
+}
+
+func (c *costAccumulator) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cost = 0
+}
+
+/*
+WithCostBudgetEnforcement caps the estimated cost of the model calls of the worker at maxCost:
+once the cumulative cost, computed from the token counts with the prices of the metrics config,
+reaches it, no more calls are made and the remaining assessments are emitted to the skipped
+output, as with MaxTotalCalls. Costs are only known once a call returns, so the last call may
+go over the budget. A maxCost of 0 disables the cap.
+*/
+func (ei *ExtractInsights) WithCostBudgetEnforcement(maxCost float64) *ExtractInsights {
+	ei.MaxCost = maxCost
+	return ei
+}
+
+// costExhausted reports whether the MaxCost budget is already spent.
+func (ei *ExtractInsights) costExhausted() bool {
+	return ei.MaxCost > 0 && totalCost.load() >= ei.MaxCost
+}
+
+// recordCost adds the estimated cost of a model call to the worker's total.
+func (ei *ExtractInsights) recordCost(meta llm.ResponseMeta) {
+	cost := (float64(meta.InputTokens)*ei.Metrics.InputTokenCost + float64(meta.OutputTokens)*ei.Metrics.OutputTokenCost) / 1e6
+	if cost > 0 {
+		totalCost.add(cost)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExtractInsights_WithCostBudgetEnforcement(t *testing.T) {
+	totalCost.reset()
+	t.Cleanup(totalCost.reset)
+
+	mockLLM := new(MockMetadataLanguageModel)
+	ei := (&ExtractInsights{
+		model:      mockLLM,
+		MaxRetries: 1,
+		// $1 per million input tokens, $4 per million output tokens
+		Metrics: MetricsConfig{InputTokenCost: 1, OutputTokenCost: 4},
+	}).WithCostBudgetEnforcement(0.01)
+
+	promptContains := func(result string) interface{} {
+		return mock.MatchedBy(func(prompt string) bool { return strings.Contains(prompt, "\n"+result+"\n") })
+	}
+
+	// Each call costs $0.006: the second one goes over the budget, so no third call is made
+	meta := llm.ResponseMeta{InputTokens: 2000, OutputTokens: 1000}
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, promptContains("first"), mock.Anything).
+		Return(`{"overall_assessment": "First"}`, meta, nil).Once()
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, promptContains("second"), mock.Anything).
+		Return(`{"overall_assessment": "Second"}`, meta, nil).Once()
+
+	var (
+		results []InsightsResult
+		skipped []Assessment
+	)
+	emit := func(insights InsightsResult) { results = append(results, insights) }
+	skip := func(assessment Assessment) { skipped = append(skipped, assessment) }
+
+	for _, result := range []string{"first", "second", "third", "fourth"} {
+		ei.ProcessElement(context.Background(), Assessment{Result: result}, noRubric, emit, skip, noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "First"}, {OverallAssessment: "Second"}}, results)
+	budget := newFailure(errCostBudgetExhausted)
+	assert.Equal(t, []Assessment{{Result: "third", Failure: budget}, {Result: "fourth", Failure: budget}}, skipped)
+	assert.InDelta(t, 0.012, totalCost.load(), 1e-9)
+	mockLLM.AssertExpectations(t)
+}
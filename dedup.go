@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	RegisterKeyExtractor("prompt", promptKey)
+	register.Function3x0(firstAssessment)
+	register.Function1x2(insightsPromptKey)
+	register.Function4x0(fanOutInsights)
+	register.Function1x2(assessmentPromptKey)
+	register.Function4x0(fanOutDeadLetters)
+	register.Iter1[Assessment]()
+	register.Iter1[InsightsResult]()
+	register.Emitter1[InsightsResult]()
+	register.Emitter1[Assessment]()
+}
+
+// promptKey is the key extractor registered as "prompt": the SHA-256 of what the prompt of
+// the assessment is built from, its result and preferred model, so assessments sharing a key
+// get the same model call within a run.
+func promptKey(assessment Assessment) string {
+	sum := sha256.Sum256([]byte(assessment.Result + "\x00" + assessment.PreferredModel))
+	return hex.EncodeToString(sum[:])
+}
+
+// firstAssessment emits the first assessment of a group of identical ones, whose insights
+// are extracted on behalf of the whole group.
+func firstAssessment(_ string, assessments func(*Assessment) bool, emit func(Assessment)) {
+	var assessment Assessment
+	if assessments(&assessment) {
+		emit(assessment)
+	}
+}
+
+// insightsPromptKey keys the insights with the prompt key of their assessment.
+func insightsPromptKey(insights InsightsResult) (string, InsightsResult) {
+	return insights.PromptKey, insights
+}
+
+// fanOutInsights emits the insights extracted for a group of identical assessments once per
+// assessment of the group, each one with its completion time and ID. Nothing is emitted for the
+// groups left without insights, e.g. refused, whose dead letters fanOutDeadLetters fans out.
+func fanOutInsights(_ string, insights func(*InsightsResult) bool, assessments func(*Assessment) bool, emit func(InsightsResult)) {
+	var extracted InsightsResult
+	if !insights(&extracted) {
+		return
+	}
+	extracted.PromptKey = ""
+
+	var assessment Assessment
+	for assessments(&assessment) {
+		out := extracted
+		out.CompletedAt = assessment.CompletedAt
+		out.AssessmentID = assessment.ID
+		out.Database = assessment.Database
+		emit(out)
+	}
+}
+
+// assessmentPromptKey keys the dead-lettered assessment with its prompt key, which, like the
+// insights it failed to get, is the key of its group.
+func assessmentPromptKey(assessment Assessment) (string, Assessment) {
+	return promptKey(assessment), assessment
+}
+
+// fanOutDeadLetters emits the dead letter of the representative of a group (skipped, refused or
+// recited) once per assessment of the group, each one with the failure of the representative.
+// Nothing is emitted for the groups whose representative wasn't dead-lettered.
+func fanOutDeadLetters(_ string, deadLetters func(*Assessment) bool, assessments func(*Assessment) bool, emit func(Assessment)) {
+	var deadLetter Assessment
+	if !deadLetters(&deadLetter) {
+		return
+	}
+
+	var assessment Assessment
+	for assessments(&assessment) {
+		out := assessment
+		out.Failure = deadLetter.Failure
+		emit(out)
+	}
+}
+
+/*
+dedupeAssessments groups the textually identical assessments of the run (e.g. template
+answers) by prompt key with a GroupByKey, returning one representative assessment per group
+and the keyed assessments, from which fanOutDeduplicated fans the insights back out.
+*/
+func dedupeAssessments(scope beam.Scope, assessments beam.PCollection) (representatives, keyed beam.PCollection) {
+	scope = scope.Scope("DedupeAssessments")
+	keyed = keyAssessments(scope, "prompt", assessments)
+	return beam.ParDo(scope, firstAssessment, beam.GroupByKey(scope, keyed)), keyed
+}
+
+// fanOutDeduplicated joins the insights of the representative assessments, tagged with their
+// PromptKey, back to every assessment of their group.
+func fanOutDeduplicated(scope beam.Scope, keyed, insights beam.PCollection) beam.PCollection {
+	scope = scope.Scope("FanOutInsights")
+	keyedInsights := beam.ParDo(scope, insightsPromptKey, insights)
+	return beam.ParDo(scope, fanOutInsights, beam.CoGroupByKey(scope, keyedInsights, keyed))
+}
+
+// fanOutDeduplicatedDeadLetters joins the dead letters of the representative assessments back to
+// every assessment of their group, so none of the duplicates goes missing from the dead letters.
+func fanOutDeduplicatedDeadLetters(scope beam.Scope, keyed, deadLetters beam.PCollection) beam.PCollection {
+	scope = scope.Scope("FanOutDeadLetters")
+	keyedDeadLetters := beam.ParDo(scope, assessmentPromptKey, deadLetters)
+	return beam.ParDo(scope, fanOutDeadLetters, beam.CoGroupByKey(scope, keyedDeadLetters, keyed))
+}
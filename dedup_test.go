@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// iterate returns an iterator over the values, as passed to DoFns after a GroupByKey.
+func iterate[T any](values ...T) func(*T) bool {
+	return func(value *T) bool {
+		if len(values) == 0 {
+			return false
+		}
+		*value, values = values[0], values[1:]
+		return true
+	}
+}
+
+func TestDedupePrompts(t *testing.T) {
+	base := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	identical := []Assessment{
+		{Result: "Template answer: 7 of 10 correct.", CompletedAt: base},
+		{Result: "Template answer: 7 of 10 correct.", CompletedAt: base.Add(time.Hour)},
+		{Result: "Template answer: 7 of 10 correct.", CompletedAt: base.Add(2 * time.Hour)},
+	}
+	preferred := Assessment{Result: "Template answer: 7 of 10 correct.", PreferredModel: "gemini-1.5-flash-002"}
+
+	// The preferred model is part of the key, the completion time isn't
+	key := promptKey(identical[0])
+	for _, assessment := range identical[1:] {
+		assert.Equal(t, key, promptKey(assessment))
+	}
+	assert.NotEqual(t, key, promptKey(preferred))
+
+	// A single representative of the group is extracted, with a single model call
+	var representatives []Assessment
+	firstAssessment(key, iterate(identical...), func(assessment Assessment) {
+		representatives = append(representatives, assessment)
+	})
+	assert.Equal(t, []Assessment{identical[0]}, representatives)
+
+	mockLLM := new(MockLanguageModel)
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 1, RetryDelay: time.Millisecond, DedupePrompts: true}
+
+	var extracted []InsightsResult
+	ei.ProcessElement(context.Background(), representatives[0], noRubric, func(insights InsightsResult) {
+		extracted = append(extracted, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	mockLLM.AssertExpectations(t)
+	if !assert.Len(t, extracted, 1) {
+		return
+	}
+	promptKey, _ := insightsPromptKey(extracted[0])
+	assert.Equal(t, key, promptKey)
+
+	// The call serves every assessment of the group
+	var results []InsightsResult
+	fanOutInsights(key, iterate(extracted...), iterate(identical...), func(insights InsightsResult) {
+		results = append(results, insights)
+	})
+	if assert.Len(t, results, 3) {
+		for i, insights := range results {
+			assert.Equal(t, "Good performance", insights.OverallAssessment)
+			assert.Equal(t, identical[i].CompletedAt, insights.CompletedAt)
+			assert.Empty(t, insights.PromptKey)
+		}
+	}
+
+	// Groups left without insights emit nothing
+	fanOutInsights(key, iterate[InsightsResult](), iterate(identical...), func(InsightsResult) {
+		t.Errorf("Expected no insights for a group without insights")
+	})
+
+	// A refused representative dead-letters every assessment of its group, with its failure
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", fmt.Errorf("%w: blocked for safety", llm.ErrRefused)).Once()
+	var refused []Assessment
+	ei.ProcessElement(context.Background(), representatives[0], noRubric, func(InsightsResult) {
+		t.Errorf("Expected no insights for a refused assessment")
+	}, noSkipped(t), func(assessment Assessment) {
+		refused = append(refused, assessment)
+	}, noRecited(t), noEvals(t), noRaw(t))
+	if !assert.Len(t, refused, 1) {
+		return
+	}
+	deadLetterKey, _ := assessmentPromptKey(refused[0])
+	assert.Equal(t, key, deadLetterKey)
+	var deadLetters []Assessment
+	fanOutDeadLetters(key, iterate(refused...), iterate(identical...), func(assessment Assessment) {
+		deadLetters = append(deadLetters, assessment)
+	})
+	if assert.Len(t, deadLetters, 3) {
+		for i, assessment := range deadLetters {
+			assert.Equal(t, identical[i].CompletedAt, assessment.CompletedAt)
+			assert.Equal(t, refused[0].Failure, assessment.Failure)
+		}
+	}
+
+	// Groups whose representative wasn't dead-lettered emit no dead letters
+	fanOutDeadLetters(key, iterate[Assessment](), iterate(identical...), func(Assessment) {
+		t.Errorf("Expected no dead letters for a group with insights")
+	})
+
+	// The deduplication is wired into the pipeline
+	_, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, identical[0], identical[1])
+	assert.NotPanics(t, func() { transformData(scope, Config{MaxRetries: 1, DedupePrompts: true}, assessments, "") })
+}
@@ -0,0 +1,66 @@
+package main
+
+import "sync"
+
+// errorRateWindow is the number of most recent model calls the error rate of a provider is computed over.
+const errorRateWindow = 100
+
+// errorRate is the rolling error rate of the model calls to a provider, over the last
+// errorRateWindow calls of the worker.
+type errorRate struct {
+	mu       sync.Mutex
+	outcomes [errorRateWindow]bool
+	calls    int
+	next     int
+	failures int
+}
+
+// record records the outcome of a model call, evicting the oldest one once the window is full.
+func (r *errorRate) record(failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.calls == errorRateWindow {
+		if r.outcomes[r.next] {
+			r.failures--
+		}
+	} else {
+		r.calls++
+	}
+	r.outcomes[r.next] = failed
+	if failed {
+		r.failures++
+	}
+	r.next = (r.next + 1) % errorRateWindow
+}
+
+// rate returns the fraction of the recorded calls that failed, 0 before any call.
+func (r *errorRate) rate() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.calls == 0 {
+		return 0
+	}
+	return float64(r.failures) / float64(r.calls)
+}
+
+// providerErrorRates holds the error rate of every provider called by the worker, shared by
+// its ExtractInsights like workerMetrics.
+var providerErrorRates = struct {
+	sync.Mutex
+	rates map[string]*errorRate
+}{rates: make(map[string]*errorRate)}
+
+// providerErrorRate returns the error rate of the provider, created on first use.
+func providerErrorRate(provider string) *errorRate {
+	providerErrorRates.Lock()
+	defer providerErrorRates.Unlock()
+
+	rate, ok := providerErrorRates.rates[provider]
+	if !ok {
+		rate = &errorRate{}
+		providerErrorRates.rates[provider] = rate
+	}
+	return rate
+}
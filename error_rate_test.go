@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestErrorRate(t *testing.T) {
+	var rate errorRate
+	assert.Equal(t, 0.0, rate.rate())
+
+	rate.record(true)
+	rate.record(false)
+	assert.Equal(t, 0.5, rate.rate())
+
+	// Only the last errorRateWindow calls count
+	for i := 0; i < errorRateWindow; i++ {
+		rate.record(i%4 == 0)
+	}
+	assert.Equal(t, 0.25, rate.rate())
+	for i := 0; i < errorRateWindow; i++ {
+		rate.record(false)
+	}
+	assert.Equal(t, 0.0, rate.rate())
+}
+
+func TestExtractInsights_ErrorRateBackoff(t *testing.T) {
+	const provider = "test-error-rate"
+	t.Cleanup(func() {
+		providerErrorRates.Lock()
+		delete(providerErrorRates.rates, provider)
+		providerErrorRates.Unlock()
+	})
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:            mockLLM,
+		LLM:              llm.LLMConfig{Provider: provider},
+		MaxRetries:       2,
+		RetryDelay:       time.Millisecond,
+		ErrorRateBackoff: 3,
+	}
+
+	// A healthy provider is retried after RetryDelay
+	assert.Equal(t, time.Millisecond, ei.retryDelay())
+
+	// Failing calls drive the error rate up, and the backoff with it
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", errors.New("service unavailable")).Twice()
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(InsightsResult) {}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	mockLLM.AssertExpectations(t)
+	assert.Equal(t, 1.0, providerErrorRate(provider).rate())
+	assert.Equal(t, 4*time.Millisecond, ei.retryDelay())
+
+	// Successful calls bring it back down
+	ei.recordCall(context.Background(), llm.ResponseMeta{Reason: llm.FinishReasonStop}, nil)
+	ei.recordCall(context.Background(), llm.ResponseMeta{Reason: llm.FinishReasonStop}, nil)
+	assert.Equal(t, 0.5, providerErrorRate(provider).rate())
+	assert.Equal(t, 2500*time.Microsecond, ei.retryDelay())
+
+	// Truncated responses aren't provider failures, responses stopped by a provider error are
+	ei.recordCall(context.Background(), llm.ResponseMeta{Reason: llm.FinishReasonLength}, llm.ErrTruncated)
+	assert.Equal(t, 0.4, providerErrorRate(provider).rate())
+	ei.recordCall(context.Background(), llm.ResponseMeta{Reason: llm.FinishReasonTransient}, nil)
+	assert.Equal(t, 0.5, providerErrorRate(provider).rate())
+}
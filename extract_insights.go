@@ -3,14 +3,23 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"math/rand"
 	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"cloud.google.com/go/firestore"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/google/generative-ai-go/genai"
 	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 // ExtractInsights is a DoFn that extracts insights from user's performance.
@@ -19,8 +28,289 @@ type ExtractInsights struct {
 	InsightsSchema string
 	MaxRetries     int
 	RetryDelay     time.Duration
+	// MaxValidationRetries and MaxTransientRetries bound, independently, the retries of the
+	// attempts failing schema validation (see WithRetryOnSchemaValidationFailure) and of the
+	// ones failing transiently, e.g. on network errors, within the MaxRetries attempts.
+	// 0 leaves them bounded by MaxRetries only.
+	MaxValidationRetries int
+	MaxTransientRetries  int
+	// RetryJitter randomizes each delay between attempts by up to this fraction of RetryDelay,
+	// either way, so workers failing together don't retry in lockstep. 0 disables the jitter.
+	// It is drawn from a shared source, unless WithRetryJitterSeed sets a seeded one.
+	RetryJitter float64
+	jitterRand  *rand.Rand
+	// ErrorRateBackoff adapts the retries to the health of the provider: the delay between
+	// attempts is scaled by 1 + ErrorRateBackoff × the rolling error rate of the provider's
+	// recent calls on the worker, so a degraded provider is backed off harder. 0 disables it.
+	ErrorRateBackoff float64
+	// CacheSchema caches the insights schema server-side when the model supports it,
+	// falling back to sending the schema inline otherwise.
+	CacheSchema  bool
+	cachedSchema string
+	// CacheResponses answers the calls repeating a previous one of the worker from the shared
+	// responseCache. Cache keys embed the fingerprint of InsightsSchema, so responses cached
+	// for another schema are missed rather than parsed against the wrong one.
+	CacheResponses bool
+	// CacheNegativeTTL also caches the deterministic failures of the calls with CacheResponses,
+	// for this long, see llm.WithResponseCacheNegativeCaching. 0 disables it.
+	CacheNegativeTTL time.Duration
+	// StructuredTools forces the model to answer through a tool whose input schema is the
+	// insights schema, instead of asking for JSON in the prompt. Requires an Anthropic model.
+	// The tool input is validated against the schema before it is parsed.
+	StructuredTools bool
+	insightsTool    *llm.GenericTool
+	toolSchema      *jsonschema.Schema
+	// GeminiResponseSchema constrains the responses of the Gemini models to the schema derived
+	// from InsightsResult, see WithGeminiResponseSchemaFromInsightsResult.
+	GeminiResponseSchema bool
+	responseSchema       *genai.Schema
+	// EmitDegraded emits a minimal InsightsResult flagged as Degraded, holding whatever
+	// could be parsed from the last response, when all retries fail.
+	EmitDegraded bool
+	// DeferFailures buffers assessments that failed all retries and retries them
+	// once more in FinishBundle, giving transient provider errors time to clear.
+	DeferFailures bool
+	deferred      []Assessment
+	// Prioritize processes the high-priority assessments of a bundle first: the other ones are
+	// buffered as they arrive and processed in FinishBundle, once every high-priority one is done.
+	Prioritize bool
+	pending    []Assessment
+	// RetryPredicateName names the retry predicate, registered with RegisterRetryPredicate, that
+	// decides for each failed attempt whether it is retried, overriding the default classification
+	// under which every error but a refusal is retried. Truncated and empty responses keep their
+	// handling when retried. Functions can't be encoded with the DoFn, so the predicate is
+	// resolved into retryPredicate in Setup.
+	RetryPredicateName string
+	retryPredicate     RetryPredicate
+	// RepairFields asks the model to correct only the invalid field of a response that is
+	// otherwise valid JSON, e.g. questions_answered_correctly as a string, rather than retrying
+	// the whole extraction. The response is used once the corrected field is merged in, if it
+	// is valid then, otherwise the attempt fails as before.
+	RepairFields bool
+	// RetryOnEmptyResponse retries empty responses, which are transient, without using
+	// up one of the MaxRetries attempts. Up to MaxRetries empty responses are retried.
+	RetryOnEmptyResponse bool
+	// ChunkSize splits assessments longer than ChunkSize characters into chunks, whose partial
+	// insights are extracted separately and merged. ChunkOverlap characters are repeated at the
+	// start of each chunk so answers cut at a boundary keep their context; they are marked as
+	// context in the prompt, so their answers are only counted once. 0 disables chunking.
+	ChunkSize    int
+	ChunkOverlap int
+	// MaxAssessmentChars truncates the assessments (or chunks) longer than MaxAssessmentChars
+	// characters before they are put in the prompt, keeping the part selected by Truncation
+	// (TruncateMiddle by default). 0 disables truncation.
+	MaxAssessmentChars int
+	Truncation         TruncationStrategy
+	// LLM selects the provider and generation parameters of the model created in Setup.
+	LLM       llm.LLMConfig
+	maxTokens int
+	// AdaptiveMaxTokens raises the maximum number of tokens of the calls, up to its ceiling, as
+	// the worker observes truncated responses, see WithAdaptiveMaxTokens.
+	AdaptiveMaxTokens AdaptiveMaxTokensConfig
+	// PreferredModels are the models, of the LLM provider, assessments may select with their
+	// preferred_model field. They are created in Setup alongside the configured model, which
+	// is used for the assessments naming no model or one missing from PreferredModels.
+	PreferredModels []string
+	models          map[string]llm.LanguageModel
+	// Timeout bounds each model call, defaultTimeout when unset.
+	Timeout time.Duration
+	// PostProcessorNames names the post-processors, registered with RegisterPostProcessor, that
+	// transform the parsed insights in order, before they are validated. Functions can't be
+	// encoded with the DoFn, so the chain is resolved into postProcessors in Setup.
+	PostProcessorNames []string
+	postProcessors     []PostProcessor
+	// RecordResponseMeta attaches the model version and finish reason of the response
+	// to the emitted insights, when the model reports them.
+	RecordResponseMeta bool
+	// RateLimit bounds the model calls of all the workers together, through token buckets
+	// shared in the RateLimit.Database Firestore database of Project.
+	RateLimit       RateLimitConfig
+	Project         string
+	rateLimitClient *firestore.Client
+	// Audit records every model interaction to a JSON Lines audit log.
+	Audit     AuditConfig
+	auditSink *llm.JSONLAuditSink
+	// MaxTotalCalls caps the model calls made by all the ExtractInsights of a worker together,
+	// retries included. Once the budget is spent, the remaining assessments are skipped and
+	// emitted to the skipped output instead. 0 disables the cap.
+	MaxTotalCalls int64
+	// MaxCost caps the estimated cost of the model calls of a worker, see WithCostBudgetEnforcement.
+	MaxCost float64
+	// TransportRetries retries the failed HTTP requests of the model calls, see WithTransportRetries.
+	TransportRetries TransportRetriesConfig
+	// PromptCompressorName names the prompt compressor, registered with RegisterPromptCompressor,
+	// that shrinks the prompt before it is sent, e.g. with stopword removal or an LLM-based
+	// compressor. It is resolved into promptCompressor in Setup. None when empty.
+	PromptCompressorName string
+	promptCompressor     PromptCompressor
+	// QualityScorerName names the quality scorer, registered with RegisterQualityScorer, that
+	// scores the quality of the insights, set as their QualityScore, degraded ones included. It
+	// is resolved into qualityScorer in Setup, the heuristic one when unset. Insights aren't
+	// scored without a scorer.
+	QualityScorerName string
+	qualityScorer     QualityScorer
+	// Recitation is what happens to the assessments whose response is blocked for reproducing
+	// training data verbatim: refused (the default), emitted to the recited output, or rephrased
+	// and retried once (Gemini only).
+	Recitation RecitationPolicy
+	// Eval emits an EvalRecord of every model call, with the exact prompt sent and the raw
+	// response, to the eval output for prompt-engineering experiments. It is disabled by
+	// default, as the records hold the assessments and responses in clear.
+	Eval  bool
+	evals []EvalRecord
+	// RawFailures emits an EvalRecord, flagged Unparseable, of every response that failed to
+	// parse as JSON insights to the eval output, eval mode or not, to be repaired by hand.
+	// They share the eval output as Beam limits FinishBundle to 7 parameters.
+	RawFailures bool
+	// MinAvgLogprob rejects, and retries, the responses whose average log probability is
+	// below it, for the models reporting it (Gemini, see llm.WithGeminiAvgLogprobs). Log
+	// probabilities are negative, 0 disables the gate.
+	MinAvgLogprob float64
+	// rubric is the official rubric read from the rubric side input, referenced by every prompt.
+	rubric     string
+	rubricRead bool
+	// DedupePrompts tags the insights with the PromptKey of their assessment, so the insights
+	// of a deduplicated assessment can be fanned out to its identical ones (see dedupeAssessments).
+	DedupePrompts bool
+	// EmitRaw emits the insights as parsed from the response, before the post-processors, to
+	// the raw output, alongside the normalized insights, for auditability. Disabled by default.
+	EmitRaw bool
+	raw     InsightsResult
+	// HistoryTable enriches the prompts with a summary of the user's past assessments, looked up
+	// in this BigQuery table of past insights (as project.dataset.table) once per user and
+	// worker, see WithContextEnrichmentFromBigQuery. Empty disables the enrichment.
+	HistoryTable  string
+	historyClient userHistoryClient
+	histories     map[string]string
+	// Metrics writes the counters of the worker (processed, failed, retries, tokens and cost)
+	// to an OpenMetrics text file at the end of every bundle.
+	Metrics MetricsConfig
+	// HealthGate switches the bundles to a fallback model while the provider is unhealthy, see
+	// WithProviderHealthGate. The bundles flagged onFallback are processed with fallback, and the
+	// schema cached for it in fallbackSchema, the provider being probed with healthProbe, its
+	// model without the response cache.
+	HealthGate     HealthGateConfig
+	healthProbe    llm.LanguageModel
+	fallback       llm.LanguageModel
+	fallbackSchema string
+	onFallback     bool
 }
 
+// RecitationPolicy selects how responses blocked for recitation are handled.
+type RecitationPolicy string
+
+const (
+	// RecitationRefuse emits the assessment to the refused output, like other blocked responses.
+	RecitationRefuse RecitationPolicy = "refuse"
+	// RecitationOutput emits the assessment to the dedicated recited output.
+	RecitationOutput RecitationPolicy = "output"
+	// RecitationRephrase retries once with the prompt asking for an answer in the model's own words.
+	RecitationRephrase RecitationPolicy = "rephrase"
+)
+
+// rephraseForRecitation asks the model not to quote its sources, for RecitationRephrase retries.
+func rephraseForRecitation(prompt string) string {
+	return prompt + "\nAnswer in your own words, without quoting any source verbatim."
+}
+
+// EvalRecord is a prompt sent to the model, its raw response and the insights parsed from it.
+type EvalRecord struct {
+	AssessmentID string `json:"assessment_id,omitempty"`
+	Prompt       string `json:"prompt"`
+	RawResponse  string `json:"raw_response"`
+	// Parsed holds the insights parsed from the response, partial when Error is set.
+	Parsed InsightsResult `json:"parsed"`
+	Error  string         `json:"error,omitempty"`
+	// Unparseable flags, with RawFailures, the responses that failed to parse and weren't
+	// repaired, to be written to raw_failures.jsonl.
+	Unparseable bool `json:"-"`
+}
+
+// RetryPredicate reports whether a failed attempt, numbered from 1, is retried.
+type RetryPredicate func(err error, attempt int) bool
+
+// retryPredicates holds the retry predicates that can be referenced by name.
+var retryPredicates = map[string]RetryPredicate{}
+
+// RegisterRetryPredicate makes a retry predicate available by name to ExtractInsights.RetryPredicateName.
+// The name is looked up by every worker in Setup, so predicates are registered from an init function.
+func RegisterRetryPredicate(name string, predicate RetryPredicate) {
+	retryPredicates[name] = predicate
+}
+
+// PromptCompressor rewrites a prompt into fewer tokens, keeping its meaning.
+type PromptCompressor func(string) (string, error)
+
+// promptCompressors holds the prompt compressors that can be referenced by name.
+var promptCompressors = map[string]PromptCompressor{
+	"whitespace": compactWhitespace,
+}
+
+// RegisterPromptCompressor makes a prompt compressor available by name to ExtractInsights.PromptCompressorName.
+// Call it from init: a compressor registered only in main is unknown to the workers.
+func RegisterPromptCompressor(name string, compressor PromptCompressor) {
+	promptCompressors[name] = compressor
+}
+
+// compactWhitespace is the default prompt compressor, registered as "whitespace": it trims
+// every line, collapses runs of spaces and tabs, and drops blank lines.
+func compactWhitespace(prompt string) (string, error) {
+	var lines []string
+	for _, line := range strings.Split(prompt, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// totalCalls counts the model calls made by every ExtractInsights of the worker, for MaxTotalCalls.
+var totalCalls atomic.Int64
+
+// errBudgetExhausted is returned when MaxTotalCalls model calls have already been made.
+var errBudgetExhausted = errors.New("call budget exhausted")
+
+// PostProcessor transforms parsed insights, e.g. to normalize terms, redact or enrich them.
+type PostProcessor func(InsightsResult) (InsightsResult, error)
+
+// postProcessors holds the post-processors that can be referenced by name.
+var postProcessors = make(map[string]PostProcessor)
+
+// RegisterPostProcessor makes a post-processor available by name to ExtractInsights.PostProcessorNames,
+// from an init function like the predicates and compressors.
+func RegisterPostProcessor(name string, postProcessor PostProcessor) {
+	postProcessors[name] = postProcessor
+}
+
+// now returns the current time, replaced in tests by a fixed clock.
+var now = time.Now
+
+// defaultTimeout bounds each model call when ExtractInsights.Timeout is unset.
+const defaultTimeout = 30 * time.Second
+
+// errEmptyResponse is returned when the model answers successfully but with no text.
+var errEmptyResponse = errors.New("empty response")
+
+// errLowConfidence is returned when the average log probability of a response is below MinAvgLogprob.
+var errLowConfidence = errors.New("low confidence response")
+
+// errInvalidToolInput is returned when the tool input of a forced tool call doesn't match the
+// tool's schema. Like malformed JSON, it is retried.
+var errInvalidToolInput = errors.New("tool input does not match the schema")
+
+// errTransientFinish is returned when the response was stopped by a provider-side error.
+var errTransientFinish = errors.New("response stopped by a provider error")
+
+// defaultMaxTokens is the maximum number of tokens of the model when LLM.MaxTokens is unset.
+const defaultMaxTokens = 8192
+
+// fakeInsights are the canned insights answered by the fake model that replaces a provider
+// failing to authenticate during local development (ALLOW_FAKE_FALLBACK=true).
+const fakeInsights = `{"overall_assessment": "Fake insights: the LLM provider failed to authenticate.", "questions_answered_correctly": 0, "strengths": [], "weaknesses": [], "actionable_feedback": {}, "business_case_impact_analysis": {}, "skill_gaps": [], "study_plans": {}}`
+
+// insightsToolName is the name of the tool used to force structured insights output.
+const insightsToolName = "record_insights"
+
 // InsightsResult represents the structure of the extracted insights.
 type InsightsResult struct {
 	OverallAssessment  string            `json:"overall_assessment"`
@@ -29,69 +319,1036 @@ type InsightsResult struct {
 	Weaknesses         []string          `json:"weaknesses"`
 	ActionableFeedback map[string]string `json:"actionable_feedback"`
 	BusinessImpact     map[string]string `json:"business_case_impact_analysis"`
+	SkillGaps          []SkillGap        `json:"skill_gaps"`
+	// StudyPlans holds a study plan for each weakness, keyed by the weakness.
+	StudyPlans map[string]StudyPlan `json:"study_plans"`
+	// RankedWeaknesses are the weaknesses ranked by severity, from the most severe.
+	RankedWeaknesses []RankedWeakness `json:"ranked_weaknesses"`
+	// CompletedAt is copied from the assessment, so insights can be weighted by recency.
+	CompletedAt time.Time `json:"completed_at"`
+	// GeneratedAt is when the insights were extracted, used to partition the output by date.
+	GeneratedAt time.Time `json:"generated_at"`
+	// Degraded is set when the insights are a partial fallback for a failed extraction.
+	Degraded bool `json:"degraded,omitempty"`
+	// ModelVersion and FinishReason describe the response the insights were extracted
+	// from, set when ExtractInsights.RecordResponseMeta is enabled.
+	ModelVersion string `json:"model_version,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	// PromptKey is the prompt key of the assessment, set with ExtractInsights.DedupePrompts
+	// to fan the insights out to the identical assessments. It is never written out.
+	PromptKey string `firestore:"-" json:"-"`
+	// AssessmentID is the ID of the assessment document the insights were extracted from.
+	AssessmentID string `json:"assessment_id,omitempty"`
+	// Database is the database of the assessment, empty for the (default) one. It is never written out.
+	Database string `firestore:"-" json:"-"`
+	// QualityScore is the quality of the insights from 0 to 1, as scored by the quality scorer
+	// of ExtractInsights (by default on completeness, specificity and validation).
+	QualityScore float64 `json:"quality_score"`
+	// ContentHash is the hash of the insights written to Firestore, to skip rewriting them unchanged.
+	ContentHash string `json:"-"`
+}
+
+// RankedWeakness is a weakness with its severity, from 0 (minor) to 1 (critical).
+type RankedWeakness struct {
+	Topic    string  `json:"topic"`
+	Severity float64 `json:"severity"`
+}
+
+// SkillGap is a normalized skill gap with a recommended resource to close it.
+type SkillGap struct {
+	Skill               string           `json:"skill"`
+	Severity            SkillGapSeverity `json:"severity"`
+	RecommendedResource string           `json:"recommended_resource"`
+}
+
+// StudyPlan is a mini study plan to address a weakness.
+type StudyPlan struct {
+	Topic          string   `json:"topic"`
+	EstimatedHours float64  `json:"estimated_hours"`
+	Resources      []string `json:"resources"`
 }
 
 // ProcessElement sends a request to the LLM to extract key insights from user performance.
-func (ei *ExtractInsights) ProcessElement(ctx context.Context, assessment Assessment, emit func(InsightsResult)) {
+// Assessments left over once the MaxTotalCalls budget is spent are emitted to skipped,
+// and the ones the model refuses to answer (e.g. for safety) to refused, or to recited when
+// blocked for recitation with the RecitationOutput policy. In Eval mode the record of every
+// model call is emitted to eval. With EmitRaw, the insights as parsed from the response, before
+// the post-processors, are emitted to raw alongside the normalized ones.
+func (ei *ExtractInsights) ProcessElement(ctx context.Context, assessment Assessment, rubric func(*string) bool, emit func(InsightsResult), skipped, refused, recited func(Assessment), eval func(EvalRecord), raw func(InsightsResult)) {
+	defer ei.flushEvals(eval)
+	ei.readRubric(rubric)
+
+	// Normal-priority assessments wait for the high-priority ones of the bundle
+	if ei.Prioritize && assessment.Priority != PriorityHigh {
+		ei.pending = append(ei.pending, assessment)
+		return
+	}
+
+	ei.process(ctx, assessment, emit, skipped, refused, recited, raw)
+}
+
+// process extracts the insights of the assessment and emits them, or the assessment to the
+// output matching its failure, unless it is deferred to the end of the bundle.
+func (ei *ExtractInsights) process(ctx context.Context, assessment Assessment, emit func(InsightsResult), skipped, refused, recited func(Assessment), raw func(InsightsResult)) {
+	if err := ei.budgetExhausted(); err != nil {
+		skipped(deadLetter(assessment, err))
+		return
+	}
+
+	insights, err := ei.extract(ctx, assessment)
+	switch {
+	case err == nil:
+		workerMetrics.processed.Add(1)
+		emit(insights)
+		ei.emitRaw(insights, raw)
+		return
+	case errors.Is(err, errBudgetExhausted):
+		log.Printf("Skipping assessment: %v", err)
+		skipped(deadLetter(assessment, err))
+		return
+	case llm.IsRecitation(err) && ei.Recitation == RecitationOutput:
+		log.Printf("Response blocked for recitation: %v", err)
+		workerMetrics.failed.Add(1)
+		recited(deadLetter(assessment, err))
+		return
+	case llm.IsRefused(err):
+		log.Printf("Model refused to answer: %v", err)
+		workerMetrics.failed.Add(1)
+		refused(deadLetter(assessment, err))
+		return
+	}
+
+	if ei.DeferFailures {
+		log.Printf("Deferring assessment to the end of the bundle after %d attempts: %v", ei.MaxRetries, err)
+		ei.deferred = append(ei.deferred, assessment)
+		return
+	}
+
+	ei.handleFailure(insights, err, emit)
+}
+
+// deadLetter returns the assessment with the categorized failure of its extraction, to be written out.
+func deadLetter(assessment Assessment, err error) Assessment {
+	assessment.Failure = newFailure(err)
+	return assessment
+}
+
+// FinishBundle flushes the work buffered during the bundle: the normal-priority assessments
+// are processed, deferred assessments get a last round of retries before the bundle is
+// committed, then the metrics are written.
+// It takes no context, as Beam's registered FinishBundle wrappers are limited to 7 parameters
+// and every side input and emitter of ProcessElement must be declared: the retries run with
+// a background context.
+func (ei *ExtractInsights) FinishBundle(rubric func(*string) bool, emit func(InsightsResult), skipped, refused, recited func(Assessment), eval func(EvalRecord), raw func(InsightsResult)) {
+	defer ei.flushEvals(eval)
+	ei.readRubric(rubric)
+
+	ctx := context.Background()
+
+	// The normal-priority assessments buffered behind the high-priority ones
+	pending := ei.pending
+	ei.pending = nil
+	for _, assessment := range pending {
+		ei.process(ctx, assessment, emit, skipped, refused, recited, raw)
+	}
+
+	deferred := ei.deferred
+	ei.deferred = nil
+
+	for _, assessment := range deferred {
+		if err := ei.budgetExhausted(); err != nil {
+			skipped(deadLetter(assessment, err))
+			continue
+		}
+
+		insights, err := ei.extract(ctx, assessment)
+		if errors.Is(err, errBudgetExhausted) {
+			skipped(deadLetter(assessment, err))
+			continue
+		}
+		if llm.IsRecitation(err) && ei.Recitation == RecitationOutput {
+			workerMetrics.failed.Add(1)
+			recited(deadLetter(assessment, err))
+			continue
+		}
+		if llm.IsRefused(err) {
+			workerMetrics.failed.Add(1)
+			refused(deadLetter(assessment, err))
+			continue
+		}
+		if err != nil {
+			ei.handleFailure(insights, err, emit)
+			continue
+		}
+		workerMetrics.processed.Add(1)
+		emit(insights)
+		ei.emitRaw(insights, raw)
+	}
+
+	if ei.Metrics.Path != "" {
+		if err := workerMetrics.writeMetricsFile(ei.Metrics.Path, ei.Metrics); err != nil {
+			log.Printf("Error exporting metrics: %v", err)
+		}
+	}
+}
+
+// readRubric reads the rubric side input once, it is the same for every element. The side
+// input is empty when no rubric is configured.
+func (ei *ExtractInsights) readRubric(rubric func(*string) bool) {
+	if ei.rubricRead {
+		return
+	}
+	var parts []string
+	var part string
+	for rubric(&part) {
+		parts = append(parts, part)
+	}
+	ei.rubric = strings.Join(parts, "\n")
+	ei.rubricRead = true
+}
+
+// emitRaw emits the raw insights of the last extraction, with the timestamps of its normalized insights.
+func (ei *ExtractInsights) emitRaw(insights InsightsResult, raw func(InsightsResult)) {
+	if !ei.EmitRaw {
+		return
+	}
+	rawInsights := ei.raw
+	rawInsights.CompletedAt = insights.CompletedAt
+	rawInsights.AssessmentID = insights.AssessmentID
+	rawInsights.Database = insights.Database
+	rawInsights.GeneratedAt = insights.GeneratedAt
+	rawInsights.PromptKey = insights.PromptKey
+	raw(rawInsights)
+}
+
+// flushEvals emits the eval records of the model calls made since the last flush.
+func (ei *ExtractInsights) flushEvals(eval func(EvalRecord)) {
+	for _, record := range ei.evals {
+		eval(record)
+	}
+	ei.evals = nil
+}
+
+// budgetExhausted returns errBudgetExhausted when the MaxTotalCalls budget is already spent,
+// or errCostBudgetExhausted when the MaxCost one is.
+func (ei *ExtractInsights) budgetExhausted() error {
+	if ei.MaxTotalCalls > 0 && totalCalls.Load() >= ei.MaxTotalCalls {
+		return errBudgetExhausted
+	}
+	if ei.costExhausted() {
+		return errCostBudgetExhausted
+	}
+	return nil
+}
+
+// takeCall reserves a model call from the MaxTotalCalls budget, once the MaxCost one is
+// checked, returning the error of the budget that is spent if any.
+func (ei *ExtractInsights) takeCall() error {
+	if ei.costExhausted() {
+		return errCostBudgetExhausted
+	}
+	if ei.MaxTotalCalls > 0 && totalCalls.Add(1) > ei.MaxTotalCalls {
+		return errBudgetExhausted
+	}
+	return nil
+}
+
+// extract extracts the insights of the assessment, chunking it first when it is longer than ChunkSize.
+// The context of its model calls carries the tenant and the ID of the assessment, as the request ID.
+func (ei *ExtractInsights) extract(ctx context.Context, assessment Assessment) (InsightsResult, error) {
+	ctx = llm.WithRequestID(llm.WithTenantID(ctx, assessment.TenantID), assessment.ID)
+
 	var (
 		insights InsightsResult
 		err      error
 	)
+	if ei.ChunkSize > 0 && len([]rune(assessment.Result)) > ei.ChunkSize {
+		insights, err = ei.chunkedExtract(ctx, assessment)
+	} else {
+		insights, err = ei.extractWithRetries(ctx, assessment)
+	}
+
+	if ei.DedupePrompts {
+		insights.PromptKey = promptKey(assessment)
+	}
+	if ei.qualityScorer != nil {
+		insights.QualityScore = ei.qualityScorer(insights, err == nil)
+	}
+	return insights, err
+}
+
+// chunkedExtract extracts partial insights from each chunk of the assessment (map)
+// and merges them into a single InsightsResult (reduce). On failure it returns the
+// merged insights of the chunks extracted so far along with the error.
+func (ei *ExtractInsights) chunkedExtract(ctx context.Context, assessment Assessment) (InsightsResult, error) {
+	chunks := chunkText(assessment.Result, ei.ChunkSize, ei.ChunkOverlap)
+	overlap := chunkOverlap(ei.ChunkSize, ei.ChunkOverlap)
+
+	partials := make([]InsightsResult, 0, len(chunks))
+	rawPartials := make([]InsightsResult, 0, len(chunks))
+	for i, chunk := range chunks {
+		part := assessment
+		part.Result = chunk
+		if i > 0 {
+			// The overlap was graded with the previous chunk, only its context is kept
+			part.Result = markOverlap(chunk, overlap)
+		}
+		insights, err := ei.extractWithRetries(ctx, part)
+		partials = append(partials, insights)
+		if err != nil {
+			return mergeInsights(partials), fmt.Errorf("error extracting chunk %d of %d: %w", i+1, len(chunks), err)
+		}
+		rawPartials = append(rawPartials, ei.raw)
+	}
+
+	if ei.EmitRaw {
+		ei.raw = mergeInsights(rawPartials)
+	}
+	return mergeInsights(partials), nil
+}
+
+// extractWithRetries extracts the insights, retrying up to MaxRetries times.
+// Truncated responses are retried with twice as many tokens, refused ones aren't retried,
+// unless the retry predicate decides otherwise. The first attempt is made with the adaptive
+// maximum number of tokens, if enabled, and its truncation observed.
+// On failure it returns the partial insights of the last attempt along with its error.
+func (ei *ExtractInsights) extractWithRetries(ctx context.Context, assessment Assessment) (InsightsResult, error) {
+	var (
+		insights  InsightsResult
+		err       error
+		maxTokens int
+	)
+	budget := ei.adaptiveBudget()
+	if budget != nil {
+		maxTokens = budget.current()
+	}
+
+	var retries retryBudgets
+	for attempt, emptyResponses := 0, 0; attempt < ei.MaxRetries; attempt++ {
+		if attempt > 0 || emptyResponses > 0 {
+			workerMetrics.retries.Add(1)
+		}
+		insights, err = ei.generateInsights(ctx, assessment, maxTokens)
+		if budget != nil && attempt == 0 && emptyResponses == 0 && !errors.Is(err, errBudgetExhausted) {
+			budget.record(llm.IsTruncated(err))
+		}
+		if err == nil || errors.Is(err, errBudgetExhausted) || !ei.retriable(err, attempt+1) || !retries.spend(ei, err) {
+			break
+		}
 
-	for attempt := 0; attempt < ei.MaxRetries; attempt++ {
-		insights, err = ei.extractInsights(ctx, assessment)
-		if err == nil {
-			emit(insights)
-			return
+		if llm.IsTruncated(err) {
+			maxTokens = ei.bumpMaxTokens(maxTokens)
+			log.Printf("Attempt %d truncated, retrying with %d max tokens...", attempt+1, maxTokens)
+			time.Sleep(ei.retryDelay())
+			continue
+		}
+
+		if ei.RetryOnEmptyResponse && errors.Is(err, errEmptyResponse) && emptyResponses < ei.MaxRetries {
+			emptyResponses++
+			attempt--
+			log.Printf("Empty response %d, retrying without using up an attempt...", emptyResponses)
+			time.Sleep(ei.retryDelay())
+			continue
 		}
 
 		log.Printf("Attempt %d failed: %v. Retrying...", attempt+1, err)
-		time.Sleep(ei.RetryDelay)
+		time.Sleep(ei.retryDelay())
+	}
+
+	insights.CompletedAt = assessment.CompletedAt
+	insights.AssessmentID = assessment.ID
+	insights.Database = assessment.Database
+	insights.GeneratedAt = now().UTC()
+	return insights, err
+}
+
+// retriable reports whether the failed attempt is retried: as the retry predicate decides when set,
+// and otherwise unless the model refused to answer.
+func (ei *ExtractInsights) retriable(err error, attempt int) bool {
+	if ei.retryPredicate != nil {
+		return ei.retryPredicate(err, attempt)
+	}
+	return !llm.IsRefused(err)
+}
+
+// retryDelay returns the delay before the next attempt: RetryDelay, jittered by RetryJitter.
+func (ei *ExtractInsights) retryDelay() time.Duration {
+	delay := ei.RetryDelay
+	if ei.ErrorRateBackoff > 0 {
+		delay = time.Duration(float64(delay) * (1 + ei.ErrorRateBackoff*providerErrorRate(ei.provider()).rate()))
+	}
+	if ei.RetryJitter <= 0 {
+		return delay
+	}
+	random := rand.Float64
+	if ei.jitterRand != nil {
+		random = ei.jitterRand.Float64
+	}
+	// A factor in [1-RetryJitter, 1+RetryJitter)
+	factor := 1 + ei.RetryJitter*(2*random()-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// provider returns the name of the provider of the bundle's model, Gemini when unset.
+func (ei *ExtractInsights) provider() string {
+	return ei.activeModel().cfg.Provider
+}
+
+// recordCall records the outcome of a model call in the error rate of the provider. Provider
+// errors, timeouts included, and responses stopped by a provider error count as failures;
+// truncated and refused responses don't, the provider answered.
+func (ei *ExtractInsights) recordCall(ctx context.Context, meta llm.ResponseMeta, err error) {
+	failed := (err != nil && !llm.IsTruncated(err) && !llm.IsRefused(err)) || meta.Reason == llm.FinishReasonTransient
+	rate := providerErrorRate(ei.provider())
+	rate.record(failed)
+	providerErrorRateGauge.Set(ctx, int64(rate.rate()*1000))
+}
+
+// WithRetryJitterSeed draws the retry jitter from a source seeded with seed instead of the
+// shared one, so the delays between attempts are reproducible, e.g. under test. The source
+// isn't serialized with the DoFn, workers always use the shared one.
+func (ei *ExtractInsights) WithRetryJitterSeed(seed int64) *ExtractInsights {
+	ei.jitterRand = rand.New(rand.NewSource(seed))
+	return ei
+}
+
+// bumpMaxTokens doubles the maximum number of tokens of the previous attempt, starting
+// from the model's when the previous attempt didn't override it, up to the model's limit.
+func (ei *ExtractInsights) bumpMaxTokens(maxTokens int) int {
+	active := ei.activeModel()
+	if maxTokens == 0 {
+		maxTokens = active.cfg.MaxTokens
 	}
+	if maxTokens == 0 {
+		maxTokens = defaultMaxTokens
+	}
+	return llm.ClampMaxTokens(active.cfg.Provider, active.cfg.Model, 2*maxTokens)
+}
 
+// handleFailure logs a failed extraction and emits the degraded insights when enabled.
+func (ei *ExtractInsights) handleFailure(insights InsightsResult, err error, emit func(InsightsResult)) {
 	log.Printf("Failed to extract insights after %d attempts: %v", ei.MaxRetries, err)
+	workerMetrics.failed.Add(1)
+
+	if ei.EmitDegraded {
+		insights.Degraded = true
+		emit(insights)
+	}
 }
 
-func (ei *ExtractInsights) extractInsights(ctx context.Context, assessment Assessment) (InsightsResult, error) {
-	prompt := fmt.Sprintf("Given the following assessment from a user's performance on the Professional Data Engineer Certification Prep:\n%s\nPlease extract key insights and respond in the following JSON schema:\n%s . Remove any ```json or ``` characters. Avoid any comments or explanations", assessment.Result, ei.InsightsSchema)
+// generateInsights extracts the insights in a single model call, limited to maxTokens
+// tokens when positive. The finish reason of the response decides whether it is parsed.
+func (ei *ExtractInsights) generateInsights(ctx context.Context, assessment Assessment, maxTokens int) (InsightsResult, error) {
+	assessment.Result = truncateAssessment(assessment.Result, ei.MaxAssessmentChars, ei.Truncation)
+
+	// The schema is only cached for the model of the bundle, preferred models get it inline
+	active := ei.modelFor(assessment)
+	model, modelName, cachedSchema := active.model, active.cfg.Model, active.cachedSchema
+
+	prompt, err := ei.prompt(assessment, cachedSchema, ei.userHistory(ctx, assessment))
+	if err != nil {
+		return InsightsResult{}, err
+	}
 
 	// Add timeout to context
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	timeout := ei.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	text, err := ei.model.GenerateText(
-		ctx,
-		prompt,
-		&llm.GenerateOptions{
-			ResponseMIMEType: "application/json",
-		},
-	)
+	opts := &llm.GenerateOptions{
+		ResponseMIMEType: "application/json",
+		CachedContent:    cachedSchema,
+		MaxTokens:        maxTokens,
+	}
+	if ei.insightsTool != nil {
+		opts.Tools = []llm.GenericTool{*ei.insightsTool}
+		opts.ToolChoice = insightsToolName
+	}
+
+	if err := ei.takeCall(); err != nil {
+		return InsightsResult{}, err
+	}
+	promptSize.Update(ctx, int64(len(prompt)))
+	start := time.Now()
+	text, meta, err := llm.GenerateTextWithMetadata(ctx, model, prompt, opts)
+	latency := time.Since(start).Milliseconds()
+	llmLatency.Update(ctx, latency)
+	if tenantID := llm.TenantID(ctx); tenantID != "" {
+		tenantLatency(tenantID).Update(ctx, latency)
+	}
+	ei.recordCall(ctx, meta, err)
+	ei.recordCost(meta)
+	ei.recordTokens(ctx, modelName, meta)
+	workerMetrics.inputTokens.Add(int64(meta.InputTokens))
+	workerMetrics.outputTokens.Add(int64(meta.OutputTokens))
+	manifestInputTokens.Inc(ctx, int64(meta.InputTokens))
+	manifestOutputTokens.Inc(ctx, int64(meta.OutputTokens))
+	if llm.IsTruncated(err) {
+		return partialInsights(text), fmt.Errorf("error generating text: %w", err)
+	}
 	if err != nil {
 		return InsightsResult{}, fmt.Errorf("error generating text: %w", err)
 	}
 
+	insights, err := ei.parseInsights(text, meta)
+	record := EvalRecord{
+		AssessmentID: assessment.ID,
+		Prompt:       prompt,
+		RawResponse:  text,
+		Parsed:       insights,
+		Unparseable:  ei.RawFailures && isUnmarshalError(err),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if field, ok := invalidField(err); ok && ei.RepairFields {
+		repaired, repairErr := ei.repairField(ctx, model, modelName, text, meta, field, err)
+		if repairErr != nil {
+			log.Printf("Warning: %v", repairErr)
+			ei.recordEval(record)
+			return insights, err
+		}
+		record.Unparseable = false
+		ei.recordEval(record)
+		return repaired, nil
+	}
+	ei.recordEval(record)
+	return insights, err
+}
+
+// recordEval buffers the eval record of a model call, in eval mode or when it holds a raw failure.
+func (ei *ExtractInsights) recordEval(record EvalRecord) {
+	if ei.Eval || record.Unparseable {
+		ei.evals = append(ei.evals, record)
+	}
+}
+
+// prompt builds the prompt of the assessment, referencing the cached schema when set and
+// embedding the insights schema otherwise, with the summary of the user history if any,
+// then compresses it with the prompt compressor, if any.
+func (ei *ExtractInsights) prompt(assessment Assessment, cachedSchema, history string) (string, error) {
+	var prompt string
+	if cachedSchema != "" {
+		prompt = fmt.Sprintf("Given the following assessment from a user's performance on the Professional Data Engineer Certification Prep:\n%s\nPlease extract key insights and respond in the JSON schema provided in your instructions. Remove any ```json or ``` characters. Avoid any comments or explanations", assessment.Result)
+	} else {
+		prompt = fmt.Sprintf("Given the following assessment from a user's performance on the Professional Data Engineer Certification Prep:\n%s\nPlease extract key insights and respond in the following JSON schema:\n%s . Remove any ```json or ``` characters. Avoid any comments or explanations", assessment.Result, ei.InsightsSchema)
+	}
+
+	if history != "" {
+		prompt = fmt.Sprintf("Take into account the history of the user:\n%s\n\n%s", history, prompt)
+	}
+
+	if ei.rubric != "" {
+		prompt = fmt.Sprintf("Compare the assessment to the following official rubric:\n%s\n\n%s", ei.rubric, prompt)
+	}
+
+	if ei.promptCompressor != nil {
+		compressed, err := ei.promptCompressor(prompt)
+		if err != nil {
+			return "", fmt.Errorf("error compressing prompt: %w", err)
+		}
+		prompt = compressed
+	}
+	return prompt, nil
+}
+
+// parseInsights parses the insights of a response, depending on its finish reason,
+// then post-processes and validates them.
+func (ei *ExtractInsights) parseInsights(text string, meta llm.ResponseMeta) (InsightsResult, error) {
+	switch meta.Reason {
+	case llm.FinishReasonLength:
+		return partialInsights(text), fmt.Errorf("error generating text: %w", llm.ErrTruncated)
+	case llm.FinishReasonSafety, llm.FinishReasonRefusal:
+		return InsightsResult{}, fmt.Errorf("error generating text: %w (finish reason %s)", llm.ErrRefused, meta.FinishReason)
+	case llm.FinishReasonRecitation:
+		return InsightsResult{}, fmt.Errorf("error generating text: %w: %w (finish reason %s)", llm.ErrRefused, llm.ErrRecitation, meta.FinishReason)
+	case llm.FinishReasonTransient:
+		return InsightsResult{}, fmt.Errorf("error generating text: %w (finish reason %s)", errTransientFinish, meta.FinishReason)
+	}
+	if strings.TrimSpace(text) == "" {
+		return InsightsResult{}, fmt.Errorf("error generating text: %w", errEmptyResponse)
+	}
+	if ei.MinAvgLogprob < 0 && meta.AvgLogprobs != nil && *meta.AvgLogprobs < ei.MinAvgLogprob {
+		return InsightsResult{}, fmt.Errorf("error generating text: %w (average logprob %.3f below %.3f)", errLowConfidence, *meta.AvgLogprobs, ei.MinAvgLogprob)
+	}
+
+	if ei.responseSchema != nil {
+		// The maps of the responses constrained by the response schema come as key/value entries
+		text = insightsFromResponseSchema(text)
+	}
+
+	if ei.toolSchema != nil {
+		if err := ei.validateToolInput(text); err != nil {
+			return partialInsights(text), err
+		}
+	}
+
 	var insights InsightsResult
-	if err := json.Unmarshal([]byte(text), &insights); err != nil {
-		return InsightsResult{}, fmt.Errorf("error unmarshaling insights: %w", err)
+	if err := decodeJSON(text, &insights); err != nil {
+		// Keep whatever could be parsed, so callers can fall back to partial insights
+		return partialInsights(text), unmarshalError(err, text)
+	}
+
+	if ei.RecordResponseMeta {
+		insights.ModelVersion = meta.ModelVersion
+		insights.FinishReason = meta.FinishReason
+	}
+
+	if ei.EmitRaw {
+		// Post-processors may modify the maps and slices of the insights in place
+		ei.raw = cloneInsights(insights)
+	}
+
+	var err error
+	for i, postProcess := range ei.postProcessors {
+		insights, err = postProcess(insights)
+		if err != nil {
+			return insights, fmt.Errorf("error post-processing insights (step %d): %w", i+1, err)
+		}
+	}
+
+	if err := validateInsights(insights); err != nil {
+		return insights, fmt.Errorf("error validating insights: %w", err)
 	}
 
 	return insights, nil
 }
 
-func (ei *ExtractInsights) Setup() error {
+// cloneInsights returns a deep copy of the insights.
+func cloneInsights(insights InsightsResult) InsightsResult {
+	clone := insights
+	clone.Strengths = slices.Clone(insights.Strengths)
+	clone.Weaknesses = slices.Clone(insights.Weaknesses)
+	clone.RankedWeaknesses = slices.Clone(insights.RankedWeaknesses)
+	clone.ActionableFeedback = maps.Clone(insights.ActionableFeedback)
+	clone.BusinessImpact = maps.Clone(insights.BusinessImpact)
+	clone.SkillGaps = slices.Clone(insights.SkillGaps)
+	clone.StudyPlans = maps.Clone(insights.StudyPlans)
+	for weakness, plan := range clone.StudyPlans {
+		plan.Resources = slices.Clone(plan.Resources)
+		clone.StudyPlans[weakness] = plan
+	}
+	return clone
+}
+
+/*
+decodeJSON decodes a JSON response into v with json.Decoder.UseNumber, so the numbers decoded
+into interface{} values are json.Numbers, converted explicitly by their consumers (e.g. the
+tool schema validation), instead of float64s losing the precision of integers above 2^53.
+Numbers decoded into typed fields (e.g. int64) are exact either way.
+
+Like json.Unmarshal, it fails on anything after the value, and reports syntax errors with
+their offset: invalid JSON is left to json.Unmarshal, as the decoder reports truncated input
+as io.ErrUnexpectedEOF.
+*/
+func decodeJSON(text string, v interface{}) error {
+	if !json.Valid([]byte(text)) {
+		return json.Unmarshal([]byte(text), v)
+	}
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// rawPreviewLen is the number of characters of the raw response quoted in unmarshal errors.
+const rawPreviewLen = 200
+
+// snippetRadius is the number of bytes quoted on each side of the offset of an unmarshal error.
+const snippetRadius = 30
+
+// unmarshalError describes a failure to unmarshal the insights of a response, with the byte
+// offset and surroundings of JSON syntax and type errors, and the start of the raw response,
+// so operators can see what the model actually produced. Quoted content is truncated, so
+// errors stay short and don't leak whole assessments into the logs.
+func unmarshalError(err error, text string) error {
+	preview := truncateText(text, rawPreviewLen)
+
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		offset    int64 = -1
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	}
+	if offset < 0 {
+		return fmt.Errorf("error unmarshaling insights: %w (response of %d bytes starts with %q)", err, len(text), preview)
+	}
+
+	start, end := max(offset-snippetRadius, 0), min(offset+snippetRadius, int64(len(text)))
+	snippet := strings.ToValidUTF8(text[start:end], "")
+	return fmt.Errorf("error unmarshaling insights at offset %d near %q: %w (response of %d bytes starts with %q)", offset, snippet, err, len(text), preview)
+}
+
+// truncateText returns the first n characters of text, followed by an ellipsis when it is longer.
+func truncateText(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
+
+// partialInsights decodes the top-level fields of a possibly truncated or malformed JSON
+// object that are complete, ignoring the rest (e.g. overall_assessment when the response
+// was cut off further down).
+func partialInsights(text string) InsightsResult {
+	var insights InsightsResult
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return insights
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+		key, ok := token.(string)
+		if !ok {
+			break
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+		fields[key] = value
+	}
+
+	for key, value := range fields {
+		setInsightsField(&insights, key, value)
+	}
+
+	return insights
+}
+
+// setInsightsField decodes a top-level field of the insights JSON object into insights,
+// skipping it when its type is unexpected.
+func setInsightsField(insights *InsightsResult, key string, value json.RawMessage) {
+	field, _ := json.Marshal(map[string]json.RawMessage{key: value})
+	_ = json.Unmarshal(field, insights)
+}
+
+func (ei *ExtractInsights) Setup(ctx context.Context) error {
 	var err error
 	ei.InsightsSchema, err = readFile("insights_schema.json")
 	if err != nil {
 		return fmt.Errorf("error reading insights schema: %w", err)
 	}
-	ei.model = llm.NewGeminiClient(llm.WithMaxTokens(8192))
+	cfg := ei.LLM
+	if cfg.MaxTokens == 0 {
+		cfg.MaxTokens = defaultMaxTokens
+	}
+	ei.maxTokens = cfg.MaxTokens
+	ei.installTransportRetries()
+	if err := ei.buildGeminiResponseSchema(); err != nil {
+		return err
+	}
+	ei.model, err = ei.newModel(cfg)
+	if err != nil {
+		return err
+	}
+	if len(ei.PreferredModels) > 0 {
+		ei.models = make(map[string]llm.LanguageModel, len(ei.PreferredModels))
+		for _, name := range ei.PreferredModels {
+			modelCfg := cfg
+			modelCfg.Model = name
+			if ei.models[name], err = ei.newModel(modelCfg); err != nil {
+				return fmt.Errorf("error creating preferred model %q: %w", name, err)
+			}
+		}
+	}
+	// The health gate models are created ahead of the audit log, rate limit and cache, which wrap them too
+	if err := ei.buildHealthGate(cfg); err != nil {
+		return err
+	}
+	if ei.Audit.Path != "" {
+		if err := ei.auditModel(cfg); err != nil {
+			return err
+		}
+	}
+	if ei.RateLimit.RequestsPerSecond > 0 {
+		if err := ei.rateLimitModel(ctx, cfg.Provider); err != nil {
+			return err
+		}
+	}
+	if ei.CacheResponses {
+		ei.cacheResponses(cfg)
+	}
+	if ei.HistoryTable != "" && ei.historyClient == nil {
+		if ei.historyClient, err = newBigQueryHistoryClient(ctx, ei.HistoryTable); err != nil {
+			return err
+		}
+	}
+	if ei.CacheSchema {
+		ei.cacheSchema(ctx)
+	}
+	if ei.StructuredTools {
+		if err := ei.buildInsightsTool(); err != nil {
+			return err
+		}
+	}
+	if err := ei.resolvePromptCompressor(); err != nil {
+		return err
+	}
+	if err := ei.resolveRetryPredicate(); err != nil {
+		return err
+	}
+	if err := ei.resolveQualityScorer(); err != nil {
+		return err
+	}
+	return ei.resolvePostProcessors()
+}
+
+// newModel creates the language model of the given configuration, or the fake model when
+// its API key is missing and ALLOW_FAKE_FALLBACK=true. Its maximum number of tokens is clamped
+// to the model's limit.
+func (ei *ExtractInsights) newModel(cfg llm.LLMConfig) (llm.LanguageModel, error) {
+	// The options add up: the clamp, the rephrasing of recitations, then the response format of the provider
+	options := []func(interface{}){llm.WithProviderSpecificMaxTokensClamp()}
+	if ei.Recitation == RecitationRephrase {
+		options = append(options, llm.WithGeminiRetryOnRecitation(rephraseForRecitation))
+	}
+	if ei.MinAvgLogprob < 0 {
+		options = append(options, llm.WithGeminiAvgLogprobs())
+	}
+	switch {
+	case cfg.Provider == llm.ProviderOpenAI:
+		// Structured outputs constrain the response to the insights schema
+		options = append(options, llm.WithResponseFormatJSONSchema("insights", ei.InsightsSchema))
+	case ei.responseSchema != nil:
+		// Gemini's constrained decoding guarantees the response conforms to the derived schema
+		options = append(options, llm.WithGeminiGenerationConfigOverride(ei.geminiResponseConfig()))
+	}
+	model, err := llm.NewLanguageModel(cfg, func(l interface{}) {
+		for _, option := range options {
+			option(l)
+		}
+	})
+	switch {
+	case llm.IsAuthError(err) && llm.FakeFallbackAllowed():
+		log.Printf("Using the fake model (ALLOW_FAKE_FALLBACK=true): %v", err)
+		return llm.NewFakeLLM(fakeInsights), nil
+	case err != nil:
+		return nil, fmt.Errorf("error creating language model: %w", err)
+	default:
+		// A no-op unless ALLOW_FAKE_FALLBACK=true
+		return llm.NewFakeOnAuthErrorModel(model, fakeInsights), nil
+	}
+}
+
+// modelFor returns the model of the assessment: the preferred model it names, if it is one of
+// PreferredModels, and the model of the bundle otherwise. The bundles switched to the fallback
+// model by the health gate process every assessment with it, as the preferred models are the
+// unhealthy provider's. The schema is never cached for preferred models.
+func (ei *ExtractInsights) modelFor(assessment Assessment) bundleModel {
+	active := ei.activeModel()
+	if ei.onFallback || assessment.PreferredModel == "" || assessment.PreferredModel == ei.LLM.Model {
+		return active
+	}
+	if model, ok := ei.models[assessment.PreferredModel]; ok {
+		cfg := active.cfg
+		cfg.Model = assessment.PreferredModel
+		return bundleModel{model: model, cfg: cfg}
+	}
+	log.Printf("Warning: unknown preferred model %q, using the configured model", assessment.PreferredModel)
+	return active
+}
+
+// Teardown closes the audit log and the Firestore client of the rate limit, if any.
+func (ei *ExtractInsights) Teardown() error {
+	var errs []error
+	if ei.auditSink != nil {
+		if err := ei.auditSink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing audit log: %w", err))
+		}
+	}
+	if ei.rateLimitClient != nil {
+		if err := ei.rateLimitClient.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing Firestore client: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// auditModel wraps the model so every interaction is recorded to the audit log.
+func (ei *ExtractInsights) auditModel(cfg llm.LLMConfig) error {
+	sink, err := llm.NewJSONLAuditSink(ei.Audit.Path, ei.Audit.Prompts)
+	if err != nil {
+		return fmt.Errorf("error creating audit log: %w", err)
+	}
+	ei.auditSink = sink
+
+	name := cfg.Model
+	if name == "" {
+		name = cfg.Provider
+	}
+	ei.model = llm.NewAuditedModel(ei.model, name, sink)
+	for name, model := range ei.models {
+		ei.models[name] = llm.NewAuditedModel(model, name, sink)
+	}
+	if ei.fallback != nil {
+		ei.fallback = llm.NewAuditedModel(ei.fallback, healthGateFallbackName(ei.HealthGate.Fallback), sink)
+		ei.healthProbe = llm.NewAuditedModel(ei.healthProbe, name, sink)
+	}
 	return nil
 }
 
+// responseCache is the cache of the responses shared by the ExtractInsights of a worker.
+var responseCache = llm.NewInMemoryResponseCache()
+
+// cacheResponses wraps the models so repeated calls are answered from the responseCache, ahead of
+// the audit log and the rate limit as cached responses don't reach the provider.
+func (ei *ExtractInsights) cacheResponses(cfg llm.LLMConfig) {
+	name := cfg.Provider + "/" + cfg.Model
+	negative := llm.WithResponseCacheNegativeCaching(ei.CacheNegativeTTL)
+	ei.model = llm.NewCachingModel(ei.model, name, responseCache, ei.InsightsSchema, negative)
+	for modelName, model := range ei.models {
+		ei.models[modelName] = llm.NewCachingModel(model, cfg.Provider+"/"+modelName, responseCache, ei.InsightsSchema, negative)
+	}
+	// The health probe isn't cached, as a cached response would hide the health of the provider
+	if ei.fallback != nil {
+		fallback := ei.HealthGate.Fallback
+		ei.fallback = llm.NewCachingModel(ei.fallback, fallback.Provider+"/"+fallback.Model, responseCache, ei.InsightsSchema, negative)
+	}
+}
+
+// rateLimitModel wraps the model so every worker takes its requests from the provider's shared token bucket.
+func (ei *ExtractInsights) rateLimitModel(ctx context.Context, provider string) error {
+	database := ei.RateLimit.Database
+	if database == "" {
+		database = firestore.DefaultDatabaseID
+	}
+	client, err := newFirestoreDatabaseClient(ctx, ei.Project, database)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %w", err)
+	}
+	ei.rateLimitClient = client
+
+	if provider == "" {
+		provider = llm.ProviderGemini
+	}
+	store := &firestoreTokenBucketStore{client: client, collection: client.Collection(ei.RateLimit.Collection), shards: ei.RateLimit.Shards}
+	ei.model = llm.NewClusterRateLimitedModel(ei.model, store, provider, ei.RateLimit.RequestsPerSecond, ei.RateLimit.Burst)
+	for name, model := range ei.models {
+		ei.models[name] = llm.NewClusterRateLimitedModel(model, store, provider, ei.RateLimit.RequestsPerSecond, ei.RateLimit.Burst)
+	}
+	if ei.fallback != nil {
+		ei.fallback = llm.NewClusterRateLimitedModel(ei.fallback, store, ei.HealthGate.Fallback.Provider, ei.RateLimit.RequestsPerSecond, ei.RateLimit.Burst)
+		ei.healthProbe = llm.NewClusterRateLimitedModel(ei.healthProbe, store, provider, ei.RateLimit.RequestsPerSecond, ei.RateLimit.Burst)
+	}
+	return nil
+}
+
+// resolvePromptCompressor sets the registered prompt compressor named in PromptCompressorName, if any.
+func (ei *ExtractInsights) resolvePromptCompressor() error {
+	if ei.PromptCompressorName == "" {
+		return nil
+	}
+	compressor, ok := promptCompressors[ei.PromptCompressorName]
+	if !ok {
+		return fmt.Errorf("error: unknown prompt compressor %q", ei.PromptCompressorName)
+	}
+	ei.promptCompressor = compressor
+	return nil
+}
+
+// resolveRetryPredicate sets the registered retry predicate named in RetryPredicateName, if any.
+func (ei *ExtractInsights) resolveRetryPredicate() error {
+	if ei.RetryPredicateName == "" {
+		return nil
+	}
+	predicate, ok := retryPredicates[ei.RetryPredicateName]
+	if !ok {
+		return fmt.Errorf("error: unknown retry predicate %q", ei.RetryPredicateName)
+	}
+	ei.retryPredicate = predicate
+	return nil
+}
+
+// resolvePostProcessors appends the registered post-processors named in PostProcessorNames to the chain.
+func (ei *ExtractInsights) resolvePostProcessors() error {
+	for _, name := range ei.PostProcessorNames {
+		postProcessor, ok := postProcessors[name]
+		if !ok {
+			return fmt.Errorf("error: unknown post-processor %q", name)
+		}
+		ei.postProcessors = append(ei.postProcessors, postProcessor)
+	}
+	return nil
+}
+
+// buildInsightsTool builds the tool used to force structured output from the insights schema,
+// along with the compiled schema its input is validated against.
+func (ei *ExtractInsights) buildInsightsTool() error {
+	tool, err := llm.NewAnthropicStructuredOutputTool(
+		insightsToolName,
+		"Record the key insights extracted from the user's assessment.",
+		ei.InsightsSchema,
+	)
+	if err != nil {
+		return fmt.Errorf("error building insights tool: %w", err)
+	}
+	ei.toolSchema, err = jsonschema.CompileString("insights_schema.json", ei.InsightsSchema)
+	if err != nil {
+		return fmt.Errorf("error compiling insights tool schema: %w", err)
+	}
+	ei.insightsTool = &tool
+	return nil
+}
+
+// validateToolInput checks the input of the forced insights tool call against the tool's schema.
+// Input that isn't valid JSON is left to the unmarshaling, which reports where it breaks.
+func (ei *ExtractInsights) validateToolInput(text string) error {
+	var input interface{}
+	if decodeJSON(text, &input) != nil {
+		return nil
+	}
+	if err := ei.toolSchema.Validate(input); err != nil {
+		return fmt.Errorf("error validating tool input: %w: %w", errInvalidToolInput, err)
+	}
+	return nil
+}
+
+// cacheSchema stores the insights schema server-side for the configured model, and for the
+// fallback model of the health gate, as each provider only reads the content it cached.
+func (ei *ExtractInsights) cacheSchema(ctx context.Context) {
+	ei.cachedSchema = ei.cacheSchemaWith(ctx, ei.model)
+	if ei.fallback != nil {
+		ei.fallbackSchema = ei.cacheSchemaWith(ctx, ei.fallback)
+	}
+}
+
+// cacheSchemaWith caches the insights schema with the model when it supports content caching,
+// through the models wrapping it, returning the handle of the cached content. On failure it
+// returns no handle, the schema keeps being sent inline with the prompts of the model.
+func (ei *ExtractInsights) cacheSchemaWith(ctx context.Context, model llm.LanguageModel) string {
+	name, err := llm.CacheContent(ctx, model, fmt.Sprintf("Respond in the following JSON schema:\n%s", ei.InsightsSchema))
+	switch {
+	case errors.Is(err, llm.ErrContentCachingNotSupported):
+		log.Printf("Warning: schema caching is enabled but the model does not support content caching, sending insights schema inline")
+	case err != nil:
+		log.Printf("Error caching insights schema, sending it inline: %v", err)
+	}
+	return name
+}
+
 func init() {
-	register.DoFn3x0[context.Context, Assessment, func(InsightsResult)](&ExtractInsights{})
+	register.DoFn9x0[context.Context, Assessment, func(*string) bool, func(InsightsResult), func(Assessment), func(Assessment), func(Assessment), func(EvalRecord), func(InsightsResult)](&ExtractInsights{})
+	register.Iter1[string]()
+	register.Emitter1[Assessment]()
+	register.Emitter1[EvalRecord]()
 	register.Function2x1(NewExtractInsights)
 	beam.RegisterType(reflect.TypeOf((*InsightsResult)(nil)).Elem())
+	beam.RegisterType(reflect.TypeOf((*EvalRecord)(nil)).Elem())
 }
 
 // NewExtractInsights creates a new ExtractInsights DoFn with custom retry settings.
@@ -2,10 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
 	"github.com/luillyfe/assessment-data-pipeline/llm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,6 +30,73 @@ func (m *MockLanguageModel) GenerateText(ctx context.Context, prompt string, opt
 	return args.String(0), args.Error(1)
 }
 
+// MockCachingLanguageModel is a MockLanguageModel that also implements llm.ContentCacher
+type MockCachingLanguageModel struct {
+	MockLanguageModel
+}
+
+func (m *MockCachingLanguageModel) CacheContent(ctx context.Context, text string) (string, error) {
+	args := m.Called(ctx, text)
+	return args.String(0), args.Error(1)
+}
+
+// MockMetadataLanguageModel is a MockLanguageModel that also implements llm.MetadataGenerator
+type MockMetadataLanguageModel struct {
+	MockLanguageModel
+}
+
+func (m *MockMetadataLanguageModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *llm.GenerateOptions) (string, llm.ResponseMeta, error) {
+	args := m.Called(ctx, prompt, opts)
+	return args.String(0), args.Get(1).(llm.ResponseMeta), args.Error(2)
+}
+
+func TestMain(m *testing.M) {
+	// Leave GeneratedAt unset, so extracted insights can be compared as a whole
+	now = func() time.Time { return time.Time{} }
+	// Initializes Beam as main does, so the DoFns that can't be encoded fail every test run
+	ptest.Main(m)
+}
+
+// noRubric is an empty rubric side input.
+func noRubric(*string) bool {
+	return false
+}
+
+// noSkipped returns a skipped emitter failing the test when an assessment is skipped.
+func noSkipped(t *testing.T) func(Assessment) {
+	return func(assessment Assessment) {
+		t.Errorf("Unexpected skipped assessment: %+v", assessment)
+	}
+}
+
+// noRecited returns a recited emitter failing the test when an assessment is blocked for recitation.
+func noRecited(t *testing.T) func(Assessment) {
+	return func(assessment Assessment) {
+		t.Errorf("Unexpected recited assessment: %+v", assessment)
+	}
+}
+
+// noEvals returns an eval emitter failing the test when an eval record is emitted.
+func noEvals(t *testing.T) func(EvalRecord) {
+	return func(record EvalRecord) {
+		t.Errorf("Unexpected eval record: %+v", record)
+	}
+}
+
+// noRaw returns a raw emitter failing the test when raw insights are emitted.
+func noRaw(t *testing.T) func(InsightsResult) {
+	return func(insights InsightsResult) {
+		t.Errorf("Unexpected raw insights: %+v", insights)
+	}
+}
+
+// noRefused returns a refused emitter failing the test when an assessment is refused.
+func noRefused(t *testing.T) func(Assessment) {
+	return func(assessment Assessment) {
+		t.Errorf("Unexpected refused assessment: %+v", assessment)
+	}
+}
+
 func TestExtractInsights_ProcessElement(t *testing.T) {
 	mockLLM := new(MockLanguageModel)
 	ei := &ExtractInsights{
@@ -112,7 +188,7 @@ func TestExtractInsights_ProcessElement(t *testing.T) {
 				result = insights
 			}
 
-			ei.ProcessElement(context.Background(), tc.assessment, emitFunc)
+			ei.ProcessElement(context.Background(), tc.assessment, noRubric, emitFunc, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
 
 			if tc.expectError {
 				assert.Equal(t, InsightsResult{}, result)
@@ -135,11 +211,12 @@ func TestNewExtractInsights(t *testing.T) {
 	assert.Equal(t, retryDelay, ei.RetryDelay)
 }
 
-func TestExtractInsights_extractInsights(t *testing.T) {
+func TestExtractInsights_ProcessElementResponses(t *testing.T) {
 	mockLLM := new(MockLanguageModel)
 	ei := &ExtractInsights{
 		model:          mockLLM,
 		InsightsSchema: `{"test": "schema"}`,
+		MaxRetries:     1,
 	}
 
 	testCases := []struct {
@@ -188,6 +265,62 @@ func TestExtractInsights_extractInsights(t *testing.T) {
 			mockResponse: `{"invalid": "json"`,
 			expectError:  true,
 		},
+		{
+			name: "Skill gaps",
+			assessment: Assessment{
+				Result: "User struggled with IAM questions.",
+			},
+			mockResponse: `{
+				"overall_assessment": "Fair",
+				"skill_gaps": [{"skill": "Cloud IAM", "severity": "high", "recommended_resource": "IAM overview"}]
+			}`,
+			expectedResult: InsightsResult{
+				OverallAssessment: "Fair",
+				SkillGaps: []SkillGap{
+					{Skill: "Cloud IAM", Severity: SeverityHigh, RecommendedResource: "IAM overview"},
+				},
+			},
+		},
+		{
+			name: "Out of enum skill gap severity",
+			assessment: Assessment{
+				Result: "User struggled with IAM questions.",
+			},
+			mockResponse: `{
+				"overall_assessment": "Fair",
+				"skill_gaps": [{"skill": "Cloud IAM", "severity": "urgent", "recommended_resource": "IAM overview"}]
+			}`,
+			expectError: true,
+		},
+		{
+			name: "Study plans",
+			assessment: Assessment{
+				Result: "User struggled with IAM questions.",
+			},
+			mockResponse: `{
+				"overall_assessment": "Fair",
+				"weaknesses": ["IAM"],
+				"study_plans": {"IAM": {"topic": "Cloud IAM roles", "estimated_hours": 3.5, "resources": ["IAM overview"]}}
+			}`,
+			expectedResult: InsightsResult{
+				OverallAssessment: "Fair",
+				Weaknesses:        []string{"IAM"},
+				StudyPlans: map[string]StudyPlan{
+					"IAM": {Topic: "Cloud IAM roles", EstimatedHours: 3.5, Resources: []string{"IAM overview"}},
+				},
+			},
+		},
+		{
+			name: "Negative study plan hours",
+			assessment: Assessment{
+				Result: "User struggled with IAM questions.",
+			},
+			mockResponse: `{
+				"overall_assessment": "Fair",
+				"study_plans": {"IAM": {"topic": "Cloud IAM roles", "estimated_hours": -1, "resources": []}}
+			}`,
+			expectError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -195,16 +328,1242 @@ func TestExtractInsights_extractInsights(t *testing.T) {
 			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
 				Return(tc.mockResponse, tc.mockError).Once()
 
-			result, err := ei.extractInsights(context.Background(), tc.assessment)
+			var emitted []InsightsResult
+			emitFunc := func(insights InsightsResult) {
+				emitted = append(emitted, insights)
+			}
+			ei.ProcessElement(context.Background(), tc.assessment, noRubric, emitFunc, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+			// Failed extractions emit nothing, unless EmitDegraded is set
+			if tc.expectError {
+				assert.Empty(t, emitted)
+			} else {
+				assert.Equal(t, []InsightsResult{tc.expectedResult}, emitted)
+			}
+
+			mockLLM.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExtractInsights_cacheSchema(t *testing.T) {
+	response := `{"overall_assessment": "Good performance"}`
+
+	t.Run("Cached schema is referenced", func(t *testing.T) {
+		mockLLM := new(MockCachingLanguageModel)
+		ei := &ExtractInsights{
+			model:          mockLLM,
+			InsightsSchema: `{"test": "schema"}`,
+			MaxRetries:     1,
+		}
+
+		mockLLM.On("CacheContent", mock.Anything, mock.Anything).
+			Return("cachedContents/schema", nil).Once()
+		mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+			return !strings.Contains(prompt, ei.InsightsSchema)
+		}), mock.MatchedBy(func(opts *llm.GenerateOptions) bool {
+			return opts.CachedContent == "cachedContents/schema"
+		})).Return(response, nil).Once()
+
+		ei.cacheSchema(context.Background())
+		var emitted int
+		ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(InsightsResult) { emitted++ }, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+		assert.Equal(t, 1, emitted)
+		mockLLM.AssertExpectations(t)
+	})
+
+	t.Run("Falls back to inline schema", func(t *testing.T) {
+		mockLLM := new(MockCachingLanguageModel)
+		ei := &ExtractInsights{
+			model:          mockLLM,
+			InsightsSchema: `{"test": "schema"}`,
+			MaxRetries:     1,
+		}
+
+		mockLLM.On("CacheContent", mock.Anything, mock.Anything).
+			Return("", errors.New("caching not available")).Once()
+		mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+			return strings.Contains(prompt, ei.InsightsSchema)
+		}), mock.MatchedBy(func(opts *llm.GenerateOptions) bool {
+			return opts.CachedContent == ""
+		})).Return(response, nil).Once()
+
+		ei.cacheSchema(context.Background())
+		var emitted int
+		ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(InsightsResult) { emitted++ }, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+		assert.Equal(t, 1, emitted)
+		mockLLM.AssertExpectations(t)
+	})
+
+	t.Run("Model without content caching gets the inline schema", func(t *testing.T) {
+		mockLLM := new(MockLanguageModel)
+		ei := &ExtractInsights{
+			model:          mockLLM,
+			InsightsSchema: `{"test": "schema"}`,
+			MaxRetries:     1,
+		}
+
+		mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+			return strings.Contains(prompt, ei.InsightsSchema)
+		}), mock.MatchedBy(func(opts *llm.GenerateOptions) bool {
+			return opts.CachedContent == ""
+		})).Return(response, nil).Once()
+
+		ei.cacheSchema(context.Background())
+		var emitted int
+		ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(InsightsResult) { emitted++ }, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+		assert.Equal(t, 1, emitted)
+		mockLLM.AssertExpectations(t)
+	})
+}
+
+func TestExtractInsights_structuredTools(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:           mockLLM,
+		InsightsSchema:  `{"type": "object"}`,
+		StructuredTools: true,
+	}
+	assert.NoError(t, ei.buildInsightsTool())
+
+	// The tool input returned by the model is parsed as the insights
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.MatchedBy(func(opts *llm.GenerateOptions) bool {
+		return opts.ToolChoice == insightsToolName && len(opts.Tools) == 1 && opts.Tools[0].Type == llm.AnthropicToolType
+	})).Return(`{"overall_assessment":"Good performance","questions_answered_correctly":8,"strengths":["Data modeling"]}`, nil).Once()
+
+	result, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, InsightsResult{
+		OverallAssessment: "Good performance",
+		CorrectAnswers:    8,
+		Strengths:         []string{"Data modeling"},
+	}, result)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_structuredToolsInvalidInput(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:      mockLLM,
+		MaxRetries: 2,
+		RetryDelay: time.Millisecond,
+		InsightsSchema: `{
+			"type": "object",
+			"properties": {"questions_answered_correctly": {"type": "integer", "minimum": 0}},
+			"required": ["questions_answered_correctly"]
+		}`,
+		StructuredTools: true,
+	}
+	assert.NoError(t, ei.buildInsightsTool())
+
+	invalid := `{"overall_assessment":"Good performance","questions_answered_correctly":-3}`
+	_, err := ei.parseInsights(invalid, llm.ResponseMeta{})
+	assert.ErrorIs(t, err, errInvalidToolInput)
+
+	// A tool input violating the schema is rejected and retried
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Return(invalid, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment":"Good performance","questions_answered_correctly":8}`, nil).Once()
+
+	result, err := ei.extractWithRetries(context.Background(), Assessment{Result: "User performance data."})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, result.CorrectAnswers)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestDecodeJSON_LargeIntegers(t *testing.T) {
+	// 2^53 + 1, the first integer a float64 can't hold
+	const large = 9007199254740993
+
+	// Numbers decoded into interface{} values are kept as json.Numbers
+	var input map[string]interface{}
+	assert.NoError(t, decodeJSON(`{"attempt_id": 9007199254740993}`, &input))
+	number, ok := input["attempt_id"].(json.Number)
+	if assert.True(t, ok, "Expected a json.Number, got %T", input["attempt_id"]) {
+		id, err := number.Int64()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(large), id)
+	}
+
+	// The tool schema validation sees the exact value, as a float64 would round it down to 2^53
+	ei := &ExtractInsights{
+		InsightsSchema:  `{"type": "object", "properties": {"questions_answered_correctly": {"type": "integer", "maximum": 9007199254740992}}}`,
+		StructuredTools: true,
+	}
+	assert.NoError(t, ei.buildInsightsTool())
+	_, err := ei.parseInsights(`{"questions_answered_correctly": 9007199254740993}`, llm.ResponseMeta{})
+	assert.ErrorIs(t, err, errInvalidToolInput)
+
+	// Integer fields of the insights are decoded exactly
+	insights, err := (&ExtractInsights{}).parseInsights(`{"questions_answered_correctly": 9007199254740993}`, llm.ResponseMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, large, insights.CorrectAnswers)
+
+	// Invalid JSON and trailing data are reported as by json.Unmarshal
+	var syntaxErr *json.SyntaxError
+	assert.ErrorAs(t, decodeJSON(`{"overall_assessment": "Good"`, &insights), &syntaxErr)
+	assert.Error(t, decodeJSON(`{"overall_assessment": "Good"} {}`, &insights))
+}
+
+func TestExtractInsights_ProcessElementDegraded(t *testing.T) {
+	testCases := []struct {
+		name           string
+		emitDegraded   bool
+		mockResponse   string
+		mockError      error
+		expectedResult *InsightsResult
+	}{
+		{
+			name:         "Degraded result on persistent error",
+			emitDegraded: true,
+			mockError:    errors.New("context deadline exceeded"),
+			expectedResult: &InsightsResult{
+				Degraded: true,
+			},
+		},
+		{
+			name:         "Degraded result keeps partial data",
+			emitDegraded: true,
+			mockResponse: `{"overall_assessment": "Good performance", "questions_answered_correctly": 8, "strengths": ["Data mod`,
+			expectedResult: &InsightsResult{
+				OverallAssessment: "Good performance",
+				CorrectAnswers:    8,
+				Degraded:          true,
+			},
+		},
+		{
+			name:         "Nothing emitted when mode is off",
+			emitDegraded: false,
+			mockError:    errors.New("context deadline exceeded"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockLLM := new(MockLanguageModel)
+			ei := &ExtractInsights{
+				model:        mockLLM,
+				MaxRetries:   2,
+				RetryDelay:   time.Millisecond,
+				EmitDegraded: tc.emitDegraded,
+			}
+			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+				Return(tc.mockResponse, tc.mockError).Times(2)
+
+			var results []InsightsResult
+			ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+				results = append(results, insights)
+			}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+			if tc.expectedResult == nil {
+				assert.Empty(t, results)
+			} else {
+				assert.Equal(t, []InsightsResult{*tc.expectedResult}, results)
+			}
+			mockLLM.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPartialInsights(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected InsightsResult
+	}{
+		{
+			name:     "Truncated response",
+			text:     `{"overall_assessment": "Needs improvement", "weaknesses": ["Big data", "Data wareh`,
+			expected: InsightsResult{OverallAssessment: "Needs improvement"},
+		},
+		{
+			name:     "Field with unexpected type is skipped",
+			text:     `{"overall_assessment": "Excellent", "questions_answered_correctly": "ten"`,
+			expected: InsightsResult{OverallAssessment: "Excellent"},
+		},
+		{
+			name:     "Not a JSON object",
+			text:     `I could not process this assessment.`,
+			expected: InsightsResult{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, partialInsights(tc.text))
+		})
+	}
+}
+
+func TestExtractInsights_FinishBundle(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:         mockLLM,
+		MaxRetries:    1,
+		RetryDelay:    time.Millisecond,
+		DeferFailures: true,
+	}
+
+	var results []InsightsResult
+	emitFunc := func(insights InsightsResult) {
+		results = append(results, insights)
+	}
+
+	// The first attempt fails and the assessment is buffered
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", errors.New("API error")).Once()
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, emitFunc, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	assert.Empty(t, results)
+	assert.Len(t, ei.deferred, 1)
+
+	// The buffered assessment is retried and emitted when the bundle finishes
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+	ei.FinishBundle(noRubric, emitFunc, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "Good performance"}}, results)
+	assert.Empty(t, ei.deferred)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_Prioritize(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 1, RetryDelay: time.Millisecond, Prioritize: true}
+
+	// Each assessment gets insights naming it
+	for _, name := range []string{"First", "Urgent", "Last"} {
+		mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+			return strings.Contains(prompt, name+" assessment.")
+		}), mock.Anything).Return(fmt.Sprintf(`{"overall_assessment": %q}`, name), nil).Once()
+	}
+
+	var results []string
+	emitFunc := func(insights InsightsResult) {
+		results = append(results, insights.OverallAssessment)
+	}
+
+	// The high-priority assessment is processed as it arrives, the others are buffered
+	for _, assessment := range []Assessment{
+		{Result: "First assessment."},
+		{Result: "Urgent assessment.", Priority: PriorityHigh},
+		{Result: "Last assessment.", Priority: "normal"},
+	} {
+		ei.ProcessElement(context.Background(), assessment, noRubric, emitFunc, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+	assert.Equal(t, []string{"Urgent"}, results)
+	assert.Len(t, ei.pending, 2)
+
+	// The buffered assessments are processed in arrival order when the bundle finishes
+	ei.FinishBundle(noRubric, emitFunc, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	assert.Equal(t, []string{"Urgent", "First", "Last"}, results)
+	assert.Empty(t, ei.pending)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_RetryOnEmptyResponse(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		retryOnEmptyResponse bool
+		expectedResult       *InsightsResult
+	}{
+		{
+			name:                 "Empty response retried without using up an attempt",
+			retryOnEmptyResponse: true,
+			expectedResult:       &InsightsResult{OverallAssessment: "Good performance"},
+		},
+		{
+			name:                 "Empty response uses up the only attempt",
+			retryOnEmptyResponse: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockLLM := new(MockLanguageModel)
+			ei := &ExtractInsights{
+				model:                mockLLM,
+				MaxRetries:           1,
+				RetryDelay:           time.Millisecond,
+				RetryOnEmptyResponse: tc.retryOnEmptyResponse,
+			}
+
+			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+				Return(" \n", nil).Once()
+			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+				Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+
+			insights, err := ei.extractWithRetries(context.Background(), Assessment{Result: "User performance data."})
+			if tc.expectedResult == nil {
+				assert.ErrorIs(t, err, errEmptyResponse)
+				mockLLM.AssertNumberOfCalls(t, "GenerateText", 1)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, *tc.expectedResult, insights)
+			mockLLM.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExtractInsights_TenantContext(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	tagged := mock.MatchedBy(func(ctx context.Context) bool {
+		return llm.TenantID(ctx) == "acme" && llm.RequestID(ctx) == "assessment-1"
+	})
+	mockLLM.On("GenerateText", tagged, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 1, RetryDelay: time.Millisecond}
+
+	// The model calls carry the tenant and the assessment ID in their context
+	_, err := ei.extract(context.Background(), Assessment{ID: "assessment-1", TenantID: "acme", Result: "User performance data."})
+	assert.NoError(t, err)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_RetryPredicate(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{name: "Provider error", err: errors.New("service unavailable")},
+		{name: "Empty response", err: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts []int
+			mockLLM := new(MockLanguageModel)
+			ei := &ExtractInsights{
+				model:      mockLLM,
+				MaxRetries: 3,
+				RetryDelay: time.Millisecond,
+				// Stops after the first attempt, whatever the error
+				retryPredicate: func(err error, attempt int) bool {
+					attempts = append(attempts, attempt)
+					return false
+				},
+			}
+
+			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Return("", tc.err)
+
+			_, err := ei.extractWithRetries(context.Background(), Assessment{Result: "User performance data."})
+			assert.Error(t, err)
+			assert.Equal(t, []int{1}, attempts)
+			mockLLM.AssertNumberOfCalls(t, "GenerateText", 1)
+		})
+	}
+
+	// A predicate may retry what the default classification doesn't, e.g. refusals
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 2, RetryDelay: time.Millisecond, retryPredicate: func(error, int) bool { return true }}
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Return("", llm.ErrRefused).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+
+	_, err := ei.extractWithRetries(context.Background(), Assessment{Result: "User performance data."})
+	assert.NoError(t, err)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_resolveRetryPredicate(t *testing.T) {
+	RegisterRetryPredicate("test-never", func(error, int) bool { return false })
+	defer delete(retryPredicates, "test-never")
+
+	ei := &ExtractInsights{RetryPredicateName: "test-never"}
+	assert.NoError(t, ei.resolveRetryPredicate())
+	assert.NotNil(t, ei.retryPredicate)
+
+	ei = &ExtractInsights{RetryPredicateName: "missing"}
+	assert.ErrorContains(t, ei.resolveRetryPredicate(), `unknown retry predicate "missing"`)
+}
+
+func TestExtractInsights_PostProcessors(t *testing.T) {
+	var calls []string
+	normalize := func(insights InsightsResult) (InsightsResult, error) {
+		calls = append(calls, "normalize")
+		for i, strength := range insights.Strengths {
+			insights.Strengths[i] = strings.ToLower(strength)
+		}
+		return insights, nil
+	}
+	enrich := func(insights InsightsResult) (InsightsResult, error) {
+		calls = append(calls, "enrich")
+		insights.Strengths = append(insights.Strengths, "verified")
+		return insights, nil
+	}
+	reject := func(insights InsightsResult) (InsightsResult, error) {
+		calls = append(calls, "reject")
+		return insights, errors.New("redaction failed")
+	}
+
+	testCases := []struct {
+		name           string
+		postProcessors []PostProcessor
+		expectedCalls  []string
+		expectedResult InsightsResult
+		expectError    bool
+	}{
+		{
+			name:           "Applied in order",
+			postProcessors: []PostProcessor{normalize, enrich},
+			expectedCalls:  []string{"normalize", "enrich"},
+			expectedResult: InsightsResult{Strengths: []string{"bigquery", "verified"}},
+		},
+		{
+			name:           "Short-circuits on error",
+			postProcessors: []PostProcessor{reject, enrich},
+			expectedCalls:  []string{"reject"},
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls = nil
+			mockLLM := new(MockLanguageModel)
+			ei := &ExtractInsights{model: mockLLM, postProcessors: tc.postProcessors}
+
+			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+				Return(`{"strengths": ["BigQuery"]}`, nil)
+
+			result, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+			assert.Equal(t, tc.expectedCalls, calls)
+			if tc.expectError {
+				assert.ErrorContains(t, err, "redaction failed")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
+
+func TestExtractInsights_resolvePostProcessors(t *testing.T) {
+	RegisterPostProcessor("test-noop", func(insights InsightsResult) (InsightsResult, error) {
+		return insights, nil
+	})
+	defer delete(postProcessors, "test-noop")
+
+	ei := &ExtractInsights{PostProcessorNames: []string{"test-noop"}}
+	assert.NoError(t, ei.resolvePostProcessors())
+	assert.Len(t, ei.postProcessors, 1)
+
+	ei = &ExtractInsights{PostProcessorNames: []string{"missing"}}
+	assert.ErrorContains(t, ei.resolvePostProcessors(), `unknown post-processor "missing"`)
+}
+
+func init() {
+	RegisterPostProcessor("test-shout", func(insights InsightsResult) (InsightsResult, error) {
+		insights.OverallAssessment = strings.ToUpper(insights.OverallAssessment)
+		return insights, nil
+	})
+	register.Function1x1(overallAssessment)
+}
+
+// overallAssessment returns the overall assessment of the insights, to be compared in pipelines.
+func overallAssessment(insights InsightsResult) string {
+	return insights.OverallAssessment
+}
+
+func TestExtractInsights_Pipeline(t *testing.T) {
+	// The fake model answers in place of Gemini, which has no API key here
+	t.Setenv("GEMINI_API_KEY", "")
+	os.Unsetenv("GEMINI_API_KEY")
+	t.Setenv("ALLOW_FAKE_FALLBACK", "true")
+
+	// The DoFn is encoded and decoded, so the workers resolve the named functions in Setup
+	extractInsights := NewExtractInsights(1, time.Millisecond)
+	extractInsights.PostProcessorNames = []string{"test-shout"}
+	extractInsights.PromptCompressorName = "whitespace"
+	extractInsights.RetryPredicateName = "test-never"
+	RegisterRetryPredicate("test-never", func(error, int) bool { return false })
+	defer delete(retryPredicates, "test-never")
+
+	p, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, Assessment{ID: "assessment-1", Result: "User performance data."})
+	rubrics := beam.CreateList(scope, []string{})
+	processed, _, _, _, _, _ := beam.ParDo6(scope, extractInsights, assessments, beam.SideInput{Input: rubrics})
+	passert.Equals(scope, beam.ParDo(scope, overallAssessment, processed), "FAKE INSIGHTS: THE LLM PROVIDER FAILED TO AUTHENTICATE.")
+
+	if err := ptest.Run(p); err != nil {
+		t.Fatalf("Failed to run the pipeline: %v", err)
+	}
+}
+
+func TestFilterDatabase(t *testing.T) {
+	p, scope := beam.NewPipelineWithRoot()
+	insights := beam.Create(scope,
+		InsightsResult{AssessmentID: "a", OverallAssessment: "EU", Database: "assessments-eu"},
+		InsightsResult{AssessmentID: "a", OverallAssessment: "US", Database: "assessments-us"},
+		InsightsResult{AssessmentID: "b", OverallAssessment: "Default"},
+	)
+	filtered := beam.ParDo(scope, &filterDatabaseFn{Database: "assessments-eu"}, insights)
+	passert.Equals(scope, beam.ParDo(scope, overallAssessment, filtered), "EU")
+
+	if err := ptest.Run(p); err != nil {
+		t.Fatalf("Failed to run the pipeline: %v", err)
+	}
+}
+
+func TestExtractInsights_RecordResponseMeta(t *testing.T) {
+	meta := llm.ResponseMeta{ModelVersion: "claude-3-5-sonnet-20240620", FinishReason: "end_turn"}
+
+	testCases := []struct {
+		name           string
+		record         bool
+		expectedResult InsightsResult
+	}{
+		{
+			name:   "Recorded",
+			record: true,
+			expectedResult: InsightsResult{
+				Strengths:    []string{"BigQuery"},
+				ModelVersion: "claude-3-5-sonnet-20240620",
+				FinishReason: "end_turn",
+			},
+		},
+		{
+			name:           "Not recorded by default",
+			expectedResult: InsightsResult{Strengths: []string{"BigQuery"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockLLM := new(MockMetadataLanguageModel)
+			ei := &ExtractInsights{model: mockLLM, RecordResponseMeta: tc.record}
+
+			mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+				Return(`{"strengths": ["BigQuery"]}`, meta, nil)
+
+			result, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
+
+func TestExtractInsights_Audit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, Audit: AuditConfig{Path: path, Prompts: llm.AuditPromptRedact}}
+	assert.NoError(t, ei.auditModel(llm.LLMConfig{Provider: llm.ProviderGemini}))
+
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"strengths": ["BigQuery"]}`, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, ei.Teardown())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2, "Expected one audit record per call")
+	for _, line := range lines {
+		assert.Contains(t, line, `"model":"gemini"`)
+		assert.Contains(t, line, `"prompt":"[REDACTED]"`)
+	}
+}
+
+func TestExtractInsights_MaxTotalCalls(t *testing.T) {
+	totalCalls.Store(0)
+	t.Cleanup(func() { totalCalls.Store(0) })
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:         mockLLM,
+		MaxRetries:    2,
+		RetryDelay:    time.Millisecond,
+		MaxTotalCalls: 3,
+	}
+
+	promptContains := func(result string) interface{} {
+		return mock.MatchedBy(func(prompt string) bool { return strings.Contains(prompt, "\n"+result+"\n") })
+	}
+
+	// The first assessment succeeds, the second one fails once and is retried, spending the budget
+	mockLLM.On("GenerateText", mock.Anything, promptContains("first"), mock.Anything).
+		Return(`{"overall_assessment": "First"}`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, promptContains("second"), mock.Anything).
+		Return("", errors.New("API error")).Once()
+	mockLLM.On("GenerateText", mock.Anything, promptContains("second"), mock.Anything).
+		Return(`{"overall_assessment": "Second"}`, nil).Once()
+
+	var (
+		results []InsightsResult
+		skipped []Assessment
+	)
+	emit := func(insights InsightsResult) { results = append(results, insights) }
+	skip := func(assessment Assessment) { skipped = append(skipped, assessment) }
+
+	for _, result := range []string{"first", "second", "third", "fourth"} {
+		ei.ProcessElement(context.Background(), Assessment{Result: result}, noRubric, emit, skip, noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "First"}, {OverallAssessment: "Second"}}, results)
+	budget := newFailure(errBudgetExhausted)
+	assert.Equal(t, []Assessment{{Result: "third", Failure: budget}, {Result: "fourth", Failure: budget}}, skipped)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_MaxTotalCallsSpentDuringRetries(t *testing.T) {
+	totalCalls.Store(0)
+	t.Cleanup(func() { totalCalls.Store(0) })
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:         mockLLM,
+		MaxRetries:    3,
+		RetryDelay:    time.Millisecond,
+		MaxTotalCalls: 1,
+	}
+
+	// The retry would go beyond the budget, so the assessment is skipped
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", errors.New("API error")).Once()
 
+	var skipped []Assessment
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+		t.Errorf("Unexpected insights: %+v", insights)
+	}, func(assessment Assessment) {
+		skipped = append(skipped, assessment)
+	}, noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	assert.Equal(t, []Assessment{{Result: "User performance data.", Failure: newFailure(errBudgetExhausted)}}, skipped)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestCompactWhitespace(t *testing.T) {
+	prompt := "  Question 1:\tWhich   service?\n\n\n   Answer:  BigQuery  \n\t\n"
+
+	compressed, err := compactWhitespace(prompt)
+	assert.NoError(t, err)
+	assert.Equal(t, "Question 1: Which service?\nAnswer: BigQuery", compressed)
+}
+
+func TestExtractInsights_PromptCompressor(t *testing.T) {
+	testCases := []struct {
+		name           string
+		compressor     PromptCompressor
+		expectedPrompt string
+		expectError    bool
+	}{
+		{
+			name:           "Compressed before sending",
+			compressor:     func(prompt string) (string, error) { return "compressed", nil },
+			expectedPrompt: "compressed",
+		},
+		{
+			name:        "Compression error",
+			compressor:  func(prompt string) (string, error) { return "", errors.New("compressor unavailable") },
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockLLM := new(MockLanguageModel)
+			ei := &ExtractInsights{model: mockLLM, promptCompressor: tc.compressor}
+
+			if !tc.expectError {
+				mockLLM.On("GenerateText", mock.Anything, tc.expectedPrompt, mock.Anything).
+					Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+			}
+
+			_, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
 			if tc.expectError {
-				assert.Error(t, err)
+				assert.ErrorContains(t, err, "compressor unavailable")
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedResult, result)
 			}
+			mockLLM.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExtractInsights_resolvePromptCompressor(t *testing.T) {
+	ei := &ExtractInsights{PromptCompressorName: "whitespace"}
+	assert.NoError(t, ei.resolvePromptCompressor())
+	assert.NotNil(t, ei.promptCompressor)
+
+	ei = &ExtractInsights{PromptCompressorName: "missing"}
+	assert.ErrorContains(t, ei.resolvePromptCompressor(), `unknown prompt compressor "missing"`)
+}
+
+func TestExtractInsights_GeneratedAt(t *testing.T) {
+	generatedAt := time.Date(2024, 1, 1, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+	now = func() time.Time { return generatedAt }
+	t.Cleanup(func() { now = func() time.Time { return time.Time{} } })
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 1}
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil)
+
+	insights, err := ei.extractWithRetries(context.Background(), Assessment{Result: "User performance data."})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 4, 30, 0, 0, time.UTC), insights.GeneratedAt)
+}
+
+func TestExtractInsights_FakeOnAuthError(t *testing.T) {
+	t.Setenv("ALLOW_FAKE_FALLBACK", "true")
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: llm.NewFakeOnAuthErrorModel(mockLLM, fakeInsights)}
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", fmt.Errorf("%w: invalid API key", llm.ErrAuthentication))
+
+	insights, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Fake insights: the LLM provider failed to authenticate.", insights.OverallAssessment)
+}
+
+func TestExtractInsights_FinishReasons(t *testing.T) {
+	testCases := []struct {
+		name              string
+		responses         []llm.ResponseMeta
+		expectedMaxTokens []int
+		expectEmitted     bool
+		expectRefused     bool
+	}{
+		{
+			name:              "Stop succeeds",
+			responses:         []llm.ResponseMeta{{Reason: llm.FinishReasonStop}},
+			expectedMaxTokens: []int{0},
+			expectEmitted:     true,
+		},
+		{
+			name:              "Length retries with more tokens",
+			responses:         []llm.ResponseMeta{{Reason: llm.FinishReasonLength}, {Reason: llm.FinishReasonLength}, {Reason: llm.FinishReasonStop}},
+			expectedMaxTokens: []int{0, 2048, 4096},
+			expectEmitted:     true,
+		},
+		{
+			name:              "Safety is refused without retrying",
+			responses:         []llm.ResponseMeta{{Reason: llm.FinishReasonSafety, FinishReason: "FinishReasonSafety"}},
+			expectedMaxTokens: []int{0},
+			expectRefused:     true,
+		},
+		{
+			name:              "Refusal is refused without retrying",
+			responses:         []llm.ResponseMeta{{Reason: llm.FinishReasonRefusal, FinishReason: "refusal"}},
+			expectedMaxTokens: []int{0},
+			expectRefused:     true,
+		},
+		{
+			name:              "Transient is retried",
+			responses:         []llm.ResponseMeta{{Reason: llm.FinishReasonTransient, FinishReason: "error"}, {Reason: llm.FinishReasonStop}},
+			expectedMaxTokens: []int{0, 0},
+			expectEmitted:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockLLM := new(MockMetadataLanguageModel)
+			ei := &ExtractInsights{model: mockLLM, MaxRetries: 3, RetryDelay: time.Millisecond, maxTokens: 1024}
+
+			var maxTokens []int
+			for _, meta := range tc.responses {
+				mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+					Run(func(args mock.Arguments) {
+						maxTokens = append(maxTokens, args.Get(2).(*llm.GenerateOptions).MaxTokens)
+					}).
+					Return(`{"overall_assessment": "Good performance"}`, meta, nil).Once()
+			}
+
+			var (
+				results []InsightsResult
+				refused []Assessment
+			)
+			ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+				results = append(results, insights)
+			}, noSkipped(t), func(assessment Assessment) {
+				refused = append(refused, assessment)
+			}, noRecited(t), noEvals(t), noRaw(t))
+
+			assert.Equal(t, tc.expectedMaxTokens, maxTokens)
+			assert.Equal(t, tc.expectEmitted, len(results) == 1)
+			assert.Equal(t, tc.expectRefused, len(refused) == 1)
+			mockLLM.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExtractInsights_Rubric(t *testing.T) {
+	const rubric = "Scoring: 8 of 10 correct answers or more is a pass."
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 1, RetryDelay: time.Millisecond}
+
+	// The rubric side input is read once, then referenced by every prompt
+	reads := 0
+	rubricSideInput := func(part *string) bool {
+		if reads > 0 {
+			return false
+		}
+		reads++
+		*part = rubric
+		return true
+	}
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, "official rubric:\n"+rubric+"\n")
+	}), mock.Anything).Return(`{"overall_assessment": "Pass"}`, nil).Twice()
+
+	var results []InsightsResult
+	emit := func(insights InsightsResult) { results = append(results, insights) }
+	for _, result := range []string{"First assessment.", "Second assessment."} {
+		ei.ProcessElement(context.Background(), Assessment{Result: result}, rubricSideInput, emit, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+
+	assert.Len(t, results, 2)
+	assert.Equal(t, 1, reads)
+	mockLLM.AssertExpectations(t)
+
+	// The side input is wired into the pipeline
+	_, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, Assessment{Result: "Assessment"})
+	assert.NotPanics(t, func() { transformData(scope, Config{MaxRetries: 1}, assessments, rubric) })
+}
+
+func TestExtractInsights_RetryJitterSeed(t *testing.T) {
+	delays := func(ei *ExtractInsights) []time.Duration {
+		var delays []time.Duration
+		for i := 0; i < 5; i++ {
+			delays = append(delays, ei.retryDelay())
+		}
+		return delays
+	}
+	newExtractInsights := func() *ExtractInsights {
+		ei := NewExtractInsights(3, 10*time.Second)
+		ei.RetryJitter = 0.2
+		return ei
+	}
+
+	// The same seed gives the same delays, within the jitter bounds
+	first := delays(newExtractInsights().WithRetryJitterSeed(42))
+	assert.Equal(t, first, delays(newExtractInsights().WithRetryJitterSeed(42)))
+	for _, delay := range first {
+		assert.GreaterOrEqual(t, delay, 8*time.Second)
+		assert.Less(t, delay, 12*time.Second)
+	}
+	assert.NotEqual(t, first, delays(newExtractInsights().WithRetryJitterSeed(7)))
+
+	// Without jitter the delay is RetryDelay
+	assert.Equal(t, 10*time.Second, NewExtractInsights(3, 10*time.Second).WithRetryJitterSeed(42).retryDelay())
+}
+
+func TestExtractInsights_PreferredModel(t *testing.T) {
+	configured, flash := new(MockLanguageModel), new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:      configured,
+		models:     map[string]llm.LanguageModel{"gemini-1.5-flash-002": flash},
+		LLM:        llm.LLMConfig{Model: "gemini-1.5-pro-002"},
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+	}
+
+	// Only the assessment preferring a known model other than the configured one is routed to it
+	configured.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Configured"}`, nil).Times(3)
+	flash.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Flash"}`, nil).Once()
+
+	testCases := []struct {
+		preferredModel string
+		expected       string
+	}{
+		{preferredModel: "", expected: "Configured"},
+		{preferredModel: "gemini-1.5-flash-002", expected: "Flash"},
+		{preferredModel: "gemini-1.5-pro-002", expected: "Configured"},
+		{preferredModel: "gpt-4o", expected: "Configured"},
+	}
+
+	for _, tc := range testCases {
+		var results []InsightsResult
+		emit := func(insights InsightsResult) { results = append(results, insights) }
+		ei.ProcessElement(context.Background(), Assessment{Result: "User performance data.", PreferredModel: tc.preferredModel}, noRubric, emit, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+		if assert.Len(t, results, 1, "preferred model %q", tc.preferredModel) {
+			assert.Equal(t, tc.expected, results[0].OverallAssessment, "preferred model %q", tc.preferredModel)
+		}
+	}
+
+	configured.AssertExpectations(t)
+	flash.AssertExpectations(t)
+
+	// Every chunk of a chunked assessment goes to its preferred model
+	ei.ChunkSize = 20
+	flash.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Flash"}`, nil).Twice()
+	var results []InsightsResult
+	ei.ProcessElement(context.Background(), Assessment{Result: "First part of the data. Second part.", PreferredModel: "gemini-1.5-flash-002"}, noRubric, func(insights InsightsResult) {
+		results = append(results, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	assert.Len(t, results, 1)
+	flash.AssertExpectations(t)
+}
+
+func TestExtractInsights_EmitRaw(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:      mockLLM,
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+		EmitRaw:    true,
+		// Normalizes the strengths in place
+		postProcessors: []PostProcessor{func(insights InsightsResult) (InsightsResult, error) {
+			for i, strength := range insights.Strengths {
+				insights.Strengths[i] = strings.ToLower(strength)
+			}
+			return insights, nil
+		}},
+	}
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance", "strengths": ["BigQuery", "Dataflow"]}`, nil).Once()
+
+	var normalized, raw []InsightsResult
+	completedAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data.", CompletedAt: completedAt}, noRubric, func(insights InsightsResult) {
+		normalized = append(normalized, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), func(insights InsightsResult) {
+		raw = append(raw, insights)
+	})
+	mockLLM.AssertExpectations(t)
+
+	// Both versions are emitted, only the normalized one is post-processed
+	if !assert.Len(t, normalized, 1) || !assert.Len(t, raw, 1) {
+		return
+	}
+	assert.Equal(t, []string{"bigquery", "dataflow"}, normalized[0].Strengths)
+	assert.Equal(t, []string{"BigQuery", "Dataflow"}, raw[0].Strengths)
+	assert.Equal(t, completedAt, raw[0].CompletedAt)
+	assert.Equal(t, normalized[0].GeneratedAt, raw[0].GeneratedAt)
+
+	// The raw output is wired into the pipeline
+	_, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, Assessment{Result: "Assessment"})
+	processed, _, _, _, _, rawInsights := transformData(scope, Config{MaxRetries: 1, EmitRaw: true}, assessments, "")
+	assert.Equal(t, processed.Type(), rawInsights.Type())
+}
+
+func TestExtractInsights_MinAvgLogprob(t *testing.T) {
+	lowConfidence, highConfidence := -1.2, -0.1
+
+	mockLLM := new(MockMetadataLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 3, RetryDelay: time.Millisecond, MinAvgLogprob: -0.5}
+
+	// A low-confidence candidate is retried, then a confident one is kept
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Unsure"}`, llm.ResponseMeta{Reason: llm.FinishReasonStop, AvgLogprobs: &lowConfidence}, nil).Once()
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, llm.ResponseMeta{Reason: llm.FinishReasonStop, AvgLogprobs: &highConfidence}, nil).Once()
+
+	var results []InsightsResult
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+		results = append(results, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "Good performance", results[0].OverallAssessment)
+	}
+	mockLLM.AssertExpectations(t)
+
+	// Disabled by default, and responses without logprobs are never rejected
+	ei.MinAvgLogprob = 0
+	_, err := ei.parseInsights(`{"overall_assessment": "Unsure"}`, llm.ResponseMeta{AvgLogprobs: &lowConfidence})
+	assert.NoError(t, err)
+	ei.MinAvgLogprob = -0.5
+	_, err = ei.parseInsights(`{"overall_assessment": "Unsure"}`, llm.ResponseMeta{})
+	assert.NoError(t, err)
+	_, err = ei.parseInsights(`{"overall_assessment": "Unsure"}`, llm.ResponseMeta{AvgLogprobs: &lowConfidence})
+	assert.ErrorIs(t, err, errLowConfidence)
+}
+
+func TestExtractInsights_Eval(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:          mockLLM,
+		InsightsSchema: "{}",
+		MaxRetries:     2,
+		RetryDelay:     time.Millisecond,
+		Eval:           true,
+	}
+
+	// A malformed response, retried, then a valid one
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good"`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good"}`, nil).Once()
+
+	var (
+		results []InsightsResult
+		records []EvalRecord
+	)
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+		results = append(results, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), func(record EvalRecord) {
+		records = append(records, record)
+	}, noRaw(t))
+
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "Good"}}, results)
+	if assert.Len(t, records, 2) {
+		for _, record := range records {
+			assert.Contains(t, record.Prompt, "User performance data.")
+		}
+		assert.Equal(t, `{"overall_assessment": "Good"`, records[0].RawResponse)
+		assert.Equal(t, InsightsResult{OverallAssessment: "Good"}, records[0].Parsed)
+		assert.Contains(t, records[0].Error, "error unmarshaling insights")
+		assert.Equal(t, `{"overall_assessment": "Good"}`, records[1].RawResponse)
+		assert.Equal(t, InsightsResult{OverallAssessment: "Good"}, records[1].Parsed)
+		assert.Empty(t, records[1].Error)
+	}
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_TruncatedError(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 2, RetryDelay: time.Millisecond, maxTokens: 1024}
+
+	// A model without metadata, e.g. behind a decorator, reports the truncation as an error
+	var maxTokens []int
+	record := func(args mock.Arguments) {
+		maxTokens = append(maxTokens, args.Get(2).(*llm.GenerateOptions).MaxTokens)
+	}
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Run(record).
+		Return(`{"overall_assessment": "Good`, fmt.Errorf("%w: anthropic stop reason max_tokens", llm.ErrTruncated)).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Run(record).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+
+	var results []InsightsResult
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+		results = append(results, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "Good performance"}}, results)
+	assert.Equal(t, []int{0, 2048}, maxTokens)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestUnmarshalError(t *testing.T) {
+	longAssessment := strings.Repeat("a", 300)
+
+	testCases := []struct {
+		name        string
+		text        string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "Syntax error",
+			text: `{"overall_assessment": "Good", oops}`,
+			contains: []string{
+				"error unmarshaling insights at offset 32",
+				`near "overall_assessment\": \"Good\", oops}"`,
+				"invalid character 'o'",
+				"response of 36 bytes",
+			},
+		},
+		{
+			name: "Type error",
+			text: `{"questions_answered_correctly": "five"}`,
+			contains: []string{
+				"error unmarshaling insights at offset 39",
+				"cannot unmarshal string",
+			},
+		},
+		{
+			name: "Long response is truncated",
+			text: `{"overall_assessment": "` + longAssessment + `"`,
+			contains: []string{
+				"error unmarshaling insights at offset 325",
+				"response of 325 bytes",
+				`starts with "{\"overall_assessment\": \"` + strings.Repeat("a", 176) + `…"`,
+			},
+			notContains: []string{strings.Repeat("a", 177)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var insights InsightsResult
+			err := unmarshalError(json.Unmarshal([]byte(tc.text), &insights), tc.text)
+
+			for _, want := range tc.contains {
+				assert.Contains(t, err.Error(), want)
+			}
+			for _, unwanted := range tc.notContains {
+				assert.NotContains(t, err.Error(), unwanted)
+			}
+		})
+	}
+}
+
+func TestExtractInsights_Recitation(t *testing.T) {
+	recitationErr := fmt.Errorf("%w: %w: error sending message: blocked: candidate: FinishReasonRecitation", llm.ErrRefused, llm.ErrRecitation)
+
+	testCases := []struct {
+		name          string
+		policy        RecitationPolicy
+		expectRecited bool
+	}{
+		{name: "Refused by default"},
+		{name: "Refused", policy: RecitationRefuse},
+		{name: "Dedicated output", policy: RecitationOutput, expectRecited: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockLLM := new(MockLanguageModel)
+			ei := &ExtractInsights{model: mockLLM, MaxRetries: 3, RetryDelay: time.Millisecond, Recitation: tc.policy}
+
+			// Blocked responses aren't retried
+			mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Return("", recitationErr).Once()
+
+			var refused, recited []Assessment
+			ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+				t.Errorf("Unexpected insights: %+v", insights)
+			}, noSkipped(t), func(assessment Assessment) {
+				refused = append(refused, assessment)
+			}, func(assessment Assessment) {
+				recited = append(recited, assessment)
+			}, noEvals(t), noRaw(t))
 
+			blocked := []Assessment{{Result: "User performance data.", Failure: newFailure(recitationErr)}}
+			if tc.expectRecited {
+				assert.Empty(t, refused)
+				assert.Equal(t, blocked, recited)
+			} else {
+				assert.Equal(t, blocked, refused)
+				assert.Empty(t, recited)
+			}
 			mockLLM.AssertExpectations(t)
 		})
 	}
 }
+
+func TestExtractInsights_RecitationFinishReason(t *testing.T) {
+	mockLLM := new(MockMetadataLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 3, RetryDelay: time.Millisecond, Recitation: RecitationOutput}
+
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Quoted"}`, llm.ResponseMeta{Reason: llm.FinishReasonRecitation, FinishReason: "FinishReasonRecitation"}, nil).Once()
+
+	var recited []Assessment
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+		t.Errorf("Unexpected insights: %+v", insights)
+	}, noSkipped(t), noRefused(t), func(assessment Assessment) {
+		recited = append(recited, assessment)
+	}, noEvals(t), noRaw(t))
+
+	recitation := &Failure{Category: FailureRecitation, Message: failureMessages[FailureRecitation]}
+	assert.Equal(t, []Assessment{{Result: "User performance data.", Failure: recitation}}, recited)
+	mockLLM.AssertExpectations(t)
+}
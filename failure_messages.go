@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FailureCategory classifies why no insights could be extracted from an assessment.
+type FailureCategory string
+
+const (
+	// FailureUnavailable is a transient provider error, e.g. a timeout or an overloaded service.
+	FailureUnavailable FailureCategory = "unavailable"
+	// FailureAuthentication is a rejected provider API key.
+	FailureAuthentication FailureCategory = "authentication"
+	// FailureBudget is a call or cost budget spent before the assessment was processed.
+	FailureBudget FailureCategory = "budget"
+	// FailureRefused is a model refusing to answer, e.g. for safety.
+	FailureRefused FailureCategory = "refused"
+	// FailureRecitation is a response blocked for reciting existing content.
+	FailureRecitation FailureCategory = "recitation"
+	// FailureTruncated is a response cut off at the token limit.
+	FailureTruncated FailureCategory = "truncated"
+	// FailureInvalidResponse is a response whose insights couldn't be parsed or validated.
+	FailureInvalidResponse FailureCategory = "invalid_response"
+	// FailureUnknown is any other error.
+	FailureUnknown FailureCategory = "unknown"
+)
+
+// failureMessages are the human-readable messages of the failure categories, shown to users.
+var failureMessages = map[FailureCategory]string{
+	FailureUnavailable:     "The AI service was temporarily unavailable; we'll retry automatically.",
+	FailureAuthentication:  "The AI service could not be reached with the configured credentials; an operator has to fix the configuration.",
+	FailureBudget:          "The processing budget of this run was spent; the assessment will be processed in a later run.",
+	FailureRefused:         "The AI service declined to analyze this assessment; it needs a manual review.",
+	FailureRecitation:      "The analysis was blocked for quoting existing content; it needs a manual review.",
+	FailureTruncated:       "The analysis of this assessment was too long to complete; it will be retried with a larger limit.",
+	FailureInvalidResponse: "The AI service returned an analysis that could not be read; we'll retry automatically.",
+	FailureUnknown:         "Something went wrong while analyzing this assessment; it needs a manual review.",
+}
+
+// Failure describes why no insights were extracted from an assessment, for the dead-letter records.
+type Failure struct {
+	Category FailureCategory `json:"category"`
+	// Message is the human-readable message of the category, e.g. for a retry UI.
+	Message string `json:"message"`
+	// SafetyBlock is the block reason and safety ratings of a Gemini safety block.
+	SafetyBlock *llm.SafetyBlock `json:"safety_block,omitempty"`
+}
+
+// newFailure categorizes the error of an extraction, with the message of its category.
+func newFailure(err error) *Failure {
+	category := failureCategory(err)
+	failure := &Failure{Category: category, Message: failureMessages[category]}
+	if block, ok := llm.SafetyBlockOf(err); ok {
+		failure.SafetyBlock = &block
+	}
+	return failure
+}
+
+// failureCategory classifies the error of an extraction. Recitations are checked before
+// refusals, as they are refusals too.
+func failureCategory(err error) FailureCategory {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, errBudgetExhausted):
+		return FailureBudget
+	case llm.IsRecitation(err):
+		return FailureRecitation
+	case llm.IsRefused(err):
+		return FailureRefused
+	case llm.IsAuthError(err):
+		return FailureAuthentication
+	case llm.IsTruncated(err):
+		return FailureTruncated
+	case errors.Is(err, errEmptyResponse), errors.Is(err, errLowConfidence), errors.Is(err, errInvalidToolInput),
+		errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return FailureInvalidResponse
+	case errors.Is(err, errTransientFinish), errors.Is(err, context.DeadlineExceeded):
+		return FailureUnavailable
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return FailureUnavailable
+	default:
+		return FailureUnknown
+	}
+}
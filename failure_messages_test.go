@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewFailure(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected Failure
+	}{
+		{
+			name:     "Provider unavailable",
+			err:      fmt.Errorf("error generating text: %w", status.Error(codes.Unavailable, "the service is currently unavailable")),
+			expected: Failure{Category: FailureUnavailable, Message: "The AI service was temporarily unavailable; we'll retry automatically."},
+		},
+		{
+			name:     "Request timeout",
+			err:      fmt.Errorf("error generating text: %w", context.DeadlineExceeded),
+			expected: Failure{Category: FailureUnavailable, Message: "The AI service was temporarily unavailable; we'll retry automatically."},
+		},
+		{
+			name:     "Rejected API key",
+			err:      fmt.Errorf("%w: invalid API key", llm.ErrAuthentication),
+			expected: Failure{Category: FailureAuthentication, Message: "The AI service could not be reached with the configured credentials; an operator has to fix the configuration."},
+		},
+		{
+			name:     "Call budget spent",
+			err:      errBudgetExhausted,
+			expected: Failure{Category: FailureBudget, Message: "The processing budget of this run was spent; the assessment will be processed in a later run."},
+		},
+		{
+			name:     "Refused response",
+			err:      fmt.Errorf("error generating text: %w", llm.ErrRefused),
+			expected: Failure{Category: FailureRefused, Message: "The AI service declined to analyze this assessment; it needs a manual review."},
+		},
+		{
+			name:     "Recitation, a refusal too",
+			err:      fmt.Errorf("%w: %w", llm.ErrRefused, llm.ErrRecitation),
+			expected: Failure{Category: FailureRecitation, Message: "The analysis was blocked for quoting existing content; it needs a manual review."},
+		},
+		{
+			name:     "Truncated response",
+			err:      fmt.Errorf("error generating text: %w", llm.ErrTruncated),
+			expected: Failure{Category: FailureTruncated, Message: "The analysis of this assessment was too long to complete; it will be retried with a larger limit."},
+		},
+		{
+			name:     "Malformed JSON",
+			err:      unmarshalError(json.Unmarshal([]byte(`{"overall_assessment": `), &InsightsResult{}), `{"overall_assessment": `),
+			expected: Failure{Category: FailureInvalidResponse, Message: "The AI service returned an analysis that could not be read; we'll retry automatically."},
+		},
+		{
+			name:     "Empty response",
+			err:      errEmptyResponse,
+			expected: Failure{Category: FailureInvalidResponse, Message: "The AI service returned an analysis that could not be read; we'll retry automatically."},
+		},
+		{
+			name:     "Other errors",
+			err:      errors.New("API error"),
+			expected: Failure{Category: FailureUnknown, Message: "Something went wrong while analyzing this assessment; it needs a manual review."},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, &tc.expected, newFailure(tc.err))
+		})
+	}
+
+	// Every category has a message
+	for _, category := range []FailureCategory{
+		FailureUnavailable, FailureAuthentication, FailureBudget, FailureRefused,
+		FailureRecitation, FailureTruncated, FailureInvalidResponse, FailureUnknown,
+	} {
+		assert.NotEmpty(t, failureMessages[category], "Expected a message for %s", category)
+	}
+}
+
+func TestExtractInsights_SafetyBlockDeadLetter(t *testing.T) {
+	blockErr := &llm.SafetyBlockError{
+		SafetyBlock: llm.SafetyBlock{
+			BlockReason: "BlockReasonSafety",
+			Ratings:     []llm.SafetyRating{{Category: "HarmCategoryHarassment", Probability: "HarmProbabilityHigh", Blocked: true}},
+		},
+		Err: &genai.BlockedError{PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonSafety}},
+	}
+	mockLLM := new(MockLanguageModel)
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", fmt.Errorf("%w: error sending message: %w", llm.ErrRefused, blockErr)).Once()
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 3, RetryDelay: time.Millisecond}
+
+	// The blocked assessment is dead-lettered once, with its block categories
+	var refused []Assessment
+	ei.ProcessElement(context.Background(), Assessment{Result: "User performance data."}, noRubric, func(insights InsightsResult) {
+		t.Errorf("Unexpected insights: %+v", insights)
+	}, noSkipped(t), func(assessment Assessment) {
+		refused = append(refused, assessment)
+	}, noRecited(t), noEvals(t), noRaw(t))
+	mockLLM.AssertExpectations(t)
+	if !assert.Len(t, refused, 1) {
+		return
+	}
+	assert.Equal(t, FailureRefused, refused[0].Failure.Category)
+	assert.Equal(t, &blockErr.SafetyBlock, refused[0].Failure.SafetyBlock)
+	assert.JSONEq(t, `{
+		"category": "refused",
+		"message": "The AI service declined to analyze this assessment; it needs a manual review.",
+		"safety_block": {
+			"block_reason": "BlockReasonSafety",
+			"safety_ratings": [{"category": "HarmCategoryHarassment", "probability": "HarmProbabilityHigh", "blocked": true}]
+		}
+	}`, failureJSON(t, refused[0]))
+}
+
+// failureJSON returns the JSON of the failure of a dead-lettered assessment.
+func failureJSON(t *testing.T, assessment Assessment) string {
+	t.Helper()
+	var record struct {
+		Failure json.RawMessage `json:"failure"`
+	}
+	if err := json.Unmarshal([]byte(assessmentToJSON(assessment)), &record); err != nil {
+		t.Fatalf("Failed to parse the dead-letter record: %v", err)
+	}
+	return string(record.Failure)
+}
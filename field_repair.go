@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// invalidField returns the top-level field of the insights an unmarshal type error or a
+// validation error is about, if any. Syntax errors and errors about no field in particular
+// aren't field errors.
+func invalidField(err error) (string, bool) {
+	var (
+		typeErr  *json.UnmarshalTypeError
+		fieldErr *fieldError
+	)
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		field, _, _ := strings.Cut(typeErr.Field, ".")
+		return field, true
+	case errors.As(err, &fieldErr):
+		return fieldErr.Field, true
+	}
+	return "", false
+}
+
+/*
+repairField asks the model to correct the invalid field of a response that is otherwise valid
+JSON, instead of extracting the insights all over again: the follow-up prompt quotes the
+response and the error, and asks for a JSON object holding only the corrected field, which
+replaces the invalid one before the response is parsed again.
+
+The follow-up call counts towards MaxTotalCalls, its tokens towards MaxCost and the metrics.
+*/
+func (ei *ExtractInsights) repairField(ctx context.Context, model llm.LanguageModel, modelName, text string, meta llm.ResponseMeta, field string, cause error) (InsightsResult, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return InsightsResult{}, fmt.Errorf("error repairing field %q: response is not a JSON object: %w", field, err)
+	}
+
+	if err := ei.takeCall(); err != nil {
+		return InsightsResult{}, err
+	}
+	prompt := fmt.Sprintf("The field %q of the following JSON response is invalid: %v\n%s\nPlease respond with a JSON object holding only the corrected %q field, following this JSON schema:\n%s . Remove any ```json or ``` characters. Avoid any comments or explanations", field, cause, text, field, ei.InsightsSchema)
+	repaired, repairMeta, err := llm.GenerateTextWithMetadata(ctx, model, prompt, &llm.GenerateOptions{ResponseMIMEType: "application/json"})
+	ei.recordCall(ctx, repairMeta, err)
+	ei.recordCost(repairMeta)
+	ei.recordTokens(ctx, modelName, repairMeta)
+	workerMetrics.inputTokens.Add(int64(repairMeta.InputTokens))
+	workerMetrics.outputTokens.Add(int64(repairMeta.OutputTokens))
+	manifestInputTokens.Inc(ctx, int64(repairMeta.InputTokens))
+	manifestOutputTokens.Inc(ctx, int64(repairMeta.OutputTokens))
+	if err != nil {
+		return InsightsResult{}, fmt.Errorf("error repairing field %q: %w", field, err)
+	}
+
+	var correction map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(repaired), &correction); err != nil {
+		return InsightsResult{}, fmt.Errorf("error repairing field %q: %w", field, unmarshalError(err, repaired))
+	}
+	value, ok := correction[field]
+	if !ok {
+		return InsightsResult{}, fmt.Errorf("error repairing field %q: missing from the response", field)
+	}
+	fields[field] = value
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return InsightsResult{}, fmt.Errorf("error repairing field %q: %w", field, err)
+	}
+	// The original response's metadata, as the repaired one only holds the field
+	return ei.parseInsights(string(merged), meta)
+}
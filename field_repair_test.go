@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExtractInsights_RepairFields(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, InsightsSchema: `{"type": "object"}`, RepairFields: true}
+
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.HasPrefix(prompt, "Given the following assessment")
+	}), mock.Anything).Return(`{"overall_assessment": "Good performance", "questions_answered_correctly": "eight", "strengths": ["BigQuery"]}`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.HasPrefix(prompt, `The field "questions_answered_correctly" of the following JSON response is invalid`)
+	}), mock.Anything).Return(`{"questions_answered_correctly": 8}`, nil).Once()
+
+	insights, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 8, insights.CorrectAnswers)
+	assert.Equal(t, "Good performance", insights.OverallAssessment)
+	assert.Equal(t, []string{"BigQuery"}, insights.Strengths)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestExtractInsights_RepairFieldsFailure(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, InsightsSchema: `{"type": "object"}`, RepairFields: true}
+
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"skill_gaps": [{"skill": "Dataflow", "severity": "critical"}]}`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return("", errors.New("provider unavailable")).Once()
+
+	// The attempt fails with the original error when the repair does
+	_, err := ei.generateInsights(context.Background(), Assessment{Result: "User performance data."}, 0)
+
+	assert.ErrorContains(t, err, `invalid severity "critical"`)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestInvalidField(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantField string
+		wantOK    bool
+	}{
+		{name: "Type error", err: unmarshalError(unmarshalInsights(`{"questions_answered_correctly": "8"}`), `{"questions_answered_correctly": "8"}`), wantField: "questions_answered_correctly", wantOK: true},
+		{name: "Nested type error", err: unmarshalInsights(`{"skill_gaps": [{"skill": 1}]}`), wantField: "skill_gaps", wantOK: true},
+		{name: "Validation error", err: validateInsights(InsightsResult{StudyPlans: map[string]StudyPlan{"Dataflow": {}}}), wantField: "study_plans", wantOK: true},
+		{name: "Syntax error", err: unmarshalInsights(`{"overall_assessment": `), wantOK: false},
+		{name: "Other error", err: errEmptyResponse, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := invalidField(tt.err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantField, field)
+		})
+	}
+}
+
+// unmarshalInsights returns the error of unmarshaling text into insights.
+func unmarshalInsights(text string) error {
+	var insights InsightsResult
+	return json.Unmarshal([]byte(text), &insights)
+}
@@ -14,16 +14,27 @@ func init() {
 	beam.RegisterType(reflect.TypeOf((*firestoreFn)(nil)))
 }
 
+// newClient creates the Firestore client for a database, replaced in tests by a fake.
+var newClient = func(ctx context.Context, project, databaseID string) (*firestore.Client, error) {
+	if databaseID == "" || databaseID == firestore.DefaultDatabaseID {
+		return firestore.NewClient(ctx, project)
+	}
+	return firestore.NewClientWithDatabase(ctx, project, databaseID)
+}
+
 type firestoreFn struct {
-	Project       string
-	Collection    string
-	Type          beam.EncodedType
+	Project    string
+	DatabaseID string
+	Collection string
+	Type       beam.EncodedType
+	// IDField names the string field of the elements holding their document ID, if any.
+	IDField       string
 	client        *firestore.Client
 	collectionRef *firestore.CollectionRef
 }
 
 func (fn *firestoreFn) Setup(ctx context.Context) error {
-	client, err := firestore.NewClient(ctx, fn.Project)
+	client, err := newClient(ctx, fn.Project, fn.DatabaseID)
 	if err != nil {
 		return fmt.Errorf("error initializing Firestore client: %w", err)
 	}
@@ -34,6 +45,28 @@ func (fn *firestoreFn) Setup(ctx context.Context) error {
 	return nil
 }
 
+// setDocumentID sets the IDField of the element out points to, if any, to the document ID.
+func (fn *firestoreFn) setDocumentID(out interface{}, id string) {
+	if fn.IDField == "" {
+		return
+	}
+	reflect.ValueOf(out).Elem().FieldByName(fn.IDField).SetString(id)
+}
+
+// checkStringField panics when the struct type has no string field named field, if any.
+func checkStringField(elemType reflect.Type, field string) {
+	if field == "" {
+		return
+	}
+	if elemType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("firestoreio: %v is not a struct, it has no field %s", elemType, field))
+	}
+	f, ok := elemType.FieldByName(field)
+	if !ok || f.Type.Kind() != reflect.String {
+		panic(fmt.Sprintf("firestoreio: %v has no string field %s", elemType, field))
+	}
+}
+
 func (fn *firestoreFn) Teardown() error {
 	if err := fn.client.Close(); err != nil {
 		return fmt.Errorf("error closing Firestore client: %w", err)
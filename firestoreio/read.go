@@ -3,23 +3,50 @@ package firestoreio
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"reflect"
+	"time"
 
+	"cloud.google.com/go/firestore"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func init() {
-	register.DoFn3x1[context.Context, []byte, func(beam.X), error](&readFn{})
+	register.DoFn4x1[context.Context, []byte, func(beam.X), func(DeadLetter), error](&readFn{})
 	register.Emitter1[beam.X]()
+	register.Emitter1[DeadLetter]()
 }
 
 type ReadConfig struct {
-	Project    string
+	Project string
+	// DatabaseID is the named database to read from, empty for the (default) database.
+	DatabaseID string
 	Collection string
+	// IDField names the string field of the elements set to their document ID, e.g. one
+	// tagged `firestore:"-"`. The document ID is not read when empty.
+	IDField string
+	// Limit bounds the number of documents read, every document is read when 0.
+	Limit int
+	// RequiredFields are the Firestore fields every document must hold, neither null nor an
+	// empty string. Documents missing one are malformed.
+	RequiredFields []string
+	// DeadLetter emits the malformed documents, that can't be decoded into the element type or
+	// miss a required field, to the dead-letter output of ReadWithDeadLetter instead of failing the read.
+	DeadLetter bool
+}
+
+// DeadLetter is a malformed document, with its raw data, as JSON, and why it was rejected.
+type DeadLetter struct {
+	ID       string `json:"id"`
+	Document string `json:"document"`
+	Error    string `json:"error"`
 }
 
 func Read(
@@ -27,10 +54,22 @@ func Read(
 	cfg ReadConfig,
 	elemType reflect.Type,
 ) beam.PCollection {
+	elems, _ := ReadWithDeadLetter(scope, cfg, elemType)
+	return elems
+}
+
+// ReadWithDeadLetter reads the documents like Read, also returning the DeadLetters of the
+// malformed documents when cfg.DeadLetter is set (an empty collection otherwise).
+func ReadWithDeadLetter(
+	scope beam.Scope,
+	cfg ReadConfig,
+	elemType reflect.Type,
+) (beam.PCollection, beam.PCollection) {
 	scope = scope.Scope("firestoreio.Read")
+	checkStringField(elemType, cfg.IDField)
 	impulse := beam.Impulse(scope)
 
-	return beam.ParDo(
+	return beam.ParDo2(
 		scope,
 		newReadFn(cfg, elemType),
 		impulse,
@@ -38,8 +77,73 @@ func Read(
 	)
 }
 
+const (
+	// defaultReadRetries is the number of times in a row a transient error is retried.
+	defaultReadRetries = 5
+	// defaultReadRetryDelay is the delay before the first retry, doubled after every retry.
+	defaultReadRetryDelay = time.Second
+)
+
+type document struct {
+	ID     string
+	DataTo func(interface{}) error
+	// Data returns the raw fields of the document.
+	Data func() map[string]interface{}
+}
+
+type documentIterator interface {
+	Next() (document, error)
+	Stop()
+}
+
+// newDocumentIterator iterates the documents of the collection by ID, starting after the
+// document startAfter (from the first document when empty), at most limit documents when set.
+var newDocumentIterator = func(ctx context.Context, collection *firestore.CollectionRef, startAfter string, limit int) documentIterator {
+	query := collection.OrderBy(firestore.DocumentID, firestore.Asc)
+	if startAfter != "" {
+		query = query.StartAfter(startAfter)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	return &queryIterator{iter: query.Documents(ctx)}
+}
+
+type queryIterator struct {
+	iter *firestore.DocumentIterator
+}
+
+func (i *queryIterator) Next() (document, error) {
+	docSnap, err := i.iter.Next()
+	if err != nil {
+		return document{}, err
+	}
+	return document{ID: docSnap.Ref.ID, DataTo: docSnap.DataTo, Data: docSnap.Data}, nil
+}
+
+func (i *queryIterator) Stop() {
+	i.iter.Stop()
+}
+
+// isTransient reports whether a Firestore error is worth retrying, e.g. a temporary unavailability.
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal:
+		return true
+	default:
+		return false
+	}
+}
+
 type readFn struct {
 	firestoreFn
+	// MaxRetries bounds the transient errors retried in a row, after which the read fails.
+	// The iteration resumes after the last document read, with exponential backoff from RetryDelay.
+	MaxRetries     int
+	RetryDelay     time.Duration
+	Limit          int
+	RequiredFields []string
+	DeadLetter     bool
 }
 
 func newReadFn(
@@ -47,11 +151,18 @@ func newReadFn(
 	elemType reflect.Type,
 ) *readFn {
 	return &readFn{
-		firestoreFn{
+		firestoreFn: firestoreFn{
 			Project:    cfg.Project,
+			DatabaseID: cfg.DatabaseID,
 			Collection: cfg.Collection,
 			Type:       beam.EncodedType{T: elemType},
+			IDField:    cfg.IDField,
 		},
+		MaxRetries:     defaultReadRetries,
+		RetryDelay:     defaultReadRetryDelay,
+		Limit:          cfg.Limit,
+		RequiredFields: cfg.RequiredFields,
+		DeadLetter:     cfg.DeadLetter,
 	}
 }
 
@@ -59,28 +170,84 @@ func (fn *readFn) ProcessElement(
 	ctx context.Context,
 	_ []byte,
 	emit func(beam.X),
+	deadLetter func(DeadLetter),
 ) error {
-	iter := fn.collectionRef.Documents(ctx)
-	defer iter.Stop()
+	var (
+		lastID  string
+		read    int
+		retries int
+		delay   = fn.RetryDelay
+	)
+
+	iter := newDocumentIterator(ctx, fn.collectionRef, lastID, fn.Limit)
+	defer func() { iter.Stop() }()
 
-	for {
-		docSnap, err := iter.Next()
+	for fn.Limit <= 0 || read < fn.Limit {
+		doc, err := iter.Next()
 		if errors.Is(err, iterator.Done) {
 			break
 		}
 
 		if err != nil {
-			return fmt.Errorf("error iterating: %w", err)
-		}
+			if !isTransient(err) || retries >= fn.MaxRetries || ctx.Err() != nil {
+				return fmt.Errorf("error iterating: %w", err)
+			}
+			retries++
+			log.Printf("Transient error reading %s (retry %d of %d in %v): %v", fn.Collection, retries, fn.MaxRetries, delay, err)
+			time.Sleep(delay)
+			delay *= 2
 
-		out := reflect.New(fn.Type.T).Interface()
-		if err := docSnap.DataTo(out); err != nil {
-			return fmt.Errorf("error parsing document: %w", err)
+			// Resuming after the last document emitted, with the documents left to read
+			iter.Stop()
+			iter = newDocumentIterator(ctx, fn.collectionRef, lastID, max(fn.Limit-read, 0))
+			continue
 		}
+		retries, delay = 0, fn.RetryDelay
 
-		newElem := reflect.ValueOf(out).Elem().Interface()
-		emit(newElem)
+		out, err := fn.decode(doc)
+		if err != nil {
+			if !fn.DeadLetter {
+				return err
+			}
+			log.Printf("Sending malformed document %s to the dead letter: %v", doc.ID, err)
+			deadLetter(newDeadLetter(doc, err))
+		} else {
+			emit(out)
+		}
+		lastID = doc.ID
+		read++
 	}
 
 	return nil
 }
+
+// decode decodes the document into an element, checking it holds the required fields.
+func (fn *readFn) decode(doc document) (interface{}, error) {
+	if len(fn.RequiredFields) > 0 {
+		data := doc.Data()
+		for _, field := range fn.RequiredFields {
+			if value, ok := data[field]; !ok || value == nil || value == "" {
+				return nil, fmt.Errorf("error parsing document: missing required field %q", field)
+			}
+		}
+	}
+
+	out := reflect.New(fn.Type.T).Interface()
+	if err := doc.DataTo(out); err != nil {
+		return nil, fmt.Errorf("error parsing document: %w", err)
+	}
+	fn.setDocumentID(out, doc.ID)
+
+	return reflect.ValueOf(out).Elem().Interface(), nil
+}
+
+// newDeadLetter returns the DeadLetter of a malformed document, its raw data encoded as JSON
+// (or formatted, for values JSON can't encode).
+func newDeadLetter(doc document, err error) DeadLetter {
+	data := doc.Data()
+	raw, jsonErr := json.Marshal(data)
+	if jsonErr != nil {
+		raw = []byte(fmt.Sprint(data))
+	}
+	return DeadLetter{ID: doc.ID, Document: string(raw), Error: err.Error()}
+}
@@ -0,0 +1,289 @@
+package firestoreio
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadFn_SetupDatabaseID(t *testing.T) {
+	// Real clients talk to the emulator address, which is never dialed by Setup
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:8080")
+
+	defaultNewClient := newClient
+	t.Cleanup(func() { newClient = defaultNewClient })
+
+	testCases := []struct {
+		name         string
+		databaseID   string
+		expectedPath string
+	}{
+		{
+			name:         "Default database",
+			expectedPath: "projects/test-project/databases/(default)/documents/assessments",
+		},
+		{
+			name:         "Named database",
+			databaseID:   "assessments-eu",
+			expectedPath: "projects/test-project/databases/assessments-eu/documents/assessments",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotProject, gotDatabaseID string
+			newClient = func(ctx context.Context, project, databaseID string) (*firestore.Client, error) {
+				gotProject, gotDatabaseID = project, databaseID
+				return defaultNewClient(ctx, project, databaseID)
+			}
+
+			fn := newReadFn(ReadConfig{
+				Project:    "test-project",
+				DatabaseID: tc.databaseID,
+				Collection: "assessments",
+			}, reflect.TypeOf(struct{}{}))
+			if err := fn.Setup(context.Background()); err != nil {
+				t.Fatalf("Setup() returned error: %v", err)
+			}
+			defer fn.Teardown()
+
+			if gotProject != "test-project" || gotDatabaseID != tc.databaseID {
+				t.Errorf("Expected client for test-project/%q, got %s/%q", tc.databaseID, gotProject, gotDatabaseID)
+			}
+			if fn.collectionRef.Path != tc.expectedPath {
+				t.Errorf("Expected collection path %s, got %s", tc.expectedPath, fn.collectionRef.Path)
+			}
+		})
+	}
+}
+
+// fakeDocumentIterator iterates the documents after startAfter, failing with err once failAfter
+// documents have been read, if set.
+type fakeDocumentIterator struct {
+	ids       []string
+	failAfter int
+	err       error
+	read      int
+}
+
+func (i *fakeDocumentIterator) Next() (document, error) {
+	if i.err != nil && i.read == i.failAfter {
+		return document{}, i.err
+	}
+	if len(i.ids) == 0 {
+		return document{}, iterator.Done
+	}
+	id := i.ids[0]
+	i.ids, i.read = i.ids[1:], i.read+1
+
+	data, _ := json.Marshal(testDocument{ID: id})
+	return jsonDocument(id, data), nil
+}
+
+func (i *fakeDocumentIterator) Stop() {}
+
+// jsonDocument returns a document of the ID, whose data is decoded from JSON.
+func jsonDocument(id string, data []byte) document {
+	return document{
+		ID:     id,
+		DataTo: func(out interface{}) error { return json.Unmarshal(data, out) },
+		Data: func() map[string]interface{} {
+			var fields map[string]interface{}
+			json.Unmarshal(data, &fields)
+			return fields
+		},
+	}
+}
+
+// noDeadLetter returns a dead-letter emitter failing the test when a document is dead-lettered.
+func noDeadLetter(t *testing.T) func(DeadLetter) {
+	return func(deadLetter DeadLetter) {
+		t.Errorf("Unexpected dead letter: %+v", deadLetter)
+	}
+}
+
+// fakeDocuments iterates the documents once.
+type fakeDocuments struct {
+	docs []document
+}
+
+func (i *fakeDocuments) Next() (document, error) {
+	if len(i.docs) == 0 {
+		return document{}, iterator.Done
+	}
+	doc := i.docs[0]
+	i.docs = i.docs[1:]
+	return doc, nil
+}
+
+func (i *fakeDocuments) Stop() {}
+
+func TestReadFn_ProcessElementRetries(t *testing.T) {
+	defaultNewDocumentIterator := newDocumentIterator
+	t.Cleanup(func() { newDocumentIterator = defaultNewDocumentIterator })
+
+	unavailable := status.Error(codes.Unavailable, "the service is currently unavailable")
+
+	testCases := []struct {
+		name        string
+		errs        []error
+		expectedIDs []string
+		expectedErr bool
+	}{
+		{
+			name:        "Transient errors are retried from the last document",
+			errs:        []error{unavailable, unavailable},
+			expectedIDs: []string{"a", "b", "c"},
+		},
+		{
+			name:        "Transient errors beyond the retries fail the read",
+			errs:        []error{unavailable, unavailable, unavailable},
+			expectedIDs: []string{"a"},
+			expectedErr: true,
+		},
+		{
+			name:        "Permanent errors are not retried",
+			errs:        []error{status.Error(codes.PermissionDenied, "missing permissions")},
+			expectedIDs: []string{"a"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// The first iterator fails after a document, the next ones right away, until no error is left
+			errs := tc.errs
+			var starts []string
+			newDocumentIterator = func(ctx context.Context, collection *firestore.CollectionRef, startAfter string, limit int) documentIterator {
+				starts = append(starts, startAfter)
+				iter := &fakeDocumentIterator{}
+				if len(starts) == 1 {
+					iter.failAfter = 1
+				}
+				for _, id := range []string{"a", "b", "c"} {
+					if id > startAfter {
+						iter.ids = append(iter.ids, id)
+					}
+				}
+				if len(errs) > 0 {
+					iter.err, errs = errs[0], errs[1:]
+				}
+				return iter
+			}
+
+			fn := newReadFn(ReadConfig{Collection: "assessments"}, reflect.TypeOf(testDocument{}))
+			fn.MaxRetries, fn.RetryDelay = 2, time.Millisecond
+
+			var ids []string
+			err := fn.ProcessElement(context.Background(), nil, func(elem beam.X) {
+				ids = append(ids, elem.(testDocument).ID)
+			}, noDeadLetter(t))
+			if tc.expectedErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", tc.expectedErr, err)
+			}
+
+			// No document is emitted twice
+			if diff := cmp.Diff(tc.expectedIDs, ids); diff != "" {
+				t.Errorf("Emitted documents mismatch (-want +got):\n%s", diff)
+			}
+			if !tc.expectedErr && !reflect.DeepEqual(starts, []string{"", "a", "a"}) {
+				t.Errorf("Expected the reads to resume after the last document, got %q", starts)
+			}
+		})
+	}
+}
+
+func TestReadFn_ProcessElementLimit(t *testing.T) {
+	defaultNewDocumentIterator := newDocumentIterator
+	t.Cleanup(func() { newDocumentIterator = defaultNewDocumentIterator })
+
+	var limits []int
+	newDocumentIterator = func(ctx context.Context, collection *firestore.CollectionRef, startAfter string, limit int) documentIterator {
+		limits = append(limits, limit)
+		return &fakeDocumentIterator{ids: []string{"a", "b", "c"}}
+	}
+
+	fn := newReadFn(ReadConfig{Collection: "assessments", Limit: 1}, reflect.TypeOf(testDocument{}))
+
+	var ids []string
+	err := fn.ProcessElement(context.Background(), nil, func(elem beam.X) {
+		ids = append(ids, elem.(testDocument).ID)
+	}, noDeadLetter(t))
+	if err != nil {
+		t.Fatalf("ProcessElement() returned error: %v", err)
+	}
+
+	// A single document is queried and emitted
+	if diff := cmp.Diff([]string{"a"}, ids); diff != "" {
+		t.Errorf("Emitted documents mismatch (-want +got):\n%s", diff)
+	}
+	if !reflect.DeepEqual(limits, []int{1}) {
+		t.Errorf("Expected a single query limited to 1 document, got limits %v", limits)
+	}
+}
+
+func TestReadFn_ProcessElementDeadLetter(t *testing.T) {
+	defaultNewDocumentIterator := newDocumentIterator
+	t.Cleanup(func() { newDocumentIterator = defaultNewDocumentIterator })
+
+	type assessment struct {
+		Result string `json:"assessment_result"`
+	}
+	newDocumentIterator = func(ctx context.Context, collection *firestore.CollectionRef, startAfter string, limit int) documentIterator {
+		return &fakeDocuments{docs: []document{
+			jsonDocument("a", []byte(`{"assessment_result": "8 of 10"}`)),
+			// Wrong type
+			jsonDocument("b", []byte(`{"assessment_result": 8}`)),
+			// Missing required field
+			jsonDocument("c", []byte(`{"completed_at": "2024-08-01"}`)),
+			jsonDocument("d", []byte(`{"assessment_result": "6 of 10"}`)),
+		}}
+	}
+
+	cfg := ReadConfig{Collection: "assessments", RequiredFields: []string{"assessment_result"}}
+
+	// Malformed documents fail the read without a dead letter
+	fn := newReadFn(cfg, reflect.TypeOf(assessment{}))
+	if err := fn.ProcessElement(context.Background(), nil, func(beam.X) {}, noDeadLetter(t)); err == nil {
+		t.Fatal("Expected error for the malformed document, got nil")
+	}
+
+	cfg.DeadLetter = true
+	fn = newReadFn(cfg, reflect.TypeOf(assessment{}))
+
+	var (
+		results     []string
+		deadLetters []DeadLetter
+	)
+	err := fn.ProcessElement(context.Background(), nil, func(elem beam.X) {
+		results = append(results, elem.(assessment).Result)
+	}, func(deadLetter DeadLetter) {
+		deadLetters = append(deadLetters, deadLetter)
+	})
+	if err != nil {
+		t.Fatalf("ProcessElement() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"8 of 10", "6 of 10"}, results); diff != "" {
+		t.Errorf("Emitted documents mismatch (-want +got):\n%s", diff)
+	}
+	if len(deadLetters) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %+v", deadLetters)
+	}
+	if deadLetters[0].ID != "b" || deadLetters[0].Document != `{"assessment_result":8}` {
+		t.Errorf("Expected the raw document b in the dead letter, got %+v", deadLetters[0])
+	}
+	if deadLetters[1].ID != "c" || !strings.Contains(deadLetters[1].Error, `missing required field "assessment_result"`) {
+		t.Errorf("Expected document c missing assessment_result, got %+v", deadLetters[1])
+	}
+}
@@ -0,0 +1,239 @@
+package firestoreio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/sdf"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/rtrackers/offsetrange"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"google.golang.org/api/iterator"
+)
+
+func init() {
+	register.DoFn5x2[
+		context.Context, *watermarkEstimator, *sdf.LockRTracker, []byte,
+		func(beam.EventTime, beam.X), sdf.ProcessContinuation, error,
+	](&watchFn{})
+	register.Emitter2[beam.EventTime, beam.X]()
+}
+
+// WatchConfig is the ReadConfig of a collection to watch.
+type WatchConfig struct {
+	ReadConfig
+	// Since skips the documents last updated before it, every document is read first when zero.
+	Since time.Time
+}
+
+/*
+Watch tails the changes of a collection with a Firestore listener, returning an unbounded
+PCollection of the documents created or updated, each one timestamped with its update time.
+
+The watermark follows the read time of the listener snapshots: every change up to it has been
+emitted. When the runner checkpoints the read, the listener is restarted and the documents not
+updated since the watermark are skipped.
+*/
+func Watch(
+	scope beam.Scope,
+	cfg WatchConfig,
+	elemType reflect.Type,
+) beam.PCollection {
+	scope = scope.Scope("firestoreio.Watch")
+	checkStringField(elemType, cfg.IDField)
+	impulse := beam.Impulse(scope)
+
+	return beam.ParDo(
+		scope,
+		newWatchFn(cfg, elemType),
+		impulse,
+		beam.TypeDefinition{Var: beam.XType, T: elemType},
+	)
+}
+
+// documentChange is a document created or updated, as seen by a listener.
+type documentChange struct {
+	ID         string
+	UpdateTime time.Time
+	DataTo     func(interface{}) error
+}
+
+// changeListener tails the changes of a collection, one snapshot at a time.
+type changeListener interface {
+	// Next blocks until the next snapshot, returning its created or updated documents and its read time.
+	Next() ([]documentChange, time.Time, error)
+	Stop()
+}
+
+// newListener starts listening to a collection, replaced in tests by a fake.
+var newListener = func(ctx context.Context, collection *firestore.CollectionRef) changeListener {
+	return &snapshotListener{iter: collection.Snapshots(ctx)}
+}
+
+// snapshotListener is a changeListener backed by Firestore query snapshots.
+type snapshotListener struct {
+	iter *firestore.QuerySnapshotIterator
+}
+
+func (l *snapshotListener) Next() ([]documentChange, time.Time, error) {
+	snap, err := l.iter.Next()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var changes []documentChange
+	for _, change := range snap.Changes {
+		if change.Kind == firestore.DocumentRemoved {
+			continue
+		}
+		changes = append(changes, documentChange{ID: change.Doc.Ref.ID, UpdateTime: change.Doc.UpdateTime, DataTo: change.Doc.DataTo})
+	}
+	return changes, snap.ReadTime, nil
+}
+
+func (l *snapshotListener) Stop() {
+	l.iter.Stop()
+}
+
+// watermarkEstimator holds the read time of the last snapshot, in Unix nanoseconds,
+// kept across checkpoints to skip the changes already emitted.
+type watermarkEstimator struct {
+	state int64
+}
+
+func (e *watermarkEstimator) CurrentWatermark() time.Time {
+	return time.Unix(0, e.state)
+}
+
+func (e *watermarkEstimator) advance(t time.Time) {
+	if nanos := t.UnixNano(); nanos > e.state {
+		e.state = nanos
+	}
+}
+
+// snapshotEndEstimator never knows of more than the next snapshot, so every split is a checkpoint.
+type snapshotEndEstimator struct{}
+
+func (snapshotEndEstimator) Estimate() int64 {
+	return 0
+}
+
+type watchFn struct {
+	firestoreFn
+	Since time.Time
+}
+
+func newWatchFn(
+	cfg WatchConfig,
+	elemType reflect.Type,
+) *watchFn {
+	return &watchFn{
+		firestoreFn: firestoreFn{
+			Project:    cfg.Project,
+			DatabaseID: cfg.DatabaseID,
+			Collection: cfg.Collection,
+			Type:       beam.EncodedType{T: elemType},
+			IDField:    cfg.IDField,
+		},
+		Since: cfg.Since,
+	}
+}
+
+// CreateInitialRestriction numbers the listener snapshots, without an end.
+func (fn *watchFn) CreateInitialRestriction(_ []byte) offsetrange.Restriction {
+	return offsetrange.Restriction{Start: 0, End: math.MaxInt64}
+}
+
+func (fn *watchFn) SplitRestriction(_ []byte, rest offsetrange.Restriction) []offsetrange.Restriction {
+	return []offsetrange.Restriction{rest}
+}
+
+func (fn *watchFn) RestrictionSize(_ []byte, rest offsetrange.Restriction) float64 {
+	return 1
+}
+
+func (fn *watchFn) CreateTracker(rest offsetrange.Restriction) (*sdf.LockRTracker, error) {
+	rt, err := offsetrange.NewGrowableTracker(rest, snapshotEndEstimator{})
+	if err != nil {
+		return nil, fmt.Errorf("error creating growable tracker: %w", err)
+	}
+
+	return sdf.NewLockRTracker(rt), nil
+}
+
+func (fn *watchFn) TruncateRestriction(rt *sdf.LockRTracker, _ []byte) offsetrange.Restriction {
+	start := rt.GetRestriction().(offsetrange.Restriction).Start
+	return offsetrange.Restriction{Start: start, End: start}
+}
+
+func (fn *watchFn) InitialWatermarkEstimatorState(
+	_ beam.EventTime,
+	_ offsetrange.Restriction,
+	_ []byte,
+) int64 {
+	if fn.Since.IsZero() {
+		return 0
+	}
+	return fn.Since.UnixNano()
+}
+
+func (fn *watchFn) CreateWatermarkEstimator(state int64) *watermarkEstimator {
+	return &watermarkEstimator{state: state}
+}
+
+func (fn *watchFn) WatermarkEstimatorState(we *watermarkEstimator) int64 {
+	return we.state
+}
+
+func (fn *watchFn) ProcessElement(
+	ctx context.Context,
+	we *watermarkEstimator,
+	rt *sdf.LockRTracker,
+	_ []byte,
+	emit func(beam.EventTime, beam.X),
+) (sdf.ProcessContinuation, error) {
+	listener := newListener(ctx, fn.collectionRef)
+	defer listener.Stop()
+
+	position := rt.GetRestriction().(offsetrange.Restriction).Start
+	for {
+		changes, readTime, err := listener.Next()
+		if errors.Is(err, iterator.Done) {
+			// The listener was stopped, no more changes will come
+			rt.TryClaim(int64(math.MaxInt64 - 1))
+			return sdf.StopProcessing(), nil
+		}
+		if err != nil {
+			return sdf.StopProcessing(), fmt.Errorf("error listening to changes: %w", err)
+		}
+
+		if !rt.TryClaim(position) {
+			return sdf.StopProcessing(), nil
+		}
+		position++
+
+		watermark := we.CurrentWatermark()
+		for _, change := range changes {
+			// Skipping the changes emitted before the last checkpoint
+			if !change.UpdateTime.After(watermark) {
+				continue
+			}
+
+			out := reflect.New(fn.Type.T).Interface()
+			if err := change.DataTo(out); err != nil {
+				return sdf.StopProcessing(), fmt.Errorf("error parsing document: %w", err)
+			}
+			fn.setDocumentID(out, change.ID)
+
+			emit(mtime.FromTime(change.UpdateTime), reflect.ValueOf(out).Elem().Interface())
+		}
+
+		we.advance(readTime)
+	}
+}
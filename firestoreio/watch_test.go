@@ -0,0 +1,196 @@
+package firestoreio
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/rtrackers/offsetrange"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/iterator"
+)
+
+type testDocument struct {
+	ID string
+}
+
+// fakeChange is a change event of a fakeListener, the document ID and its update time.
+type fakeChange struct {
+	id         string
+	updateTime time.Time
+}
+
+// fakeSnapshot is a snapshot of a fakeListener, with the documents changed and its read time.
+type fakeSnapshot struct {
+	changes  []fakeChange
+	readTime time.Time
+}
+
+// fakeListener replays snapshots of change events, then reports it was stopped.
+type fakeListener struct {
+	snapshots []fakeSnapshot
+	stopped   bool
+}
+
+func (l *fakeListener) Next() ([]documentChange, time.Time, error) {
+	if len(l.snapshots) == 0 {
+		return nil, time.Time{}, iterator.Done
+	}
+	snap := l.snapshots[0]
+	l.snapshots = l.snapshots[1:]
+
+	var changes []documentChange
+	for _, change := range snap.changes {
+		data, _ := json.Marshal(testDocument{ID: change.id})
+		changes = append(changes, documentChange{
+			UpdateTime: change.updateTime,
+			DataTo:     func(out interface{}) error { return json.Unmarshal(data, out) },
+		})
+	}
+	return changes, snap.readTime, nil
+}
+
+func (l *fakeListener) Stop() {
+	l.stopped = true
+}
+
+type timestamped struct {
+	Time time.Time
+	ID   string
+}
+
+func TestWatchFn_ProcessElement(t *testing.T) {
+	base := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	snapshots := []fakeSnapshot{
+		// Initial snapshot, every existing document is reported as added
+		{changes: []fakeChange{{"a", base.Add(-time.Hour)}}, readTime: base},
+		// A document created and another one updated
+		{changes: []fakeChange{{"b", base.Add(time.Minute)}, {"a", base.Add(2 * time.Minute)}}, readTime: base.Add(3 * time.Minute)},
+	}
+
+	testCases := []struct {
+		name          string
+		since         time.Time
+		state         *int64
+		expected      []timestamped
+		wantWatermark time.Time
+	}{
+		{
+			name: "Every document",
+			expected: []timestamped{
+				{Time: base.Add(-time.Hour), ID: "a"},
+				{Time: base.Add(time.Minute), ID: "b"},
+				{Time: base.Add(2 * time.Minute), ID: "a"},
+			},
+			wantWatermark: base.Add(3 * time.Minute),
+		},
+		{
+			name:  "Documents updated since",
+			since: base.Add(-time.Minute),
+			expected: []timestamped{
+				{Time: base.Add(time.Minute), ID: "b"},
+				{Time: base.Add(2 * time.Minute), ID: "a"},
+			},
+			wantWatermark: base.Add(3 * time.Minute),
+		},
+		{
+			name:  "Resumed after a checkpoint",
+			state: ptr(base.Add(90 * time.Second).UnixNano()),
+			expected: []timestamped{
+				{Time: base.Add(2 * time.Minute), ID: "a"},
+			},
+			wantWatermark: base.Add(3 * time.Minute),
+		},
+	}
+
+	defaultNewListener := newListener
+	t.Cleanup(func() { newListener = defaultNewListener })
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			listener := &fakeListener{snapshots: append([]fakeSnapshot(nil), snapshots...)}
+			newListener = func(ctx context.Context, collection *firestore.CollectionRef) changeListener {
+				return listener
+			}
+
+			fn := newWatchFn(WatchConfig{
+				ReadConfig: ReadConfig{Project: "test-project", Collection: "assessments"},
+				Since:      tc.since,
+			}, reflect.TypeOf(testDocument{}))
+
+			state := fn.InitialWatermarkEstimatorState(mtime.MinTimestamp, offsetrange.Restriction{}, nil)
+			if tc.state != nil {
+				state = *tc.state
+			}
+			we := fn.CreateWatermarkEstimator(state)
+			rt, err := fn.CreateTracker(fn.CreateInitialRestriction(nil))
+			if err != nil {
+				t.Fatalf("CreateTracker() returned error: %v", err)
+			}
+
+			var got []timestamped
+			emit := func(et beam.EventTime, elem beam.X) {
+				got = append(got, timestamped{Time: et.ToTime().UTC(), ID: elem.(testDocument).ID})
+			}
+
+			cont, err := fn.ProcessElement(context.Background(), we, rt, nil, emit)
+			if err != nil {
+				t.Fatalf("ProcessElement() returned error: %v", err)
+			}
+			if cont.ShouldResume() {
+				t.Error("Expected processing to stop once the listener is stopped")
+			}
+			if !rt.IsDone() {
+				t.Error("Expected the restriction to be done")
+			}
+			if !listener.stopped {
+				t.Error("Expected the listener to be stopped")
+			}
+
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("Emitted documents mismatch (-want +got):\n%s", diff)
+			}
+			if watermark := we.CurrentWatermark(); !watermark.Equal(tc.wantWatermark) {
+				t.Errorf("Expected watermark %v, got %v", tc.wantWatermark, watermark)
+			}
+		})
+	}
+}
+
+func TestWatchFn_Checkpoint(t *testing.T) {
+	fn := newWatchFn(WatchConfig{}, reflect.TypeOf(testDocument{}))
+	rt, err := fn.CreateTracker(fn.CreateInitialRestriction(nil))
+	if err != nil {
+		t.Fatalf("CreateTracker() returned error: %v", err)
+	}
+	if rt.IsBounded() {
+		t.Error("Expected an unbounded restriction")
+	}
+
+	rt.TryClaim(int64(0))
+	primary, residual, err := rt.TrySplit(0.5)
+	if err != nil {
+		t.Fatalf("TrySplit() returned error: %v", err)
+	}
+
+	// Splitting only ever checkpoints after the current snapshot
+	if diff := cmp.Diff(offsetrange.Restriction{Start: 0, End: 1}, primary); diff != "" {
+		t.Errorf("Primary mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(offsetrange.Restriction{Start: 1, End: math.MaxInt64}, residual); diff != "" {
+		t.Errorf("Residual mismatch (-want +got):\n%s", diff)
+	}
+	if rt.TryClaim(int64(1)) {
+		t.Error("Expected the next snapshot to belong to the residual")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
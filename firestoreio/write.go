@@ -0,0 +1,171 @@
+package firestoreio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/firestore"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	register.DoFn3x1[context.Context, string, beam.X, error](&writeFn{})
+}
+
+var (
+	written   = beam.NewCounter("firestoreio.Write", "written")
+	unchanged = beam.NewCounter("firestoreio.Write", "unchanged")
+)
+
+type WriteConfig struct {
+	Project string
+	// DatabaseID is the named database to write to, empty for the (default) database.
+	DatabaseID string
+	Collection string
+	// HashField names the string field of the elements holding their content hash, written
+	// with the document and compared on the next write to skip the unchanged documents.
+	HashField string
+	// IgnoreFields names the fields left out of the content hash, e.g. generation timestamps.
+	IgnoreFields []string
+}
+
+/*
+Write writes a PCollection<KV<string, T>> to the collection, each element as the document
+of its key.
+
+Writes are idempotent: the existing document is read first and the element is only written
+when its content hash differs from the one of the document, so reruns spare the writes and
+the update time churn of the unchanged documents.
+*/
+func Write(
+	scope beam.Scope,
+	cfg WriteConfig,
+	col beam.PCollection,
+) {
+	scope = scope.Scope("firestoreio.Write")
+	elemType := col.Type().Components()[1].Type()
+	if cfg.HashField == "" {
+		panic("firestoreio: Write requires a HashField")
+	}
+	checkStringField(elemType, cfg.HashField)
+	for _, field := range cfg.IgnoreFields {
+		if _, ok := elemType.FieldByName(field); !ok {
+			panic(fmt.Sprintf("firestoreio: %v has no field %s", elemType, field))
+		}
+	}
+
+	beam.ParDo0(scope, newWriteFn(cfg, elemType), col)
+}
+
+// documentStore gets and sets the documents of a collection by ID.
+type documentStore interface {
+	Get(ctx context.Context, id string) (document, error)
+	Set(ctx context.Context, id string, data interface{}) error
+}
+
+// newDocumentStore returns the documentStore of the collection, replaced in tests by a fake.
+var newDocumentStore = func(collection *firestore.CollectionRef) documentStore {
+	return &collectionStore{collection: collection}
+}
+
+type collectionStore struct {
+	collection *firestore.CollectionRef
+}
+
+func (s *collectionStore) Get(ctx context.Context, id string) (document, error) {
+	docSnap, err := s.collection.Doc(id).Get(ctx)
+	if err != nil {
+		return document{}, err
+	}
+	return document{ID: docSnap.Ref.ID, DataTo: docSnap.DataTo}, nil
+}
+
+func (s *collectionStore) Set(ctx context.Context, id string, data interface{}) error {
+	_, err := s.collection.Doc(id).Set(ctx, data)
+	return err
+}
+
+type writeFn struct {
+	firestoreFn
+	HashField    string
+	IgnoreFields []string
+}
+
+func newWriteFn(
+	cfg WriteConfig,
+	elemType reflect.Type,
+) *writeFn {
+	return &writeFn{
+		firestoreFn: firestoreFn{
+			Project:    cfg.Project,
+			DatabaseID: cfg.DatabaseID,
+			Collection: cfg.Collection,
+			Type:       beam.EncodedType{T: elemType},
+		},
+		HashField:    cfg.HashField,
+		IgnoreFields: cfg.IgnoreFields,
+	}
+}
+
+func (fn *writeFn) ProcessElement(
+	ctx context.Context,
+	id string,
+	elem beam.X,
+) error {
+	hash, err := fn.contentHash(elem)
+	if err != nil {
+		return err
+	}
+
+	store := newDocumentStore(fn.collectionRef)
+	doc, err := store.Get(ctx, id)
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		return fmt.Errorf("error reading document %s: %w", id, err)
+	default:
+		existing := reflect.New(fn.Type.T)
+		if err := doc.DataTo(existing.Interface()); err != nil {
+			return fmt.Errorf("error parsing document %s: %w", id, err)
+		}
+		// Skipping the documents already written with the same content
+		if existing.Elem().FieldByName(fn.HashField).String() == hash {
+			unchanged.Inc(ctx, 1)
+			return nil
+		}
+	}
+
+	out := reflect.New(fn.Type.T).Elem()
+	out.Set(reflect.ValueOf(elem))
+	out.FieldByName(fn.HashField).SetString(hash)
+	if err := store.Set(ctx, id, out.Interface()); err != nil {
+		return fmt.Errorf("error writing document %s: %w", id, err)
+	}
+	written.Inc(ctx, 1)
+
+	return nil
+}
+
+// contentHash returns the SHA-256 of the JSON encoding of the element, without its hash and ignored fields.
+func (fn *writeFn) contentHash(elem beam.X) (string, error) {
+	content := reflect.New(fn.Type.T).Elem()
+	content.Set(reflect.ValueOf(elem))
+	for _, field := range append([]string{fn.HashField}, fn.IgnoreFields...) {
+		f := content.FieldByName(field)
+		f.Set(reflect.Zero(f.Type()))
+	}
+
+	data, err := json.Marshal(content.Interface())
+	if err != nil {
+		return "", fmt.Errorf("error encoding document content: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,89 @@
+package firestoreio
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testResult struct {
+	Summary     string
+	GeneratedAt time.Time
+	ContentHash string
+}
+
+// fakeDocumentStore keeps the documents as JSON, counting the writes.
+type fakeDocumentStore struct {
+	docs   map[string][]byte
+	writes int
+}
+
+func (s *fakeDocumentStore) Get(ctx context.Context, id string) (document, error) {
+	data, ok := s.docs[id]
+	if !ok {
+		return document{}, status.Errorf(codes.NotFound, "document %s not found", id)
+	}
+	return document{ID: id, DataTo: func(out interface{}) error { return json.Unmarshal(data, out) }}, nil
+}
+
+func (s *fakeDocumentStore) Set(ctx context.Context, id string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	s.docs[id] = encoded
+	s.writes++
+	return nil
+}
+
+func TestWriteFn_ProcessElementSkipsUnchanged(t *testing.T) {
+	defaultNewDocumentStore := newDocumentStore
+	t.Cleanup(func() { newDocumentStore = defaultNewDocumentStore })
+
+	store := &fakeDocumentStore{docs: make(map[string][]byte)}
+	newDocumentStore = func(collection *firestore.CollectionRef) documentStore { return store }
+
+	fn := newWriteFn(WriteConfig{
+		Collection:   "insights",
+		HashField:    "ContentHash",
+		IgnoreFields: []string{"GeneratedAt"},
+	}, reflect.TypeOf(testResult{}))
+
+	write := func(result testResult) {
+		t.Helper()
+		if err := fn.ProcessElement(context.Background(), "assessment-1", result); err != nil {
+			t.Fatalf("ProcessElement() returned error: %v", err)
+		}
+	}
+
+	// The first run writes the document with its content hash
+	write(testResult{Summary: "Good performance", GeneratedAt: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)})
+	if store.writes != 1 {
+		t.Fatalf("Expected the new document to be written, got %d writes", store.writes)
+	}
+	var stored testResult
+	if err := json.Unmarshal(store.docs["assessment-1"], &stored); err != nil {
+		t.Fatalf("Failed to decode the stored document: %v", err)
+	}
+	if stored.ContentHash == "" {
+		t.Errorf("Expected the document to be written with its content hash")
+	}
+
+	// A rerun with the same content, generated later, is skipped
+	write(testResult{Summary: "Good performance", GeneratedAt: time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC)})
+	if store.writes != 1 {
+		t.Errorf("Expected the unchanged document not to be rewritten, got %d writes", store.writes)
+	}
+
+	// Changed content is written over the document
+	write(testResult{Summary: "Excellent performance", GeneratedAt: time.Date(2024, 7, 3, 0, 0, 0, 0, time.UTC)})
+	if store.writes != 2 {
+		t.Errorf("Expected the changed document to be rewritten, got %d writes", store.writes)
+	}
+}
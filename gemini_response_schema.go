@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// schemaEnums are the values of the string types restricted to a set, as enums of their schema.
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(SkillGapSeverity("")): {string(SeverityLow), string(SeverityMedium), string(SeverityHigh)},
+}
+
+/*
+WithGeminiResponseSchemaFromInsightsResult sets the Gemini response schema, derived from
+InsightsResult (see insightsResponseSchema), on the models created in Setup, so Gemini's
+constrained decoding only produces responses conforming to it. The schema follows the
+struct, with no schema to maintain by hand.
+
+Other providers ignore it, and so do the models answering through the insights tool with
+StructuredTools, as the tool input schema already constrains the response.
+*/
+func (ei *ExtractInsights) WithGeminiResponseSchemaFromInsightsResult() *ExtractInsights {
+	ei.GeminiResponseSchema = true
+	return ei
+}
+
+// buildGeminiResponseSchema derives the response schema of the Gemini models, once, in Setup.
+func (ei *ExtractInsights) buildGeminiResponseSchema() error {
+	if !ei.GeminiResponseSchema || ei.StructuredTools {
+		return nil
+	}
+	schema, err := insightsResponseSchema()
+	if err != nil {
+		return fmt.Errorf("error deriving the Gemini response schema: %w", err)
+	}
+	ei.responseSchema = schema
+	return nil
+}
+
+// geminiResponseConfig is the generation config constraining the Gemini responses to the response schema.
+func (ei *ExtractInsights) geminiResponseConfig() genai.GenerationConfig {
+	return genai.GenerationConfig{ResponseMIMEType: "application/json", ResponseSchema: ei.responseSchema}
+}
+
+/*
+insightsResponseSchema derives the genai.Schema of the insights produced by the model from
+the InsightsResult struct: an object with a required property for every JSON field, skipping
+the fields filled in by the pipeline (see pipelineFields) and those never written out.
+
+Strings, integers, floats and booleans map to their schema type, slices to arrays and structs
+to objects. Maps map to arrays of key/value entries, as Gemini's schema can't describe objects
+with arbitrary keys: mapsFromEntries converts them back before the response is parsed.
+Restricted string types, such as SkillGapSeverity, get their values as an enum.
+*/
+func insightsResponseSchema() (*genai.Schema, error) {
+	return schemaOf(reflect.TypeOf(InsightsResult{}), pipelineFields)
+}
+
+// schemaOf returns the genai.Schema of values of type t, skipping the struct fields named in skip.
+func schemaOf(t reflect.Type, skip map[string]bool) (*genai.Schema, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return &genai.Schema{Type: genai.TypeString, Enum: schemaEnums[t]}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &genai.Schema{Type: genai.TypeInteger}, nil
+	case reflect.Float32, reflect.Float64:
+		return &genai.Schema{Type: genai.TypeNumber}, nil
+	case reflect.Bool:
+		return &genai.Schema{Type: genai.TypeBoolean}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return &genai.Schema{Type: genai.TypeArray, Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		value, err := schemaOf(t.Elem(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return &genai.Schema{Type: genai.TypeArray, Items: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"key": {Type: genai.TypeString}, "value": value},
+			Required:   []string{"key", "value"},
+		}}, nil
+	case reflect.Struct:
+		schema := &genai.Schema{Type: genai.TypeObject, Properties: make(map[string]*genai.Schema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" || !field.IsExported() || skip[name] {
+				continue
+			}
+			property, err := schemaOf(field.Type, nil)
+			if err != nil {
+				return nil, fmt.Errorf("error deriving the schema of %s: %w", name, err)
+			}
+			schema.Properties[name] = property
+			if !strings.Contains(options, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// mapEntry is an entry of a map of a response constrained by the response schema, see schemaOf.
+type mapEntry struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// insightsFromResponseSchema converts the maps of the insights of a response constrained by the
+// response schema, which come as key/value entries, back to JSON objects. Responses that aren't
+// valid JSON, or whose maps are objects already, are returned as is.
+func insightsFromResponseSchema(text string) string {
+	if !json.Valid([]byte(text)) {
+		return text
+	}
+	return string(mapsFromEntries(reflect.TypeOf(InsightsResult{}), json.RawMessage(text)))
+}
+
+// mapsFromEntries converts the maps of type t found in raw from arrays of key/value entries to
+// JSON objects, following the fields, elements and values of t. Values not matching t are kept
+// for the decoding of the insights to report.
+func mapsFromEntries(t reflect.Type, raw json.RawMessage) json.RawMessage {
+	switch t.Kind() {
+	case reflect.Map:
+		var entries []mapEntry
+		if err := json.Unmarshal(raw, &entries); err != nil || entries == nil {
+			return raw
+		}
+		object := make(map[string]json.RawMessage, len(entries))
+		for _, entry := range entries {
+			object[entry.Key] = mapsFromEntries(t.Elem(), entry.Value)
+		}
+		return marshalRaw(object, raw)
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil || items == nil {
+			return raw
+		}
+		for i, item := range items {
+			items[i] = mapsFromEntries(t.Elem(), item)
+		}
+		return marshalRaw(items, raw)
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+			return raw
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if value, ok := fields[name]; ok && name != "" && name != "-" {
+				fields[name] = mapsFromEntries(t.Field(i).Type, value)
+			}
+		}
+		return marshalRaw(fields, raw)
+	default:
+		return raw
+	}
+}
+
+// marshalRaw marshals the converted value, or returns the original one if it can't be.
+func marshalRaw(v any, original json.RawMessage) json.RawMessage {
+	converted, err := json.Marshal(v)
+	if err != nil {
+		return original
+	}
+	return converted
+}
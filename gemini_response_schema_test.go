@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsightsResponseSchema(t *testing.T) {
+	stringList := &genai.Schema{Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}}
+	// Maps are arrays of key/value entries
+	entries := func(value *genai.Schema) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeArray, Items: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"key": {Type: genai.TypeString}, "value": value},
+			Required:   []string{"key", "value"},
+		}}
+	}
+	want := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"overall_assessment":            {Type: genai.TypeString},
+			"questions_answered_correctly":  {Type: genai.TypeInteger},
+			"strengths":                     stringList,
+			"weaknesses":                    stringList,
+			"actionable_feedback":           entries(&genai.Schema{Type: genai.TypeString}),
+			"business_case_impact_analysis": entries(&genai.Schema{Type: genai.TypeString}),
+			"skill_gaps": {Type: genai.TypeArray, Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"skill":                {Type: genai.TypeString},
+					"severity":             {Type: genai.TypeString, Enum: []string{"low", "medium", "high"}},
+					"recommended_resource": {Type: genai.TypeString},
+				},
+				Required: []string{"skill", "severity", "recommended_resource"},
+			}},
+			"study_plans": entries(&genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"topic":           {Type: genai.TypeString},
+					"estimated_hours": {Type: genai.TypeNumber},
+					"resources":       stringList,
+				},
+				Required: []string{"topic", "estimated_hours", "resources"},
+			}),
+			"ranked_weaknesses": {Type: genai.TypeArray, Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"topic":    {Type: genai.TypeString},
+					"severity": {Type: genai.TypeNumber},
+				},
+				Required: []string{"topic", "severity"},
+			}},
+		},
+		// The pipeline fields (e.g. completed_at) and those never written out are left out
+		Required: []string{
+			"overall_assessment", "questions_answered_correctly", "strengths", "weaknesses", "actionable_feedback",
+			"business_case_impact_analysis", "skill_gaps", "study_plans", "ranked_weaknesses",
+		},
+	}
+
+	schema, err := insightsResponseSchema()
+	assert.NoError(t, err)
+	assert.Equal(t, want, schema)
+
+	// Setup wires the schema as the response schema of the Gemini models
+	ei := (&ExtractInsights{}).WithGeminiResponseSchemaFromInsightsResult()
+	assert.NoError(t, ei.buildGeminiResponseSchema())
+	assert.Equal(t, genai.GenerationConfig{ResponseMIMEType: "application/json", ResponseSchema: want}, ei.geminiResponseConfig())
+
+	// The insights tool already constrains the responses
+	ei = (&ExtractInsights{StructuredTools: true}).WithGeminiResponseSchemaFromInsightsResult()
+	assert.NoError(t, ei.buildGeminiResponseSchema())
+	assert.Nil(t, ei.responseSchema)
+}
+
+func TestInsightsFromResponseSchema(t *testing.T) {
+	ei := (&ExtractInsights{}).WithGeminiResponseSchemaFromInsightsResult()
+	assert.NoError(t, ei.buildGeminiResponseSchema())
+
+	// The key/value entries constrained by the response schema are parsed back into maps
+	insights, err := ei.parseInsights(`{
+		"overall_assessment": "Good",
+		"actionable_feedback": [{"key": "IAM", "value": "Review the predefined roles"}],
+		"study_plans": [{"key": "Networking", "value": {"topic": "VPC", "estimated_hours": 2.5, "resources": ["VPC docs"]}}]
+	}`, llm.ResponseMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, InsightsResult{
+		OverallAssessment:  "Good",
+		ActionableFeedback: map[string]string{"IAM": "Review the predefined roles"},
+		StudyPlans:         map[string]StudyPlan{"Networking": {Topic: "VPC", EstimatedHours: 2.5, Resources: []string{"VPC docs"}}},
+	}, insights)
+
+	// Maps that are objects already, and invalid JSON, are left as they are
+	objects := `{"actionable_feedback": {"IAM": "Review"}, "study_plans": null}`
+	assert.JSONEq(t, objects, insightsFromResponseSchema(objects))
+	assert.Equal(t, `{"overall_assessment": `, insightsFromResponseSchema(`{"overall_assessment": `))
+}
@@ -5,12 +5,17 @@ go 1.22.5
 require (
 	cloud.google.com/go/firestore v1.16.0
 	github.com/apache/beam/sdks/v2 v2.58.1
+	github.com/bufbuild/protocompile v0.14.1
 	github.com/gage-technologies/mistral-go v1.1.0
 	github.com/google/generative-ai-go v0.17.0
 	github.com/google/go-cmp v0.6.0
 	github.com/liushuangls/go-anthropic/v2 v2.6.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/stretchr/testify v1.9.0
 	google.golang.org/api v0.192.0
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -68,8 +73,5 @@ require (
 	google.golang.org/genproto v0.0.0-20240730163845-b1a4ccb954bf // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240725223205-93522f1f2a9f // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240730163845-b1a4ccb954bf // indirect
-	google.golang.org/grpc v1.64.1 // indirect
-	google.golang.org/protobuf v1.34.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gotest.tools/v3 v3.5.1 // indirect
 )
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// defaultHealthGateTimeout bounds the health probe of the provider when HealthGateConfig.Timeout is unset.
+const defaultHealthGateTimeout = 5 * time.Second
+
+// HealthGateConfig holds the provider health gate, see WithProviderHealthGate.
+type HealthGateConfig struct {
+	// Fallback is the model the bundles switch to while the configured provider is unhealthy.
+	// The gate is disabled when its provider is empty.
+	Fallback llm.LLMConfig `yaml:"fallback"`
+	// Timeout bounds the health probe, 5s when unset. A provider slower than that is unhealthy.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+/*
+WithProviderHealthGate probes the health of the configured provider (see llm.HealthChecker)
+before each bundle and, when it is unhealthy, switches the whole bundle to the fallback model
+right away, rather than failing, and retrying, assessment by assessment. The next bundle probes
+the provider again, going back to it once it has recovered. The probe is bounded by timeout
+(5s when 0) and costs a single-token call per bundle, counted against MaxTotalCalls and MaxCost.
+
+The fallback model is created like the preferred models and, like the probe, goes through the
+audit log and rate limit of the configured one; only the fallback is cached. A bundle on the
+fallback processes every assessment with it, those naming a preferred model included, with the
+insights schema cached for it, and its retries, metrics and token limits are the fallback's.
+*/
+func (ei *ExtractInsights) WithProviderHealthGate(fallback llm.LLMConfig, timeout time.Duration) *ExtractInsights {
+	ei.HealthGate = HealthGateConfig{Fallback: fallback, Timeout: timeout}
+	return ei
+}
+
+// buildHealthGate creates, in Setup, the probe of the configured provider and the fallback
+// model, ahead of the audit log, rate limit and cache wrapping them with the configured model.
+func (ei *ExtractInsights) buildHealthGate(cfg llm.LLMConfig) error {
+	if ei.HealthGate.Fallback.Provider == "" {
+		return nil
+	}
+	probe, err := llm.NewLanguageModel(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating health probe: %w", err)
+	}
+	if _, ok := probe.(llm.HealthChecker); !ok {
+		return fmt.Errorf("error: the %q provider can't be probed", cfg.Provider)
+	}
+	fallbackCfg := ei.HealthGate.Fallback
+	if fallbackCfg.MaxTokens == 0 {
+		fallbackCfg.MaxTokens = cfg.MaxTokens
+	}
+	if ei.fallback, err = ei.newModel(fallbackCfg); err != nil {
+		return fmt.Errorf("error creating fallback model: %w", err)
+	}
+	ei.healthProbe = probe
+	return nil
+}
+
+// healthGateFallbackName is the name of the fallback model in the audit log: its model, or its provider.
+func healthGateFallbackName(fallback llm.LLMConfig) string {
+	if fallback.Model != "" {
+		return fallback.Model
+	}
+	return fallback.Provider
+}
+
+// bundleModel is a model the assessments of a bundle are extracted with, along with its
+// configuration and the handle of the insights schema cached for it, if any.
+type bundleModel struct {
+	model        llm.LanguageModel
+	cfg          llm.LLMConfig
+	cachedSchema string
+}
+
+// activeModel returns the model of the bundle: the fallback model when the health gate found
+// the configured provider unhealthy, whose maximum number of tokens defaults to the configured
+// one, and the configured model otherwise.
+func (ei *ExtractInsights) activeModel() bundleModel {
+	if ei.onFallback {
+		cfg := ei.HealthGate.Fallback
+		if cfg.MaxTokens == 0 {
+			cfg.MaxTokens = ei.maxTokens
+		}
+		return bundleModel{model: ei.fallback, cfg: cfg, cachedSchema: ei.fallbackSchema}
+	}
+	cfg := ei.LLM
+	if cfg.Provider == "" {
+		cfg.Provider = llm.ProviderGemini
+	}
+	cfg.MaxTokens = ei.maxTokens
+	return bundleModel{model: ei.model, cfg: cfg, cachedSchema: ei.cachedSchema}
+}
+
+// StartBundle switches the bundle to the fallback model when the health gate finds the
+// configured provider unhealthy, and back to the configured model otherwise. Once the call
+// budget is spent, the bundle, whose assessments are skipped, isn't probed and stays on the
+// configured model.
+// Like FinishBundle, it declares the side input and emitters of ProcessElement, as Beam
+// requires, and takes no context, the probe running with a background one.
+func (ei *ExtractInsights) StartBundle(_ func(*string) bool, _ func(InsightsResult), _, _, _ func(Assessment), _ func(EvalRecord), _ func(InsightsResult)) {
+	// Every bundle starts on the configured model, whatever the previous one was switched to
+	ei.onFallback = false
+	if ei.healthProbe == nil || ei.takeCall() != nil {
+		return
+	}
+	timeout := ei.HealthGate.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthGateTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	meta, err := llm.Ping(ctx, ei.healthProbe)
+	ei.recordCost(meta)
+	if err != nil {
+		log.Printf("Provider unhealthy, processing the bundle with the fallback %s model: %v", ei.HealthGate.Fallback.Provider, err)
+		ei.onFallback = true
+	}
+}
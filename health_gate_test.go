@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// probeCall matches the single-token call probing the health of the provider.
+var probeCall = mock.MatchedBy(func(opts *llm.GenerateOptions) bool { return opts != nil && opts.MaxTokens == 1 })
+
+func TestExtractInsights_ProviderHealthGate(t *testing.T) {
+	primary, fallback, probe := new(MockLanguageModel), new(MockLanguageModel), new(MockLanguageModel)
+	ei := (&ExtractInsights{MaxRetries: 1, RetryDelay: time.Millisecond}).
+		WithProviderHealthGate(llm.LLMConfig{Provider: llm.ProviderAnthropic}, time.Second)
+	ei.model, ei.fallback, ei.healthProbe = primary, fallback, probe
+
+	process := func() []InsightsResult {
+		var results []InsightsResult
+		ei.StartBundle(noRubric, nil, nil, nil, nil, nil, nil)
+		for _, result := range []string{"first", "second"} {
+			ei.ProcessElement(context.Background(), Assessment{Result: result}, noRubric, func(insights InsightsResult) {
+				results = append(results, insights)
+			}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+		}
+		return results
+	}
+
+	// An unhealthy primary switches the whole bundle to the fallback, probed once
+	probe.On("GenerateText", mock.Anything, "ping", probeCall).Return("", errors.New("503 Service Unavailable")).Once()
+	fallback.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Fallback"}`, nil).Twice()
+	results := process()
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "Fallback"}, {OverallAssessment: "Fallback"}}, results)
+	fallback.AssertExpectations(t)
+	primary.AssertNotCalled(t, "GenerateText", mock.Anything, mock.Anything, mock.Anything)
+
+	// Once it has recovered, the next bundle goes back to the primary
+	probe.On("GenerateText", mock.Anything, "ping", probeCall).Return("pong", nil).Once()
+	primary.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Primary"}`, nil).Twice()
+	results = process()
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "Primary"}, {OverallAssessment: "Primary"}}, results)
+	probe.AssertExpectations(t)
+	primary.AssertExpectations(t)
+
+	// Without a fallback provider there is no gate
+	ei = &ExtractInsights{model: primary}
+	assert.NoError(t, ei.buildHealthGate(llm.LLMConfig{}))
+	ei.StartBundle(noRubric, nil, nil, nil, nil, nil, nil)
+	assert.Same(t, primary, ei.model)
+}
+
+func TestExtractInsights_ProviderHealthGateAuditAndBudget(t *testing.T) {
+	totalCalls.Store(0)
+	t.Cleanup(func() { totalCalls.Store(0) })
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	primary, fallback, probe := new(MockLanguageModel), new(MockLanguageModel), new(MockLanguageModel)
+	ei := (&ExtractInsights{MaxRetries: 1, RetryDelay: time.Millisecond, MaxTotalCalls: 2, Audit: AuditConfig{Path: path}}).
+		WithProviderHealthGate(llm.LLMConfig{Provider: llm.ProviderAnthropic, Model: "claude-3-5-haiku-20241022"}, time.Second)
+	ei.model, ei.fallback, ei.healthProbe = primary, fallback, probe
+	assert.NoError(t, ei.auditModel(llm.LLMConfig{Provider: llm.ProviderGemini}))
+
+	// The probe and the fallback go through the audit log, and the call budget
+	probe.On("GenerateText", mock.Anything, "ping", probeCall).Return("", errors.New("503 Service Unavailable")).Once()
+	fallback.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Fallback"}`, nil).Once()
+	ei.StartBundle(noRubric, nil, nil, nil, nil, nil, nil)
+	var skipped []Assessment
+	for _, result := range []string{"first", "second"} {
+		ei.ProcessElement(context.Background(), Assessment{Result: result}, noRubric, func(InsightsResult) {}, func(assessment Assessment) {
+			skipped = append(skipped, assessment)
+		}, noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+	assert.Len(t, skipped, 1, "Expected the probe to take one of the 2 calls of the budget")
+	assert.NoError(t, ei.Teardown())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 2, "Expected one audit record for the probe and one for the fallback") {
+		assert.Contains(t, lines[0], `"model":"gemini"`)
+		assert.Contains(t, lines[1], `"model":"claude-3-5-haiku-20241022"`)
+	}
+
+	// Once the budget is spent, the provider isn't probed
+	ei.StartBundle(noRubric, nil, nil, nil, nil, nil, nil)
+	probe.AssertExpectations(t)
+}
+
+func TestExtractInsights_ProviderHealthGateBundleModel(t *testing.T) {
+	totalCalls.Store(0)
+	t.Cleanup(func() { totalCalls.Store(0) })
+
+	preferred, probe := new(MockLanguageModel), new(MockLanguageModel)
+	primary, fallback := new(MockCachingLanguageModel), new(MockCachingLanguageModel)
+	ei := (&ExtractInsights{
+		MaxRetries:      1,
+		RetryDelay:      time.Millisecond,
+		LLM:             llm.LLMConfig{Provider: llm.ProviderGemini, Model: "gemini-1.5-pro-002"},
+		maxTokens:       8192,
+		PreferredModels: []string{"gemini-1.5-flash-002"},
+	}).WithProviderHealthGate(llm.LLMConfig{Provider: llm.ProviderAnthropic, Model: "claude-3-opus-20240229"}, time.Second)
+	ei.model, ei.fallback, ei.healthProbe = primary, fallback, probe
+	ei.models = map[string]llm.LanguageModel{"gemini-1.5-flash-002": preferred}
+
+	// The fallback gets the schema cached for it, never the one of the configured model
+	primary.On("CacheContent", mock.Anything, mock.Anything).Return("cachedContents/gemini-schema", nil).Once()
+	fallback.On("CacheContent", mock.Anything, mock.Anything).Return("anthropic-schema", nil).Once()
+	ei.cacheSchema(context.Background())
+
+	probe.On("GenerateText", mock.Anything, "ping", probeCall).Return("", errors.New("503 Service Unavailable")).Once()
+	fallback.On("GenerateText", mock.Anything, mock.Anything, mock.MatchedBy(func(opts *llm.GenerateOptions) bool {
+		return opts.CachedContent == "anthropic-schema"
+	})).Return(`{"overall_assessment": "Fallback"}`, nil).Twice()
+	ei.StartBundle(noRubric, nil, nil, nil, nil, nil, nil)
+
+	// Assessments naming a preferred model of the unhealthy provider go to the fallback too
+	for _, assessment := range []Assessment{{Result: "first"}, {Result: "second", PreferredModel: "gemini-1.5-flash-002"}} {
+		ei.ProcessElement(context.Background(), assessment, noRubric, func(InsightsResult) {}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+	fallback.AssertExpectations(t)
+	preferred.AssertNotCalled(t, "GenerateText", mock.Anything, mock.Anything, mock.Anything)
+
+	// The retries and metrics of the bundle are the fallback's: claude-3-opus is limited to 4096 tokens
+	assert.Equal(t, llm.ProviderAnthropic, ei.provider())
+	assert.Equal(t, 4096, ei.bumpMaxTokens(0))
+
+	// A bundle that can't be probed, once the call budget is spent, goes back to the configured model
+	ei.MaxTotalCalls = 1
+	totalCalls.Store(1)
+	ei.StartBundle(noRubric, nil, nil, nil, nil, nil, nil)
+	assert.Equal(t, llm.ProviderGemini, ei.provider())
+	assert.Equal(t, "cachedContents/gemini-schema", ei.modelFor(Assessment{}).cachedSchema)
+	assert.Same(t, preferred, ei.modelFor(Assessment{PreferredModel: "gemini-1.5-flash-002"}).model)
+	probe.AssertExpectations(t)
+	primary.AssertExpectations(t)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/textio"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/x/beamx"
+)
+
+func init() {
+	register.Function4x0(diffGroupedInsights)
+	register.Function2x1(insightsFromJSON)
+	register.Emitter1[InsightsDiff]()
+	beam.RegisterType(reflect.TypeOf((*InsightsDiff)(nil)).Elem())
+	beam.RegisterFunction(insightsDiffToJSON)
+}
+
+// diffPath is where the diff report of two runs is written.
+const diffPath = "insights_diff.jsonl"
+
+// Statuses of the insights of an assessment in the diff of two runs.
+const (
+	DiffUnchanged = "unchanged"
+	DiffChanged   = "changed"
+	// DiffAdded insights are in the candidate run only, DiffRemoved ones in the baseline run only.
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// InsightsDiff is the diff of the insights extracted for an assessment by a baseline run and a
+// candidate run, e.g. with a new prompt or model, as written to insights_diff.jsonl.
+type InsightsDiff struct {
+	AssessmentID string `json:"assessment_id"`
+	Status       string `json:"status"`
+	// ChangedFields are the JSON names of the fields produced by the model whose value changed.
+	ChangedFields []string `json:"changed_fields,omitempty"`
+	// CorrectAnswersDelta is the candidate's questions_answered_correctly minus the baseline's.
+	CorrectAnswersDelta int      `json:"questions_answered_correctly_delta,omitempty"`
+	AddedStrengths      []string `json:"added_strengths,omitempty"`
+	RemovedStrengths    []string `json:"removed_strengths,omitempty"`
+	AddedWeaknesses     []string `json:"added_weaknesses,omitempty"`
+	RemovedWeaknesses   []string `json:"removed_weaknesses,omitempty"`
+}
+
+/*
+diffInsights compares the insights of an assessment in the baseline and candidate runs, either
+being nil when the assessment is missing from that run. Only the fields produced by the model
+are compared, the ones filled in by the pipeline (e.g. generated_at) differing on every run.
+Empty and missing lists or maps are equal.
+*/
+func diffInsights(assessmentID string, baseline, candidate *InsightsResult) InsightsDiff {
+	diff := InsightsDiff{AssessmentID: assessmentID}
+	switch {
+	case baseline == nil:
+		diff.Status = DiffAdded
+		return diff
+	case candidate == nil:
+		diff.Status = DiffRemoved
+		return diff
+	}
+
+	before, after := reflect.ValueOf(*baseline), reflect.ValueOf(*candidate)
+	resultType := before.Type()
+	for i := 0; i < resultType.NumField(); i++ {
+		name, _, _ := strings.Cut(resultType.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" || pipelineFields[name] {
+			continue
+		}
+		if !equalField(before.Field(i), after.Field(i)) {
+			diff.ChangedFields = append(diff.ChangedFields, name)
+		}
+	}
+
+	diff.Status = DiffUnchanged
+	if len(diff.ChangedFields) > 0 {
+		diff.Status = DiffChanged
+	}
+	diff.CorrectAnswersDelta = candidate.CorrectAnswers - baseline.CorrectAnswers
+	diff.AddedStrengths, diff.RemovedStrengths = diffTerms(baseline.Strengths, candidate.Strengths)
+	diff.AddedWeaknesses, diff.RemovedWeaknesses = diffTerms(baseline.Weaknesses, candidate.Weaknesses)
+	return diff
+}
+
+// equalField reports whether two values of a field are equal, empty and nil lists or maps included.
+func equalField(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// diffTerms returns the terms of after missing from before, and those of before missing from after.
+func diffTerms(before, after []string) (added, removed []string) {
+	in := func(terms []string, term string) bool {
+		for _, t := range terms {
+			if t == term {
+				return true
+			}
+		}
+		return false
+	}
+	for _, term := range after {
+		if !in(before, term) {
+			added = append(added, term)
+		}
+	}
+	for _, term := range before {
+		if !in(after, term) {
+			removed = append(removed, term)
+		}
+	}
+	return added, removed
+}
+
+// diffGroupedInsights diffs the insights of an assessment grouped from the two runs. An assessment
+// processed more than once by a run, e.g. by a streaming job, is compared on its first insights.
+func diffGroupedInsights(assessmentID string, baseline, candidate func(*InsightsResult) bool, emit func(InsightsDiff)) {
+	var before, after InsightsResult
+	var baselineInsights, candidateInsights *InsightsResult
+	if baseline(&before) {
+		baselineInsights = &before
+	}
+	if candidate(&after) {
+		candidateInsights = &after
+	}
+	emit(diffInsights(assessmentID, baselineInsights, candidateInsights))
+}
+
+// DiffInsights joins the insights of a baseline run and a candidate run by assessment ID,
+// returning the InsightsDiff of every assessment of either run, for regression testing
+// prompt or model changes.
+func DiffInsights(scope beam.Scope, baseline, candidate beam.PCollection) beam.PCollection {
+	scope = scope.Scope("DiffInsights")
+	keyedBaseline := beam.ParDo(scope, insightsByAssessment, baseline)
+	keyedCandidate := beam.ParDo(scope, insightsByAssessment, candidate)
+	return beam.ParDo(scope, diffGroupedInsights, beam.CoGroupByKey(scope, keyedBaseline, keyedCandidate))
+}
+
+// insightsFromJSON parses a line of a JSON Lines output of the insights, skipping blank lines.
+func insightsFromJSON(line string, emit func(InsightsResult)) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	var insights InsightsResult
+	if err := json.Unmarshal([]byte(line), &insights); err != nil {
+		return fmt.Errorf("error parsing insights: %w", err)
+	}
+	emit(insights)
+	return nil
+}
+
+// insightsDiffToJSON converts InsightsDiff to JSON string
+func insightsDiffToJSON(diff InsightsDiff) string {
+	jsonBytes, err := json.Marshal(diff)
+	if err != nil {
+		log.Printf("Error marshaling insights diff to JSON: %v", err)
+		return ""
+	}
+	return string(jsonBytes)
+}
+
+// runDiff diffs the JSON Lines outputs of two runs, e.g. two processed.jsonl files, writing
+// the InsightsDiff of every assessment to insights_diff.jsonl.
+func runDiff(baselinePath, candidatePath string) {
+	beam.Init()
+	pipeline, scope := beam.NewPipelineWithRoot()
+
+	baseline := beam.ParDo(scope, insightsFromJSON, textio.Read(scope, baselinePath))
+	candidate := beam.ParDo(scope, insightsFromJSON, textio.Read(scope, candidatePath))
+	textio.Write(scope, diffPath, beam.ParDo(scope, insightsDiffToJSON, DiffInsights(scope, baseline, candidate)))
+
+	if err := beamx.Run(context.Background(), pipeline); err != nil {
+		log.Fatalf("Failed to diff the runs: %v", err)
+	}
+}
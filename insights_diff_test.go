@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffInsights(t *testing.T) {
+	baseline := InsightsResult{
+		AssessmentID:      "a-1",
+		OverallAssessment: "Good performance",
+		CorrectAnswers:    7,
+		Strengths:         []string{"algebra", "geometry"},
+		Weaknesses:        []string{"statistics"},
+		GeneratedAt:       time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	diff := func(baseline, candidate func(*InsightsResult) bool) InsightsDiff {
+		var diffs []InsightsDiff
+		diffGroupedInsights("a-1", baseline, candidate, func(diff InsightsDiff) {
+			diffs = append(diffs, diff)
+		})
+		if !assert.Len(t, diffs, 1) {
+			return InsightsDiff{}
+		}
+		return diffs[0]
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		// Fields filled in by the pipeline differ on every run, and empty maps are missing ones
+		candidate := baseline
+		candidate.GeneratedAt = baseline.GeneratedAt.Add(24 * time.Hour)
+		candidate.ActionableFeedback = map[string]string{}
+		assert.Equal(t, InsightsDiff{AssessmentID: "a-1", Status: DiffUnchanged},
+			diff(iterate(baseline), iterate(candidate)))
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		candidate := baseline
+		candidate.CorrectAnswers = 9
+		candidate.Strengths = []string{"geometry", "probability"}
+		assert.Equal(t, InsightsDiff{
+			AssessmentID:        "a-1",
+			Status:              DiffChanged,
+			ChangedFields:       []string{"questions_answered_correctly", "strengths"},
+			CorrectAnswersDelta: 2,
+			AddedStrengths:      []string{"probability"},
+			RemovedStrengths:    []string{"algebra"},
+		}, diff(iterate(baseline), iterate(candidate)))
+	})
+
+	t.Run("Missing in one run", func(t *testing.T) {
+		assert.Equal(t, InsightsDiff{AssessmentID: "a-1", Status: DiffAdded},
+			diff(iterate[InsightsResult](), iterate(baseline)))
+		assert.Equal(t, InsightsDiff{AssessmentID: "a-1", Status: DiffRemoved},
+			diff(iterate(baseline), iterate[InsightsResult]()))
+	})
+}
+
+func TestInsightsFromJSON(t *testing.T) {
+	var parsed []InsightsResult
+	emit := func(insights InsightsResult) { parsed = append(parsed, insights) }
+
+	assert.NoError(t, insightsFromJSON(insightsToJSON(InsightsResult{AssessmentID: "a-1", CorrectAnswers: 7}), emit))
+	assert.NoError(t, insightsFromJSON("  ", emit))
+	assert.Error(t, insightsFromJSON("{not json", emit))
+	if assert.Len(t, parsed, 1) {
+		assert.Equal(t, "a-1", parsed[0].AssessmentID)
+		assert.Equal(t, 7, parsed[0].CorrectAnswers)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/luillyfe/assessment-data-pipeline/insightspb"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/luillyfe/assessment-data-pipeline insights.proto
+
+func init() {
+	register.DoFn2x1[context.Context, InsightsResult, error](&writeProtoRecordsFn{})
+}
+
+// Output formats of the insights.
+const (
+	OutputFormatJSON  = "json"
+	OutputFormatProto = "proto"
+)
+
+/*
+insightsToProto converts the insights to an InsightsResult message of insights.proto, leaving
+out the fields that are never written out (PromptKey, ContentHash).
+*/
+func insightsToProto(insights InsightsResult) *insightspb.InsightsResult {
+	m := &insightspb.InsightsResult{
+		OverallAssessment:          insights.OverallAssessment,
+		QuestionsAnsweredCorrectly: int64(insights.CorrectAnswers),
+		Strengths:                  insights.Strengths,
+		Weaknesses:                 insights.Weaknesses,
+		ActionableFeedback:         insights.ActionableFeedback,
+		BusinessCaseImpactAnalysis: insights.BusinessImpact,
+		CompletedAt:                timestampToProto(insights.CompletedAt),
+		GeneratedAt:                timestampToProto(insights.GeneratedAt),
+		Degraded:                   insights.Degraded,
+		ModelVersion:               insights.ModelVersion,
+		FinishReason:               insights.FinishReason,
+		AssessmentId:               insights.AssessmentID,
+		QualityScore:               insights.QualityScore,
+	}
+	for _, gap := range insights.SkillGaps {
+		m.SkillGaps = append(m.SkillGaps, &insightspb.SkillGap{
+			Skill:               gap.Skill,
+			Severity:            string(gap.Severity),
+			RecommendedResource: gap.RecommendedResource,
+		})
+	}
+	if len(insights.StudyPlans) > 0 {
+		m.StudyPlans = make(map[string]*insightspb.StudyPlan, len(insights.StudyPlans))
+		for weakness, plan := range insights.StudyPlans {
+			m.StudyPlans[weakness] = &insightspb.StudyPlan{
+				Topic:          plan.Topic,
+				EstimatedHours: plan.EstimatedHours,
+				Resources:      plan.Resources,
+			}
+		}
+	}
+	for _, weakness := range insights.RankedWeaknesses {
+		m.RankedWeaknesses = append(m.RankedWeaknesses, &insightspb.RankedWeakness{
+			Topic:    weakness.Topic,
+			Severity: weakness.Severity,
+		})
+	}
+	return m
+}
+
+// insightsFromProto converts an InsightsResult message of insights.proto to the insights.
+// Timestamps are converted in UTC.
+func insightsFromProto(m *insightspb.InsightsResult) InsightsResult {
+	insights := InsightsResult{
+		OverallAssessment: m.GetOverallAssessment(),
+		CorrectAnswers:    int(m.GetQuestionsAnsweredCorrectly()),
+		Strengths:         m.GetStrengths(),
+		Weaknesses:        m.GetWeaknesses(),
+		CompletedAt:       timestampFromProto(m.GetCompletedAt()),
+		GeneratedAt:       timestampFromProto(m.GetGeneratedAt()),
+		Degraded:          m.GetDegraded(),
+		ModelVersion:      m.GetModelVersion(),
+		FinishReason:      m.GetFinishReason(),
+		AssessmentID:      m.GetAssessmentId(),
+		QualityScore:      m.GetQualityScore(),
+	}
+	if len(m.GetActionableFeedback()) > 0 {
+		insights.ActionableFeedback = m.GetActionableFeedback()
+	}
+	if len(m.GetBusinessCaseImpactAnalysis()) > 0 {
+		insights.BusinessImpact = m.GetBusinessCaseImpactAnalysis()
+	}
+	for _, gap := range m.GetSkillGaps() {
+		insights.SkillGaps = append(insights.SkillGaps, SkillGap{
+			Skill:               gap.GetSkill(),
+			Severity:            SkillGapSeverity(gap.GetSeverity()),
+			RecommendedResource: gap.GetRecommendedResource(),
+		})
+	}
+	if len(m.GetStudyPlans()) > 0 {
+		insights.StudyPlans = make(map[string]StudyPlan, len(m.GetStudyPlans()))
+		for weakness, plan := range m.GetStudyPlans() {
+			insights.StudyPlans[weakness] = StudyPlan{
+				Topic:          plan.GetTopic(),
+				EstimatedHours: plan.GetEstimatedHours(),
+				Resources:      plan.GetResources(),
+			}
+		}
+	}
+	for _, weakness := range m.GetRankedWeaknesses() {
+		insights.RankedWeaknesses = append(insights.RankedWeaknesses, RankedWeakness{
+			Topic:    weakness.GetTopic(),
+			Severity: weakness.GetSeverity(),
+		})
+	}
+	return insights
+}
+
+// timestampToProto converts t to a google.protobuf.Timestamp, left out for the zero time.
+func timestampToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// timestampFromProto converts a google.protobuf.Timestamp to a time in UTC, the zero time when unset.
+func timestampFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// encodeInsightsProto encodes the insights as an InsightsResult message of insights.proto. Map
+// entries are encoded in key order, so equal insights have equal encodings.
+func encodeInsightsProto(insights InsightsResult) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(insightsToProto(insights))
+}
+
+// decodeInsightsProto decodes an InsightsResult message of insights.proto, skipping unknown fields.
+func decodeInsightsProto(b []byte) (InsightsResult, error) {
+	var m insightspb.InsightsResult
+	if err := proto.Unmarshal(b, &m); err != nil {
+		return InsightsResult{}, fmt.Errorf("error decoding insights: %w", err)
+	}
+	return insightsFromProto(&m), nil
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// appendProtoRecord appends the message m to b as a length-prefixed record: its varint size, then m.
+func appendProtoRecord(b, m []byte) []byte {
+	return protowire.AppendBytes(b, m)
+}
+
+// readProtoRecords decodes the insights of a file of length-prefixed InsightsResult records.
+func readProtoRecords(data []byte) ([]InsightsResult, error) {
+	var records []InsightsResult
+	for len(data) > 0 {
+		m, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, fmt.Errorf("error reading record %d: %w", len(records), protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		insights, err := decodeInsightsProto(m)
+		if err != nil {
+			return nil, fmt.Errorf("error reading record %d: %w", len(records), err)
+		}
+		records = append(records, insights)
+	}
+	return records, nil
+}
+
+/*
+writeProtoRecordsFn is a DoFn that writes the insights as length-prefixed records encoded with
+the Serializer it names, InsightsResult messages when empty, one "<Prefix>-<shard>.pb" file per
+bundle so concurrent workers never share files.
+
+The shard is named after the assessments of the bundle, whose records are written in the order
+of their IDs. Runners don't keep the composition of a retried bundle, so the records of a failed
+attempt may be left in another file: the writes are at-least-once, and readers keep a record
+per assessment_id.
+*/
+type writeProtoRecordsFn struct {
+	Prefix     string
+	Serializer string
+	serializer Serializer[InsightsResult]
+	fs         filesystem.Interface
+	records    []protoRecord
+}
+
+// protoRecord is a serialized record of the insights of an assessment.
+type protoRecord struct {
+	assessmentID string
+	data         []byte
+}
+
+func (fn *writeProtoRecordsFn) Setup(ctx context.Context) error {
+	name := fn.Serializer
+	if name == "" {
+		name = OutputFormatProto
+	}
+	serializer, err := insightsSerializer(name)
+	if err != nil {
+		return err
+	}
+	fn.serializer = serializer
+	fs, err := filesystem.New(ctx, fn.Prefix)
+	if err != nil {
+		return fmt.Errorf("error initializing filesystem: %w", err)
+	}
+	fn.fs = fs
+	return nil
+}
+
+func (fn *writeProtoRecordsFn) StartBundle(_ context.Context) {
+	fn.records = nil
+}
+
+func (fn *writeProtoRecordsFn) ProcessElement(_ context.Context, insights InsightsResult) error {
+	record, err := fn.serializer.Serialize(insights)
+	if err != nil {
+		return fmt.Errorf("error serializing insights: %w", err)
+	}
+	fn.records = append(fn.records, protoRecord{assessmentID: insights.AssessmentID, data: record})
+	return nil
+}
+
+func (fn *writeProtoRecordsFn) FinishBundle(ctx context.Context) error {
+	if len(fn.records) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(fn.records, func(a, b protoRecord) int {
+		return strings.Compare(a.assessmentID, b.assessmentID)
+	})
+	shard := sha256.New()
+	var data []byte
+	for _, record := range fn.records {
+		shard.Write([]byte(record.assessmentID + "\n"))
+		data = appendProtoRecord(data, record.data)
+	}
+	file := fmt.Sprintf("%s-%s.pb", fn.Prefix, hex.EncodeToString(shard.Sum(nil))[:16])
+	if err := filesystem.Write(ctx, fn.fs, file, data); err != nil {
+		return fmt.Errorf("error writing records file %s: %w", file, err)
+	}
+	fn.records = nil
+	return nil
+}
+
+func (fn *writeProtoRecordsFn) Teardown() error {
+	if fn.fs == nil {
+		return nil
+	}
+	if err := fn.fs.Close(); err != nil {
+		return fmt.Errorf("error closing filesystem: %w", err)
+	}
+	return nil
+}
+
+// writeProtoRecords writes the insights as sharded files of length-prefixed InsightsResult
+// records, "<path without .jsonl>-<shard>.pb".
+func writeProtoRecords(scope beam.Scope, path string, insights beam.PCollection) {
+	scope = scope.Scope("writeProtoRecords")
+	beam.ParDo0(scope, &writeProtoRecordsFn{Prefix: strings.TrimSuffix(path, ".jsonl"), Serializer: OutputFormatProto}, insights)
+}
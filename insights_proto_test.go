@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+	"github.com/bufbuild/protocompile"
+	"github.com/luillyfe/assessment-data-pipeline/insightspb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+func TestInsightsProto_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		insights InsightsResult
+	}{
+		{
+			name: "Every field",
+			insights: InsightsResult{
+				OverallAssessment:  "Solid understanding of data services.",
+				CorrectAnswers:     42,
+				Strengths:          []string{"BigQuery", ""},
+				Weaknesses:         []string{"IAM", "Pub/Sub"},
+				ActionableFeedback: map[string]string{"security": "Review IAM roles.", "streaming": "Build a Dataflow job."},
+				BusinessImpact:     map[string]string{"cost": "Lower query costs."},
+				SkillGaps:          []SkillGap{{Skill: "Cloud security", Severity: SeverityHigh, RecommendedResource: "https://cloud.google.com/iam/docs"}},
+				StudyPlans: map[string]StudyPlan{
+					"IAM":     {Topic: "IAM roles", EstimatedHours: 2.5, Resources: []string{"IAM overview", "Custom roles lab"}},
+					"Pub/Sub": {Topic: "Pub/Sub"},
+				},
+				RankedWeaknesses: []RankedWeakness{{Topic: "IAM", Severity: 0.9}, {Topic: "Pub/Sub", Severity: 0}},
+				CompletedAt:      time.Date(2024, 7, 1, 12, 30, 15, 500, time.UTC),
+				GeneratedAt:      time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC),
+				Degraded:         true,
+				ModelVersion:     "gemini-1.5-pro-001",
+				FinishReason:     "STOP",
+				AssessmentID:     "assessment-1",
+				QualityScore:     0.85,
+			},
+		},
+		{
+			name:     "Empty insights",
+			insights: InsightsResult{},
+		},
+		{
+			name:     "Negative count and pre-epoch time",
+			insights: InsightsResult{CorrectAnswers: -1, CompletedAt: time.Date(1969, 12, 31, 23, 59, 59, 999, time.UTC)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, err := encodeInsightsProto(tc.insights)
+			assert.NoError(t, err)
+			decoded, err := decodeInsightsProto(encoded)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.insights, decoded)
+		})
+	}
+}
+
+func TestInsightsProto_GeneratedCodeUpToDate(t *testing.T) {
+	compiler := protocompile.Compiler{Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{})}
+	files, err := compiler.Compile(context.Background(), "insights.proto")
+	if err != nil {
+		t.Fatalf("Failed to parse insights.proto: %v", err)
+	}
+
+	// The generated code describes insights.proto as it is, or it must be regenerated
+	want := protodesc.ToFileDescriptorProto(files[0])
+	got := protodesc.ToFileDescriptorProto(insightspb.File_insights_proto)
+	want.SourceCodeInfo, got.SourceCodeInfo = nil, nil
+	assert.True(t, proto.Equal(want, got), "insightspb is out of date with insights.proto, run go generate")
+}
+
+func TestInsightsProto_MatchesJSON(t *testing.T) {
+	insights := InsightsResult{
+		OverallAssessment:  "Solid understanding of data services.",
+		CorrectAnswers:     -1,
+		Strengths:          []string{"BigQuery", ""},
+		Weaknesses:         []string{"IAM", "Pub/Sub"},
+		ActionableFeedback: map[string]string{"security": "Review IAM roles.", "streaming": "Build a Dataflow job."},
+		BusinessImpact:     map[string]string{"cost": "Lower query costs."},
+		SkillGaps:          []SkillGap{{Skill: "Cloud security", Severity: SeverityHigh, RecommendedResource: "https://cloud.google.com/iam/docs"}},
+		StudyPlans: map[string]StudyPlan{
+			"IAM":     {Topic: "IAM roles", EstimatedHours: 2.5, Resources: []string{"IAM overview", "Custom roles lab"}},
+			"Pub/Sub": {Topic: "Pub/Sub"},
+		},
+		RankedWeaknesses: []RankedWeakness{{Topic: "IAM", Severity: 0.9}, {Topic: "Pub/Sub", Severity: 0}},
+		CompletedAt:      time.Date(1969, 12, 31, 23, 59, 59, 999, time.UTC),
+		GeneratedAt:      time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC),
+		Degraded:         true,
+		ModelVersion:     "gemini-1.5-pro-001",
+		FinishReason:     "STOP",
+		AssessmentID:     "assessment-1",
+		QualityScore:     0.85,
+	}
+
+	// The JSON keys of the insights are the field names of insights.proto
+	data, err := json.Marshal(insights)
+	assert.NoError(t, err)
+	var expected insightspb.InsightsResult
+	if err := protojson.Unmarshal(data, &expected); err != nil {
+		t.Fatalf("Failed to read the insights into the insights.proto message: %v", err)
+	}
+	assert.True(t, proto.Equal(&expected, insightsToProto(insights)), "Converted insights don't match their JSON:\nwant %v\ngot  %v", &expected, insightsToProto(insights))
+}
+
+func TestInsightsProto_Deterministic(t *testing.T) {
+	insights := InsightsResult{ActionableFeedback: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}}
+
+	// Maps are encoded in key order
+	encoded, err := encodeInsightsProto(insights)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		again, err := encodeInsightsProto(insights)
+		assert.NoError(t, err)
+		assert.Equal(t, encoded, again)
+	}
+}
+
+func TestDecodeInsightsProto_UnknownAndInvalidFields(t *testing.T) {
+	// Fields added to insights.proto later are skipped
+	encoded, err := encodeInsightsProto(InsightsResult{AssessmentID: "assessment-1"})
+	assert.NoError(t, err)
+	encoded = protowire.AppendTag(encoded, 99, protowire.BytesType)
+	encoded = protowire.AppendString(encoded, "future field")
+	decoded, err := decodeInsightsProto(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, InsightsResult{AssessmentID: "assessment-1"}, decoded)
+
+	// A truncated message is an error
+	_, err = decodeInsightsProto(encoded[:len(encoded)-3])
+	assert.Error(t, err)
+}
+
+func TestWriteProtoRecordsFn(t *testing.T) {
+	ctx := context.Background()
+	records := []InsightsResult{
+		{OverallAssessment: "Good performance", AssessmentID: "a"},
+		{Weaknesses: []string{"IAM"}, AssessmentID: "b"},
+	}
+
+	fn := &writeProtoRecordsFn{Prefix: "memfs://proto/processed"}
+	assert.NoError(t, fn.Setup(ctx))
+	fn.StartBundle(ctx)
+	for _, insights := range records {
+		assert.NoError(t, fn.ProcessElement(ctx, insights))
+	}
+	assert.NoError(t, fn.FinishBundle(ctx))
+
+	// The bundle is written to a single file of length-prefixed records
+	fs := memfs.New(ctx)
+	files, err := fs.List(ctx, "memfs://proto/processed-*.pb")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	data, err := filesystem.Read(ctx, fs, files[0])
+	assert.NoError(t, err)
+	decoded, err := readProtoRecords(data)
+	assert.NoError(t, err)
+	assert.Equal(t, records, decoded)
+
+	// A bundle of the same assessments, e.g. retried unchanged, rewrites the same file
+	retried := []InsightsResult{
+		{Weaknesses: []string{"IAM", "Pub/Sub"}, AssessmentID: "b"},
+		{OverallAssessment: "Great performance", AssessmentID: "a"},
+	}
+	fn.StartBundle(ctx)
+	for _, insights := range retried {
+		assert.NoError(t, fn.ProcessElement(ctx, insights))
+	}
+	assert.NoError(t, fn.FinishBundle(ctx))
+	retriedFiles, err := fs.List(ctx, "memfs://proto/processed-*.pb")
+	assert.NoError(t, err)
+	assert.Equal(t, files, retriedFiles)
+	data, err = filesystem.Read(ctx, fs, files[0])
+	assert.NoError(t, err)
+	decoded, err = readProtoRecords(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []InsightsResult{retried[1], retried[0]}, decoded)
+
+	// Another bundle writes its own file
+	fn.StartBundle(ctx)
+	assert.NoError(t, fn.ProcessElement(ctx, InsightsResult{AssessmentID: "c"}))
+	assert.NoError(t, fn.FinishBundle(ctx))
+	files, err = fs.List(ctx, "memfs://proto/processed-*.pb")
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
@@ -0,0 +1,602 @@
+// Protocol Buffers definition of the insights written with OUTPUT_FORMAT=proto, as
+// length-prefixed (varint) records. The Go types of package insightspb are generated from
+// this file, see insights_proto.go.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: insights.proto
+
+package insightspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InsightsResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	OverallAssessment          string            `protobuf:"bytes,1,opt,name=overall_assessment,json=overallAssessment,proto3" json:"overall_assessment,omitempty"`
+	QuestionsAnsweredCorrectly int64             `protobuf:"varint,2,opt,name=questions_answered_correctly,json=questionsAnsweredCorrectly,proto3" json:"questions_answered_correctly,omitempty"`
+	Strengths                  []string          `protobuf:"bytes,3,rep,name=strengths,proto3" json:"strengths,omitempty"`
+	Weaknesses                 []string          `protobuf:"bytes,4,rep,name=weaknesses,proto3" json:"weaknesses,omitempty"`
+	ActionableFeedback         map[string]string `protobuf:"bytes,5,rep,name=actionable_feedback,json=actionableFeedback,proto3" json:"actionable_feedback,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	BusinessCaseImpactAnalysis map[string]string `protobuf:"bytes,6,rep,name=business_case_impact_analysis,json=businessCaseImpactAnalysis,proto3" json:"business_case_impact_analysis,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	SkillGaps                  []*SkillGap       `protobuf:"bytes,7,rep,name=skill_gaps,json=skillGaps,proto3" json:"skill_gaps,omitempty"`
+	// A study plan for each weakness, keyed by the weakness.
+	StudyPlans map[string]*StudyPlan `protobuf:"bytes,8,rep,name=study_plans,json=studyPlans,proto3" json:"study_plans,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// The weaknesses ranked by severity, from the most severe.
+	RankedWeaknesses []*RankedWeakness      `protobuf:"bytes,9,rep,name=ranked_weaknesses,json=rankedWeaknesses,proto3" json:"ranked_weaknesses,omitempty"`
+	CompletedAt      *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=completed_at,json=completedAt,proto3" json:"completed_at,omitempty"`
+	GeneratedAt      *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=generated_at,json=generatedAt,proto3" json:"generated_at,omitempty"`
+	Degraded         bool                   `protobuf:"varint,12,opt,name=degraded,proto3" json:"degraded,omitempty"`
+	ModelVersion     string                 `protobuf:"bytes,13,opt,name=model_version,json=modelVersion,proto3" json:"model_version,omitempty"`
+	FinishReason     string                 `protobuf:"bytes,14,opt,name=finish_reason,json=finishReason,proto3" json:"finish_reason,omitempty"`
+	AssessmentId     string                 `protobuf:"bytes,15,opt,name=assessment_id,json=assessmentId,proto3" json:"assessment_id,omitempty"`
+	// From 0 to 1, see ExtractInsights.QualityScorerName.
+	QualityScore float64 `protobuf:"fixed64,16,opt,name=quality_score,json=qualityScore,proto3" json:"quality_score,omitempty"`
+}
+
+func (x *InsightsResult) Reset() {
+	*x = InsightsResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_insights_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InsightsResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InsightsResult) ProtoMessage() {}
+
+func (x *InsightsResult) ProtoReflect() protoreflect.Message {
+	mi := &file_insights_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InsightsResult.ProtoReflect.Descriptor instead.
+func (*InsightsResult) Descriptor() ([]byte, []int) {
+	return file_insights_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *InsightsResult) GetOverallAssessment() string {
+	if x != nil {
+		return x.OverallAssessment
+	}
+	return ""
+}
+
+func (x *InsightsResult) GetQuestionsAnsweredCorrectly() int64 {
+	if x != nil {
+		return x.QuestionsAnsweredCorrectly
+	}
+	return 0
+}
+
+func (x *InsightsResult) GetStrengths() []string {
+	if x != nil {
+		return x.Strengths
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetWeaknesses() []string {
+	if x != nil {
+		return x.Weaknesses
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetActionableFeedback() map[string]string {
+	if x != nil {
+		return x.ActionableFeedback
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetBusinessCaseImpactAnalysis() map[string]string {
+	if x != nil {
+		return x.BusinessCaseImpactAnalysis
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetSkillGaps() []*SkillGap {
+	if x != nil {
+		return x.SkillGaps
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetStudyPlans() map[string]*StudyPlan {
+	if x != nil {
+		return x.StudyPlans
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetRankedWeaknesses() []*RankedWeakness {
+	if x != nil {
+		return x.RankedWeaknesses
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetCompletedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CompletedAt
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetGeneratedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.GeneratedAt
+	}
+	return nil
+}
+
+func (x *InsightsResult) GetDegraded() bool {
+	if x != nil {
+		return x.Degraded
+	}
+	return false
+}
+
+func (x *InsightsResult) GetModelVersion() string {
+	if x != nil {
+		return x.ModelVersion
+	}
+	return ""
+}
+
+func (x *InsightsResult) GetFinishReason() string {
+	if x != nil {
+		return x.FinishReason
+	}
+	return ""
+}
+
+func (x *InsightsResult) GetAssessmentId() string {
+	if x != nil {
+		return x.AssessmentId
+	}
+	return ""
+}
+
+func (x *InsightsResult) GetQualityScore() float64 {
+	if x != nil {
+		return x.QualityScore
+	}
+	return 0
+}
+
+type SkillGap struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Skill string `protobuf:"bytes,1,opt,name=skill,proto3" json:"skill,omitempty"`
+	// low, medium or high.
+	Severity            string `protobuf:"bytes,2,opt,name=severity,proto3" json:"severity,omitempty"`
+	RecommendedResource string `protobuf:"bytes,3,opt,name=recommended_resource,json=recommendedResource,proto3" json:"recommended_resource,omitempty"`
+}
+
+func (x *SkillGap) Reset() {
+	*x = SkillGap{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_insights_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SkillGap) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SkillGap) ProtoMessage() {}
+
+func (x *SkillGap) ProtoReflect() protoreflect.Message {
+	mi := &file_insights_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SkillGap.ProtoReflect.Descriptor instead.
+func (*SkillGap) Descriptor() ([]byte, []int) {
+	return file_insights_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SkillGap) GetSkill() string {
+	if x != nil {
+		return x.Skill
+	}
+	return ""
+}
+
+func (x *SkillGap) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *SkillGap) GetRecommendedResource() string {
+	if x != nil {
+		return x.RecommendedResource
+	}
+	return ""
+}
+
+type StudyPlan struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Topic          string   `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	EstimatedHours float64  `protobuf:"fixed64,2,opt,name=estimated_hours,json=estimatedHours,proto3" json:"estimated_hours,omitempty"`
+	Resources      []string `protobuf:"bytes,3,rep,name=resources,proto3" json:"resources,omitempty"`
+}
+
+func (x *StudyPlan) Reset() {
+	*x = StudyPlan{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_insights_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StudyPlan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StudyPlan) ProtoMessage() {}
+
+func (x *StudyPlan) ProtoReflect() protoreflect.Message {
+	mi := &file_insights_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StudyPlan.ProtoReflect.Descriptor instead.
+func (*StudyPlan) Descriptor() ([]byte, []int) {
+	return file_insights_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StudyPlan) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *StudyPlan) GetEstimatedHours() float64 {
+	if x != nil {
+		return x.EstimatedHours
+	}
+	return 0
+}
+
+func (x *StudyPlan) GetResources() []string {
+	if x != nil {
+		return x.Resources
+	}
+	return nil
+}
+
+type RankedWeakness struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Topic string `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	// From 0 (minor) to 1 (critical).
+	Severity float64 `protobuf:"fixed64,2,opt,name=severity,proto3" json:"severity,omitempty"`
+}
+
+func (x *RankedWeakness) Reset() {
+	*x = RankedWeakness{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_insights_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RankedWeakness) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankedWeakness) ProtoMessage() {}
+
+func (x *RankedWeakness) ProtoReflect() protoreflect.Message {
+	mi := &file_insights_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankedWeakness.ProtoReflect.Descriptor instead.
+func (*RankedWeakness) Descriptor() ([]byte, []int) {
+	return file_insights_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RankedWeakness) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *RankedWeakness) GetSeverity() float64 {
+	if x != nil {
+		return x.Severity
+	}
+	return 0
+}
+
+var File_insights_proto protoreflect.FileDescriptor
+
+var file_insights_proto_rawDesc = []byte{
+	0x0a, 0x0e, 0x69, 0x6e, 0x73, 0x69, 0x67, 0x68, 0x74, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x16, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2e, 0x69, 0x6e, 0x73,
+	0x69, 0x67, 0x68, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xd1, 0x09, 0x0a, 0x0e, 0x49, 0x6e,
+	0x73, 0x69, 0x67, 0x68, 0x74, 0x73, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x2d, 0x0a, 0x12,
+	0x6f, 0x76, 0x65, 0x72, 0x61, 0x6c, 0x6c, 0x5f, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65,
+	0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x11, 0x6f, 0x76, 0x65, 0x72, 0x61, 0x6c,
+	0x6c, 0x41, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x40, 0x0a, 0x1c, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x5f, 0x61, 0x6e, 0x73, 0x77, 0x65, 0x72, 0x65,
+	0x64, 0x5f, 0x63, 0x6f, 0x72, 0x72, 0x65, 0x63, 0x74, 0x6c, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x1a, 0x71, 0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x41, 0x6e, 0x73, 0x77,
+	0x65, 0x72, 0x65, 0x64, 0x43, 0x6f, 0x72, 0x72, 0x65, 0x63, 0x74, 0x6c, 0x79, 0x12, 0x1c, 0x0a,
+	0x09, 0x73, 0x74, 0x72, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x09, 0x73, 0x74, 0x72, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x77,
+	0x65, 0x61, 0x6b, 0x6e, 0x65, 0x73, 0x73, 0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x0a, 0x77, 0x65, 0x61, 0x6b, 0x6e, 0x65, 0x73, 0x73, 0x65, 0x73, 0x12, 0x6f, 0x0a, 0x13, 0x61,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x66, 0x65, 0x65, 0x64, 0x62, 0x61,
+	0x63, 0x6b, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x3e, 0x2e, 0x61, 0x73, 0x73, 0x65, 0x73,
+	0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2e, 0x69, 0x6e, 0x73, 0x69, 0x67, 0x68, 0x74, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x49, 0x6e, 0x73, 0x69, 0x67, 0x68, 0x74, 0x73, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x2e, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x61, 0x62, 0x6c, 0x65, 0x46, 0x65, 0x65, 0x64, 0x62,
+	0x61, 0x63, 0x6b, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x12, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x61, 0x62, 0x6c, 0x65, 0x46, 0x65, 0x65, 0x64, 0x62, 0x61, 0x63, 0x6b, 0x12, 0x89, 0x01, 0x0a,
+	0x1d, 0x62, 0x75, 0x73, 0x69, 0x6e, 0x65, 0x73, 0x73, 0x5f, 0x63, 0x61, 0x73, 0x65, 0x5f, 0x69,
+	0x6d, 0x70, 0x61, 0x63, 0x74, 0x5f, 0x61, 0x6e, 0x61, 0x6c, 0x79, 0x73, 0x69, 0x73, 0x18, 0x06,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x46, 0x2e, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e,
+	0x74, 0x2e, 0x69, 0x6e, 0x73, 0x69, 0x67, 0x68, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x6e,
+	0x73, 0x69, 0x67, 0x68, 0x74, 0x73, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x2e, 0x42, 0x75, 0x73,
+	0x69, 0x6e, 0x65, 0x73, 0x73, 0x43, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x70, 0x61, 0x63, 0x74, 0x41,
+	0x6e, 0x61, 0x6c, 0x79, 0x73, 0x69, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x1a, 0x62, 0x75,
+	0x73, 0x69, 0x6e, 0x65, 0x73, 0x73, 0x43, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x70, 0x61, 0x63, 0x74,
+	0x41, 0x6e, 0x61, 0x6c, 0x79, 0x73, 0x69, 0x73, 0x12, 0x3f, 0x0a, 0x0a, 0x73, 0x6b, 0x69, 0x6c,
+	0x6c, 0x5f, 0x67, 0x61, 0x70, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x61,
+	0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2e, 0x69, 0x6e, 0x73, 0x69, 0x67, 0x68,
+	0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x6b, 0x69, 0x6c, 0x6c, 0x47, 0x61, 0x70, 0x52, 0x09,
+	0x73, 0x6b, 0x69, 0x6c, 0x6c, 0x47, 0x61, 0x70, 0x73, 0x12, 0x57, 0x0a, 0x0b, 0x73, 0x74, 0x75,
+	0x64, 0x79, 0x5f, 0x70, 0x6c, 0x61, 0x6e, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x36,
+	0x2e, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2e, 0x69, 0x6e, 0x73, 0x69,
+	0x67, 0x68, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x6e, 0x73, 0x69, 0x67, 0x68, 0x74, 0x73,
+	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x2e, 0x53, 0x74, 0x75, 0x64, 0x79, 0x50, 0x6c, 0x61, 0x6e,
+	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0a, 0x73, 0x74, 0x75, 0x64, 0x79, 0x50, 0x6c, 0x61,
+	0x6e, 0x73, 0x12, 0x53, 0x0a, 0x11, 0x72, 0x61, 0x6e, 0x6b, 0x65, 0x64, 0x5f, 0x77, 0x65, 0x61,
+	0x6b, 0x6e, 0x65, 0x73, 0x73, 0x65, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x26, 0x2e,
+	0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2e, 0x69, 0x6e, 0x73, 0x69, 0x67,
+	0x68, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x61, 0x6e, 0x6b, 0x65, 0x64, 0x57, 0x65, 0x61,
+	0x6b, 0x6e, 0x65, 0x73, 0x73, 0x52, 0x10, 0x72, 0x61, 0x6e, 0x6b, 0x65, 0x64, 0x57, 0x65, 0x61,
+	0x6b, 0x6e, 0x65, 0x73, 0x73, 0x65, 0x73, 0x12, 0x3d, 0x0a, 0x0c, 0x63, 0x6f, 0x6d, 0x70, 0x6c,
+	0x65, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x6c,
+	0x65, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x3d, 0x0a, 0x0c, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61,
+	0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61,
+	0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x65, 0x67, 0x72, 0x61, 0x64, 0x65,
+	0x64, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x64, 0x65, 0x67, 0x72, 0x61, 0x64, 0x65,
+	0x64, 0x12, 0x23, 0x0a, 0x0d, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x23, 0x0a, 0x0d, 0x66, 0x69, 0x6e, 0x69, 0x73, 0x68,
+	0x5f, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x66,
+	0x69, 0x6e, 0x69, 0x73, 0x68, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x23, 0x0a, 0x0d, 0x61,
+	0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x0f, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0c, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x49, 0x64,
+	0x12, 0x23, 0x0a, 0x0d, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x5f, 0x73, 0x63, 0x6f, 0x72,
+	0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0c, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79,
+	0x53, 0x63, 0x6f, 0x72, 0x65, 0x1a, 0x45, 0x0a, 0x17, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x61,
+	0x62, 0x6c, 0x65, 0x46, 0x65, 0x65, 0x64, 0x62, 0x61, 0x63, 0x6b, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x4d, 0x0a, 0x1f,
+	0x42, 0x75, 0x73, 0x69, 0x6e, 0x65, 0x73, 0x73, 0x43, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x70, 0x61,
+	0x63, 0x74, 0x41, 0x6e, 0x61, 0x6c, 0x79, 0x73, 0x69, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
+	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
+	0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x60, 0x0a, 0x0f, 0x53,
+	0x74, 0x75, 0x64, 0x79, 0x50, 0x6c, 0x61, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10,
+	0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79,
+	0x12, 0x37, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x21, 0x2e, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2e, 0x69, 0x6e, 0x73,
+	0x69, 0x67, 0x68, 0x74, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x75, 0x64, 0x79, 0x50, 0x6c,
+	0x61, 0x6e, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x6f, 0x0a,
+	0x08, 0x53, 0x6b, 0x69, 0x6c, 0x6c, 0x47, 0x61, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x6b, 0x69,
+	0x6c, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x6b, 0x69, 0x6c, 0x6c, 0x12,
+	0x1a, 0x0a, 0x08, 0x73, 0x65, 0x76, 0x65, 0x72, 0x69, 0x74, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x73, 0x65, 0x76, 0x65, 0x72, 0x69, 0x74, 0x79, 0x12, 0x31, 0x0a, 0x14, 0x72,
+	0x65, 0x63, 0x6f, 0x6d, 0x6d, 0x65, 0x6e, 0x64, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x13, 0x72, 0x65, 0x63, 0x6f, 0x6d,
+	0x6d, 0x65, 0x6e, 0x64, 0x65, 0x64, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x22, 0x68,
+	0x0a, 0x09, 0x53, 0x74, 0x75, 0x64, 0x79, 0x50, 0x6c, 0x61, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x74,
+	0x6f, 0x70, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x70, 0x69,
+	0x63, 0x12, 0x27, 0x0a, 0x0f, 0x65, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x68,
+	0x6f, 0x75, 0x72, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0e, 0x65, 0x73, 0x74, 0x69,
+	0x6d, 0x61, 0x74, 0x65, 0x64, 0x48, 0x6f, 0x75, 0x72, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x72, 0x65,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x72,
+	0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x22, 0x42, 0x0a, 0x0e, 0x52, 0x61, 0x6e, 0x6b,
+	0x65, 0x64, 0x57, 0x65, 0x61, 0x6b, 0x6e, 0x65, 0x73, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f,
+	0x70, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x70, 0x69, 0x63,
+	0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x76, 0x65, 0x72, 0x69, 0x74, 0x79, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x08, 0x73, 0x65, 0x76, 0x65, 0x72, 0x69, 0x74, 0x79, 0x42, 0x39, 0x5a, 0x37,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6c, 0x75, 0x69, 0x6c, 0x6c,
+	0x79, 0x66, 0x65, 0x2f, 0x61, 0x73, 0x73, 0x65, 0x73, 0x73, 0x6d, 0x65, 0x6e, 0x74, 0x2d, 0x64,
+	0x61, 0x74, 0x61, 0x2d, 0x70, 0x69, 0x70, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x2f, 0x69, 0x6e, 0x73,
+	0x69, 0x67, 0x68, 0x74, 0x73, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_insights_proto_rawDescOnce sync.Once
+	file_insights_proto_rawDescData = file_insights_proto_rawDesc
+)
+
+func file_insights_proto_rawDescGZIP() []byte {
+	file_insights_proto_rawDescOnce.Do(func() {
+		file_insights_proto_rawDescData = protoimpl.X.CompressGZIP(file_insights_proto_rawDescData)
+	})
+	return file_insights_proto_rawDescData
+}
+
+var file_insights_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_insights_proto_goTypes = []any{
+	(*InsightsResult)(nil),        // 0: assessment.insights.v1.InsightsResult
+	(*SkillGap)(nil),              // 1: assessment.insights.v1.SkillGap
+	(*StudyPlan)(nil),             // 2: assessment.insights.v1.StudyPlan
+	(*RankedWeakness)(nil),        // 3: assessment.insights.v1.RankedWeakness
+	nil,                           // 4: assessment.insights.v1.InsightsResult.ActionableFeedbackEntry
+	nil,                           // 5: assessment.insights.v1.InsightsResult.BusinessCaseImpactAnalysisEntry
+	nil,                           // 6: assessment.insights.v1.InsightsResult.StudyPlansEntry
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+}
+var file_insights_proto_depIdxs = []int32{
+	4, // 0: assessment.insights.v1.InsightsResult.actionable_feedback:type_name -> assessment.insights.v1.InsightsResult.ActionableFeedbackEntry
+	5, // 1: assessment.insights.v1.InsightsResult.business_case_impact_analysis:type_name -> assessment.insights.v1.InsightsResult.BusinessCaseImpactAnalysisEntry
+	1, // 2: assessment.insights.v1.InsightsResult.skill_gaps:type_name -> assessment.insights.v1.SkillGap
+	6, // 3: assessment.insights.v1.InsightsResult.study_plans:type_name -> assessment.insights.v1.InsightsResult.StudyPlansEntry
+	3, // 4: assessment.insights.v1.InsightsResult.ranked_weaknesses:type_name -> assessment.insights.v1.RankedWeakness
+	7, // 5: assessment.insights.v1.InsightsResult.completed_at:type_name -> google.protobuf.Timestamp
+	7, // 6: assessment.insights.v1.InsightsResult.generated_at:type_name -> google.protobuf.Timestamp
+	2, // 7: assessment.insights.v1.InsightsResult.StudyPlansEntry.value:type_name -> assessment.insights.v1.StudyPlan
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_insights_proto_init() }
+func file_insights_proto_init() {
+	if File_insights_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_insights_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*InsightsResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_insights_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*SkillGap); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_insights_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*StudyPlan); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_insights_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*RankedWeakness); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_insights_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_insights_proto_goTypes,
+		DependencyIndexes: file_insights_proto_depIdxs,
+		MessageInfos:      file_insights_proto_msgTypes,
+	}.Build()
+	File_insights_proto = out.File
+	file_insights_proto_rawDesc = nil
+	file_insights_proto_goTypes = nil
+	file_insights_proto_depIdxs = nil
+}
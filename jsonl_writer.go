@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn3x1[context.Context, beam.Window, string, error](&writeJSONLFn{})
+}
+
+// jsonlCheckpoint records how much of a shard's output has been durably written.
+type jsonlCheckpoint struct {
+	Parts     int       `json:"parts"`
+	Lines     int       `json:"lines"`
+	LastPart  string    `json:"last_part"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// jsonlWriter buffers JSON lines and flushes them as numbered part files.
+// After every flush it rewrites a checkpoint file, so a failure loses at most
+// the lines buffered since the last flush.
+type jsonlWriter struct {
+	fs         filesystem.Interface
+	prefix     string
+	flushEvery int
+	buffer     []string
+	parts      int
+	lines      int
+}
+
+// newJSONLWriter creates a jsonlWriter writing "<prefix>-part-NNNNN.jsonl" files
+// and a "<prefix>.checkpoint" file, flushing every flushEvery lines.
+func newJSONLWriter(fs filesystem.Interface, prefix string, flushEvery int) *jsonlWriter {
+	return &jsonlWriter{
+		fs:         fs,
+		prefix:     prefix,
+		flushEvery: flushEvery,
+	}
+}
+
+// Write buffers a line and flushes the buffer once it holds flushEvery lines.
+func (w *jsonlWriter) Write(ctx context.Context, line string) error {
+	w.buffer = append(w.buffer, line)
+	if len(w.buffer) >= w.flushEvery {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush writes the buffered lines to a new part file and updates the checkpoint.
+func (w *jsonlWriter) Flush(ctx context.Context) error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	part := fmt.Sprintf("%s-part-%05d.jsonl", w.prefix, w.parts)
+	data := []byte(strings.Join(w.buffer, "\n") + "\n")
+	if err := filesystem.Write(ctx, w.fs, part, data); err != nil {
+		return fmt.Errorf("error writing part file %s: %w", part, err)
+	}
+
+	w.parts++
+	w.lines += len(w.buffer)
+	w.buffer = nil
+
+	checkpoint, err := json.Marshal(jsonlCheckpoint{
+		Parts:     w.parts,
+		Lines:     w.lines,
+		LastPart:  part,
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling checkpoint: %w", err)
+	}
+	if err := filesystem.Write(ctx, w.fs, w.prefix+".checkpoint", checkpoint); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// writeJSONLFn is a DoFn that writes JSON lines incrementally, one writer per window.
+// Each bundle writes its own shard so concurrent workers never share files.
+type writeJSONLFn struct {
+	Prefix     string
+	FlushEvery int
+	fs         filesystem.Interface
+	shard      string
+	writers    map[string]*jsonlWriter
+}
+
+func (fn *writeJSONLFn) Setup(ctx context.Context) error {
+	fs, err := filesystem.New(ctx, fn.Prefix)
+	if err != nil {
+		return fmt.Errorf("error initializing filesystem: %w", err)
+	}
+	fn.fs = fs
+	return nil
+}
+
+func (fn *writeJSONLFn) StartBundle(_ context.Context) {
+	fn.shard = strconv.FormatInt(rand.Int63(), 36)
+	fn.writers = make(map[string]*jsonlWriter)
+}
+
+func (fn *writeJSONLFn) ProcessElement(ctx context.Context, w beam.Window, line string) error {
+	key := windowName(w)
+	writer, ok := fn.writers[key]
+	if !ok {
+		writer = newJSONLWriter(fn.fs, fmt.Sprintf("%s-%s-%s", fn.Prefix, key, fn.shard), fn.FlushEvery)
+		fn.writers[key] = writer
+	}
+	return writer.Write(ctx, line)
+}
+
+func (fn *writeJSONLFn) FinishBundle(ctx context.Context) error {
+	for _, writer := range fn.writers {
+		if err := writer.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fn *writeJSONLFn) Teardown() error {
+	if fn.fs == nil {
+		return nil
+	}
+	if err := fn.fs.Close(); err != nil {
+		return fmt.Errorf("error closing filesystem: %w", err)
+	}
+	return nil
+}
+
+// windowName returns a file-name friendly identifier for a window.
+func windowName(w beam.Window) string {
+	if iw, ok := w.(window.IntervalWindow); ok {
+		return fmt.Sprintf("%s-%s", iw.Start.ToTime().UTC().Format("20060102T150405"), iw.End.ToTime().UTC().Format("20060102T150405"))
+	}
+	return "global"
+}
+
+// writeJSONLIncrementally windows the JSON lines into fixed windows of the given size
+// and writes them with writeJSONLFn, flushing every flushEvery lines.
+func writeJSONLIncrementally(scope beam.Scope, prefix string, flushEvery int, windowSize time.Duration, lines beam.PCollection) {
+	scope = scope.Scope("writeJSONLIncrementally")
+	windowed := beam.WindowInto(scope, window.NewFixedWindows(windowSize), lines)
+	beam.ParDo0(scope, &writeJSONLFn{Prefix: prefix, FlushEvery: flushEvery}, windowed)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLWriter_IncrementalFlush(t *testing.T) {
+	ctx := context.Background()
+	fs := memfs.New(ctx)
+	w := newJSONLWriter(fs, "memfs://incremental/processed", 2)
+
+	readCheckpoint := func() jsonlCheckpoint {
+		data, err := filesystem.Read(ctx, fs, "memfs://incremental/processed.checkpoint")
+		if err != nil {
+			t.Fatalf("Failed to read checkpoint: %s", err)
+		}
+		var checkpoint jsonlCheckpoint
+		if err := json.Unmarshal(data, &checkpoint); err != nil {
+			t.Fatalf("Failed to parse checkpoint: %s", err)
+		}
+		return checkpoint
+	}
+
+	// Nothing is written until the buffer is full
+	assert.NoError(t, w.Write(ctx, `{"n":1}`))
+	parts, err := fs.List(ctx, "memfs://incremental/processed-part-*")
+	assert.NoError(t, err)
+	assert.Empty(t, parts)
+
+	// The second line triggers a flush
+	assert.NoError(t, w.Write(ctx, `{"n":2}`))
+	data, err := filesystem.Read(ctx, fs, "memfs://incremental/processed-part-00000.jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"n\":1}\n{\"n\":2}\n", string(data))
+	assert.Equal(t, 2, readCheckpoint().Lines)
+
+	// A partial buffer is written on an explicit flush
+	assert.NoError(t, w.Write(ctx, `{"n":3}`))
+	assert.Equal(t, 2, readCheckpoint().Lines)
+	assert.NoError(t, w.Flush(ctx))
+	data, err = filesystem.Read(ctx, fs, "memfs://incremental/processed-part-00001.jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"n\":3}\n", string(data))
+
+	checkpoint := readCheckpoint()
+	assert.Equal(t, 2, checkpoint.Parts)
+	assert.Equal(t, 3, checkpoint.Lines)
+	assert.Equal(t, "memfs://incremental/processed-part-00001.jsonl", checkpoint.LastPart)
+
+	// Flushing an empty buffer is a no-op
+	assert.NoError(t, w.Flush(ctx))
+	assert.Equal(t, 2, readCheckpoint().Parts)
+}
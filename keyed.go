@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn1x2[Assessment, string, Assessment](&keyAssessmentsFn{})
+}
+
+// KeyExtractor returns the key of an assessment, e.g. its user, for per-key operations
+// such as deduplication or combining.
+type KeyExtractor func(Assessment) string
+
+// keyExtractors holds the key extractors that can be referenced by name.
+var keyExtractors = map[string]KeyExtractor{
+	"content":        contentKey,
+	"completed_date": completedDateKey,
+}
+
+// RegisterKeyExtractor makes a key extractor available by name to keyAssessments. The keying
+// DoFn carries the name only, so extractors are registered in init to exist on every worker.
+func RegisterKeyExtractor(name string, extractor KeyExtractor) {
+	keyExtractors[name] = extractor
+}
+
+// contentKey is the key extractor registered as "content": the SHA-256 of the assessment
+// result, so identical assessments share a key.
+func contentKey(assessment Assessment) string {
+	sum := sha256.Sum256([]byte(assessment.Result))
+	return hex.EncodeToString(sum[:])
+}
+
+// completedDateKey is the key extractor registered as "completed_date": the UTC date
+// the assessment was completed on, as YYYY-MM-DD.
+func completedDateKey(assessment Assessment) string {
+	return assessment.CompletedAt.UTC().Format("2006-01-02")
+}
+
+// keyAssessmentsFn is a DoFn pairing every assessment with its key. Functions can't be
+// serialized with the DoFn, so the extractor is resolved by name in Setup.
+type keyAssessmentsFn struct {
+	KeyExtractorName string
+	extractor        KeyExtractor
+}
+
+func (fn *keyAssessmentsFn) Setup() error {
+	extractor, ok := keyExtractors[fn.KeyExtractorName]
+	if !ok {
+		return fmt.Errorf("error: unknown key extractor %q", fn.KeyExtractorName)
+	}
+	fn.extractor = extractor
+	return nil
+}
+
+func (fn *keyAssessmentsFn) ProcessElement(assessment Assessment) (string, Assessment) {
+	return fn.extractor(assessment), assessment
+}
+
+// keyAssessments keys the assessments with the registered key extractor of the given name,
+// returning a PCollection<KV<string, Assessment>>.
+func keyAssessments(scope beam.Scope, extractorName string, assessments beam.PCollection) beam.PCollection {
+	return beam.ParDo(scope.Scope("KeyAssessments"), &keyAssessmentsFn{KeyExtractorName: extractorName}, assessments)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+func TestKeyAssessmentsFn(t *testing.T) {
+	RegisterKeyExtractor("result_prefix", func(assessment Assessment) string {
+		return assessment.Result[:4]
+	})
+	t.Cleanup(func() { delete(keyExtractors, "result_prefix") })
+
+	assessment := Assessment{
+		Result:      "user-42: 8 of 10 correct",
+		CompletedAt: time.Date(2024, 9, 1, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60)),
+	}
+
+	testCases := []struct {
+		name      string
+		extractor string
+		expected  string
+	}{
+		{name: "Registered extractor", extractor: "result_prefix", expected: "user"},
+		{name: "Completed date in UTC", extractor: "completed_date", expected: "2024-09-02"},
+		{name: "Content hash", extractor: "content", expected: contentKey(Assessment{Result: assessment.Result})},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fn := &keyAssessmentsFn{KeyExtractorName: tc.extractor}
+			if err := fn.Setup(); err != nil {
+				t.Fatalf("Setup() returned error: %v", err)
+			}
+
+			key, value := fn.ProcessElement(assessment)
+			if key != tc.expected {
+				t.Errorf("Expected key %q, got %q", tc.expected, key)
+			}
+			if value != assessment {
+				t.Errorf("Expected the assessment to be kept, got %+v", value)
+			}
+		})
+	}
+
+	if err := (&keyAssessmentsFn{KeyExtractorName: "user"}).Setup(); err == nil {
+		t.Errorf("Expected error for an unknown key extractor, got nil")
+	}
+}
+
+func TestKeyAssessments(t *testing.T) {
+	_, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, Assessment{Result: "Assessment"})
+
+	keyed := keyAssessments(scope, "content", assessments)
+
+	// The output is a KV of the key and the assessment
+	if !typex.IsKV(keyed.Type()) {
+		t.Fatalf("Expected a KV PCollection, got %v", keyed.Type())
+	}
+	components := keyed.Type().Components()
+	if components[0].Type() != reflect.TypeOf("") || components[1].Type() != reflect.TypeOf(Assessment{}) {
+		t.Errorf("Expected KV<string, Assessment>, got %v", keyed.Type())
+	}
+}
@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+/*
+AsSimpleFunc adapts a LanguageModel to a plain function of the prompt, hiding the generation options.
+
+The given options are passed to every call, so the returned function can be handed to tooling that
+only knows about prompts and text. For example:
+
+	generate := AsSimpleFunc(NewMistralLLM(), nil)
+	text, err := generate(ctx, "Hello, how are you?")
+*/
+func AsSimpleFunc(m LanguageModel, opts *GenerateOptions) func(context.Context, string) (string, error) {
+	return func(ctx context.Context, prompt string) (string, error) {
+		return m.GenerateText(ctx, prompt, opts)
+	}
+}
+
+/*
+Pipe reads the whole prompt from r, generates text for it with the LanguageModel and writes
+the generated text to w, so a model can sit between a reader and a writer like any other filter.
+*/
+func Pipe(ctx context.Context, m LanguageModel, opts *GenerateOptions, r io.Reader, w io.Writer) error {
+	prompt, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading prompt: %w", err)
+	}
+
+	text, err := AsSimpleFunc(m, opts)(ctx, string(prompt))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, text); err != nil {
+		return fmt.Errorf("error writing generated text: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// promptRecordingModel records the prompt and options of the last call.
+type promptRecordingModel struct {
+	prompt string
+	opts   *GenerateOptions
+	err    error
+}
+
+func (m *promptRecordingModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	m.prompt = prompt
+	m.opts = opts
+	if m.err != nil {
+		return "", m.err
+	}
+	return strings.ToUpper(prompt), nil
+}
+
+func TestAsSimpleFunc(t *testing.T) {
+	model := &promptRecordingModel{}
+	opts := &GenerateOptions{SystemPrompt: "You are an exam grader."}
+
+	generate := AsSimpleFunc(model, opts)
+	got, err := generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("HELLO", got); diff != "" {
+		t.Errorf("AsSimpleFunc() mismatch (-want +got):\n%s", diff)
+	}
+	if model.opts != opts {
+		t.Errorf("Expected the adapter options to be passed to the model, got %v", model.opts)
+	}
+
+	model.err = errors.New("provider unavailable")
+	if _, err := generate(context.Background(), "hello"); !errors.Is(err, model.err) {
+		t.Errorf("Expected the model error, got %v", err)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	model := &promptRecordingModel{}
+
+	var out strings.Builder
+	if err := Pipe(context.Background(), model, nil, strings.NewReader("hello"), &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("hello", model.prompt); diff != "" {
+		t.Errorf("Pipe() prompt mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("HELLO", out.String()); diff != "" {
+		t.Errorf("Pipe() output mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/liushuangls/go-anthropic/v2"
 )
@@ -38,14 +39,26 @@ Fields:
 	topP: Sets the nucleus sampling threshold for the generated text.
 	      This parameter controls the diversity of the generated text.
 
+	topK: Only samples from the top K options for each token.
+	      0 or negative leaves it unset.
+
+	stopSequences: Custom sequences that stop the generation.
+
+	tools: The tools passed with the calls without tools of their own, set with WithTools.
+
 	client: An instance of the AnthropicClient interface, used to interact with the Anthropic API.
 */
 type anthropicLLM struct {
-	modelName   string
-	temperature float64
-	maxTokens   int
-	topP        float64
-	client      AnthropicClient
+	modelName     string
+	temperature   float64
+	maxTokens     int
+	topP          float64
+	topK          int
+	stopSequences []string
+	tools         []GenericTool
+	// metadata tags the requests, set with WithRequestMetadata.
+	metadata map[string]string
+	client   AnthropicClient
 }
 
 /*
@@ -61,51 +74,125 @@ Args:
 
 	ctx: The context for the request.
 	prompt: The input prompt for text generation.
-	opts: Optional generation options, such as tools.
+	opts: Optional generation options, such as tools or a forced tool choice.
 
 Returns:
 
-	A string containing the generated text and an error if any occurred.
+	A string containing the generated text (or the forced tool input) and an error if any occurred.
 */
 func (a *anthropicLLM) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := a.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata is GenerateText, also returning the model version and finish reason of the response.
+func (a *anthropicLLM) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	if opts != nil && len(opts.InlineData) > 0 {
+		return "", ResponseMeta{}, fmt.Errorf("%w by Anthropic LLM", ErrInlineDataNotSupported)
+	}
+
 	// Cast to float32
 	temperature := float32(a.temperature)
 	topP := float32(a.topP)
 
 	// Tool handling
 	var anthropicTools []anthropic.ToolDefinition
-	if opts != nil && len(opts.Tools) > 0 {
-		for _, genericTool := range opts.Tools {
+	if tools := opts.tools(a.tools); len(tools) > 0 {
+		for _, genericTool := range tools {
 			if genericTool.Type != AnthropicToolType {
-				return "", fmt.Errorf("error: tool type mismatch for Anthropic LLM")
+				return "", ResponseMeta{}, fmt.Errorf("error: tool type mismatch for Anthropic LLM")
 			}
 			anthropicTool, ok := genericTool.Tool.(anthropic.ToolDefinition)
 			if !ok {
-				return "", fmt.Errorf("error: invalid tool type for Anthropic LLM")
+				return "", ResponseMeta{}, fmt.Errorf("error: invalid tool type for Anthropic LLM")
 			}
 			anthropicTools = append(anthropicTools, anthropicTool)
 		}
 	}
 
+	// Forced tool choice
+	var toolChoice *anthropic.ToolChoice
+	if opts != nil && opts.ToolChoice != "" {
+		toolChoice = &anthropic.ToolChoice{Type: "tool", Name: opts.ToolChoice}
+	}
+
+	// System prompt
+	var system string
+	if opts != nil {
+		system = opts.SystemPrompt
+	}
+
+	// Top-k sampling, only sent when enabled
+	var topK *int
+	if a.topK > 0 {
+		topK = &a.topK
+	}
+
 	// Using chat completion
 	resp, err := a.client.CreateMessages(ctx, anthropic.MessagesRequest{
 		Model: a.modelName,
 		Messages: []anthropic.Message{
 			anthropic.NewUserTextMessage(prompt),
 		},
-		MaxTokens:   a.maxTokens,
-		Temperature: &temperature,
-		TopP:        &topP,
-		Tools:       anthropicTools,
+		System:        system,
+		MaxTokens:     opts.maxTokens(a.maxTokens),
+		Temperature:   &temperature,
+		TopP:          &topP,
+		TopK:          topK,
+		StopSequences: a.stopSequences,
+		Tools:         anthropicTools,
+		ToolChoice:    toolChoice,
+		Metadata:      anthropicMetadata(a.metadata),
 	})
 	if err != nil {
 		var e *anthropic.APIError
 		if errors.As(err, &e) {
-			return "", fmt.Errorf("anthropic API error, type: %s, message: %s", e.Type, e.Message)
+			if e.Type == anthropic.ErrTypeAuthentication || e.Type == anthropic.ErrTypePermission {
+				return "", ResponseMeta{}, fmt.Errorf("%w: anthropic API error, type: %s, message: %s", ErrAuthentication, e.Type, e.Message)
+			}
+			if e.Type == anthropic.ErrTypeInvalidRequest {
+				return "", ResponseMeta{}, fmt.Errorf("%w: anthropic API error, type: %s, message: %s", ErrInvalidRequest, e.Type, e.Message)
+			}
+			return "", ResponseMeta{}, fmt.Errorf("anthropic API error, type: %s, message: %s", e.Type, e.Message)
 		}
-		return "", fmt.Errorf("anthropic API error: %w", err)
+		var requestErr *anthropic.RequestError
+		if errors.As(err, &requestErr) && (requestErr.StatusCode == http.StatusUnauthorized || requestErr.StatusCode == http.StatusForbidden) {
+			return "", ResponseMeta{}, fmt.Errorf("%w: anthropic API error: %w", ErrAuthentication, err)
+		}
+		return "", ResponseMeta{}, fmt.Errorf("anthropic API error: %w", err)
 	}
 
-	// Return generated text
-	return *resp.Content[0].Text, nil
+	meta := ResponseMeta{
+		ModelVersion: resp.Model,
+		FinishReason: string(resp.StopReason),
+		Reason:       anthropicFinishReason(resp.StopReason),
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+	}
+
+	// Return the forced tool input as the generated text
+	if toolChoice != nil {
+		for _, content := range resp.Content {
+			if content.Type == anthropic.MessagesContentTypeToolUse && content.MessageContentToolUse != nil &&
+				content.MessageContentToolUse.Name == toolChoice.Name {
+				return string(content.MessageContentToolUse.Input), meta, truncationError(meta)
+			}
+		}
+		if err := truncationError(meta); err != nil {
+			return "", meta, fmt.Errorf("%w before calling tool %s", err, toolChoice.Name)
+		}
+		return "", meta, fmt.Errorf("error: anthropic response did not call tool %s", toolChoice.Name)
+	}
+
+	// Return generated text, partial when truncated
+	return *resp.Content[0].Text, meta, truncationError(meta)
+}
+
+// truncationError returns an ErrTruncated error when the response stopped at the maximum number
+// of tokens, so callers see the partial text can't be parsed and may retry with more tokens.
+func truncationError(meta ResponseMeta) error {
+	if meta.Reason != FinishReasonLength {
+		return nil
+	}
+	return fmt.Errorf("%w: anthropic stop reason %s", ErrTruncated, meta.FinishReason)
 }
@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is a single model interaction, as retained for compliance.
+type AuditRecord struct {
+	Time         time.Time `json:"time"`
+	Model        string    `json:"model"`
+	Prompt       string    `json:"prompt"`
+	Response     string    `json:"response"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	LatencyMs    int64     `json:"latency_ms"`
+	Error        string    `json:"error,omitempty"`
+	// TenantID and RequestID tag the call with the IDs carried by its context, see WithTenantID.
+	TenantID  string `json:"tenant_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// AuditSink receives an AuditRecord for every call of a model created with NewAuditedModel.
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+/*
+auditedModel is a LanguageModel that records every call to an AuditSink.
+
+Fields:
+
+	model: The audited model.
+
+	name: The model identity recorded when the response doesn't report its model version.
+
+	sink: The sink receiving the audit records.
+
+	now: Returns the current time, replaced in tests by a fake clock.
+*/
+type auditedModel struct {
+	model LanguageModel
+	name  string
+	sink  AuditSink
+	now   func() time.Time
+}
+
+/*
+NewAuditedModel creates a LanguageModel that records the prompt, response, model identity,
+token usage and latency of every call of the given model to the sink, tagged with the tenant
+and request IDs of its context. The model version reported by the response is recorded when
+available, name otherwise.
+
+Failed calls are recorded too. A call fails if its audit record can't be written, so no
+interaction goes unaudited.
+*/
+func NewAuditedModel(model LanguageModel, name string, sink AuditSink) LanguageModel {
+	return &auditedModel{
+		model: model,
+		name:  name,
+		sink:  sink,
+		now:   time.Now,
+	}
+}
+
+// GenerateText generates text with the audited model, then records the interaction.
+func (a *auditedModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := a.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata generates text with the audited model, then records the interaction,
+// returning the metadata of the response.
+func (a *auditedModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	start := a.now()
+	text, meta, err := GenerateTextWithMetadata(ctx, a.model, prompt, opts)
+
+	record := AuditRecord{
+		Time:         start,
+		Model:        a.name,
+		Prompt:       prompt,
+		Response:     text,
+		InputTokens:  meta.InputTokens,
+		OutputTokens: meta.OutputTokens,
+		LatencyMs:    a.now().Sub(start).Milliseconds(),
+		TenantID:     TenantID(ctx),
+		RequestID:    RequestID(ctx),
+	}
+	if meta.ModelVersion != "" {
+		record.Model = meta.ModelVersion
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if auditErr := a.sink.Record(ctx, record); auditErr != nil {
+		return "", meta, fmt.Errorf("error recording audit log: %w", auditErr)
+	}
+	return text, meta, err
+}
+
+// CacheContent caches the content with the audited model. It isn't recorded, as it generates nothing.
+func (a *auditedModel) CacheContent(ctx context.Context, text string) (string, error) {
+	return CacheContent(ctx, a.model, text)
+}
+
+// AuditPromptMode selects how prompts are written to the audit log.
+type AuditPromptMode string
+
+const (
+	// AuditPromptPlain writes prompts as they are.
+	AuditPromptPlain AuditPromptMode = "plain"
+	// AuditPromptHash writes the hex-encoded SHA-256 of prompts, so they can be matched but not read.
+	AuditPromptHash AuditPromptMode = "hash"
+	// AuditPromptRedact leaves prompts out of the audit log.
+	AuditPromptRedact AuditPromptMode = "redact"
+)
+
+// redactedPrompt replaces the prompts left out of the audit log.
+const redactedPrompt = "[REDACTED]"
+
+// JSONLAuditSink is an AuditSink appending one JSON line per record to a file.
+type JSONLAuditSink struct {
+	mu         sync.Mutex
+	file       *os.File
+	promptMode AuditPromptMode
+}
+
+/*
+NewJSONLAuditSink opens (or creates) the JSON Lines file at path, appending the audit records to it.
+The prompts are written according to promptMode, AuditPromptPlain when empty.
+
+The returned sink must be closed when the model is no longer used.
+*/
+func NewJSONLAuditSink(path string, promptMode AuditPromptMode) (*JSONLAuditSink, error) {
+	switch promptMode {
+	case "":
+		promptMode = AuditPromptPlain
+	case AuditPromptPlain, AuditPromptHash, AuditPromptRedact:
+	default:
+		return nil, fmt.Errorf("error: unknown audit prompt mode %q", promptMode)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	return &JSONLAuditSink{file: file, promptMode: promptMode}, nil
+}
+
+// Record appends the record to the file, with its prompt hashed or redacted as configured.
+func (s *JSONLAuditSink) Record(ctx context.Context, record AuditRecord) error {
+	switch s.promptMode {
+	case AuditPromptHash:
+		sum := sha256.Sum256([]byte(record.Prompt))
+		record.Prompt = hex.EncodeToString(sum[:])
+	case AuditPromptRedact:
+		record.Prompt = redactedPrompt
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit record: %w", err)
+	}
+
+	// A single write per line keeps records whole when several sinks append to the same file
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log file.
+func (s *JSONLAuditSink) Close() error {
+	return s.file.Close()
+}
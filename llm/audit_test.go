@@ -0,0 +1,208 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readAuditLog reads the records of a JSON Lines audit log.
+func readAuditLog(t *testing.T, path string) []AuditRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditedModel(t *testing.T) {
+	start := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		promptMode AuditPromptMode
+		wantPrompt string
+	}{
+		{
+			name:       "Plain prompts",
+			wantPrompt: "Test prompt",
+		},
+		{
+			name:       "Hashed prompts",
+			promptMode: AuditPromptHash,
+			wantPrompt: "1439da2cb34b7c5b712b0cda7d879591a19fefcfedfd1c8bd7aa72364ac9fae7",
+		},
+		{
+			name:       "Redacted prompts",
+			promptMode: AuditPromptRedact,
+			wantPrompt: "[REDACTED]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			sink, err := NewJSONLAuditSink(path, tt.promptMode)
+			if err != nil {
+				t.Fatalf("NewJSONLAuditSink() error = %v", err)
+			}
+
+			anthropicModel := &anthropicLLM{modelName: "claude-3-5-sonnet-latest", client: &mockAnthropicClient{}}
+			model := NewAuditedModel(anthropicModel, "claude-3-5-sonnet-latest", sink).(*auditedModel)
+			now := start
+			model.now = func() time.Time {
+				now = now.Add(250 * time.Millisecond)
+				return now
+			}
+
+			for i := 0; i < 2; i++ {
+				if _, err := model.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+					t.Fatalf("GenerateText() error = %v", err)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			record := AuditRecord{
+				Model:        "claude-3-5-sonnet-20240620",
+				Prompt:       tt.wantPrompt,
+				Response:     "Anthropic Response",
+				InputTokens:  12,
+				OutputTokens: 34,
+				LatencyMs:    250,
+			}
+			first, second := record, record
+			first.Time = start.Add(250 * time.Millisecond)
+			second.Time = start.Add(750 * time.Millisecond)
+
+			// One record per call
+			if diff := cmp.Diff([]AuditRecord{first, second}, readAuditLog(t, path)); diff != "" {
+				t.Errorf("Audit log mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAuditedModelMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLAuditSink(path, AuditPromptPlain)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	inner := &metadataModel{text: `{"overall`, meta: ResponseMeta{Reason: FinishReasonLength, InputTokens: 100, OutputTokens: 50}}
+	model := NewAuditedModel(inner, "gemini-1.5-pro-exp-0801", sink)
+
+	// The metadata of the response goes through the audit log
+	text, meta, err := GenerateTextWithMetadata(context.Background(), model, "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+	}
+	if text != inner.text || meta != inner.meta {
+		t.Errorf("GenerateTextWithMetadata() = %q, %+v, want %q, %+v", text, meta, inner.text, inner.meta)
+	}
+	if records := readAuditLog(t, path); len(records) != 1 || records[0].InputTokens != 100 || records[0].OutputTokens != 50 {
+		t.Errorf("Expected the call to be recorded with its token usage, got %+v", records)
+	}
+
+	// So does content caching, which isn't recorded
+	if name, err := CacheContent(context.Background(), model, "schema"); err != nil || name != "cachedContents/schema" {
+		t.Errorf("CacheContent() = %q, %v, want the handle of the wrapped model", name, err)
+	}
+	if records := readAuditLog(t, path); len(records) != 1 {
+		t.Errorf("Expected content caching not to be recorded, got %d records", len(records))
+	}
+}
+
+// failingModel always fails.
+type failingModel struct{}
+
+func (m *failingModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	return "", errors.New("provider unavailable")
+}
+
+func TestAuditedModelRecordsFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLAuditSink(path, AuditPromptPlain)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	model := NewAuditedModel(&failingModel{}, "gemini-1.5-pro-exp-0801", sink)
+	if _, err := model.GenerateText(context.Background(), "Test prompt", nil); err == nil {
+		t.Fatal("Expected the model error to be returned")
+	}
+
+	records := readAuditLog(t, path)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d", len(records))
+	}
+	if records[0].Model != "gemini-1.5-pro-exp-0801" || records[0].Error != "provider unavailable" {
+		t.Errorf("Unexpected audit record: %+v", records[0])
+	}
+}
+
+func TestAuditedModelTenantTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLAuditSink(path, AuditPromptPlain)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	mistralModel := &mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}}
+	model := NewAuditedModel(mistralModel, "mistral-small-latest", sink)
+	ctx := WithRequestID(WithTenantID(context.Background(), "acme"), "assessment-1")
+	if _, err := model.GenerateText(ctx, "Test prompt", nil); err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+	// Calls without tags are recorded without them
+	if _, err := model.GenerateText(WithTenantID(context.Background(), ""), "Test prompt", nil); err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+
+	records := readAuditLog(t, path)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 audit records, got %d", len(records))
+	}
+	if records[0].TenantID != "acme" || records[0].RequestID != "assessment-1" {
+		t.Errorf("Expected the record to be tagged with the tenant and request, got %+v", records[0])
+	}
+	if records[1].TenantID != "" || records[1].RequestID != "" {
+		t.Errorf("Expected an untagged record, got %+v", records[1])
+	}
+
+	if got := logPrefix(ctx); got != "[tenant=acme request=assessment-1] " {
+		t.Errorf("logPrefix() = %q", got)
+	}
+	if got := logPrefix(context.Background()); got != "" {
+		t.Errorf("logPrefix() = %q, want no tags", got)
+	}
+}
+
+func TestNewJSONLAuditSinkWithInvalidMode(t *testing.T) {
+	if _, err := NewJSONLAuditSink(filepath.Join(t.TempDir(), "audit.jsonl"), "encrypt"); err == nil {
+		t.Error("Expected an error for an unknown prompt mode")
+	}
+}
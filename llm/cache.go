@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+ResponseCache stores the responses of a model created with NewCachingModel, by cache key.
+*/
+type ResponseCache interface {
+	// Get returns the response stored under key, and whether there is one.
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Set stores the response under key.
+	Set(ctx context.Context, key string, response string) error
+}
+
+// inMemoryResponseCache is a ResponseCache kept in memory, also a NegativeResponseCache.
+type inMemoryResponseCache struct {
+	mu        sync.Mutex
+	responses map[string]string
+	failures  map[string]cachedFailureEntry
+	now       func() time.Time
+}
+
+// NewInMemoryResponseCache returns a ResponseCache kept in memory, shared by the models of the process.
+// It also stores failures, see WithResponseCacheNegativeCaching.
+func NewInMemoryResponseCache() ResponseCache {
+	return &inMemoryResponseCache{
+		responses: make(map[string]string),
+		failures:  make(map[string]cachedFailureEntry),
+		now:       time.Now,
+	}
+}
+
+func (c *inMemoryResponseCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	response, ok := c.responses[key]
+	return response, ok, nil
+}
+
+func (c *inMemoryResponseCache) Set(ctx context.Context, key string, response string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[key] = response
+	return nil
+}
+
+// SchemaFingerprint returns the hex-encoded SHA-256 of the response schema, as embedded in the
+// cache keys of NewCachingModel.
+func SchemaFingerprint(schema string) string {
+	sum := sha256.Sum256([]byte(schema))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+cachingModel is a LanguageModel that answers the calls it has already made from a ResponseCache.
+
+Fields:
+
+	model: The cached model.
+
+	name: The model identity, keeping apart the responses of the models sharing the cache.
+
+	cache: The cache the responses are stored in.
+
+	fingerprint: The SchemaFingerprint of the response schema.
+
+	negativeTTL: How long deterministic failures are cached, see WithResponseCacheNegativeCaching.
+*/
+type cachingModel struct {
+	model       LanguageModel
+	name        string
+	cache       ResponseCache
+	fingerprint string
+	negativeTTL time.Duration
+}
+
+/*
+NewCachingModel creates a LanguageModel that stores the responses of the given model in the
+cache, and answers the calls repeating a previous one from it, without calling the model.
+
+Cache keys embed the fingerprint of the schema the responses follow, so changing the schema
+(e.g. when it is cached server-side and doesn't appear in the prompt) misses the responses
+stored for the previous one instead of returning incompatible JSON. The generation options
+shaping the response are part of the keys too.
+
+Calls with inline data or a conversation key, whose responses depend on more than the
+prompt, aren't cached. Cached responses report no ResponseMeta. Only responses are cached,
+unless failures are too with WithResponseCacheNegativeCaching.
+*/
+func NewCachingModel(model LanguageModel, name string, cache ResponseCache, schema string, opts ...lLMOption) LanguageModel {
+	c := &cachingModel{
+		model:       model,
+		name:        name,
+		cache:       cache,
+		fingerprint: SchemaFingerprint(schema),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// key returns the cache key of the call, nothing when it can't be cached.
+func (c *cachingModel) key(prompt string, opts *GenerateOptions) (string, bool) {
+	var o GenerateOptions
+	if opts != nil {
+		o = *opts
+	}
+	if len(o.InlineData) > 0 || o.ConversationKey != "" {
+		return "", false
+	}
+
+	h := sha256.New()
+	// Every part is length-prefixed, so no two calls share a key
+	for _, part := range []string{c.fingerprint, c.name, prompt, o.SystemPrompt, o.ResponseMIMEType, o.CachedContent, o.ToolChoice, fmt.Sprint(o.MaxTokens)} {
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	for _, tool := range o.Tools {
+		fmt.Fprintf(h, "%v", tool)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// GenerateText answers the call from the cache if it was made before, and with the model otherwise.
+func (c *cachingModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := c.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata answers the call from the cache if it was made before, and with the
+// model otherwise, storing its response, or its deterministic failure with negative caching.
+func (c *cachingModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	key, ok := c.key(prompt, opts)
+	if !ok {
+		return GenerateTextWithMetadata(ctx, c.model, prompt, opts)
+	}
+
+	text, hit, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return "", ResponseMeta{}, fmt.Errorf("error reading response cache: %w", err)
+	}
+	if hit {
+		return text, ResponseMeta{}, nil
+	}
+	negative, negativeCaching := c.negativeCache()
+	if negativeCaching {
+		failure, hit, err := negative.GetFailure(ctx, key)
+		if err != nil {
+			return "", ResponseMeta{}, fmt.Errorf("error reading response cache: %w", err)
+		}
+		if hit {
+			return "", ResponseMeta{}, failure.Err()
+		}
+	}
+
+	text, meta, err := GenerateTextWithMetadata(ctx, c.model, prompt, opts)
+	if err != nil {
+		if failure, ok := deterministicFailure(err); ok && negativeCaching {
+			if err := negative.SetFailure(ctx, key, failure, c.negativeTTL); err != nil {
+				return "", meta, fmt.Errorf("error writing response cache: %w", err)
+			}
+		}
+		return text, meta, err
+	}
+	if err := c.cache.Set(ctx, key, text); err != nil {
+		return "", meta, fmt.Errorf("error writing response cache: %w", err)
+	}
+	return text, meta, nil
+}
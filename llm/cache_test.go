@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCachingModel(t *testing.T) {
+	ctx := context.Background()
+	cache := NewInMemoryResponseCache()
+	model := &mockLanguageModel{response: `{"score": 1}`}
+	opts := &GenerateOptions{ResponseMIMEType: "application/json", CachedContent: "cachedContents/schema"}
+
+	cached := NewCachingModel(model, "gemini-1.5-pro-001", cache, `{"version": 1}`)
+	for i := 0; i < 2; i++ {
+		text, err := cached.GenerateText(ctx, "Assessment", opts)
+		if err != nil {
+			t.Fatalf("GenerateText() returned error: %v", err)
+		}
+		if text != `{"score": 1}` {
+			t.Errorf("Expected the model response, got %q", text)
+		}
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected the repeated call to hit the cache, got %d model calls", model.calls)
+	}
+
+	// Changing the schema misses the responses of the previous one, even with the same prompt
+	model.response = `{"score": 1, "level": "pro"}`
+	evolved := NewCachingModel(model, "gemini-1.5-pro-001", cache, `{"version": 2}`)
+	text, err := evolved.GenerateText(ctx, "Assessment", opts)
+	if err != nil {
+		t.Fatalf("GenerateText() returned error: %v", err)
+	}
+	if text != `{"score": 1, "level": "pro"}` {
+		t.Errorf("Expected the response of the new schema, got %q", text)
+	}
+	if model.calls != 2 {
+		t.Errorf("Expected a schema change to invalidate the cache, got %d model calls", model.calls)
+	}
+
+	// Other models and options are cached apart
+	other := NewCachingModel(model, "gemini-1.5-flash-001", cache, `{"version": 2}`)
+	if _, err := other.GenerateText(ctx, "Assessment", opts); err != nil {
+		t.Fatalf("GenerateText() returned error: %v", err)
+	}
+	if _, err := evolved.GenerateText(ctx, "Assessment", &GenerateOptions{ResponseMIMEType: "application/json"}); err != nil {
+		t.Fatalf("GenerateText() returned error: %v", err)
+	}
+	if model.calls != 4 {
+		t.Errorf("Expected 4 model calls, got %d", model.calls)
+	}
+}
+
+func TestCachingModelSkipsConversations(t *testing.T) {
+	model := &mockLanguageModel{response: "Response"}
+	cached := NewCachingModel(model, "gemini-1.5-pro-001", NewInMemoryResponseCache(), "{}")
+
+	opts := &GenerateOptions{ConversationKey: "user-1"}
+	for i := 0; i < 2; i++ {
+		if _, err := cached.GenerateText(context.Background(), "Follow-up", opts); err != nil {
+			t.Fatalf("GenerateText() returned error: %v", err)
+		}
+	}
+	if model.calls != 2 {
+		t.Errorf("Expected conversation calls to bypass the cache, got %d model calls", model.calls)
+	}
+}
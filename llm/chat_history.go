@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+/*
+ChatHistoryStore persists the Gemini chat history of conversations, e.g. one per user, so that
+follow-up calls resume where the previous ones left off. See WithGeminiChatHistoryPersistence.
+*/
+type ChatHistoryStore interface {
+	// Load returns the history of the conversation, empty for a new conversation.
+	Load(ctx context.Context, key string) ([]*genai.Content, error)
+	// Save replaces the history of the conversation.
+	Save(ctx context.Context, key string, history []*genai.Content) error
+}
+
+// inMemoryChatHistoryStore is a ChatHistoryStore kept in memory.
+type inMemoryChatHistoryStore struct {
+	mu        sync.Mutex
+	histories map[string][]*genai.Content
+}
+
+// NewInMemoryChatHistoryStore returns a ChatHistoryStore kept in memory, shared by the models of the process.
+func NewInMemoryChatHistoryStore() ChatHistoryStore {
+	return &inMemoryChatHistoryStore{histories: make(map[string][]*genai.Content)}
+}
+
+func (s *inMemoryChatHistoryStore) Load(ctx context.Context, key string) ([]*genai.Content, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.histories[key]), nil
+}
+
+func (s *inMemoryChatHistoryStore) Save(ctx context.Context, key string, history []*genai.Content) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.histories[key] = slices.Clone(history)
+	return nil
+}
+
+/*
+WithGeminiChatHistoryPersistence creates an lLMOption that persists the chat history of the
+Gemini calls with a GenerateOptions.ConversationKey in the store: the history of the
+conversation seeds the chat session, and the prompt and response are appended to it after
+each successful call. Calls without a ConversationKey stay stateless.
+
+Other providers ignore this option.
+*/
+func WithGeminiChatHistoryPersistence(store ChatHistoryStore) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.historyStore = store
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGeminiChatHistoryPersistence(t *testing.T) {
+	client := &mockGeminiClient{}
+	store := NewInMemoryChatHistoryStore()
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-001", temperature: 0.7, maxTokens: 512, topP: 1, client: client}
+	WithGeminiChatHistoryPersistence(store)(llm)
+
+	userTurn := func(prompt string) *genai.Content {
+		return &genai.Content{Role: "user", Parts: []genai.Part{genai.Text(prompt)}}
+	}
+	modelTurn := &genai.Content{Parts: []genai.Part{genai.Text("Gemini Response")}}
+
+	// The first call of a conversation starts from an empty history, then saves the turn
+	opts := &GenerateOptions{ConversationKey: "user-1"}
+	if _, err := llm.GenerateText(context.Background(), "First assessment", opts); err != nil {
+		t.Fatalf("GenerateText() returned error: %v", err)
+	}
+	if len(client.history) != 0 {
+		t.Errorf("Expected an empty history, got %d contents", len(client.history))
+	}
+	history, _ := store.Load(context.Background(), "user-1")
+	if diff := cmp.Diff([]*genai.Content{userTurn("First assessment"), modelTurn}, history); diff != "" {
+		t.Errorf("Saved history mismatch (-want +got):\n%s", diff)
+	}
+
+	// The next call resumes the history and appends its turn
+	if _, err := llm.GenerateText(context.Background(), "Follow-up", opts); err != nil {
+		t.Fatalf("GenerateText() returned error: %v", err)
+	}
+	if diff := cmp.Diff([]*genai.Content{userTurn("First assessment"), modelTurn}, client.history); diff != "" {
+		t.Errorf("Loaded history mismatch (-want +got):\n%s", diff)
+	}
+	history, _ = store.Load(context.Background(), "user-1")
+	if len(history) != 4 {
+		t.Errorf("Expected 4 contents in the saved history, got %d", len(history))
+	}
+
+	// Calls without a conversation key are stateless
+	if _, err := llm.GenerateText(context.Background(), "Other assessment", nil); err != nil {
+		t.Fatalf("GenerateText() returned error: %v", err)
+	}
+	if len(client.history) != 0 {
+		t.Errorf("Expected an empty history, got %d contents", len(client.history))
+	}
+	if history, _ := store.Load(context.Background(), ""); len(history) != 0 {
+		t.Errorf("Expected nothing saved without a conversation key, got %d contents", len(history))
+	}
+}
@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+)
+
+// Supported LLM providers.
+const (
+	ProviderGemini    = "gemini"
+	ProviderAnthropic = "anthropic"
+	ProviderMistral   = "mistral"
+	ProviderOpenAI    = "openai"
+)
+
+/*
+LLMConfig holds the provider and generation parameters of a LanguageModel.
+
+Zero values keep the provider defaults, so only the parameters that need to be changed
+have to be set. It can be decoded from YAML, e.g.:
+
+	provider: anthropic
+	model: claude-3-5-sonnet-20240620
+	temperature: 0.2
+	max_tokens: 4096
+	provider_config:
+	  stop_sequences: ["\n\n\n"]
+
+ProviderConfig holds the settings only one provider has, see ProviderConfig and WithProviderSpecificConfig.
+*/
+type LLMConfig struct {
+	Provider    string  `yaml:"provider" json:"provider"`
+	Model       string  `yaml:"model" json:"model"`
+	Temperature float64 `yaml:"temperature" json:"temperature"`
+	MaxTokens   int     `yaml:"max_tokens" json:"max_tokens"`
+	TopP        float64 `yaml:"top_p" json:"top_p"`
+	TopK        int     `yaml:"top_k" json:"top_k"`
+	// ModelAliases maps model aliases to the pinned versions they resolve to, see ResolveGeminiModel.
+	ModelAliases map[string]string `yaml:"model_aliases" json:"model_aliases"`
+	// ProviderConfig holds provider-specific settings, applied after the generic ones.
+	ProviderConfig ProviderConfig `yaml:"provider_config" json:"provider_config"`
+	// RequestMetadata tags every request for billing attribution, see WithRequestMetadata.
+	RequestMetadata map[string]string `yaml:"request_metadata" json:"request_metadata"`
+}
+
+/*
+NewLanguageModel creates the LanguageModel of the configured provider, applying the
+configured parameters on top of the provider defaults. An empty provider selects Gemini,
+whose model aliases are resolved to pinned versions with ResolveGeminiModel.
+
+Additional lLMOptions are applied after the configuration. Tools set with WithTools are
+validated against the provider, so mismatched tools fail here rather than on the first call.
+*/
+func NewLanguageModel(cfg LLMConfig, opts ...lLMOption) (LanguageModel, error) {
+	model, err := newProviderModel(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateTools(cfg.Provider, modelTools(model)); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// newProviderModel creates the LanguageModel of the configured provider, see NewLanguageModel.
+func newProviderModel(cfg LLMConfig, opts ...lLMOption) (LanguageModel, error) {
+	if cfg.Provider == "" || cfg.Provider == ProviderGemini {
+		model, err := ResolveGeminiModel(cfg.Model, cfg.ModelAliases)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving gemini model: %w", err)
+		}
+		cfg.Model = model
+	}
+
+	opts = append([]lLMOption{WithConfig(cfg)}, opts...)
+
+	switch cfg.Provider {
+	case "", ProviderGemini:
+		// NewGeminiClient exits without an API key, report it as an authentication error instead
+		if _, ok := os.LookupEnv("GEMINI_API_KEY"); !ok {
+			return nil, fmt.Errorf("%w: environment variable GEMINI_API_KEY not set", ErrAuthentication)
+		}
+		return NewGeminiClient(opts...), nil
+	case ProviderAnthropic:
+		return NewAnthropicLLM(opts...), nil
+	case ProviderMistral:
+		return NewMistralLLM(opts...), nil
+	case ProviderOpenAI:
+		return NewOpenAILLM(opts...), nil
+	default:
+		return nil, fmt.Errorf("error: unknown LLM provider %q", cfg.Provider)
+	}
+}
+
+/*
+WithConfig creates an lLMOption that applies the non-zero parameters of an LLMConfig
+(model name, temperature, max tokens, top P, top K and request metadata) to the given
+LanguageModel, followed by its ProviderConfig.
+
+The Provider field is ignored, since the provider is chosen by the constructor.
+*/
+func WithConfig(cfg LLMConfig) lLMOption {
+	return func(l interface{}) {
+		if cfg.Model != "" {
+			WithModelName(cfg.Model)(l)
+		}
+		if cfg.MaxTokens > 0 {
+			WithMaxTokens(cfg.MaxTokens)(l)
+		}
+		if cfg.TopK != 0 {
+			WithTopK(cfg.TopK)(l)
+		}
+
+		switch v := l.(type) {
+		case *mistralLLM:
+			if cfg.Temperature != 0 {
+				v.temperature = cfg.Temperature
+			}
+			if cfg.TopP != 0 {
+				v.topP = cfg.TopP
+			}
+		case *anthropicLLM:
+			if cfg.Temperature != 0 {
+				v.temperature = cfg.Temperature
+			}
+			if cfg.TopP != 0 {
+				v.topP = cfg.TopP
+			}
+		case *geminiLLM:
+			if cfg.Temperature != 0 {
+				v.temperature = cfg.Temperature
+			}
+			if cfg.TopP != 0 {
+				v.topP = cfg.TopP
+			}
+		case *openAILLM:
+			if cfg.Temperature != 0 {
+				v.temperature = cfg.Temperature
+			}
+			if cfg.TopP != 0 {
+				v.topP = cfg.TopP
+			}
+		}
+
+		if len(cfg.RequestMetadata) > 0 {
+			WithRequestMetadata(cfg.RequestMetadata)(l)
+		}
+		if len(cfg.ProviderConfig) > 0 {
+			WithProviderSpecificConfig(cfg.ProviderConfig)(l)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithConfig(t *testing.T) {
+	cfg := LLMConfig{Model: "mistral-large", Temperature: 0.2, MaxTokens: 2048, TopK: 20}
+
+	got := &mistralLLM{modelName: "mistral-small-latest", temperature: 0.7, maxTokens: 512, topP: 1}
+	WithConfig(cfg)(got)
+
+	// Mistral has no top-k and keeps its default top P
+	want := &mistralLLM{modelName: "mistral-large", temperature: 0.2, maxTokens: 2048, topP: 1}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(mistralLLM{})); diff != "" {
+		t.Errorf("WithConfig() mismatch (-want +got):\n%s", diff)
+	}
+
+	gemini := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", temperature: 0.7, maxTokens: 512, topP: 1, topK: 64}
+	WithConfig(cfg)(gemini)
+	if gemini.topK != 20 || gemini.maxTokens != 2048 || gemini.temperature != 0.2 {
+		t.Errorf("WithConfig() did not apply to Gemini: %+v", gemini)
+	}
+}
+
+func TestNewLanguageModel(t *testing.T) {
+	t.Setenv("CLAUDE_API_KEY", "claude-key")
+
+	model, err := NewLanguageModel(LLMConfig{Provider: ProviderAnthropic, Model: "claude-3-5-sonnet-20240620"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	anthropicModel, ok := model.(*anthropicLLM)
+	if !ok {
+		t.Fatalf("Expected an Anthropic LLM, got %T", model)
+	}
+	if anthropicModel.modelName != "claude-3-5-sonnet-20240620" {
+		t.Errorf("Expected the configured model name, got %s", anthropicModel.modelName)
+	}
+
+	if _, err := NewLanguageModel(LLMConfig{Provider: "unknown"}); err == nil {
+		t.Errorf("Expected error for an unknown provider, got nil")
+	}
+}
+
+func TestNewLanguageModelWithoutGeminiAPIKey(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	os.Unsetenv("GEMINI_API_KEY")
+
+	if _, err := NewLanguageModel(LLMConfig{Provider: ProviderGemini}); !IsAuthError(err) {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+}
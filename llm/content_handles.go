@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/*
+contentHandles keeps track of the content cached by the models that dispatch each call to one of
+several underlying models. A handle is only valid for the model that created it, so the content
+is cached with the first model and, lazily, with every other model a call referencing it is sent to.
+
+Fields:
+
+	texts: The cached text of each handle returned to the caller.
+
+	handles: The handle of each model the content of a returned handle is cached with.
+*/
+type contentHandles struct {
+	mu      sync.Mutex
+	texts   map[string]string
+	handles map[string]map[LanguageModel]string
+}
+
+// cache caches text with model, returning its handle.
+func (c *contentHandles) cache(ctx context.Context, model LanguageModel, text string) (string, error) {
+	handle, err := CacheContent(ctx, model, text)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.texts == nil {
+		c.texts = make(map[string]string)
+		c.handles = make(map[string]map[LanguageModel]string)
+	}
+	c.texts[handle] = text
+	c.handles[handle] = map[LanguageModel]string{model: handle}
+	return handle, nil
+}
+
+// options returns the options of a call sent to model, with the cached content referenced as
+// the handle of model, caching the content with it first if needed. Unknown handles are kept.
+func (c *contentHandles) options(ctx context.Context, model LanguageModel, opts *GenerateOptions) (*GenerateOptions, error) {
+	if opts == nil || opts.CachedContent == "" {
+		return opts, nil
+	}
+
+	c.mu.Lock()
+	text, ok := c.texts[opts.CachedContent]
+	handle, cached := c.handles[opts.CachedContent][model]
+	c.mu.Unlock()
+	if !ok {
+		return opts, nil
+	}
+
+	if !cached {
+		var err error
+		if handle, err = CacheContent(ctx, model, text); err != nil {
+			return nil, fmt.Errorf("error caching content for the model: %w", err)
+		}
+		c.mu.Lock()
+		c.handles[opts.CachedContent][model] = handle
+		c.mu.Unlock()
+	}
+
+	modelOpts := *opts
+	modelOpts.CachedContent = handle
+	return &modelOpts, nil
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// contextKey is the type of the context keys of the package, so they can't collide with others.
+type contextKey int
+
+const (
+	tenantIDKey contextKey = iota
+	requestIDKey
+)
+
+/*
+WithTenantID returns a copy of ctx carrying the ID of the tenant the model calls are made for,
+in multi-tenant deployments. The calls made with it are tagged with the tenant in the audit
+log (see AuditRecord) and the logs of the package. An empty ID leaves ctx unchanged.
+*/
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	if tenantID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantIDKey, tenantID)
+}
+
+// TenantID returns the tenant ID carried by ctx, empty when none was set with WithTenantID.
+func TenantID(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantIDKey).(string)
+	return tenantID
+}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request the model calls are made
+// for (e.g. the assessment), tagging them like WithTenantID. An empty ID leaves ctx unchanged.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, empty when none was set with WithRequestID.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// logPrefix returns the tags of the tenant and request IDs carried by ctx, e.g.
+// "[tenant=acme request=a1] ", to prefix the log lines of a call. Empty when there are none.
+func logPrefix(ctx context.Context) string {
+	var tags []string
+	if tenantID := TenantID(ctx); tenantID != "" {
+		tags = append(tags, "tenant="+tenantID)
+	}
+	if requestID := RequestID(ctx); requestID != "" {
+		tags = append(tags, "request="+requestID)
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", strings.Join(tags, " "))
+}
@@ -0,0 +1,259 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Embedder embeds texts into vectors, e.g. to cluster assessments by similarity.
+type Embedder interface {
+	// EmbedTexts returns the embedding of every text, in order.
+	EmbedTexts(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// BatchLimiter is implemented by the Embedders whose provider bounds the number of texts per request.
+type BatchLimiter interface {
+	MaxBatchSize() int
+}
+
+const (
+	// defaultEmbeddingBatchSize is the number of texts per request when unset.
+	defaultEmbeddingBatchSize = 100
+	// embeddingBatchAttempts is the number of times a failed batch is sent before giving up.
+	embeddingBatchAttempts = 3
+	// defaultEmbeddingRetryBackoff is the wait before the first retry of a failed batch, doubled
+	// before each further retry.
+	defaultEmbeddingRetryBackoff = time.Second
+	// geminiMaxEmbeddingBatch is the maximum number of texts of a Gemini batch embedding request.
+	geminiMaxEmbeddingBatch = 100
+)
+
+/*
+batchEmbedder is an Embedder that splits the texts into batches, embedded concurrently.
+
+Fields:
+
+	embedder: The Embedder each batch is sent to.
+
+	batchSize: The number of texts per request, capped by the provider's limit.
+
+	inFlight: The maximum number of batches embedded at the same time.
+
+	backoff: The wait before the first retry of a failed batch, doubled before each further retry.
+
+	retriable: Reports whether a failed attempt of a batch, numbered from 1, is retried.
+
+	sleep: Waits for the given duration, replaced in tests by a fake clock.
+*/
+type batchEmbedder struct {
+	embedder  Embedder
+	batchSize int
+	inFlight  int
+	backoff   time.Duration
+	retriable func(err error, attempt int) bool
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+/*
+NewBatchEmbedder creates an Embedder that splits the texts into batches of the given
+embedder, one batch at a time unless set otherwise with WithConcurrentEmbeddingBatches:
+
+	embedder := NewBatchEmbedder(NewGeminiEmbedder(client, "text-embedding-004"), WithConcurrentEmbeddingBatches(4, 50))
+
+A failed batch is retried on its own, the texts of the other batches aren't sent again. Only
+transient failures are retried, with a growing backoff, unless set otherwise with
+WithEmbeddingRetries: the batches rejected for their credentials or as invalid fail at once.
+*/
+func NewBatchEmbedder(embedder Embedder, opts ...lLMOption) Embedder {
+	b := &batchEmbedder{
+		embedder:  embedder,
+		batchSize: defaultEmbeddingBatchSize,
+		inFlight:  1,
+		backoff:   defaultEmbeddingRetryBackoff,
+		retriable: retriableEmbeddingError,
+		sleep:     sleepContext,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+/*
+WithConcurrentEmbeddingBatches creates an lLMOption that embeds up to inFlight batches of
+batchSize texts at the same time, for embedders created with NewBatchEmbedder. The batch
+size is capped by the provider's limit, values of 0 or less keep the defaults.
+*/
+func WithConcurrentEmbeddingBatches(inFlight, batchSize int) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*batchEmbedder); ok {
+			if inFlight > 0 {
+				v.inFlight = inFlight
+			}
+			if batchSize > 0 {
+				v.batchSize = batchSize
+			}
+		}
+	}
+}
+
+/*
+WithEmbeddingRetries creates an lLMOption that retries the failed batches of an embedder created
+with NewBatchEmbedder after backoff, doubled before each further retry, when retriable reports
+that the failed attempt, numbered from 1, is worth retrying. It has the signature of the retry
+predicates of the pipeline, so they can be shared. Values of 0 or less and nil keep the defaults.
+*/
+func WithEmbeddingRetries(backoff time.Duration, retriable func(err error, attempt int) bool) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*batchEmbedder); ok {
+			if backoff > 0 {
+				v.backoff = backoff
+			}
+			if retriable != nil {
+				v.retriable = retriable
+			}
+		}
+	}
+}
+
+// retriableEmbeddingError reports whether a failed batch is worth retrying: rejected credentials
+// and invalid requests fail the same way however often they are sent.
+func retriableEmbeddingError(err error, _ int) bool {
+	return !IsAuthError(err) && !IsInvalidRequest(err)
+}
+
+// EmbedTexts embeds the texts batch by batch, reporting the errors of every batch that failed all its attempts.
+func (b *batchEmbedder) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	batchSize := b.batchSize
+	if limiter, ok := b.embedder.(BatchLimiter); ok && limiter.MaxBatchSize() > 0 {
+		batchSize = min(batchSize, limiter.MaxBatchSize())
+	}
+
+	embeddings := make([][]float32, len(texts))
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, b.inFlight)
+	)
+	for start := 0; start < len(texts); start += batchSize {
+		end := min(start+batchSize, len(texts))
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(start, end int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := b.embedBatch(ctx, texts[start:end], embeddings[start:end]); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("error embedding texts %d to %d: %w", start, end-1, err))
+				mu.Unlock()
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return embeddings, nil
+}
+
+// embedBatch embeds a single batch into out, sending it up to embeddingBatchAttempts times
+// while its failures are retriable.
+func (b *batchEmbedder) embedBatch(ctx context.Context, texts []string, out [][]float32) error {
+	wait := b.backoff
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		embeddings, err := b.embedder.EmbedTexts(ctx, texts)
+		if err == nil && len(embeddings) != len(texts) {
+			err = fmt.Errorf("error: got %d embeddings for %d texts", len(embeddings), len(texts))
+		}
+		if err == nil {
+			copy(out, embeddings)
+			return nil
+		}
+		if attempt >= embeddingBatchAttempts || !b.retriable(err, attempt) {
+			return err
+		}
+
+		if err := b.sleep(ctx, wait); err != nil {
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// geminiEmbedder is an Embedder backed by a Gemini embedding model.
+type geminiEmbedder struct {
+	model *genai.EmbeddingModel
+}
+
+/*
+NewGeminiEmbedder creates an Embedder with the given Gemini embedding model, e.g.
+"text-embedding-004". The task type of the embeddings can be set with WithGeminiEmbeddingTaskType.
+*/
+func NewGeminiEmbedder(client *genai.Client, modelName string, opts ...lLMOption) Embedder {
+	g := &geminiEmbedder{model: client.EmbeddingModel(modelName)}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+/*
+WithGeminiEmbeddingTaskType creates an lLMOption that sets the task type sent with every text
+embedded by a Gemini embedder, e.g. genai.TaskTypeClustering to cluster assessments or
+genai.TaskTypeSemanticSimilarity to compare them: the embeddings are tuned for that use.
+*/
+func WithGeminiEmbeddingTaskType(taskType genai.TaskType) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiEmbedder); ok {
+			v.model.TaskType = taskType
+		}
+	}
+}
+
+// EmbedTexts embeds the texts in a single batch request.
+func (g *geminiEmbedder) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	batch := g.model.NewBatch()
+	for _, text := range texts {
+		batch.AddContent(genai.Text(text))
+	}
+
+	resp, err := g.model.BatchEmbedContents(ctx, batch)
+	switch {
+	case err != nil && isGeminiAuthError(err):
+		return nil, fmt.Errorf("%w: error embedding contents: %w", ErrAuthentication, err)
+	case err != nil && isGeminiInvalidRequest(err):
+		return nil, fmt.Errorf("%w: error embedding contents: %w", ErrInvalidRequest, err)
+	case err != nil:
+		return nil, fmt.Errorf("error embedding contents: %w", err)
+	}
+
+	embeddings := make([][]float32, len(resp.Embeddings))
+	for i, embedding := range resp.Embeddings {
+		embeddings[i] = embedding.Values
+	}
+	return embeddings, nil
+}
+
+// MaxBatchSize is the maximum number of texts of a Gemini batch embedding request.
+func (g *geminiEmbedder) MaxBatchSize() int {
+	return geminiMaxEmbeddingBatch
+}
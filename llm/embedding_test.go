@@ -0,0 +1,276 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// fakeEmbedder embeds every text as its length, recording the batches and the peak concurrency.
+type fakeEmbedder struct {
+	mu          sync.Mutex
+	batchSizes  []int
+	inFlight    int
+	maxInFlight int
+	// failures holds the number of times the batch starting with a text fails before succeeding.
+	failures map[string]int
+	// err is the error of the failures, a transient one when nil.
+	err   error
+	limit int
+}
+
+func (f *fakeEmbedder) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	f.mu.Lock()
+	f.batchSizes = append(f.batchSizes, len(texts))
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	fail := f.failures[texts[0]] > 0
+	if fail {
+		f.failures[texts[0]]--
+	}
+	f.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+
+	if fail && f.err != nil {
+		return nil, f.err
+	}
+	if fail {
+		return nil, errors.New("transient error")
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = []float32{float32(len(text))}
+	}
+	return embeddings, nil
+}
+
+// recordSleeps replaces the clock of the embedder, recording the waits between retries.
+func recordSleeps(embedder Embedder) *[]time.Duration {
+	var sleeps []time.Duration
+	var mu sync.Mutex
+	embedder.(*batchEmbedder).sleep = func(_ context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return &sleeps
+}
+
+// limitedEmbedder is a fakeEmbedder whose provider bounds the batch size.
+type limitedEmbedder struct {
+	*fakeEmbedder
+}
+
+func (l limitedEmbedder) MaxBatchSize() int {
+	return l.limit
+}
+
+func embeddingTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = string(make([]byte, i))
+	}
+	return texts
+}
+
+func TestBatchEmbedder(t *testing.T) {
+	fake := &fakeEmbedder{}
+	embedder := NewBatchEmbedder(fake, WithConcurrentEmbeddingBatches(3, 4))
+
+	input := embeddingTexts(30)
+	embeddings, err := embedder.EmbedTexts(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Embeddings are in the order of the texts
+	for i, embedding := range embeddings {
+		if len(embedding) != 1 || embedding[0] != float32(i) {
+			t.Fatalf("Embedding %d mismatch, got %v", i, embedding)
+		}
+	}
+
+	// 7 full batches and a last one of 2 texts, at most 3 at the same time
+	total := 0
+	for _, size := range fake.batchSizes {
+		if size > 4 {
+			t.Errorf("Expected batches of at most 4 texts, got %d", size)
+		}
+		total += size
+	}
+	if len(fake.batchSizes) != 8 || total != 30 {
+		t.Errorf("Expected 8 batches of 30 texts, got %v", fake.batchSizes)
+	}
+	if fake.maxInFlight > 3 {
+		t.Errorf("Expected at most 3 batches in flight, got %d", fake.maxInFlight)
+	}
+	if fake.maxInFlight < 2 {
+		t.Errorf("Expected batches to be embedded concurrently, got %d in flight", fake.maxInFlight)
+	}
+}
+
+func TestBatchEmbedder_ProviderLimit(t *testing.T) {
+	fake := &fakeEmbedder{limit: 2}
+	embedder := NewBatchEmbedder(limitedEmbedder{fake}, WithConcurrentEmbeddingBatches(2, 10))
+
+	if _, err := embedder.EmbedTexts(context.Background(), embeddingTexts(5)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fake.batchSizes) != 3 {
+		t.Errorf("Expected the batch size to be capped at 2, got batches %v", fake.batchSizes)
+	}
+}
+
+func TestBatchEmbedder_RetriesFailedBatch(t *testing.T) {
+	input := embeddingTexts(6)
+
+	// The second batch fails once, then succeeds
+	fake := &fakeEmbedder{failures: map[string]int{input[2]: 1}}
+	embedder := NewBatchEmbedder(fake, WithConcurrentEmbeddingBatches(3, 2))
+	sleeps := recordSleeps(embedder)
+
+	embeddings, err := embedder.EmbedTexts(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(embeddings) != 6 || embeddings[2][0] != 2 {
+		t.Errorf("Expected the retried batch to be embedded, got %v", embeddings)
+	}
+	if len(fake.batchSizes) != 4 {
+		t.Errorf("Expected only the failed batch to be retried, got batches %v", fake.batchSizes)
+	}
+	if len(*sleeps) != 1 || (*sleeps)[0] != defaultEmbeddingRetryBackoff {
+		t.Errorf("Expected the retry to wait %v, got %v", defaultEmbeddingRetryBackoff, *sleeps)
+	}
+
+	// A batch failing every attempt fails the call, waiting twice as long before each retry
+	fake = &fakeEmbedder{failures: map[string]int{input[4]: embeddingBatchAttempts}}
+	embedder = NewBatchEmbedder(fake, WithConcurrentEmbeddingBatches(3, 2), WithEmbeddingRetries(time.Millisecond, nil))
+	sleeps = recordSleeps(embedder)
+	if _, err := embedder.EmbedTexts(context.Background(), input); err == nil {
+		t.Errorf("Expected error for a batch failing every attempt, got nil")
+	}
+	if want := []time.Duration{time.Millisecond, 2 * time.Millisecond}; len(*sleeps) != 2 || (*sleeps)[0] != want[0] || (*sleeps)[1] != want[1] {
+		t.Errorf("Expected the retries to wait %v, got %v", want, *sleeps)
+	}
+}
+
+func TestBatchEmbedder_RetriesTransientErrorsOnly(t *testing.T) {
+	input := embeddingTexts(2)
+
+	testCases := []struct {
+		name      string
+		err       error
+		retriable func(err error, attempt int) bool
+		wantCalls int
+	}{
+		{name: "Authentication error", err: fmt.Errorf("%w: invalid API key", ErrAuthentication), wantCalls: 1},
+		{name: "Invalid request", err: fmt.Errorf("%w: too many texts", ErrInvalidRequest), wantCalls: 1},
+		{name: "Transient error", err: errors.New("unavailable"), wantCalls: embeddingBatchAttempts},
+		{name: "Custom predicate", err: errors.New("unavailable"), retriable: func(err error, attempt int) bool { return attempt < 2 }, wantCalls: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeEmbedder{failures: map[string]int{input[0]: embeddingBatchAttempts}, err: tc.err}
+			embedder := NewBatchEmbedder(fake, WithEmbeddingRetries(0, tc.retriable))
+			recordSleeps(embedder)
+
+			_, err := embedder.EmbedTexts(context.Background(), input)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected error %v, got %v", tc.err, err)
+			}
+			if len(fake.batchSizes) != tc.wantCalls {
+				t.Errorf("Expected %d attempts, got %d", tc.wantCalls, len(fake.batchSizes))
+			}
+		})
+	}
+}
+
+func TestGeminiEmbedder_ErrorKinds(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		is     func(error) bool
+	}{
+		{name: "Rejected credentials", status: http.StatusForbidden, is: IsAuthError},
+		{name: "Invalid request", status: http.StatusBadRequest, is: IsInvalidRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(`{"error": {"code": 0, "message": "rejected"}}`))
+			}))
+			defer server.Close()
+
+			client, err := genai.NewClient(context.Background(), option.WithAPIKey("test-key"), option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+			if err != nil {
+				t.Fatalf("Error creating the client: %v", err)
+			}
+			defer client.Close()
+
+			_, err = NewGeminiEmbedder(client, "text-embedding-004").EmbedTexts(context.Background(), []string{"text"})
+			if !tc.is(err) {
+				t.Errorf("Expected the error to be classified as %s, got %v", strings.ToLower(tc.name), err)
+			}
+		})
+	}
+}
+
+func TestGeminiEmbedder_TaskType(t *testing.T) {
+	var body struct {
+		Requests []struct {
+			TaskType genai.TaskType `json:"taskType"`
+		} `json:"requests"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Error decoding the request: %v", err)
+		}
+		w.Write([]byte(`{"embeddings": [{"values": [0.1, 0.2]}, {"values": [0.3, 0.4]}]}`))
+	}))
+	defer server.Close()
+
+	client, err := genai.NewClient(context.Background(), option.WithAPIKey("test-key"), option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("Error creating the client: %v", err)
+	}
+	defer client.Close()
+
+	embedder := NewGeminiEmbedder(client, "text-embedding-004", WithGeminiEmbeddingTaskType(genai.TaskTypeClustering))
+	embeddings, err := embedder.EmbedTexts(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("EmbedTexts() returned error: %v", err)
+	}
+	if len(embeddings) != 2 {
+		t.Fatalf("Expected 2 embeddings, got %d", len(embeddings))
+	}
+
+	// Every text of the batch is sent with the task type
+	if len(body.Requests) != 2 {
+		t.Fatalf("Expected 2 requests in the batch, got %d", len(body.Requests))
+	}
+	for i, request := range body.Requests {
+		if request.TaskType != genai.TaskTypeClustering {
+			t.Errorf("Request %d: expected task type %v, got %v", i, genai.TaskTypeClustering, request.TaskType)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+)
+
+// ErrAuthentication is wrapped by the errors of requests rejected for missing or invalid credentials.
+var ErrAuthentication = errors.New("authentication error")
+
+// IsAuthError reports whether err is a provider rejecting the credentials, or missing them.
+func IsAuthError(err error) bool {
+	return errors.Is(err, ErrAuthentication)
+}
+
+// fakeLLM is a LanguageModel answering every prompt with the same canned response.
+type fakeLLM struct {
+	response string
+}
+
+// NewFakeLLM creates a LanguageModel that answers every prompt with the given response,
+// without calling any provider. It is meant for local development and tests.
+func NewFakeLLM(response string) LanguageModel {
+	return &fakeLLM{response: response}
+}
+
+// GenerateText returns the canned response.
+func (f *fakeLLM) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	return f.response, nil
+}
+
+// FakeFallbackAllowed reports whether ALLOW_FAKE_FALLBACK=true explicitly allows falling back
+// to a fake model, which must never happen in production.
+func FakeFallbackAllowed() bool {
+	return os.Getenv("ALLOW_FAKE_FALLBACK") == "true"
+}
+
+// fakeOnAuthErrorModel is a LanguageModel that switches to a fake model once the wrapped model fails to authenticate.
+type fakeOnAuthErrorModel struct {
+	model LanguageModel
+	fake  LanguageModel
+}
+
+/*
+NewFakeOnAuthErrorModel creates a LanguageModel that answers with cannedResponse when the given model
+returns an authentication error (e.g. a missing API key), so local runs keep going end-to-end.
+
+It is a development-only fallback: unless ALLOW_FAKE_FALLBACK=true, the model is returned unchanged.
+*/
+func NewFakeOnAuthErrorModel(model LanguageModel, cannedResponse string) LanguageModel {
+	if !FakeFallbackAllowed() {
+		return model
+	}
+	return &fakeOnAuthErrorModel{model: model, fake: NewFakeLLM(cannedResponse)}
+}
+
+// GenerateText generates text with the wrapped model, falling back to the fake model on authentication errors.
+func (f *fakeOnAuthErrorModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := f.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata generates text with the wrapped model, returning the metadata of its
+// response, and falls back to the fake model, without metadata, on authentication errors.
+func (f *fakeOnAuthErrorModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	text, meta, err := GenerateTextWithMetadata(ctx, f.model, prompt, opts)
+	if IsAuthError(err) {
+		log.Printf("%sAuthentication failed, answering with the fake model (ALLOW_FAKE_FALLBACK=true): %v", logPrefix(ctx), err)
+		text, err = f.fake.GenerateText(ctx, prompt, opts)
+		return text, ResponseMeta{}, err
+	}
+	return text, meta, err
+}
+
+// CacheContent caches the content with the wrapped model.
+func (f *fakeOnAuthErrorModel) CacheContent(ctx context.Context, text string) (string, error) {
+	return CacheContent(ctx, f.model, text)
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gage-technologies/mistral-go"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/liushuangls/go-anthropic/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type errMistralClient struct{ err error }
+
+func (m *errMistralClient) Chat(model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error) {
+	return nil, m.err
+}
+
+type errAnthropicClient struct{ err error }
+
+func (m *errAnthropicClient) CreateMessages(ctx context.Context, request anthropic.MessagesRequest) (anthropic.MessagesResponse, error) {
+	return anthropic.MessagesResponse{}, m.err
+}
+
+type errGeminiClient struct {
+	mockGeminiClient
+	err error
+}
+
+func (m *errGeminiClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	return nil, m.err
+}
+
+func TestProviderAuthErrors(t *testing.T) {
+	mistralModel := func(err error) LanguageModel {
+		return &mistralLLM{modelName: "mistral-small-latest", client: &errMistralClient{err: err}}
+	}
+	anthropicModel := func(err error) LanguageModel {
+		return &anthropicLLM{modelName: "claude-3-5-sonnet-latest", client: &errAnthropicClient{err: err}}
+	}
+	geminiModel := func(err error) LanguageModel {
+		return &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", client: &errGeminiClient{err: err}}
+	}
+
+	tests := []struct {
+		name     string
+		llm      LanguageModel
+		wantAuth bool
+	}{
+		{"Mistral unauthorized", mistralModel(errors.New(`(HTTP Error 401) {"message":"Unauthorized"}`)), true},
+		{"Mistral server error", mistralModel(errors.New(`(HTTP Error 500) {"message":"Internal error"}`)), false},
+		{"Anthropic invalid API key", anthropicModel(&anthropic.APIError{Type: anthropic.ErrTypeAuthentication, Message: "invalid x-api-key"}), true},
+		{"Anthropic forbidden", anthropicModel(&anthropic.RequestError{StatusCode: 403, Err: errors.New("status 403")}), true},
+		{"Anthropic overloaded", anthropicModel(&anthropic.APIError{Type: anthropic.ErrTypeOverloaded, Message: "Overloaded"}), false},
+		{"Gemini REST unauthorized", geminiModel(&googleapi.Error{Code: 401}), true},
+		{"Gemini gRPC permission denied", geminiModel(status.Error(codes.PermissionDenied, "API key not valid")), true},
+		{"Gemini unavailable", geminiModel(status.Error(codes.Unavailable, "unavailable")), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.llm.GenerateText(context.Background(), "Test prompt", nil)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if got := IsAuthError(err); got != tt.wantAuth {
+				t.Errorf("IsAuthError(%v) = %v, want %v", err, got, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestFakeOnAuthErrorModel(t *testing.T) {
+	authErr := fmt.Errorf("%w: invalid API key", ErrAuthentication)
+
+	tests := []struct {
+		name    string
+		allow   string
+		err     error
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "Falls back on auth error",
+			allow: "true",
+			err:   authErr,
+			want:  `{"overall_assessment": "fake"}`,
+		},
+		{
+			name:    "Other errors are returned",
+			allow:   "true",
+			err:     errors.New("provider unavailable"),
+			wantErr: true,
+		},
+		{
+			name:    "Never falls back unless allowed",
+			allow:   "1",
+			err:     authErr,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ALLOW_FAKE_FALLBACK", tt.allow)
+
+			model := NewFakeOnAuthErrorModel(&failingModelWithError{err: tt.err}, `{"overall_assessment": "fake"}`)
+			got, err := model.GenerateText(context.Background(), "Test prompt", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GenerateText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingModelWithError always fails with the given error.
+type failingModelWithError struct{ err error }
+
+func (m *failingModelWithError) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	return "", m.err
+}
+
+func TestFakeOnAuthErrorModelMetadata(t *testing.T) {
+	t.Setenv("ALLOW_FAKE_FALLBACK", "true")
+
+	inner := &metadataModel{text: `{"overall`, meta: ResponseMeta{Reason: FinishReasonLength, InputTokens: 100, OutputTokens: 50}}
+	model := NewFakeOnAuthErrorModel(inner, `{"overall_assessment": "fake"}`)
+
+	// The metadata of the response goes through the fallback
+	text, meta, err := GenerateTextWithMetadata(context.Background(), model, "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+	}
+	if text != inner.text || meta != inner.meta {
+		t.Errorf("GenerateTextWithMetadata() = %q, %+v, want %q, %+v", text, meta, inner.text, inner.meta)
+	}
+
+	// So does content caching
+	if name, err := CacheContent(context.Background(), model, "schema"); err != nil || name != "cachedContents/schema" {
+		t.Errorf("CacheContent() = %q, %v, want the handle of the wrapped model", name, err)
+	}
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+fallbackModel is a LanguageModel that tries a chain of models in order,
+returning the first successful response.
+
+Fields:
+
+	models: The models to try, from primary to last resort.
+
+	timeouts: Optional per-model timeouts. A model without a timeout uses the caller's deadline,
+	          so fast primaries can be given a short timeout and slow fallbacks a longer one.
+
+	contents: The content cached with the models of the chain.
+*/
+type fallbackModel struct {
+	models   []LanguageModel
+	timeouts map[LanguageModel]time.Duration
+	contents contentHandles
+}
+
+/*
+NewFallbackModel creates a LanguageModel that calls each of the given models in order
+until one of them succeeds. If every model fails, the errors of all attempts are returned.
+
+Only provider failures fall through to the next model. A refusal (see IsRefused) would be refused
+again, and a canceled or expired caller context ends the chain, so both are returned unchanged.
+A model running out of its own timeout is a provider failure and falls through.
+
+It takes a variable number of lLMOption arguments, for example to set per-model timeouts:
+
+	model := NewFallbackModel(
+		[]LanguageModel{gemini, mistral},
+		WithProviderTimeouts(map[LanguageModel]time.Duration{gemini: 5 * time.Second, mistral: 20 * time.Second}),
+	)
+*/
+func NewFallbackModel(models []LanguageModel, opts ...lLMOption) LanguageModel {
+	llm := &fallbackModel{
+		models:   models,
+		timeouts: map[LanguageModel]time.Duration{},
+	}
+
+	for _, opt := range opts {
+		opt(llm)
+	}
+
+	return llm
+}
+
+// GenerateText generates text with the first model of the chain that succeeds.
+func (f *fallbackModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := f.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata generates text with the first model of the chain that succeeds,
+// returning the metadata of its response.
+func (f *fallbackModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	var errs []error
+	for i, model := range f.models {
+		text, meta, err := f.generateText(ctx, model, prompt, opts)
+		if err == nil {
+			return text, meta, nil
+		}
+		if IsRefused(err) || errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			return "", meta, err
+		}
+		errs = append(errs, fmt.Errorf("model %d: %w", i, err))
+	}
+
+	return "", ResponseMeta{}, fmt.Errorf("error: all fallback models failed: %w", errors.Join(errs...))
+}
+
+// generateText calls a single model of the chain, applying its timeout when configured.
+func (f *fallbackModel) generateText(ctx context.Context, model LanguageModel, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	if timeout, ok := f.timeouts[model]; ok && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	opts, err := f.contents.options(ctx, model, opts)
+	if err != nil {
+		return "", ResponseMeta{}, err
+	}
+	return GenerateTextWithMetadata(ctx, model, prompt, opts)
+}
+
+// CacheContent caches the content with every model of the chain, so any of them can answer the
+// prompts referencing it. It fails when one of them can't cache content.
+func (f *fallbackModel) CacheContent(ctx context.Context, text string) (string, error) {
+	if len(f.models) == 0 {
+		return "", ErrContentCachingNotSupported
+	}
+
+	handle, err := f.contents.cache(ctx, f.models[0], text)
+	if err != nil {
+		return "", err
+	}
+	for _, model := range f.models[1:] {
+		if _, err := f.contents.options(ctx, model, &GenerateOptions{CachedContent: handle}); err != nil {
+			return "", err
+		}
+	}
+	return handle, nil
+}
+
+/*
+WithProviderTimeouts creates an lLMOption that sets per-model timeouts on a fallback chain
+created with NewFallbackModel. Models missing from the map keep the caller's deadline.
+*/
+func WithProviderTimeouts(timeouts map[LanguageModel]time.Duration) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*fallbackModel); ok {
+			for model, timeout := range timeouts {
+				v.timeouts[model] = timeout
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type deadlineRecordingModel struct {
+	response string
+	err      error
+	timeout  time.Duration
+}
+
+func (m *deadlineRecordingModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		m.timeout = time.Until(deadline)
+	}
+	return m.response, m.err
+}
+
+func TestFallbackModel(t *testing.T) {
+	primary := &deadlineRecordingModel{err: errors.New("primary unavailable")}
+	fallback := &deadlineRecordingModel{response: "Fallback Response"}
+
+	model := NewFallbackModel(
+		[]LanguageModel{primary, fallback},
+		WithProviderTimeouts(map[LanguageModel]time.Duration{
+			primary:  5 * time.Second,
+			fallback: 20 * time.Second,
+		}),
+	)
+
+	got, err := model.GenerateText(context.Background(), "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("Fallback Response", got); diff != "" {
+		t.Errorf("GenerateText() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Each model gets its own deadline
+	if primary.timeout <= 4*time.Second || primary.timeout > 5*time.Second {
+		t.Errorf("Expected primary deadline of about 5s, got %v", primary.timeout)
+	}
+	if fallback.timeout <= 19*time.Second || fallback.timeout > 20*time.Second {
+		t.Errorf("Expected fallback deadline of about 20s, got %v", fallback.timeout)
+	}
+}
+
+func TestFallbackModelWithoutTimeouts(t *testing.T) {
+	primary := &deadlineRecordingModel{err: errors.New("primary unavailable")}
+	fallback := &deadlineRecordingModel{err: errors.New("fallback unavailable")}
+
+	model := NewFallbackModel([]LanguageModel{primary, fallback})
+
+	if _, err := model.GenerateText(context.Background(), "Test prompt", nil); err == nil {
+		t.Errorf("Expected error when all models fail, got nil")
+	}
+	if primary.timeout != 0 || fallback.timeout != 0 {
+		t.Errorf("Expected no deadlines, got primary=%v fallback=%v", primary.timeout, fallback.timeout)
+	}
+}
+
+func TestFallbackModelMetadata(t *testing.T) {
+	primary := &deadlineRecordingModel{err: errors.New("primary unavailable")}
+	inner := &metadataModel{text: `{"overall`, meta: ResponseMeta{Reason: FinishReasonLength, InputTokens: 100, OutputTokens: 50}}
+	model := NewFallbackModel([]LanguageModel{primary, inner})
+
+	// The metadata of the response of the model that succeeded goes through the chain
+	text, meta, err := GenerateTextWithMetadata(context.Background(), model, "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+	}
+	if text != inner.text || meta != inner.meta {
+		t.Errorf("GenerateTextWithMetadata() = %q, %+v, want %q, %+v", text, meta, inner.text, inner.meta)
+	}
+
+	// Content isn't cached unless every model of the chain can cache it
+	if _, err := CacheContent(context.Background(), model, "schema"); !errors.Is(err, ErrContentCachingNotSupported) {
+		t.Errorf("CacheContent() error = %v, want %v", err, ErrContentCachingNotSupported)
+	}
+}
+
+func TestFallbackModelCachedContent(t *testing.T) {
+	primary := &handleModel{name: "primary", err: errors.New("primary unavailable")}
+	fallback := &handleModel{name: "fallback"}
+	model := NewFallbackModel([]LanguageModel{primary, fallback})
+
+	handle, err := CacheContent(context.Background(), model, "schema")
+	if err != nil || handle != "primary/schema" {
+		t.Fatalf("CacheContent() = %q, %v, want the handle of the primary model", handle, err)
+	}
+
+	// Each model of the chain references the content by its own handle
+	got, err := model.GenerateText(context.Background(), "Test prompt", &GenerateOptions{CachedContent: handle})
+	if err != nil || got != "fallback" {
+		t.Fatalf("GenerateText() = %q, %v, want the response of the fallback model", got, err)
+	}
+	if primary.cachedContent != "primary/schema" || fallback.cachedContent != "fallback/schema" {
+		t.Errorf("Cached content = %q, %q, want the handle of each model", primary.cachedContent, fallback.cachedContent)
+	}
+}
+
+func TestFallbackModelStopsOnRefusalsAndCallerContext(t *testing.T) {
+	refused := fmt.Errorf("error: response blocked: %w", ErrRefused)
+
+	tests := []struct {
+		name   string
+		err    error
+		cancel bool
+		want   error
+	}{
+		{name: "refusal", err: refused, want: refused},
+		{name: "canceled", err: context.Canceled, want: context.Canceled},
+		{name: "caller context done", err: context.DeadlineExceeded, cancel: true, want: context.DeadlineExceeded},
+		{name: "model timeout", err: context.DeadlineExceeded},
+		{name: "provider error", err: errors.New("primary unavailable")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &deadlineRecordingModel{err: tt.err}
+			fallback := &mockLanguageModel{response: "Fallback Response"}
+			model := NewFallbackModel([]LanguageModel{primary, fallback})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			got, err := model.GenerateText(ctx, "Test prompt", nil)
+			if tt.want != nil {
+				// The error is returned unchanged, without trying the fallback
+				if err != tt.want {
+					t.Errorf("GenerateText() error = %v, want %v", err, tt.want)
+				}
+				if fallback.calls != 0 {
+					t.Errorf("Expected the fallback not to be called, got %d calls", fallback.calls)
+				}
+				return
+			}
+			if err != nil || got != "Fallback Response" {
+				t.Errorf("GenerateText() = %q, %v, want %q, nil", got, err, "Fallback Response")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"errors"
+
+	"github.com/gage-technologies/mistral-go"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/liushuangls/go-anthropic/v2"
+)
+
+// FinishReason is why a model stopped generating, normalized across providers.
+type FinishReason string
+
+const (
+	// FinishReasonStop is a complete response, including forced tool calls.
+	FinishReasonStop FinishReason = "stop"
+	// FinishReasonLength is a response truncated at the maximum number of tokens.
+	FinishReasonLength FinishReason = "length"
+	// FinishReasonSafety is a response stopped by the provider's safety filters.
+	FinishReasonSafety FinishReason = "safety"
+	// FinishReasonRecitation is a response stopped for reproducing training data verbatim.
+	FinishReasonRecitation FinishReason = "recitation"
+	// FinishReasonRefusal is the model declining to answer.
+	FinishReasonRefusal FinishReason = "refusal"
+	// FinishReasonTransient is a response stopped by a provider-side error, worth retrying.
+	FinishReasonTransient FinishReason = "transient"
+	// FinishReasonOther is any other or unknown reason.
+	FinishReasonOther FinishReason = "other"
+)
+
+// ErrRefused is wrapped by the errors of requests the provider refuses to answer, e.g. for safety.
+// Retrying them unchanged gives the same result.
+var ErrRefused = errors.New("response refused")
+
+// ErrRecitation is wrapped, along with ErrRefused, by the errors of responses blocked for
+// reproducing training data verbatim. Unlike safety blocks, rephrasing the prompt often helps.
+var ErrRecitation = errors.New("response blocked for recitation")
+
+// IsRecitation reports whether err is a response blocked for reproducing training data.
+func IsRecitation(err error) bool {
+	return errors.Is(err, ErrRecitation)
+}
+
+// ErrTruncated is wrapped by the errors of responses cut off at the maximum number of tokens,
+// returned along with the partial text. Retrying with more tokens may complete them.
+var ErrTruncated = errors.New("response truncated")
+
+// IsTruncated reports whether err is the response being cut off at the maximum number of tokens.
+func IsTruncated(err error) bool {
+	return errors.Is(err, ErrTruncated)
+}
+
+// IsRefused reports whether err is the provider refusing to answer.
+func IsRefused(err error) bool {
+	return errors.Is(err, ErrRefused)
+}
+
+// anthropicFinishReason normalizes an Anthropic stop reason.
+func anthropicFinishReason(reason anthropic.MessagesStopReason) FinishReason {
+	switch reason {
+	case anthropic.MessagesStopReasonEndTurn, anthropic.MessagesStopReasonStopSequence, anthropic.MessagesStopReasonToolUse:
+		return FinishReasonStop
+	case anthropic.MessagesStopReasonMaxTokens:
+		return FinishReasonLength
+	case "refusal":
+		return FinishReasonRefusal
+	default:
+		return FinishReasonOther
+	}
+}
+
+// mistralFinishReason normalizes a Mistral finish reason.
+func mistralFinishReason(reason mistral.FinishReason) FinishReason {
+	switch reason {
+	case mistral.FinishReasonStop, "tool_calls":
+		return FinishReasonStop
+	case mistral.FinishReasonLength, "model_length":
+		return FinishReasonLength
+	case mistral.FinishReasonError:
+		return FinishReasonTransient
+	default:
+		return FinishReasonOther
+	}
+}
+
+// openAIFinishReason normalizes an OpenAI finish reason.
+func openAIFinishReason(reason string) FinishReason {
+	switch reason {
+	case "stop", "tool_calls":
+		return FinishReasonStop
+	case "length":
+		return FinishReasonLength
+	case "content_filter":
+		return FinishReasonSafety
+	default:
+		return FinishReasonOther
+	}
+}
+
+// geminiFinishReason normalizes a Gemini finish reason.
+func geminiFinishReason(reason genai.FinishReason) FinishReason {
+	switch reason {
+	case genai.FinishReasonStop:
+		return FinishReasonStop
+	case genai.FinishReasonMaxTokens:
+		return FinishReasonLength
+	case genai.FinishReasonSafety:
+		return FinishReasonSafety
+	case genai.FinishReasonRecitation:
+		return FinishReasonRecitation
+	default:
+		return FinishReasonOther
+	}
+}
@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gage-technologies/mistral-go"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/google/go-cmp/cmp"
+	"github.com/liushuangls/go-anthropic/v2"
+)
+
+func TestFinishReasons(t *testing.T) {
+	tests := []struct {
+		name string
+		got  FinishReason
+		want FinishReason
+	}{
+		{"Anthropic end turn", anthropicFinishReason(anthropic.MessagesStopReasonEndTurn), FinishReasonStop},
+		{"Anthropic tool use", anthropicFinishReason(anthropic.MessagesStopReasonToolUse), FinishReasonStop},
+		{"Anthropic max tokens", anthropicFinishReason(anthropic.MessagesStopReasonMaxTokens), FinishReasonLength},
+		{"Anthropic refusal", anthropicFinishReason("refusal"), FinishReasonRefusal},
+		{"Mistral stop", mistralFinishReason(mistral.FinishReasonStop), FinishReasonStop},
+		{"Mistral length", mistralFinishReason(mistral.FinishReasonLength), FinishReasonLength},
+		{"Mistral error", mistralFinishReason(mistral.FinishReasonError), FinishReasonTransient},
+		{"Gemini stop", geminiFinishReason(genai.FinishReasonStop), FinishReasonStop},
+		{"Gemini max tokens", geminiFinishReason(genai.FinishReasonMaxTokens), FinishReasonLength},
+		{"Gemini safety", geminiFinishReason(genai.FinishReasonSafety), FinishReasonSafety},
+		{"Gemini recitation", geminiFinishReason(genai.FinishReasonRecitation), FinishReasonRecitation},
+		{"Gemini unspecified", geminiFinishReason(genai.FinishReasonUnspecified), FinishReasonOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeminiSafetyBlockIsRefused(t *testing.T) {
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: &mockGeminiSafetyClient{}}
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); !IsRefused(err) {
+		t.Errorf("Expected a refused response error, got %v", err)
+	}
+}
+
+func TestMaxTokensOverride(t *testing.T) {
+	client := &mockAnthropicRecordingClient{}
+	llm := &anthropicLLM{modelName: anthropic.ModelClaudeInstant1Dot2, maxTokens: 512, topP: 1, client: client}
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{MaxTokens: 1024}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.request.MaxTokens != 1024 {
+		t.Errorf("Expected max tokens 1024, got %d", client.request.MaxTokens)
+	}
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.request.MaxTokens != 512 {
+		t.Errorf("Expected the model max tokens 512, got %d", client.request.MaxTokens)
+	}
+}
+
+// mockAnthropicTruncatedClient answers with a response cut off at the maximum number of tokens.
+type mockAnthropicTruncatedClient struct {
+	content anthropic.MessageContent
+}
+
+func (m *mockAnthropicTruncatedClient) CreateMessages(ctx context.Context, request anthropic.MessagesRequest) (anthropic.MessagesResponse, error) {
+	return anthropic.MessagesResponse{
+		Content:    []anthropic.MessageContent{m.content},
+		StopReason: anthropic.MessagesStopReasonMaxTokens,
+	}, nil
+}
+
+func TestAnthropicMaxTokensIsTruncated(t *testing.T) {
+	partial := `{"overall_assessment": "Good`
+	tests := []struct {
+		name     string
+		content  anthropic.MessageContent
+		opts     *GenerateOptions
+		wantText string
+	}{
+		{
+			name:     "Text",
+			content:  anthropic.MessageContent{Type: anthropic.MessagesContentTypeText, Text: &partial},
+			wantText: partial,
+		},
+		{
+			name: "Forced tool",
+			content: anthropic.MessageContent{
+				Type:                  anthropic.MessagesContentTypeToolUse,
+				MessageContentToolUse: &anthropic.MessageContentToolUse{Name: "record_insights", Input: json.RawMessage(partial)},
+			},
+			opts:     &GenerateOptions{ToolChoice: "record_insights"},
+			wantText: partial,
+		},
+		{
+			name:    "Forced tool never called",
+			content: anthropic.MessageContent{Type: anthropic.MessagesContentTypeText, Text: &partial},
+			opts:    &GenerateOptions{ToolChoice: "record_insights"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &anthropicLLM{modelName: anthropic.ModelClaudeInstant1Dot2, maxTokens: 512, topP: 1, client: &mockAnthropicTruncatedClient{content: tt.content}}
+
+			text, meta, err := llm.GenerateTextWithMetadata(context.Background(), "Test prompt", tt.opts)
+			if !IsTruncated(err) {
+				t.Errorf("Expected a truncated response error, got %v", err)
+			}
+			if text != tt.wantText {
+				t.Errorf("Expected partial text %q, got %q", tt.wantText, text)
+			}
+			if meta.Reason != FinishReasonLength {
+				t.Errorf("Expected finish reason %q, got %q", FinishReasonLength, meta.Reason)
+			}
+
+			// GenerateText surfaces the same error, e.g. through decorators dropping the metadata
+			if _, err := llm.GenerateText(context.Background(), "Test prompt", tt.opts); !IsTruncated(err) {
+				t.Errorf("Expected a truncated response error from GenerateText, got %v", err)
+			}
+		})
+	}
+}
+
+// mockGeminiRecitationClient blocks the first response for recitation and records the prompts it receives.
+type mockGeminiRecitationClient struct {
+	mockGeminiClient
+	prompts []string
+}
+
+func (m *mockGeminiRecitationClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	m.prompts = append(m.prompts, fmt.Sprint(parts[0]))
+	if len(m.prompts) == 1 {
+		return nil, &genai.BlockedError{Candidate: &genai.Candidate{FinishReason: genai.FinishReasonRecitation}}
+	}
+	return m.mockGeminiClient.SendMessage(ctx, model, history, parts...)
+}
+
+func TestGeminiRetryOnRecitation(t *testing.T) {
+	rephrase := func(prompt string) string { return prompt + " In your own words." }
+
+	tests := []struct {
+		name           string
+		opts           []lLMOption
+		want           string
+		wantRecitation bool
+		wantPrompts    []string
+	}{
+		{
+			name:        "Retried with the rephrased prompt",
+			opts:        []lLMOption{WithGeminiRetryOnRecitation(rephrase)},
+			want:        "Gemini Response\n",
+			wantPrompts: []string{"Test prompt", "Test prompt In your own words."},
+		},
+		{
+			name:           "Blocked without retry",
+			wantRecitation: true,
+			wantPrompts:    []string{"Test prompt"},
+		},
+		{
+			// Recitation blocks aren't safety blocks
+			name:           "Not retried by the safety fallback",
+			opts:           []lLMOption{WithGeminiCandidateSafetyFallback(rephrase)},
+			wantRecitation: true,
+			wantPrompts:    []string{"Test prompt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockGeminiRecitationClient{}
+			llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: client}
+			for _, opt := range tt.opts {
+				opt(llm)
+			}
+
+			got, err := llm.GenerateText(context.Background(), "Test prompt", nil)
+			if IsRecitation(err) != tt.wantRecitation {
+				t.Fatalf("GenerateText() error = %v, want a recitation error %v", err, tt.wantRecitation)
+			}
+			if tt.wantRecitation && !IsRefused(err) {
+				t.Errorf("Expected a recitation error to be a refused response, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GenerateText() = %q, want %q", got, tt.want)
+			}
+			if diff := cmp.Diff(tt.wantPrompts, client.prompts); diff != "" {
+				t.Errorf("GenerateText() prompts mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
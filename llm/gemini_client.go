@@ -2,17 +2,94 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+/*
+GeminiClient is an interface for interacting with the Google Gemini API.
+
+It mirrors the subset of genai.Client used by geminiLLM, plus a SendMessage method
+that sends a single chat turn for a fully configured model, so the client can be mocked.
+*/
+type GeminiClient interface {
+	GenerativeModel(name string) *genai.GenerativeModel
+	CreateCachedContent(ctx context.Context, cc *genai.CachedContent) (*genai.CachedContent, error)
+	SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error)
+}
+
+// overrideGenerationConfig sets the fields of config that are set in override.
+func overrideGenerationConfig(config *genai.GenerationConfig, override *genai.GenerationConfig) {
+	if override.CandidateCount != nil {
+		config.CandidateCount = override.CandidateCount
+	}
+	if len(override.StopSequences) > 0 {
+		config.StopSequences = override.StopSequences
+	}
+	if override.MaxOutputTokens != nil {
+		config.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.Temperature != nil {
+		config.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		config.TopP = override.TopP
+	}
+	if override.TopK != nil {
+		config.TopK = override.TopK
+	}
+	if override.ResponseMIMEType != "" {
+		config.ResponseMIMEType = override.ResponseMIMEType
+	}
+	if override.ResponseSchema != nil {
+		config.ResponseSchema = override.ResponseSchema
+	}
+}
+
+// genaiClient adapts a *genai.Client to the GeminiClient interface.
+type genaiClient struct {
+	*genai.Client
+}
+
+// SendMessage starts a chat session on the model, seeds it with the given history and sends the parts.
+func (c *genaiClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	session := model.StartChat()
+	session.History = history
+	return session.SendMessage(ctx, parts...)
+}
+
 type geminiLLM struct {
 	modelName   string
 	temperature float64
 	maxTokens   int
 	topP        float64
-	client      *genai.Client
+	topK        int
+	// stopSequences stop the generation, set from the provider config.
+	stopSequences []string
+	client        GeminiClient
+	// safetyFallback transforms the prompt for a single retry when the response is blocked for safety.
+	safetyFallback func(prompt string) string
+	// recitationRephrase rephrases the prompt for a single retry when the response is blocked for recitation.
+	recitationRephrase func(prompt string) string
+	// safetyBlockRetried fails safety blocks like any other error rather than as refusals.
+	safetyBlockRetried bool
+	// generationConfig overrides the generation config built from the other fields, where set.
+	generationConfig *genai.GenerationConfig
+	// tools are passed with the calls without tools of their own, set with WithTools.
+	tools []GenericTool
+	// historyStore persists the chat history of the calls with a conversation key, stateless when nil.
+	historyStore ChatHistoryStore
+	// thinkingBudget is the thinking budget of the Gemini 2.5 models, their default when nil.
+	thinkingBudget *int
+	// avgLogprobs reports the avgLogprobs of the responses, read by the HTTP transport of the client.
+	avgLogprobs bool
 }
 
 /*
@@ -28,60 +105,241 @@ Args:
 
 	ctx: The context for the request.
 	prompt: The input prompt for text generation.
-	opts: Optional generation options, such as tools.
+	opts: Optional generation options, such as tools, a system prompt or a cached content reference.
 
 Returns:
 
 	A string containing the generated text and an error if any occurred.
 */
 func (g *geminiLLM) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := g.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata is GenerateText, also returning the model version and finish reason of the response.
+func (g *geminiLLM) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	// The avgLogprobs of the responses are recorded by the HTTP transport, see WithGeminiAvgLogprobs
+	var logprobs *avgLogprobsRecorder
+	if g.avgLogprobs {
+		ctx, logprobs = withAvgLogprobsRecorder(ctx)
+	}
+
 	// Model initialization
 	model := g.client.GenerativeModel(g.modelName)
 
 	// Model configuration
 	model.SetTemperature(float32(g.temperature))
 	model.SetTopP(float32(g.topP))
-	model.SetMaxOutputTokens(int32(g.maxTokens))
-	model.SetTopK(64)
+	model.SetMaxOutputTokens(int32(opts.maxTokens(g.maxTokens)))
+	// 0 or negative leaves TopK unset, for pure nucleus sampling
+	if g.topK > 0 {
+		model.SetTopK(int32(g.topK))
+	}
+	if len(g.stopSequences) > 0 {
+		model.StopSequences = g.stopSequences
+	}
 	model.ResponseMIMEType = "text/plain" // Default MIME type
 
 	// Tool handling
-	if opts != nil && len(opts.Tools) > 0 {
+	if tools := opts.tools(g.tools); len(tools) > 0 {
 		model.Tools = make([]*genai.Tool, 0)
-		for _, genericTool := range opts.Tools {
+		for _, genericTool := range tools {
 			if genericTool.Type != GeminiToolType {
-				return "", fmt.Errorf("error: tool type mismatch for Gemini LLM")
+				return "", ResponseMeta{}, fmt.Errorf("error: tool type mismatch for Gemini LLM")
 			}
 			geminiTool, ok := genericTool.Tool.(*genai.Tool)
 			if !ok {
-				return "", fmt.Errorf("error: invalid tool type for Gemini LLM")
+				return "", ResponseMeta{}, fmt.Errorf("error: invalid tool type for Gemini LLM")
 			}
 			model.Tools = append(model.Tools, geminiTool)
 		}
 
 		// Update ResponseMIMEType if it was set by the caller
-		if opts.ResponseMIMEType != "" {
+		if opts != nil && opts.ResponseMIMEType != "" {
 			model.ResponseMIMEType = opts.ResponseMIMEType
 		} else {
 			model.ResponseMIMEType = "text/plain" // Default MIME type
 		}
 	}
 
-	// Chat session
-	session := model.StartChat()
-	session.History = []*genai.Content{}
+	// Generation config override, the per-call maximum number of tokens still applies
+	if g.generationConfig != nil {
+		overrideGenerationConfig(&model.GenerationConfig, g.generationConfig)
+		if opts != nil && opts.MaxTokens > 0 {
+			model.SetMaxOutputTokens(int32(opts.MaxTokens))
+		}
+	}
+
+	// Cached content handling
+	if opts != nil && opts.CachedContent != "" {
+		model.CachedContentName = opts.CachedContent
+	}
+
+	// System instruction, set on the model before the chat session is started.
+	// Cached content carries its own instructions, so both can't be combined.
+	if opts != nil && opts.SystemPrompt != "" && opts.CachedContent == "" {
+		model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(opts.SystemPrompt)}}
+	}
+
+	// Inline data (e.g. images) is sent as blob parts after the text prompt
+	var blobs []genai.Part
+	if opts != nil {
+		for _, data := range opts.InlineData {
+			blobs = append(blobs, genai.Blob{MIMEType: data.MIMEType, Data: data.Data})
+		}
+	}
+
+	// Chat history of the conversation, when persisted
+	history := []*genai.Content{}
+	var conversation string
+	if g.historyStore != nil && opts != nil && opts.ConversationKey != "" {
+		conversation = opts.ConversationKey
+		loaded, err := g.historyStore.Load(ctx, conversation)
+		if err != nil {
+			return "", ResponseMeta{}, fmt.Errorf("error loading chat history: %w", err)
+		}
+		history = append(history, loaded...)
+	}
 
 	// Message sending
-	resp, err := session.SendMessage(ctx, genai.Text(prompt))
+	parts := append([]genai.Part{genai.Text(prompt)}, blobs...)
+	resp, err := g.client.SendMessage(ctx, model, history, parts...)
+	if err != nil && g.safetyFallback != nil && isSafetyBlock(err) {
+		// Retry once with the transformed (e.g. softened) prompt
+		parts = append([]genai.Part{genai.Text(g.safetyFallback(prompt))}, blobs...)
+		resp, err = g.client.SendMessage(ctx, model, history, parts...)
+	}
+	if err != nil && g.recitationRephrase != nil && isRecitationBlock(err) {
+		// Retry once with the rephrased prompt
+		parts = append([]genai.Part{genai.Text(g.recitationRephrase(prompt))}, blobs...)
+		resp, err = g.client.SendMessage(ctx, model, history, parts...)
+	}
 	if err != nil {
-		return "", fmt.Errorf("error sending message: %w", err)
+		if isGeminiAuthError(err) {
+			return "", ResponseMeta{}, fmt.Errorf("%w: error sending message: %w", ErrAuthentication, err)
+		}
+		if isSafetyBlock(err) && !g.safetyBlockRetried {
+			return "", ResponseMeta{}, geminiSafetyBlockError(err)
+		}
+		if isRecitationBlock(err) {
+			return "", ResponseMeta{}, fmt.Errorf("%w: %w: error sending message: %w", ErrRefused, ErrRecitation, err)
+		}
+		return "", ResponseMeta{}, fmt.Errorf("error sending message: %w", err)
+	}
+
+	output, candidate, err := geminiResponseText(resp)
+	if err != nil {
+		return "", ResponseMeta{}, err
+	}
+
+	// Saving the turn to the chat history of the conversation
+	if conversation != "" {
+		turn := []*genai.Content{{Role: "user", Parts: parts}, candidate.Content}
+		if err := g.historyStore.Save(ctx, conversation, append(history[:len(history):len(history)], turn...)); err != nil {
+			return "", ResponseMeta{}, fmt.Errorf("error saving chat history: %w", err)
+		}
+	}
+
+	// Return generated text. The Gemini SDK doesn't expose the response model version,
+	// so the requested model name is reported instead.
+	meta := ResponseMeta{
+		ModelVersion: g.modelName,
+		FinishReason: candidate.FinishReason.String(),
+		Reason:       geminiFinishReason(candidate.FinishReason),
+	}
+	if resp.UsageMetadata != nil {
+		meta.InputTokens = int(resp.UsageMetadata.PromptTokenCount)
+		meta.OutputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+	if logprobs != nil {
+		meta.AvgLogprobs = logprobs.get()
+	}
+	return output, meta, nil
+}
+
+// ErrNoText is wrapped by the errors of responses without any text, e.g. Gemini candidates
+// whose parts are all function calls or empty.
+var ErrNoText = errors.New("response has no text")
+
+/*
+geminiResponseText returns the text of the first candidate of resp having text parts, each
+followed by a newline, along with the candidate. Parts of other types (function calls, inline
+data, ...) are skipped rather than stringified into text that fails parsing; the error wraps
+ErrNoText when no candidate has any.
+*/
+func geminiResponseText(resp *genai.GenerateContentResponse) (string, *genai.Candidate, error) {
+	for _, candidate := range resp.Candidates {
+		if candidate == nil || candidate.Content == nil {
+			continue
+		}
+		var output strings.Builder
+		for _, part := range candidate.Content.Parts {
+			if text, ok := part.(genai.Text); ok && text != "" {
+				output.WriteString(string(text) + "\n")
+			}
+		}
+		if output.Len() > 0 {
+			return output.String(), candidate, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: %d candidates without text parts", ErrNoText, len(resp.Candidates))
+}
+
+// isGeminiAuthError reports whether err is the Gemini API rejecting the credentials, over REST or gRPC.
+func isGeminiAuthError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden
+	}
+	code := status.Code(err)
+	return code == codes.Unauthenticated || code == codes.PermissionDenied
+}
+
+// isGeminiInvalidRequest reports whether err is the Gemini API rejecting the request as invalid,
+// e.g. an unknown model or too many texts, over REST or gRPC.
+func isGeminiInvalidRequest(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusNotFound
+	}
+	code := status.Code(err)
+	return code == codes.InvalidArgument || code == codes.NotFound
+}
+
+// isSafetyBlock reports whether err is a Gemini response or prompt blocked for safety.
+func isSafetyBlock(err error) bool {
+	var blocked *genai.BlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	if blocked.Candidate != nil && blocked.Candidate.FinishReason == genai.FinishReasonSafety {
+		return true
 	}
+	return blocked.PromptFeedback != nil && blocked.PromptFeedback.BlockReason == genai.BlockReasonSafety
+}
+
+// isRecitationBlock reports whether err is a Gemini response blocked for reproducing training data.
+func isRecitationBlock(err error) bool {
+	var blocked *genai.BlockedError
+	return errors.As(err, &blocked) && blocked.Candidate != nil && blocked.Candidate.FinishReason == genai.FinishReasonRecitation
+}
+
+/*
+CacheContent stores the given text server-side as Gemini cached content for the configured model.
 
-	output := ""
-	for _, part := range resp.Candidates[0].Content.Parts {
-		output = fmt.Sprintf("%v\n", part)
+It returns the cached content name, which can be passed as GenerateOptions.CachedContent
+to reference the text in later GenerateText calls instead of sending it inline.
+Caching fails when the text is below the model's minimum cacheable size or the model
+does not support caching; callers are expected to fall back to inline content.
+*/
+func (g *geminiLLM) CacheContent(ctx context.Context, text string) (string, error) {
+	cc, err := g.client.CreateCachedContent(ctx, &genai.CachedContent{
+		Model:             g.modelName,
+		SystemInstruction: genai.NewUserContent(genai.Text(text)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating cached content: %w", err)
 	}
 
-	// Return generated text
-	return output, nil
+	return cc.Name, nil
 }
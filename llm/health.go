@@ -0,0 +1,49 @@
+package llm
+
+import "context"
+
+// HealthChecker is implemented by LanguageModels that can probe the health of their provider,
+// e.g. before a batch of calls.
+type HealthChecker interface {
+	// Ping returns an error when the provider can't serve calls, e.g. is down or rejects the credentials.
+	Ping(ctx context.Context) error
+}
+
+// healthProbePrompt is the prompt of the calls probing the health of a provider.
+const healthProbePrompt = "ping"
+
+/*
+Ping probes the health of the provider of the model, which may be wrapped (e.g. audited or rate
+limited), with a call generating a single token, returning the metadata of the call. A truncated
+or refused response still comes from a provider able to serve calls, so only the other failures
+make it unhealthy.
+*/
+func Ping(ctx context.Context, model LanguageModel) (ResponseMeta, error) {
+	_, meta, err := GenerateTextWithMetadata(ctx, model, healthProbePrompt, &GenerateOptions{MaxTokens: 1})
+	if err != nil && !IsTruncated(err) && !IsRefused(err) {
+		return meta, err
+	}
+	return meta, nil
+}
+
+// ping is Ping for the HealthChecker implementations.
+func ping(ctx context.Context, model LanguageModel) error {
+	_, err := Ping(ctx, model)
+	return err
+}
+
+func (a *anthropicLLM) Ping(ctx context.Context) error {
+	return ping(ctx, a)
+}
+
+func (g *geminiLLM) Ping(ctx context.Context) error {
+	return ping(ctx, g)
+}
+
+func (m *mistralLLM) Ping(ctx context.Context) error {
+	return ping(ctx, m)
+}
+
+func (o *openAILLM) Ping(ctx context.Context) error {
+	return ping(ctx, o)
+}
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+
+	// A healthy provider answers a single-token call
+	client := &mockOpenAIClient{response: &OpenAIChatResponse{
+		Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "pong"}, FinishReason: "length"}},
+	}}
+	var model LanguageModel = &openAILLM{modelName: "gpt-4o-mini", maxTokens: 512, client: client}
+	checker, ok := model.(HealthChecker)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.NoError(t, checker.Ping(ctx))
+	assert.Equal(t, 1, client.request.MaxTokens)
+
+	// A provider failing the call is unhealthy
+	client.err = errors.New("503 Service Unavailable")
+	assert.Error(t, checker.Ping(ctx))
+
+	// A refusal still comes from a healthy provider
+	gemini := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: &mockGeminiBlockClient{}}
+	assert.NoError(t, gemini.Ping(ctx))
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gage-technologies/mistral-go"
+)
+
+var (
+	sharedHTTPClientMu sync.RWMutex
+	sharedHTTPClient   *http.Client
+)
+
+/*
+SetHTTPClient sets an *http.Client shared by every provider created afterwards with
+NewAnthropicLLM, NewMistralLLM or NewGeminiClient, so all of them reuse the same
+connection pool instead of each building its own client with default transport settings.
+
+Passing nil restores each provider's default HTTP client.
+*/
+func SetHTTPClient(client *http.Client) {
+	sharedHTTPClientMu.Lock()
+	defer sharedHTTPClientMu.Unlock()
+	sharedHTTPClient = client
+}
+
+// getHTTPClient returns the shared HTTP client, or nil if none was set.
+func getHTTPClient() *http.Client {
+	sharedHTTPClientMu.RLock()
+	defer sharedHTTPClientMu.RUnlock()
+	return sharedHTTPClient
+}
+
+/*
+NewPooledHTTPClient creates an *http.Client tuned for connection reuse in high-throughput runs.
+
+It clones http.DefaultTransport and raises the number of idle connections kept per host,
+which avoids repeated TLS handshakes when many requests are sent to the same provider.
+
+Args:
+
+	maxIdleConns: The maximum number of idle connections kept, in total and per host.
+	idleConnTimeout: How long an idle connection is kept before being closed.
+*/
+func NewPooledHTTPClient(maxIdleConns int, idleConnTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConns
+	transport.IdleConnTimeout = idleConnTimeout
+
+	return &http.Client{Transport: transport}
+}
+
+// mistralEndpoint is the base URL of the Mistral API.
+const mistralEndpoint = "https://api.mistral.ai"
+
+/*
+mistralHTTPClient implements the MistralClient interface over a caller-provided *http.Client.
+
+The mistral-go client builds a new http.Client for every request, so it can't share a
+connection pool; this client sends the same chat completion request through the given one.
+*/
+type mistralHTTPClient struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+// Chat sends a chat completion request to the Mistral API.
+func (c *mistralHTTPClient) Chat(model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error) {
+	return c.ChatWithContext(context.Background(), model, messages, params)
+}
+
+// ChatWithContext sends a chat completion request to the Mistral API, canceled along with ctx.
+func (c *mistralHTTPClient) ChatWithContext(ctx context.Context, model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error) {
+	if params == nil {
+		params = &mistral.DefaultChatRequestParams
+	}
+
+	requestData := map[string]interface{}{
+		"model":       model,
+		"messages":    messages,
+		"temperature": params.Temperature,
+		"max_tokens":  params.MaxTokens,
+		"top_p":       params.TopP,
+		"random_seed": params.RandomSeed,
+		"safe_prompt": params.SafePrompt,
+	}
+	if params.Tools != nil {
+		requestData["tools"] = params.Tools
+	}
+	if params.ToolChoice != "" {
+		requestData["tool_choice"] = params.ToolChoice
+	}
+	if params.ResponseFormat != "" {
+		requestData["response_format"] = map[string]any{"type": params.ResponseFormat}
+	}
+
+	body, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating chat request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending chat request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		responseBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("(HTTP Error %d) %s", resp.StatusCode, string(responseBytes))
+	}
+
+	var chatResponse mistral.ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
+		return nil, fmt.Errorf("error decoding chat response: %w", err)
+	}
+
+	return &chatResponse, nil
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport answers every request with a canned response for its host
+// and records which hosts were called, along with the API key sent in the query.
+type recordingTransport struct {
+	mu        sync.Mutex
+	hosts     map[string]int
+	keys      map[string]string
+	responses map[string]string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.hosts[req.URL.Host]++
+	rt.keys[req.URL.Host] = req.URL.Query().Get("key")
+	rt.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(rt.responses[req.URL.Host])),
+		Request:    req,
+	}, nil
+}
+
+func TestSetHTTPClient(t *testing.T) {
+	t.Setenv("CLAUDE_API_KEY", "claude-key")
+	t.Setenv("MISTRAL_API_KEY", "mistral-key")
+	t.Setenv("GEMINI_API_KEY", "gemini-key")
+
+	rt := &recordingTransport{
+		hosts: make(map[string]int),
+		keys:  make(map[string]string),
+		responses: map[string]string{
+			"api.anthropic.com":                 `{"type":"message","role":"assistant","content":[{"type":"text","text":"Anthropic Response"}]}`,
+			"api.mistral.ai":                    `{"choices":[{"index":0,"message":{"role":"assistant","content":"Mistral Response"}}]}`,
+			"generativelanguage.googleapis.com": `[{"candidates":[{"content":{"role":"model","parts":[{"text":"Gemini Response"}]}}]}]`,
+		},
+	}
+	SetHTTPClient(&http.Client{Transport: rt})
+	defer SetHTTPClient(nil)
+
+	models := map[string]LanguageModel{
+		"api.anthropic.com":                 NewAnthropicLLM(),
+		"api.mistral.ai":                    NewMistralLLM(),
+		"generativelanguage.googleapis.com": NewGeminiClient(),
+	}
+
+	for host, model := range models {
+		// Only the transport used matters here, not the decoded response
+		_, _ = model.GenerateText(context.Background(), "Test prompt", &GenerateOptions{})
+		if rt.hosts[host] == 0 {
+			t.Errorf("Expected a request to %s through the shared HTTP client", host)
+		}
+	}
+
+	if rt.keys["generativelanguage.googleapis.com"] != "gemini-key" {
+		t.Errorf("Expected the Gemini API key to be sent, got %q", rt.keys["generativelanguage.googleapis.com"])
+	}
+}
+
+// contextTransport fails the requests whose context is done, like http.Transport does.
+type contextTransport struct{ http.RoundTripper }
+
+func (rt contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	return rt.RoundTripper.RoundTrip(req)
+}
+
+func TestMistralHTTPClientContext(t *testing.T) {
+	rt := &recordingTransport{
+		hosts:     make(map[string]int),
+		keys:      make(map[string]string),
+		responses: map[string]string{"api.mistral.ai": `{"choices":[{"index":0,"message":{"role":"assistant","content":"Mistral Response"}}]}`},
+	}
+	SetHTTPClient(&http.Client{Transport: contextTransport{rt}})
+	defer SetHTTPClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The request is canceled along with the call
+	if _, err := NewMistralLLM().GenerateText(ctx, "Test prompt", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("GenerateText() error = %v, want %v", err, context.Canceled)
+	}
+	if rt.hosts["api.mistral.ai"] != 0 {
+		t.Errorf("Expected no request to be sent, got %d", rt.hosts["api.mistral.ai"])
+	}
+}
+
+func TestNewPooledHTTPClient(t *testing.T) {
+	client := NewPooledHTTPClient(32, time.Minute)
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected an *http.Transport, got %T", client.Transport)
+	}
+	if transport.MaxIdleConns != 32 || transport.MaxIdleConnsPerHost != 32 {
+		t.Errorf("Expected 32 idle connections, got %d (%d per host)", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != time.Minute {
+		t.Errorf("Expected idle timeout of %v, got %v", time.Minute, transport.IdleConnTimeout)
+	}
+}
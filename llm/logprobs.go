@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+WithGeminiAvgLogprobs creates an lLMOption reporting the average log probability of the tokens
+of the Gemini responses (their avgLogprobs) in ResponseMeta.AvgLogprobs, a measure of the
+model's confidence.
+
+The genai SDK drops it from the responses, so it is read from the generateContent response
+bodies by the HTTP transport of the client.
+
+Other providers ignore this option.
+*/
+func WithGeminiAvgLogprobs() lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.avgLogprobs = true
+		}
+	}
+}
+
+// avgLogprobsKey is the context key of the avgLogprobsRecorder of a request.
+type avgLogprobsKey struct{}
+
+// avgLogprobsRecorder receives the avgLogprobs of the responses to the requests of its context.
+type avgLogprobsRecorder struct {
+	mu    sync.Mutex
+	value *float64
+}
+
+// withAvgLogprobsRecorder returns a context whose requests record their avgLogprobs in the returned recorder.
+func withAvgLogprobsRecorder(ctx context.Context) (context.Context, *avgLogprobsRecorder) {
+	recorder := &avgLogprobsRecorder{}
+	return context.WithValue(ctx, avgLogprobsKey{}, recorder), recorder
+}
+
+func (r *avgLogprobsRecorder) set(value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = &value
+}
+
+// get returns the avgLogprobs of the last response reporting it, nil if none did.
+func (r *avgLogprobsRecorder) get() *float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.value
+}
+
+/*
+avgLogprobsTransport is an http.RoundTripper reading the avgLogprobs of the Gemini
+generateContent (and streamGenerateContent) responses into the avgLogprobsRecorder of the
+context of their request. Other requests, and requests without a recorder, are sent as is.
+*/
+type avgLogprobsTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *avgLogprobsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	recorder, ok := req.Context().Value(avgLogprobsKey{}).(*avgLogprobsRecorder)
+	generate := strings.HasSuffix(req.URL.Path, ":generateContent") || strings.HasSuffix(req.URL.Path, ":streamGenerateContent")
+	if !ok || !generate {
+		return transport.RoundTrip(req)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading Gemini response: %w", err)
+	}
+	if value, ok := readAvgLogprobs(body); ok {
+		recorder.set(value)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// readAvgLogprobs returns the avgLogprobs of the first candidate of a generateContent response
+// body, or of the last of the responses of a streamGenerateContent one reporting it.
+func readAvgLogprobs(body []byte) (float64, bool) {
+	type response struct {
+		Candidates []struct {
+			AvgLogprobs *float64 `json:"avgLogprobs"`
+		} `json:"candidates"`
+	}
+	var responses []response
+	if err := json.Unmarshal(body, &responses); err != nil {
+		var single response
+		if err := json.Unmarshal(body, &single); err != nil {
+			return 0, false
+		}
+		responses = []response{single}
+	}
+
+	var (
+		value float64
+		found bool
+	)
+	for _, response := range responses {
+		if len(response.Candidates) > 0 && response.Candidates[0].AvgLogprobs != nil {
+			value, found = *response.Candidates[0].AvgLogprobs, true
+		}
+	}
+	return value, found
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockGeminiHTTPClient sends a generateContent request through the HTTP client with the
+// context of the call, as the genai SDK does, before answering like mockGeminiClient.
+type mockGeminiHTTPClient struct {
+	mockGeminiClient
+	url  string
+	http *http.Client
+}
+
+func (m *mockGeminiHTTPClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url+"/v1beta/models/gemini-1.5-flash-002:generateContent", strings.NewReader("{}"))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return m.mockGeminiClient.SendMessage(ctx, model, history, parts...)
+}
+
+func TestWithGeminiAvgLogprobs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"candidates": [{"content": {"role": "model", "parts": [{"text": "{}"}]}, "finishReason": "STOP", "avgLogprobs": -0.42}]}`)
+	}))
+	defer server.Close()
+
+	client := &mockGeminiHTTPClient{url: server.URL, http: &http.Client{Transport: &avgLogprobsTransport{}}}
+	model := &geminiLLM{modelName: "gemini-1.5-flash-002", topP: 1, client: client}
+	WithGeminiAvgLogprobs()(model)
+
+	// The avgLogprobs dropped by the SDK are read by the transport into the response metadata
+	_, meta, err := model.GenerateTextWithMetadata(context.Background(), "Assessment", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() returned error: %v", err)
+	}
+	if assert.NotNil(t, meta.AvgLogprobs) {
+		assert.Equal(t, -0.42, *meta.AvgLogprobs)
+	}
+
+	// They aren't without the option
+	model.avgLogprobs = false
+	_, meta, err = model.GenerateTextWithMetadata(context.Background(), "Assessment", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, meta.AvgLogprobs)
+}
+
+func TestReadAvgLogprobs(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		want  float64
+		found bool
+	}{
+		{"generateContent", `{"candidates": [{"avgLogprobs": -0.1}, {"avgLogprobs": -0.9}]}`, -0.1, true},
+		{"streamed, last reporting", `[{"candidates": [{"avgLogprobs": -0.1}]}, {"candidates": [{"avgLogprobs": -0.3}]}, {"candidates": [{}]}]`, -0.3, true},
+		{"not reported", `{"candidates": [{"finishReason": "STOP"}]}`, 0, false},
+		{"not JSON", "not json", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := readAvgLogprobs([]byte(tt.body))
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
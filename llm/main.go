@@ -9,12 +9,14 @@ The package currently supports the following LLM providers:
 - Anthropic: Uses the Anthropic API to access Claude models.
 - Mistral: Uses the Mistral API to access Mistral models.
 - Google Gemini: Uses the Google Gemini API to access Gemini models.
+- OpenAI: Uses the OpenAI API to access GPT models.
 
 Each LLM provider has its own factory function for creating a new LanguageModel instance:
 
 - NewAnthropicLLM: Creates a new Anthropic LLM instance.
 - NewMistralLLM: Creates a new Mistral LLM instance.
 - NewGeminiClient: Creates a new Google Gemini LLM instance.
+- NewOpenAILLM: Creates a new OpenAI LLM instance.
 
 These factory functions take a variable number of lLMOption arguments to customize the model's settings, such as:
 
@@ -22,11 +24,61 @@ These factory functions take a variable number of lLMOption arguments to customi
 - Temperature: Controls the randomness of the generated text.
 - Max Tokens: Sets the maximum number of tokens allowed in the generated text.
 - Top P: Sets the nucleus sampling threshold for the generated text.
+- Top K: Sets the top-k sampling limit, where supported.
+
+NewLanguageModel creates the model of a provider from an LLMConfig, which holds the same
+settings and can be decoded from a configuration file. Gemini model aliases (e.g.
+gemini-1.5-pro-latest) are resolved to pinned versions when the model is created.
+
+Models can also be composed:
+
+- NewRouterModel: Picks the model to use for each call with a caller-supplied route function.
+- NewFallbackModel: Tries a chain of models in order until one succeeds, with optional per-model timeouts.
+- NewWeightedModel: Spreads calls across models by weight, e.g. to share the load according to each provider's quota.
+- NewClusterRateLimitedModel: Bounds the request rate of a model across workers with a shared token bucket.
+- NewFakeOnAuthErrorModel: Answers with a canned response when a model fails to authenticate, only if ALLOW_FAKE_FALLBACK=true.
+- NewBatchEmbedder: Splits the texts of an Embedder (e.g. NewGeminiEmbedder) into batches, embedded concurrently with WithConcurrentEmbeddingBatches and retried on transient failures with WithEmbeddingRetries.
+- NewCachingModel: Answers repeated calls from a ResponseCache, keyed with the fingerprint of the response schema.
+- NewRetryingTransport: Retries the HTTP requests failing with a connection error or a 5xx status, for the client shared with SetHTTPClient.
+- HealthChecker: Implemented by the provider models, whose Ping probes the provider with a single-token call.
+- NewAuditedModel: Records every call of a model (prompt, response, model, usage, latency) to an AuditSink, e.g. a JSONLAuditSink.
 
 The package also provides helper functions for creating common lLMOptions:
 
 - WithMaxTokens: Creates an lLMOption that sets the maximum number of tokens.
 - WithModelName: Creates an lLMOption that sets the model name.
+- WithConfig: Creates an lLMOption that applies the non-zero settings of an LLMConfig.
+- WithTopK: Creates an lLMOption that sets, or disables, top-k sampling.
+- WithProviderSpecificConfig: Creates an lLMOption that applies the settings only one provider has, e.g. Mistral's safe_prompt.
+- WithGeminiCandidateSafetyFallback: Creates an lLMOption that retries safety-blocked Gemini requests with a transformed prompt.
+- WithGeminiRetryOnRecitation: Creates an lLMOption that retries recitation-blocked Gemini requests with a rephrased prompt.
+- WithGeminiSafetyBlockAsDeadLetter: Creates an lLMOption that sets whether Gemini safety blocks fail as refusals carrying their block reason and safety ratings (the default).
+- WithGeminiChatHistoryPersistence: Creates an lLMOption that resumes and saves Gemini chat histories in a ChatHistoryStore.
+- WithGeminiGenerationConfigOverride: Creates an lLMOption that applies a complete Gemini generation config over the configured one.
+- WithGeminiThinkingBudget: Creates an lLMOption that sets the thinking budget of Gemini 2.5 models, whose thoughts are stripped from the text.
+- WithGeminiAvgLogprobs: Creates an lLMOption that reports the average log probability of the Gemini responses in ResponseMeta.AvgLogprobs.
+- WithRequestMetadata: Creates an lLMOption that tags the requests with metadata, forwarded to the Anthropic and OpenAI metadata and user fields.
+- WithMistralSafePrompt: Creates an lLMOption that prepends Mistral's guardrailing system prompt to the calls.
+- WithResponseFormatJSONSchema: Creates an lLMOption that sends a JSON schema with OpenAI JSON responses, in strict mode when the schema is within its subset.
+- WithProviderSpecificMaxTokensClamp: Creates an lLMOption that caps the maximum number of tokens by the model's known limit.
+- WithTools: Creates an lLMOption that sets the tools of the calls without tools, validated by NewLanguageModel.
+- WithProviderTimeouts: Creates an lLMOption that sets per-model timeouts on a fallback chain.
+- WithResponseCacheNegativeCaching: Creates an lLMOption that also caches the deterministic failures of a caching model, with their own TTL.
+- WithConcurrentEmbeddingBatches: Creates an lLMOption that sets the in-flight batches and batch size of a batch embedder.
+- WithGeminiEmbeddingTaskType: Creates an lLMOption that sets the task type of a Gemini embedder, e.g. CLUSTERING.
+
+Any LanguageModel can be adapted for other tooling with AsSimpleFunc, which hides the
+generation options behind a plain prompt function, or Pipe, which reads the prompt from
+an io.Reader and writes the generated text to an io.Writer.
+
+GenerateTextWithMetadata also returns the ResponseMeta (model version, finish reason and
+token usage) of the response, for the models implementing MetadataGenerator.
+
+In multi-tenant deployments, WithTenantID and WithRequestID tag the context of the calls with
+the tenant and request IDs, which are carried into the audit records and the logs of the package.
+
+A shared, pre-tuned *http.Client (see NewPooledHTTPClient) can be set once with SetHTTPClient
+and is then used by every provider constructor.
 
 Example Usage:
 
@@ -48,12 +100,18 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/gage-technologies/mistral-go"
 	"github.com/google/generative-ai-go/genai"
 	"github.com/liushuangls/go-anthropic/v2"
+	"google.golang.org/api/googleapi/transport"
 	"google.golang.org/api/option"
 )
 
@@ -76,6 +134,50 @@ type GenericTool struct {
 type GenerateOptions struct {
 	Tools            []GenericTool
 	ResponseMIMEType string
+	// CachedContent references content previously stored with a ContentCacher.
+	// Providers without caching support ignore it.
+	CachedContent string
+	// SystemPrompt holds instructions passed to the model separately from the prompt
+	// (Gemini SystemInstruction, Anthropic system, Mistral system message).
+	SystemPrompt string
+	// ToolChoice forces the model to call the named tool and returns the tool input
+	// as the generated text. Only supported by Anthropic; other providers ignore it.
+	ToolChoice string
+	// InlineData holds binary parts (e.g. screenshots) sent along with the prompt.
+	// Only supported by Gemini; other providers fail with ErrInlineDataNotSupported.
+	InlineData []InlineData
+	// MaxTokens overrides the maximum number of tokens of the model for this call, when positive.
+	MaxTokens int
+	// ConversationKey keys the chat history persisted with WithGeminiChatHistoryPersistence,
+	// e.g. a user ID. Calls without one are stateless; other providers ignore it.
+	ConversationKey string
+}
+
+// maxTokens returns the maximum number of tokens of a call, the model's unless overridden by the options.
+func (opts *GenerateOptions) maxTokens(modelMaxTokens int) int {
+	if opts != nil && opts.MaxTokens > 0 {
+		return opts.MaxTokens
+	}
+	return modelMaxTokens
+}
+
+// InlineData is a binary part of a multimodal prompt, such as an image.
+type InlineData struct {
+	// MIMEType is the IANA media type of the data, e.g. "image/png".
+	MIMEType string
+	Data     []byte
+}
+
+// ErrInlineDataNotSupported is returned by the providers that can't send GenerateOptions.InlineData.
+var ErrInlineDataNotSupported = errors.New("error: inline data is not supported")
+
+// ErrInvalidRequest is wrapped by the errors of the requests the provider rejects as invalid
+// (e.g. a prompt over the context window), which fail the same way however often they are sent.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// IsInvalidRequest reports whether err is a request the provider rejected as invalid.
+func IsInvalidRequest(err error) bool {
+	return errors.Is(err, ErrInvalidRequest)
 }
 
 // LanguageModel defines a common interface for interacting with different Large Language Models (LLMs).
@@ -86,6 +188,63 @@ type LanguageModel interface {
 	GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error)
 }
 
+// ResponseMeta describes which model answered a request and why it stopped generating.
+type ResponseMeta struct {
+	// ModelVersion is the exact model version reported by the provider.
+	ModelVersion string
+	// FinishReason is the provider's reason for stopping (e.g. "end_turn", "stop", "FinishReasonStop").
+	FinishReason string
+	// Reason is FinishReason normalized across providers.
+	Reason FinishReason
+	// InputTokens and OutputTokens are the prompt and generated tokens billed for the request.
+	InputTokens  int
+	OutputTokens int
+	// AvgLogprobs is the average log probability of the generated tokens, a measure of the
+	// model's confidence. Nil when the provider doesn't report it.
+	AvgLogprobs *float64
+}
+
+// MetadataGenerator is implemented by LanguageModels that can report the metadata of their responses.
+type MetadataGenerator interface {
+	// GenerateTextWithMetadata is GenerateText, also returning the response metadata.
+	GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error)
+}
+
+/*
+GenerateTextWithMetadata generates text with the given LanguageModel, returning the response
+metadata when the model implements MetadataGenerator and an empty ResponseMeta otherwise.
+*/
+func GenerateTextWithMetadata(ctx context.Context, m LanguageModel, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	if generator, ok := m.(MetadataGenerator); ok {
+		return generator.GenerateTextWithMetadata(ctx, prompt, opts)
+	}
+
+	text, err := m.GenerateText(ctx, prompt, opts)
+	return text, ResponseMeta{}, err
+}
+
+// ContentCacher is implemented by LanguageModels that can cache content server-side
+// (e.g. Gemini context caching) and reference it by handle across GenerateText calls.
+type ContentCacher interface {
+	// CacheContent stores text and returns a handle for GenerateOptions.CachedContent.
+	CacheContent(ctx context.Context, text string) (string, error)
+}
+
+// ErrContentCachingNotSupported is returned by CacheContent for the models that can't cache content.
+var ErrContentCachingNotSupported = errors.New("error: content caching is not supported")
+
+/*
+CacheContent caches text with the given LanguageModel, returning the handle of the content when
+the model implements ContentCacher and ErrContentCachingNotSupported otherwise. The models
+wrapping another one forward it, so the content is cached by the provider underneath.
+*/
+func CacheContent(ctx context.Context, m LanguageModel, text string) (string, error) {
+	if cacher, ok := m.(ContentCacher); ok {
+		return cacher.CacheContent(ctx, text)
+	}
+	return "", ErrContentCachingNotSupported
+}
+
 /*
 NewAnthropicLLM creates a new instance of a LanguageModel using Anthropic's API.
 It takes a variable number of lLMOption arguments to customize the model's settings.
@@ -108,12 +267,17 @@ The function returns a LanguageModel interface that can be used to generate text
 func NewAnthropicLLM(opts ...lLMOption) LanguageModel {
 	CLAUDE_API_KEY := os.Getenv("CLAUDE_API_KEY")
 
+	var clientOpts []anthropic.ClientOption
+	if httpClient := getHTTPClient(); httpClient != nil {
+		clientOpts = append(clientOpts, anthropic.WithHTTPClient(httpClient))
+	}
+
 	llm := &anthropicLLM{
 		modelName:   anthropic.ModelClaudeInstant1Dot2,
 		temperature: 0.7,
 		maxTokens:   512,
 		topP:        1,
-		client:      anthropic.NewClient(CLAUDE_API_KEY),
+		client:      anthropic.NewClient(CLAUDE_API_KEY, clientOpts...),
 	}
 
 	for _, opt := range opts {
@@ -152,6 +316,15 @@ func NewMistralLLM(opts ...lLMOption) LanguageModel {
 		client: mistral.NewMistralClientDefault(""),
 	}
 
+	// The mistral-go client can't take an HTTP client, so the shared one needs its own MistralClient
+	if httpClient := getHTTPClient(); httpClient != nil {
+		llm.client = &mistralHTTPClient{
+			apiKey:     os.Getenv("MISTRAL_API_KEY"),
+			endpoint:   mistralEndpoint,
+			httpClient: httpClient,
+		}
+	}
+
 	for _, opt := range opts {
 		opt(llm)
 	}
@@ -171,6 +344,7 @@ By default, the function initializes the Gemini LLM with the following settings:
   - Temperature: 0.7
   - Max Tokens: 512
   - Top P: 1
+  - Top K: 64
 
 These default settings can be overridden by passing in lLMOption arguments.
 For example, to change the model name to "gemini-pro", you would use the following code:
@@ -187,23 +361,47 @@ func NewGeminiClient(opts ...lLMOption) LanguageModel {
 		log.Fatalln("Environment variable GEMINI_API_KEY not set")
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		log.Fatalf("Error creating client: %v", err)
-	}
-
 	llm := &geminiLLM{
 		modelName:   "gemini-1.5-pro-exp-0801",
 		temperature: 0.7,
 		maxTokens:   512,
 		topP:        1,
-		client:      client,
+		topK:        64,
 	}
 
 	for _, opt := range opts {
 		opt(llm)
 	}
 
+	clientOpts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	httpClient := getHTTPClient()
+	if httpClient != nil || llm.thinkingBudget != nil || llm.avgLogprobs {
+		// An HTTP client replaces the API key option on REST calls, so the key is added by the transport
+		var rt http.RoundTripper = &transport.APIKey{Key: apiKey}
+		var timeout time.Duration
+		if httpClient != nil {
+			rt, timeout = &transport.APIKey{Key: apiKey, Transport: httpClient.Transport}, httpClient.Timeout
+		}
+		// The SDK can't set a thinking budget, the transport adds it to the requests
+		if llm.thinkingBudget != nil {
+			if !supportsThinking(llm.modelName) {
+				log.Printf("Ignoring the thinking budget: model %s doesn't support thinking", llm.modelName)
+			}
+			rt = &thinkingBudgetTransport{budget: *llm.thinkingBudget, transport: rt}
+		}
+		// The SDK drops the avgLogprobs of the responses, the transport reads them
+		if llm.avgLogprobs {
+			rt = &avgLogprobsTransport{transport: rt}
+		}
+		clientOpts = append(clientOpts, option.WithHTTPClient(&http.Client{Transport: rt, Timeout: timeout}))
+	}
+
+	client, err := genai.NewClient(ctx, clientOpts...)
+	if err != nil {
+		log.Fatalf("Error creating client: %v", err)
+	}
+	llm.client = &genaiClient{client}
+
 	return llm
 }
 
@@ -238,6 +436,8 @@ func WithMaxTokens(maxTokens int) lLMOption {
 			v.maxTokens = maxTokens
 		case *geminiLLM:
 			v.maxTokens = maxTokens
+		case *openAILLM:
+			v.maxTokens = maxTokens
 		}
 	}
 }
@@ -260,11 +460,102 @@ func WithModelName(modelName string) lLMOption {
 			v.modelName = modelName
 		case *geminiLLM:
 			v.modelName = modelName
+		case *openAILLM:
+			v.modelName = modelName
+		}
+	}
+}
+
+/*
+WithTopK creates an lLMOption that sets the top-k sampling limit for the given LanguageModel.
+
+A topK of 0 or less disables top-k sampling, so only TopP (nucleus sampling) applies.
+Providers without top-k support, such as Mistral, ignore this option.
+
+It returns an lLMOption function that takes an empty interface as input.
+This function uses a type switch to determine the concrete type of the
+LanguageModel passed to it and sets the topK property accordingly.
+*/
+func WithTopK(topK int) lLMOption {
+	return func(l interface{}) {
+		switch v := l.(type) {
+		case *anthropicLLM:
+			v.topK = topK
+		case *geminiLLM:
+			v.topK = topK
+		}
+	}
+}
+
+// WithGeminiTopKDisabled creates an lLMOption that disables Gemini's default top-k sampling.
+func WithGeminiTopKDisabled() lLMOption {
+	return WithTopK(0)
+}
+
+/*
+WithGeminiCandidateSafetyFallback creates an lLMOption that retries a Gemini request once
+when its response (or prompt) is blocked for safety, with the prompt rewritten by transform
+(e.g. softened or paraphrased), instead of failing right away.
+
+Other providers ignore this option.
+*/
+func WithGeminiCandidateSafetyFallback(transform func(prompt string) string) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.safetyFallback = transform
+		}
+	}
+}
+
+/*
+WithGeminiRetryOnRecitation creates an lLMOption that retries a Gemini request once when its
+response is blocked for recitation (reproducing training data verbatim), with the prompt
+rewritten by rephrase (e.g. asking to answer in its own words), instead of failing right away.
+
+Other providers ignore this option.
+*/
+func WithGeminiRetryOnRecitation(rephrase func(prompt string) string) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.recitationRephrase = rephrase
+		}
+	}
+}
+
+/*
+WithGeminiGenerationConfigOverride creates an lLMOption that applies a complete genai.GenerationConfig
+to every Gemini request, for the settings the other options don't cover (e.g. a ResponseSchema).
+The fields set in config override the configured ones, which still fill the unset fields. The
+maximum number of tokens of a call set with GenerateOptions.MaxTokens takes precedence.
+
+Other providers ignore this option.
+*/
+func WithGeminiGenerationConfigOverride(config genai.GenerationConfig) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.generationConfig = &config
+		}
+	}
+}
+
+/*
+WithMistralSafePrompt creates an lLMOption that sets Mistral's safe_prompt flag, which
+prepends Mistral's guardrailing system prompt to the conversation, e.g. for public-facing
+content. It is off by default, as with the safe_prompt provider config setting.
+
+Other providers ignore this option.
+*/
+func WithMistralSafePrompt(enabled bool) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*mistralLLM); ok {
+			v.safePrompt = enabled
 		}
 	}
 }
 
 // Helper functions to create GenericTools
+
+// NewGeminiTool wraps a Gemini tool, to be passed to a Gemini LLM.
 func NewGeminiTool(tool *genai.Tool) GenericTool {
 	return GenericTool{
 		Type: GeminiToolType,
@@ -272,6 +563,7 @@ func NewGeminiTool(tool *genai.Tool) GenericTool {
 	}
 }
 
+// NewMistralTool wraps a Mistral tool, to be passed to a Mistral LLM.
 func NewMistralTool(tool mistral.Tool) GenericTool {
 	return GenericTool{
 		Type: MistralToolType,
@@ -279,9 +571,47 @@ func NewMistralTool(tool mistral.Tool) GenericTool {
 	}
 }
 
+// NewAnthropicTool wraps an Anthropic tool definition, to be passed to an Anthropic LLM.
 func NewAnthropicTool(tool anthropic.ToolDefinition) GenericTool {
 	return GenericTool{
 		Type: AnthropicToolType,
 		Tool: tool,
 	}
 }
+
+/*
+NewTool wraps a provider tool of any supported type (*genai.Tool, mistral.Tool or
+anthropic.ToolDefinition), setting its ToolType from the tool itself, so the type and
+the tool can't disagree. It returns an error for any other type.
+*/
+func NewTool(tool interface{}) (GenericTool, error) {
+	switch t := tool.(type) {
+	case *genai.Tool:
+		return NewGeminiTool(t), nil
+	case mistral.Tool:
+		return NewMistralTool(t), nil
+	case anthropic.ToolDefinition:
+		return NewAnthropicTool(t), nil
+	default:
+		return GenericTool{}, fmt.Errorf("error: unsupported tool type %T", tool)
+	}
+}
+
+/*
+NewAnthropicStructuredOutputTool creates an Anthropic tool whose input schema is the given JSON schema.
+
+Forcing the model to call this tool (by setting GenerateOptions.ToolChoice to its name) makes
+Anthropic return its answer as the tool input, which is guaranteed to be a JSON object and is
+a more reliable way of getting structured output than asking for JSON in the prompt.
+*/
+func NewAnthropicStructuredOutputTool(name, description, schema string) (GenericTool, error) {
+	if !json.Valid([]byte(schema)) {
+		return GenericTool{}, fmt.Errorf("error: invalid JSON schema for tool %s", name)
+	}
+
+	return NewAnthropicTool(anthropic.ToolDefinition{
+		Name:        name,
+		Description: description,
+		InputSchema: json.RawMessage(schema),
+	}), nil
+}
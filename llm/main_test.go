@@ -2,6 +2,9 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/gage-technologies/mistral-go"
@@ -14,7 +17,41 @@ type mockMistralClient struct{}
 
 func (m *mockMistralClient) Chat(model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error) {
 	return &mistral.ChatCompletionResponse{
-		Choices: []mistral.ChatCompletionResponseChoice{{Message: mistral.ChatMessage{Content: "Mistral Response"}}}}, nil
+		Model: "mistral-small-2409",
+		Usage: mistral.UsageInfo{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30},
+		Choices: []mistral.ChatCompletionResponseChoice{{
+			Message:      mistral.ChatMessage{Content: "Mistral Response"},
+			FinishReason: mistral.FinishReasonStop,
+		}}}, nil
+}
+
+type mockGeminiClient struct {
+	model         *genai.GenerativeModel
+	history       []*genai.Content
+	parts         []genai.Part
+	cachedContent *genai.CachedContent
+}
+
+func (m *mockGeminiClient) GenerativeModel(name string) *genai.GenerativeModel {
+	return new(genai.Client).GenerativeModel(name)
+}
+
+func (m *mockGeminiClient) CreateCachedContent(ctx context.Context, cc *genai.CachedContent) (*genai.CachedContent, error) {
+	m.cachedContent = cc
+	return &genai.CachedContent{Name: "cachedContents/test-cache", Model: cc.Model}, nil
+}
+
+func (m *mockGeminiClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	m.model = model
+	m.history = history
+	m.parts = parts
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Content:      &genai.Content{Parts: []genai.Part{genai.Text("Gemini Response")}},
+			FinishReason: genai.FinishReasonStop,
+		}},
+		UsageMetadata: &genai.UsageMetadata{PromptTokenCount: 8, CandidatesTokenCount: 16, TotalTokenCount: 24},
+	}, nil
 }
 
 type mockAnthropicClient struct{}
@@ -22,7 +59,10 @@ type mockAnthropicClient struct{}
 func (m *mockAnthropicClient) CreateMessages(ctx context.Context, request anthropic.MessagesRequest) (response anthropic.MessagesResponse, err error) {
 	text := "Anthropic Response"
 	return anthropic.MessagesResponse{
-		Content: []anthropic.MessageContent{{Text: &text}},
+		Model:      "claude-3-5-sonnet-20240620",
+		StopReason: anthropic.MessagesStopReasonEndTurn,
+		Content:    []anthropic.MessageContent{{Text: &text}},
+		Usage:      anthropic.MessagesUsage{InputTokens: 12, OutputTokens: 34},
 	}, nil
 }
 
@@ -139,3 +179,504 @@ func TestGenerateTextWithInvalidTools(t *testing.T) {
 		t.Errorf("Expected error for invalid tool type, got nil")
 	}
 }
+
+func TestGeminiCachedContent(t *testing.T) {
+	client := &mockGeminiClient{}
+	llm := &geminiLLM{
+		modelName:   "gemini-1.5-pro-exp-0801",
+		temperature: 0.7,
+		maxTokens:   512,
+		topP:        1,
+		client:      client,
+	}
+
+	name, err := llm.CacheContent(context.Background(), "Respond in the following JSON schema: {}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("gemini-1.5-pro-exp-0801", client.cachedContent.Model); diff != "" {
+		t.Errorf("CacheContent() model mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{CachedContent: name}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("cachedContents/test-cache", client.model.CachedContentName); diff != "" {
+		t.Errorf("GenerateText() cached content mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without a cached content reference the model is used inline
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.model.CachedContentName != "" {
+		t.Errorf("Expected no cached content, got %q", client.model.CachedContentName)
+	}
+}
+
+func TestCacheContent(t *testing.T) {
+	gemini := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", client: &mockGeminiClient{}}
+	name, err := CacheContent(context.Background(), gemini, "Respond in the following JSON schema: {}")
+	if err != nil || name != "cachedContents/test-cache" {
+		t.Errorf("CacheContent() = %q, %v, want the handle of the cached content", name, err)
+	}
+
+	// Models that can't cache content report it
+	if _, err := CacheContent(context.Background(), &anthropicLLM{}, "{}"); !errors.Is(err, ErrContentCachingNotSupported) {
+		t.Errorf("Expected ErrContentCachingNotSupported, got %v", err)
+	}
+}
+
+type mockAnthropicToolUseClient struct {
+	request anthropic.MessagesRequest
+}
+
+func (m *mockAnthropicToolUseClient) CreateMessages(ctx context.Context, request anthropic.MessagesRequest) (response anthropic.MessagesResponse, err error) {
+	m.request = request
+	return anthropic.MessagesResponse{
+		Content: []anthropic.MessageContent{{
+			Type: anthropic.MessagesContentTypeToolUse,
+			MessageContentToolUse: &anthropic.MessageContentToolUse{
+				ID:    "toolu_01",
+				Name:  "record_insights",
+				Input: json.RawMessage(`{"overall_assessment":"Good performance","questions_answered_correctly":8}`),
+			},
+		}},
+		StopReason: anthropic.MessagesStopReasonToolUse,
+	}, nil
+}
+
+func TestGenerateTextWithForcedTool(t *testing.T) {
+	client := &mockAnthropicToolUseClient{}
+	llm := &anthropicLLM{
+		modelName:   anthropic.ModelClaudeInstant1Dot2,
+		temperature: 0.7,
+		maxTokens:   512,
+		topP:        1,
+		client:      client,
+	}
+
+	tool, err := NewAnthropicStructuredOutputTool("record_insights", "Record insights", `{"type": "object"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{
+		Tools:      []GenericTool{tool},
+		ToolChoice: "record_insights",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := `{"overall_assessment":"Good performance","questions_answered_correctly":8}`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GenerateText() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&anthropic.ToolChoice{Type: "tool", Name: "record_insights"}, client.request.ToolChoice); diff != "" {
+		t.Errorf("GenerateText() tool choice mismatch (-want +got):\n%s", diff)
+	}
+
+	// A forced tool that was not called is an error
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{
+		Tools:      []GenericTool{tool},
+		ToolChoice: "other_tool",
+	}); err == nil {
+		t.Errorf("Expected error when the forced tool is not called, got nil")
+	}
+}
+
+func TestNewAnthropicStructuredOutputToolWithInvalidSchema(t *testing.T) {
+	if _, err := NewAnthropicStructuredOutputTool("record_insights", "Record insights", `{"type":`); err == nil {
+		t.Errorf("Expected error for invalid schema, got nil")
+	}
+}
+
+func TestGeminiSystemInstruction(t *testing.T) {
+	client := &mockGeminiClient{}
+	llm := &geminiLLM{
+		modelName:   "gemini-1.5-pro-exp-0801",
+		temperature: 0.7,
+		maxTokens:   512,
+		topP:        1,
+		client:      client,
+	}
+
+	got, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{SystemPrompt: "You are an exam grader."})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("Gemini Response\n", got); diff != "" {
+		t.Errorf("GenerateText() mismatch (-want +got):\n%s", diff)
+	}
+
+	want := &genai.Content{Parts: []genai.Part{genai.Text("You are an exam grader.")}}
+	if diff := cmp.Diff(want, client.model.SystemInstruction); diff != "" {
+		t.Errorf("GenerateText() system instruction mismatch (-want +got):\n%s", diff)
+	}
+
+	// No system instruction is set when no system prompt is given
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.model.SystemInstruction != nil {
+		t.Errorf("Expected no system instruction, got %v", client.model.SystemInstruction)
+	}
+}
+
+// mockGeminiCandidatesClient answers with the given candidates.
+type mockGeminiCandidatesClient struct {
+	mockGeminiClient
+	candidates []*genai.Candidate
+}
+
+func (m *mockGeminiCandidatesClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	return &genai.GenerateContentResponse{Candidates: m.candidates}, nil
+}
+
+func TestGeminiNonTextParts(t *testing.T) {
+	functionCall := genai.FunctionCall{Name: "record_insights", Args: map[string]any{"overall_assessment": "Good"}}
+
+	tests := []struct {
+		name       string
+		candidates []*genai.Candidate
+		want       string
+		wantErr    bool
+	}{
+		{
+			name: "Only non-text parts",
+			candidates: []*genai.Candidate{{
+				Content:      &genai.Content{Parts: []genai.Part{functionCall, genai.Text("")}},
+				FinishReason: genai.FinishReasonStop,
+			}},
+			wantErr: true,
+		},
+		{
+			name: "Several candidates without text",
+			candidates: []*genai.Candidate{
+				{Content: &genai.Content{Parts: []genai.Part{functionCall}}},
+				{Content: nil, FinishReason: genai.FinishReasonOther},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Non-text parts skipped",
+			candidates: []*genai.Candidate{{
+				Content: &genai.Content{Parts: []genai.Part{genai.Text(`{"overall_assessment":`), functionCall, genai.Text(` "Good"}`)}},
+			}},
+			want: "{\"overall_assessment\":\n \"Good\"}\n",
+		},
+		{
+			name: "First candidate with text",
+			candidates: []*genai.Candidate{
+				{Content: &genai.Content{Parts: []genai.Part{functionCall}}},
+				{Content: &genai.Content{Parts: []genai.Part{genai.Text("Gemini Response")}}},
+			},
+			want: "Gemini Response\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", client: &mockGeminiCandidatesClient{candidates: tt.candidates}}
+			got, err := llm.GenerateText(context.Background(), "Test prompt", nil)
+			if tt.wantErr != errors.Is(err, ErrNoText) {
+				t.Fatalf("GenerateText() error = %v, want ErrNoText %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("GenerateText() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGeminiTopK(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []lLMOption
+		want *int32
+	}{
+		{name: "Default", want: genai.Ptr[int32](64)},
+		{name: "Enabled", opts: []lLMOption{WithTopK(40)}, want: genai.Ptr[int32](40)},
+		{name: "Disabled", opts: []lLMOption{WithGeminiTopKDisabled()}},
+		{name: "Negative", opts: []lLMOption{WithTopK(-1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockGeminiClient{}
+			llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 0.9, topK: 64, client: client}
+			for _, opt := range tt.opts {
+				opt(llm)
+			}
+
+			if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, client.model.TopK); diff != "" {
+				t.Errorf("GenerateText() top-k mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGeminiGenerationConfigOverride(t *testing.T) {
+	schema := &genai.Schema{
+		Type:       genai.TypeObject,
+		Properties: map[string]*genai.Schema{"overall_assessment": {Type: genai.TypeString}},
+	}
+	client := &mockGeminiClient{}
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", temperature: 0.7, maxTokens: 512, topP: 0.9, topK: 64, client: client}
+	WithGeminiGenerationConfigOverride(genai.GenerationConfig{
+		StopSequences:    []string{"END"},
+		Temperature:      genai.Ptr[float32](0.2),
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   schema,
+	})(llm)
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The overridden fields are applied, the configured ones fill the others
+	want := genai.GenerationConfig{
+		StopSequences:    []string{"END"},
+		MaxOutputTokens:  genai.Ptr[int32](512),
+		Temperature:      genai.Ptr[float32](0.2),
+		TopP:             genai.Ptr[float32](0.9),
+		TopK:             genai.Ptr[int32](64),
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   schema,
+	}
+	if diff := cmp.Diff(want, client.model.GenerationConfig); diff != "" {
+		t.Errorf("GenerateText() generation config mismatch (-want +got):\n%s", diff)
+	}
+
+	// The maximum number of tokens of a call takes precedence
+	llm.generationConfig.MaxOutputTokens = genai.Ptr[int32](1024)
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{MaxTokens: 2048}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(genai.Ptr[int32](2048), client.model.MaxOutputTokens); diff != "" {
+		t.Errorf("GenerateText() max tokens mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// mockAnthropicRecordingClient records the last request it received.
+type mockAnthropicRecordingClient struct {
+	request anthropic.MessagesRequest
+}
+
+func (m *mockAnthropicRecordingClient) CreateMessages(ctx context.Context, request anthropic.MessagesRequest) (response anthropic.MessagesResponse, err error) {
+	m.request = request
+	text := "Anthropic Response"
+	return anthropic.MessagesResponse{
+		Content: []anthropic.MessageContent{{Text: &text}},
+	}, nil
+}
+
+func TestAnthropicTopK(t *testing.T) {
+	client := &mockAnthropicRecordingClient{}
+	llm := &anthropicLLM{modelName: anthropic.ModelClaudeInstant1Dot2, maxTokens: 512, topP: 1, client: client}
+
+	// Unset by default
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.request.TopK != nil {
+		t.Errorf("Expected no top-k, got %v", *client.request.TopK)
+	}
+
+	WithTopK(10)(llm)
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.request.TopK == nil || *client.request.TopK != 10 {
+		t.Errorf("Expected top-k 10, got %v", client.request.TopK)
+	}
+
+	// Mistral has no top-k, the option is ignored
+	mistralModel := &mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}}
+	WithTopK(10)(mistralModel)
+	if diff := cmp.Diff(&mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}}, mistralModel, cmp.AllowUnexported(mistralLLM{})); diff != "" {
+		t.Errorf("WithTopK() changed Mistral LLM (-want +got):\n%s", diff)
+	}
+}
+
+// mockGeminiSafetyClient blocks the first response for safety and records the prompts it receives.
+type mockGeminiSafetyClient struct {
+	mockGeminiClient
+	prompts []string
+}
+
+func (m *mockGeminiSafetyClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	m.prompts = append(m.prompts, fmt.Sprint(parts[0]))
+	if len(m.prompts) == 1 {
+		return nil, &genai.BlockedError{Candidate: &genai.Candidate{FinishReason: genai.FinishReasonSafety}}
+	}
+	return m.mockGeminiClient.SendMessage(ctx, model, history, parts...)
+}
+
+func TestGeminiCandidateSafetyFallback(t *testing.T) {
+	soften := func(prompt string) string { return "Politely, " + prompt }
+
+	tests := []struct {
+		name        string
+		opts        []lLMOption
+		want        string
+		wantErr     bool
+		wantPrompts []string
+	}{
+		{
+			name:        "Retried with the transformed prompt",
+			opts:        []lLMOption{WithGeminiCandidateSafetyFallback(soften)},
+			want:        "Gemini Response\n",
+			wantPrompts: []string{"Test prompt", "Politely, Test prompt"},
+		},
+		{
+			name:        "Blocked without fallback",
+			wantErr:     true,
+			wantPrompts: []string{"Test prompt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockGeminiSafetyClient{}
+			llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: client}
+			for _, opt := range tt.opts {
+				opt(llm)
+			}
+
+			got, err := llm.GenerateText(context.Background(), "Test prompt", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("GenerateText() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantPrompts, client.prompts); diff != "" {
+				t.Errorf("GenerateText() prompts mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateTextWithMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		llm      LanguageModel
+		want     string
+		wantMeta ResponseMeta
+	}{
+		{
+			name:     "Anthropic",
+			llm:      &anthropicLLM{modelName: "claude-3-5-sonnet-latest", client: &mockAnthropicClient{}},
+			want:     "Anthropic Response",
+			wantMeta: ResponseMeta{ModelVersion: "claude-3-5-sonnet-20240620", FinishReason: "end_turn", Reason: FinishReasonStop, InputTokens: 12, OutputTokens: 34},
+		},
+		{
+			name:     "Mistral",
+			llm:      &mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}},
+			want:     "Mistral Response",
+			wantMeta: ResponseMeta{ModelVersion: "mistral-small-2409", FinishReason: "stop", Reason: FinishReasonStop, InputTokens: 10, OutputTokens: 20},
+		},
+		{
+			name:     "Gemini",
+			llm:      &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: &mockGeminiClient{}},
+			want:     "Gemini Response\n",
+			wantMeta: ResponseMeta{ModelVersion: "gemini-1.5-pro-exp-0801", FinishReason: "FinishReasonStop", Reason: FinishReasonStop, InputTokens: 8, OutputTokens: 16},
+		},
+		{
+			name: "Model without metadata",
+			llm:  &mockLanguageModel{response: "Mock Response"},
+			want: "Mock Response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, meta, err := GenerateTextWithMetadata(context.Background(), tt.llm, "Test prompt", nil)
+			if err != nil {
+				t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GenerateTextWithMetadata() = %q, want %q", got, tt.want)
+			}
+			if diff := cmp.Diff(tt.wantMeta, meta); diff != "" {
+				t.Errorf("GenerateTextWithMetadata() meta mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGeminiInlineData(t *testing.T) {
+	client := &mockGeminiClient{}
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: client}
+
+	diagram := []byte{0x89, 'P', 'N', 'G'}
+	opts := &GenerateOptions{InlineData: []InlineData{{MIMEType: "image/png", Data: diagram}}}
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", opts); err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+
+	want := []genai.Part{genai.Text("Test prompt"), genai.Blob{MIMEType: "image/png", Data: diagram}}
+	if diff := cmp.Diff(want, client.parts); diff != "" {
+		t.Errorf("Sent parts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestInlineDataNotSupported(t *testing.T) {
+	opts := &GenerateOptions{InlineData: []InlineData{{MIMEType: "image/png", Data: []byte{0x89}}}}
+
+	for name, llm := range map[string]LanguageModel{
+		"Anthropic": &anthropicLLM{modelName: "claude-3-5-sonnet-latest", client: &mockAnthropicClient{}},
+		"Mistral":   &mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := llm.GenerateText(context.Background(), "Test prompt", opts); !errors.Is(err, ErrInlineDataNotSupported) {
+				t.Errorf("Expected ErrInlineDataNotSupported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestToolConstructors(t *testing.T) {
+	geminiTool := &genai.Tool{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: "test_function"}}}
+	mistralTool := mistral.Tool{Type: mistral.ToolTypeFunction, Function: mistral.Function{Name: "test_function"}}
+	anthropicTool := anthropic.ToolDefinition{Name: "test_function"}
+
+	tests := []struct {
+		name     string
+		tool     interface{}
+		got      GenericTool
+		wantType ToolType
+	}{
+		{"Gemini", geminiTool, NewGeminiTool(geminiTool), GeminiToolType},
+		{"Mistral", mistralTool, NewMistralTool(mistralTool), MistralToolType},
+		{"Anthropic", anthropicTool, NewAnthropicTool(anthropicTool), AnthropicToolType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.Type != tt.wantType {
+				t.Errorf("Type = %d, want %d", tt.got.Type, tt.wantType)
+			}
+			if diff := cmp.Diff(tt.tool, tt.got.Tool); diff != "" {
+				t.Errorf("Tool mismatch (-want +got):\n%s", diff)
+			}
+
+			generic, err := NewTool(tt.tool)
+			if err != nil {
+				t.Fatalf("NewTool() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.got, generic); diff != "" {
+				t.Errorf("NewTool() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := NewTool("not a tool"); err == nil {
+		t.Error("NewTool() expected an error for an unsupported tool type")
+	}
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"log"
+	"strings"
+)
+
+/*
+maxTokensCeilings are the known output token limits of the models of each provider, keyed by
+model name prefix: the longest prefix matching a model name applies, e.g. "gpt-4o-mini" over
+"gpt-4o". Requests asking for more are rejected by the providers. Models missing from the
+table aren't clamped.
+*/
+var maxTokensCeilings = map[string]map[string]int{
+	ProviderGemini: {
+		"gemini-1.0-pro":   2048,
+		"gemini-pro":       2048,
+		"gemini-1.5-pro":   8192,
+		"gemini-1.5-flash": 8192,
+	},
+	ProviderAnthropic: {
+		"claude-instant-1":  4096,
+		"claude-2":          4096,
+		"claude-3-haiku":    4096,
+		"claude-3-sonnet":   4096,
+		"claude-3-opus":     4096,
+		"claude-3-5-haiku":  8192,
+		"claude-3-5-sonnet": 8192,
+	},
+	ProviderOpenAI: {
+		"gpt-4o":            4096,
+		"gpt-4o-2024-08-06": 16384,
+		"gpt-4o-mini":       16384,
+		"gpt-4-turbo":       4096,
+		"gpt-3.5-turbo":     4096,
+	},
+}
+
+// MaxTokensCeiling returns the output token limit of the model of the provider (an empty
+// provider being Gemini), and whether it is known.
+func MaxTokensCeiling(provider, model string) (int, bool) {
+	if provider == "" {
+		provider = ProviderGemini
+	}
+	ceiling, prefixLen := 0, -1
+	for prefix, limit := range maxTokensCeilings[provider] {
+		if strings.HasPrefix(model, prefix) && len(prefix) > prefixLen {
+			ceiling, prefixLen = limit, len(prefix)
+		}
+	}
+	return ceiling, prefixLen >= 0
+}
+
+// ClampMaxTokens returns maxTokens, capped by the output token limit of the model of the
+// provider when it is known, logging a warning when it is over the limit.
+func ClampMaxTokens(provider, model string, maxTokens int) int {
+	ceiling, ok := MaxTokensCeiling(provider, model)
+	if !ok || maxTokens <= ceiling {
+		return maxTokens
+	}
+	log.Printf("Warning: %d max tokens is over the %d limit of %s, clamping it", maxTokens, ceiling, model)
+	return ceiling
+}
+
+/*
+WithProviderSpecificMaxTokensClamp creates an lLMOption that caps the maximum number of tokens
+of the model by the output token limit of the model in the ceiling table, with a logged
+warning, rather than letting the provider reject the requests. It has to be applied after
+the model name and maximum number of tokens are set, e.g. after WithConfig.
+
+Per-call GenerateOptions.MaxTokens aren't clamped: clamp them with ClampMaxTokens.
+*/
+func WithProviderSpecificMaxTokensClamp() lLMOption {
+	return func(l interface{}) {
+		switch v := l.(type) {
+		case *geminiLLM:
+			v.maxTokens = ClampMaxTokens(ProviderGemini, v.modelName, v.maxTokens)
+		case *anthropicLLM:
+			v.maxTokens = ClampMaxTokens(ProviderAnthropic, v.modelName, v.maxTokens)
+		case *mistralLLM:
+			v.maxTokens = ClampMaxTokens(ProviderMistral, v.modelName, v.maxTokens)
+		case *openAILLM:
+			v.maxTokens = ClampMaxTokens(ProviderOpenAI, v.modelName, v.maxTokens)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package llm
+
+import "testing"
+
+func TestWithProviderSpecificMaxTokensClamp(t *testing.T) {
+	t.Setenv("CLAUDE_API_KEY", "claude-key")
+
+	// An over-limit configuration is clamped to the model's ceiling
+	model, err := NewLanguageModel(LLMConfig{Provider: ProviderAnthropic, Model: "claude-3-opus-20240229", MaxTokens: 8192}, WithProviderSpecificMaxTokensClamp())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if maxTokens := model.(*anthropicLLM).maxTokens; maxTokens != 4096 {
+		t.Errorf("Expected max tokens clamped to 4096, got %d", maxTokens)
+	}
+
+	// A configuration within the limit is kept
+	model, err = NewLanguageModel(LLMConfig{Provider: ProviderAnthropic, Model: "claude-3-5-sonnet-20240620", MaxTokens: 8192}, WithProviderSpecificMaxTokensClamp())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if maxTokens := model.(*anthropicLLM).maxTokens; maxTokens != 8192 {
+		t.Errorf("Expected max tokens of 8192, got %d", maxTokens)
+	}
+}
+
+func TestClampMaxTokens(t *testing.T) {
+	testCases := []struct {
+		name      string
+		provider  string
+		model     string
+		maxTokens int
+		expected  int
+	}{
+		{name: "Over the limit", provider: ProviderOpenAI, model: "gpt-4o-2024-05-13", maxTokens: 8192, expected: 4096},
+		{name: "Longest prefix", provider: ProviderOpenAI, model: "gpt-4o-mini", maxTokens: 8192, expected: 8192},
+		{name: "Default provider", model: "gemini-1.0-pro-002", maxTokens: 8192, expected: 2048},
+		{name: "Unknown model", provider: ProviderMistral, model: "mistral-large-latest", maxTokens: 100000, expected: 100000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ClampMaxTokens(tc.provider, tc.model, tc.maxTokens); got != tc.expected {
+				t.Errorf("ClampMaxTokens() = %d, expected %d", got, tc.expected)
+			}
+		})
+	}
+}
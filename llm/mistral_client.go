@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/gage-technologies/mistral-go"
 )
@@ -17,6 +18,12 @@ type MistralClient interface {
 	Chat(model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error)
 }
 
+// mistralContextClient is implemented by the MistralClients that can bind a chat request to the
+// caller's context, so it is canceled along with the call. The mistral-go client can't.
+type mistralContextClient interface {
+	ChatWithContext(ctx context.Context, model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error)
+}
+
 /*
 mistralLLM represents a Mistral Large Language Model.
 
@@ -37,6 +44,12 @@ Fields:
 	topP: Sets the nucleus sampling threshold for the generated text.
 	      This parameter controls the diversity of the generated text.
 
+	safePrompt: Prepends Mistral's guardrailing system prompt when true.
+
+	randomSeed: The seed used for sampling, 0 leaves it to the API.
+
+	tools: The tools passed with the calls without tools of their own, set with WithTools.
+
 	client: An instance of the MistralClient interface, used to interact with the Mistral API.
 */
 type mistralLLM struct {
@@ -44,6 +57,9 @@ type mistralLLM struct {
 	temperature float64
 	maxTokens   int
 	topP        float64
+	safePrompt  bool
+	randomSeed  int
+	tools       []GenericTool
 	client      MistralClient
 }
 
@@ -67,32 +83,76 @@ Returns:
 	A string containing the generated text and an error if any occurred.
 */
 func (m *mistralLLM) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := m.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata is GenerateText, also returning the model version and finish reason of the response.
+func (m *mistralLLM) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	if opts != nil && len(opts.InlineData) > 0 {
+		return "", ResponseMeta{}, fmt.Errorf("%w by Mistral LLM", ErrInlineDataNotSupported)
+	}
+
 	// Tool handling
 	var mistralTools []mistral.Tool
-	if opts != nil && len(opts.Tools) > 0 {
-		for _, genericTool := range opts.Tools {
+	if tools := opts.tools(m.tools); len(tools) > 0 {
+		for _, genericTool := range tools {
 			if genericTool.Type != MistralToolType {
-				return "", fmt.Errorf("error: tool type mismatch for Mistral LLM")
+				return "", ResponseMeta{}, fmt.Errorf("error: tool type mismatch for Mistral LLM")
 			}
 			mistralTool, ok := genericTool.Tool.(mistral.Tool)
 			if !ok {
-				return "", fmt.Errorf("error: invalid tool type for Mistral LLM")
+				return "", ResponseMeta{}, fmt.Errorf("error: invalid tool type for Mistral LLM")
 			}
 			mistralTools = append(mistralTools, mistralTool)
 		}
 	}
 
+	// System prompt goes first as a system message
+	messages := []mistral.ChatMessage{{Content: prompt, Role: mistral.RoleUser}}
+	if opts != nil && opts.SystemPrompt != "" {
+		messages = append([]mistral.ChatMessage{{Content: opts.SystemPrompt, Role: mistral.RoleSystem}}, messages...)
+	}
+
 	// Using chat completion
-	resp, err := m.client.Chat(m.modelName, []mistral.ChatMessage{{Content: prompt, Role: mistral.RoleUser}}, &mistral.ChatRequestParams{
+	params := &mistral.ChatRequestParams{
 		Temperature: m.temperature,
-		MaxTokens:   m.maxTokens,
+		MaxTokens:   opts.maxTokens(m.maxTokens),
 		TopP:        m.topP,
+		RandomSeed:  m.randomSeed,
+		SafePrompt:  m.safePrompt,
 		Tools:       mistralTools,
-	})
+	}
+	var (
+		resp *mistral.ChatCompletionResponse
+		err  error
+	)
+	if client, ok := m.client.(mistralContextClient); ok {
+		resp, err = client.ChatWithContext(ctx, m.modelName, messages, params)
+	} else {
+		resp, err = m.client.Chat(m.modelName, messages, params)
+	}
 	if err != nil {
-		return "", fmt.Errorf("error getting chat completion: %w", err)
+		if isMistralAuthError(err) {
+			return "", ResponseMeta{}, fmt.Errorf("%w: error getting chat completion: %w", ErrAuthentication, err)
+		}
+		return "", ResponseMeta{}, fmt.Errorf("error getting chat completion: %w", err)
 	}
 
 	// Return generated text
-	return resp.Choices[0].Message.Content, nil
+	meta := ResponseMeta{
+		ModelVersion: resp.Model,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		Reason:       mistralFinishReason(resp.Choices[0].FinishReason),
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+	}
+	return resp.Choices[0].Message.Content, meta, nil
+}
+
+// isMistralAuthError reports whether err is the Mistral API rejecting the API key.
+// The Mistral client only reports the HTTP status in the error message.
+func isMistralAuthError(err error) bool {
+	message := err.Error()
+	return strings.HasPrefix(message, "(HTTP Error 401)") || strings.HasPrefix(message, "(HTTP Error 403)")
 }
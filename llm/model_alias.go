@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ErrUnknownModelAlias is returned for a model alias without a pinned version to resolve to.
+var ErrUnknownModelAlias = errors.New("unknown model alias")
+
+// DefaultGeminiModelAliases maps the Gemini model aliases to the pinned versions they resolve to,
+// unless LLMConfig.ModelAliases maps them to another one.
+var DefaultGeminiModelAliases = map[string]string{
+	"gemini-1.5-pro-latest":   "gemini-1.5-pro-002",
+	"gemini-1.5-flash-latest": "gemini-1.5-flash-002",
+	"gemini-1.5-pro":          "gemini-1.5-pro-002",
+	"gemini-1.5-flash":        "gemini-1.5-flash-002",
+}
+
+/*
+ResolveGeminiModel returns the pinned version of a Gemini model alias, looked up in aliases
+first and then in DefaultGeminiModelAliases. Other model names are returned unchanged, except
+the "-latest" aliases missing from both tables, which return an ErrUnknownModelAlias.
+
+Aliases are resolved once, when the model is created, so a retired alias fails the run
+right away instead of failing requests mid-stream.
+*/
+func ResolveGeminiModel(model string, aliases map[string]string) (string, error) {
+	pinned, ok := aliases[model]
+	if !ok {
+		pinned, ok = DefaultGeminiModelAliases[model]
+	}
+	if ok {
+		log.Printf("Resolved Gemini model alias %s to %s", model, pinned)
+		return pinned, nil
+	}
+
+	if strings.HasSuffix(model, "-latest") {
+		return "", fmt.Errorf("%w %q, add it to model_aliases with the pinned version to use", ErrUnknownModelAlias, model)
+	}
+	return model, nil
+}
+
+// IsUnknownModelAlias reports whether err is caused by a model alias that couldn't be resolved.
+func IsUnknownModelAlias(err error) bool {
+	return errors.Is(err, ErrUnknownModelAlias)
+}
@@ -0,0 +1,43 @@
+package llm
+
+import "testing"
+
+func TestResolveGeminiModel(t *testing.T) {
+	aliases := map[string]string{"gemini-1.5-pro-latest": "gemini-1.5-pro-001", "gemini-experimental-latest": "gemini-exp-1114"}
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{name: "Configured alias", model: "gemini-experimental-latest", want: "gemini-exp-1114"},
+		{name: "Configured alias overrides the default", model: "gemini-1.5-pro-latest", want: "gemini-1.5-pro-001"},
+		{name: "Default alias", model: "gemini-1.5-flash-latest", want: "gemini-1.5-flash-002"},
+		{name: "Pinned version", model: "gemini-1.5-pro-exp-0801", want: "gemini-1.5-pro-exp-0801"},
+		{name: "Provider default", model: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveGeminiModel(tt.model, aliases)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveGeminiModel(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveGeminiModel_UnknownAlias(t *testing.T) {
+	if _, err := ResolveGeminiModel("gemini-1.0-ultra-latest", nil); !IsUnknownModelAlias(err) {
+		t.Errorf("Expected an unknown model alias error, got %v", err)
+	}
+
+	// The model isn't created with an unknown alias, whatever the API key
+	t.Setenv("GEMINI_API_KEY", "gemini-key")
+	if _, err := NewLanguageModel(LLMConfig{Provider: ProviderGemini, Model: "gemini-1.0-ultra-latest"}); !IsUnknownModelAlias(err) {
+		t.Errorf("Expected an unknown model alias error, got %v", err)
+	}
+}
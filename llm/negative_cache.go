@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Kinds of the deterministic failures a NegativeResponseCache stores.
+const (
+	FailureRefused        = "refused"
+	FailureRecitation     = "recitation"
+	FailureInvalidRequest = "invalid_request"
+)
+
+// CachedFailure is a deterministic failure of a call, stored in a NegativeResponseCache.
+type CachedFailure struct {
+	// Kind is the kind of failure: FailureRefused, FailureRecitation or FailureInvalidRequest.
+	Kind string
+	// Message is the error message of the failure.
+	Message string
+}
+
+/*
+NegativeResponseCache is implemented by the ResponseCaches that can also store the deterministic
+failures of the calls, for WithResponseCacheNegativeCaching. Failures are stored apart from the
+responses, so a failure never shadows a response, and expire after their TTL.
+*/
+type NegativeResponseCache interface {
+	// GetFailure returns the failure stored under key, unless it has expired, and whether there is one.
+	GetFailure(ctx context.Context, key string) (CachedFailure, bool, error)
+	// SetFailure stores the failure under key for ttl.
+	SetFailure(ctx context.Context, key string, failure CachedFailure, ttl time.Duration) error
+}
+
+// cachedFailureEntry is a failure of the in-memory cache, with its expiry.
+type cachedFailureEntry struct {
+	failure CachedFailure
+	expires time.Time
+}
+
+func (c *inMemoryResponseCache) GetFailure(ctx context.Context, key string) (CachedFailure, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.failures[key]
+	if !ok {
+		return CachedFailure{}, false, nil
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.failures, key)
+		return CachedFailure{}, false, nil
+	}
+	return entry.failure, true, nil
+}
+
+func (c *inMemoryResponseCache) SetFailure(ctx context.Context, key string, failure CachedFailure, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[key] = cachedFailureEntry{failure: failure, expires: c.now().Add(ttl)}
+	return nil
+}
+
+/*
+WithResponseCacheNegativeCaching creates an lLMOption that also caches, for ttl, the failures
+of the calls that fail the same way however often they are made, for caching models created
+with NewCachingModel: responses refused for safety or blocked for recitation, and requests
+rejected as invalid. Repeating such a call returns the cached failure, wrapping the same error
+(e.g. ErrRefused), without paying for the call again. Other failures, e.g. timeouts, are never
+cached.
+
+The ttl should be shorter than the lifetime of the responses: a failure may come from a
+provider setting since changed. Failures need a cache implementing NegativeResponseCache, such
+as NewInMemoryResponseCache, and are stored apart from the responses. 0 disables it.
+*/
+func WithResponseCacheNegativeCaching(ttl time.Duration) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*cachingModel); ok {
+			v.negativeTTL = ttl
+		}
+	}
+}
+
+// deterministicFailure returns the failure to cache for err, and whether err fails every time.
+func deterministicFailure(err error) (CachedFailure, bool) {
+	switch {
+	case IsRecitation(err):
+		return CachedFailure{Kind: FailureRecitation, Message: err.Error()}, true
+	case IsRefused(err):
+		return CachedFailure{Kind: FailureRefused, Message: err.Error()}, true
+	case IsInvalidRequest(err):
+		return CachedFailure{Kind: FailureInvalidRequest, Message: err.Error()}, true
+	default:
+		return CachedFailure{}, false
+	}
+}
+
+// Err returns the error of the failure, wrapping the error of its kind as the original one did.
+func (f CachedFailure) Err() error {
+	switch f.Kind {
+	case FailureRecitation:
+		return fmt.Errorf("%w: %w: cached failure: %s", ErrRefused, ErrRecitation, f.Message)
+	case FailureRefused:
+		return fmt.Errorf("%w: cached failure: %s", ErrRefused, f.Message)
+	case FailureInvalidRequest:
+		return fmt.Errorf("%w: cached failure: %s", ErrInvalidRequest, f.Message)
+	default:
+		return fmt.Errorf("cached failure: %s", f.Message)
+	}
+}
+
+// negativeCache returns the cache of the failures, when negative caching is enabled and supported.
+func (c *cachingModel) negativeCache() (NegativeResponseCache, bool) {
+	if c.negativeTTL <= 0 {
+		return nil, false
+	}
+	negative, ok := c.cache.(NegativeResponseCache)
+	return negative, ok
+}
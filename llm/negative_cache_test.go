@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingFailingModel fails every call with err, counting them.
+type countingFailingModel struct {
+	err   error
+	calls int
+}
+
+func (m *countingFailingModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	m.calls++
+	return "", m.err
+}
+
+func TestCachingModelNegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewInMemoryResponseCache().(*inMemoryResponseCache)
+	cache.now = func() time.Time { return now }
+
+	model := &countingFailingModel{err: fmt.Errorf("%w: gemini finish reason SAFETY", ErrRefused)}
+	cached := NewCachingModel(model, "gemini-1.5-pro-001", cache, "{}", WithResponseCacheNegativeCaching(time.Minute))
+
+	// The second identical call is served the failure from the negative cache
+	for i := 0; i < 2; i++ {
+		_, err := cached.GenerateText(ctx, "Assessment", nil)
+		if !IsRefused(err) {
+			t.Fatalf("Expected a refusal, got %v", err)
+		}
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected the repeated call to hit the negative cache, got %d model calls", model.calls)
+	}
+
+	// Failures are stored apart from the responses
+	if _, hit, _ := cache.Get(ctx, mustKey(t, cached, "Assessment")); hit {
+		t.Error("Expected no response cached for the failure")
+	}
+
+	// The failure expires after its TTL, and the call is made again
+	now = now.Add(time.Minute)
+	if _, err := cached.GenerateText(ctx, "Assessment", nil); !IsRefused(err) {
+		t.Fatalf("Expected a refusal, got %v", err)
+	}
+	if model.calls != 2 {
+		t.Errorf("Expected an expired failure to be missed, got %d model calls", model.calls)
+	}
+
+	// Recitations and invalid requests keep their kind from the cache
+	for _, err := range []error{
+		fmt.Errorf("%w: %w: gemini finish reason RECITATION", ErrRefused, ErrRecitation),
+		fmt.Errorf("%w: anthropic API error, type: invalid_request_error", ErrInvalidRequest),
+	} {
+		model.err = err
+		prompt := err.Error()
+		cached.GenerateText(ctx, prompt, nil)
+		_, cachedErr := cached.GenerateText(ctx, prompt, nil)
+		if IsRecitation(err) != IsRecitation(cachedErr) || IsRefused(err) != IsRefused(cachedErr) || IsInvalidRequest(err) != IsInvalidRequest(cachedErr) {
+			t.Errorf("Expected the cached failure to match %v, got %v", err, cachedErr)
+		}
+	}
+	if model.calls != 4 {
+		t.Errorf("Expected 4 model calls, got %d", model.calls)
+	}
+
+	// Transient failures are never cached
+	model.err = errors.New("connection reset by peer")
+	for i := 0; i < 2; i++ {
+		cached.GenerateText(ctx, "Transient", nil)
+	}
+	if model.calls != 6 {
+		t.Errorf("Expected transient failures to reach the model, got %d model calls", model.calls)
+	}
+
+	// Without the option, failures are not cached
+	plain := NewCachingModel(model, "gemini-1.5-pro-001", cache, "{}")
+	model.err = ErrRefused
+	for i := 0; i < 2; i++ {
+		plain.GenerateText(ctx, "Plain", nil)
+	}
+	if model.calls != 8 {
+		t.Errorf("Expected no negative caching by default, got %d model calls", model.calls)
+	}
+}
+
+// mustKey returns the cache key of the prompt without options.
+func mustKey(t *testing.T, model LanguageModel, prompt string) string {
+	t.Helper()
+	key, ok := model.(*cachingModel).key(prompt, nil)
+	if !ok {
+		t.Fatalf("Expected %q to be cacheable", prompt)
+	}
+	return key
+}
@@ -0,0 +1,353 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// openAIEndpoint is the base URL of the OpenAI API.
+const openAIEndpoint = "https://api.openai.com"
+
+/*
+OpenAIClient is an interface for interacting with the OpenAI API.
+
+It defines a single method, CreateChatCompletion, which sends a chat completion request
+to generate text based on a given prompt and model parameters.
+*/
+type OpenAIClient interface {
+	CreateChatCompletion(ctx context.Context, request OpenAIChatRequest) (*OpenAIChatResponse, error)
+}
+
+// OpenAIMessage is a message of an OpenAI chat.
+type OpenAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// OpenAIJSONSchema is the JSON schema a structured response must conform to.
+type OpenAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	// Strict guarantees the response conforms to the schema, for the schemas in OpenAI's supported subset.
+	Strict bool `json:"strict"`
+}
+
+// OpenAIResponseFormat is the format of an OpenAI response: "text", "json_object" or "json_schema".
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIChatRequest is an OpenAI chat completion request.
+type OpenAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []OpenAIMessage       `json:"messages"`
+	Temperature    float64               `json:"temperature"`
+	TopP           float64               `json:"top_p"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+	// Metadata and User tag the request for abuse monitoring and billing, see WithRequestMetadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	User     string            `json:"user,omitempty"`
+}
+
+// OpenAIChoice is a generated message of an OpenAI chat completion.
+type OpenAIChoice struct {
+	Message      OpenAIMessage `json:"message"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+// OpenAIUsage is the token usage of an OpenAI chat completion.
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// OpenAIChatResponse is an OpenAI chat completion response.
+type OpenAIChatResponse struct {
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   OpenAIUsage    `json:"usage"`
+}
+
+// openAIStatusError is an error response of the OpenAI API.
+type openAIStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *openAIStatusError) Error() string {
+	return fmt.Sprintf("(HTTP Error %d) %s", e.StatusCode, e.Body)
+}
+
+// openAIHTTPClient implements the OpenAIClient interface over an *http.Client.
+type openAIHTTPClient struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+// CreateChatCompletion sends a chat completion request to the OpenAI API.
+func (c *openAIHTTPClient) CreateChatCompletion(ctx context.Context, request OpenAIChatRequest) (*OpenAIChatResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating chat request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending chat request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		responseBytes, _ := io.ReadAll(resp.Body)
+		return nil, &openAIStatusError{StatusCode: resp.StatusCode, Body: string(responseBytes)}
+	}
+
+	var chatResponse OpenAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
+		return nil, fmt.Errorf("error decoding chat response: %w", err)
+	}
+
+	return &chatResponse, nil
+}
+
+/*
+openAILLM represents an OpenAI Large Language Model.
+
+It implements the LanguageModel interface, providing text generation capabilities
+using the OpenAI chat completions API.
+
+Fields:
+
+	modelName: The name of the OpenAI model to use for text generation, e.g. "gpt-4o-mini".
+
+	temperature: Controls the randomness of the generated text.
+
+	maxTokens: The maximum number of tokens allowed in the generated text.
+
+	topP: Sets the nucleus sampling threshold for the generated text.
+
+	responseSchema: The JSON schema of JSON responses, sent as a response format, strict when it allows it.
+
+	tools: The tools set with WithTools, rejected like the tools of a call.
+
+	metadata: The metadata tagging the requests, set with WithRequestMetadata.
+
+	client: An instance of the OpenAIClient interface, used to interact with the OpenAI API.
+*/
+type openAILLM struct {
+	modelName      string
+	temperature    float64
+	maxTokens      int
+	topP           float64
+	responseSchema *OpenAIJSONSchema
+	tools          []GenericTool
+	metadata       map[string]string
+	client         OpenAIClient
+}
+
+/*
+NewOpenAILLM creates a new instance of a LanguageModel using the OpenAI API.
+It takes a variable number of lLMOption arguments to customize the model's settings.
+
+The function initializes the OpenAI LLM with the following default settings:
+  - Model Name: "gpt-4o-mini"
+  - Temperature: 0.7
+  - Max Tokens: 512
+  - Top P: 1
+
+It automatically retrieves the OpenAI API key from the "OPENAI_API_KEY" environment variable.
+*/
+func NewOpenAILLM(opts ...lLMOption) LanguageModel {
+	httpClient := getHTTPClient()
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	llm := &openAILLM{
+		modelName:   "gpt-4o-mini",
+		temperature: 0.7,
+		maxTokens:   512,
+		topP:        1,
+		client: &openAIHTTPClient{
+			apiKey:     os.Getenv("OPENAI_API_KEY"),
+			endpoint:   openAIEndpoint,
+			httpClient: httpClient,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(llm)
+	}
+
+	return llm
+}
+
+/*
+WithResponseFormatJSONSchema creates an lLMOption that sends the given JSON schema as a response
+format (response_format: {type: "json_schema"}) with the requests whose ResponseMIMEType is
+"application/json". Schemas within OpenAI's strict mode subset (see openAIStrictSchema) are sent
+with strict: true, so the responses are guaranteed to conform to them; others, which the strict
+mode would reject, are sent with strict: false and only guide the responses.
+
+Other providers ignore this option.
+*/
+func WithResponseFormatJSONSchema(name string, schema string) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*openAILLM); ok {
+			v.responseSchema = &OpenAIJSONSchema{Name: name, Schema: json.RawMessage(schema), Strict: openAIStrictSchema(schema)}
+		}
+	}
+}
+
+// openAIStrictUnsupported are the keywords OpenAI's strict mode rejects.
+var openAIStrictUnsupported = []string{
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf",
+	"minLength", "maxLength", "pattern", "format",
+	"minItems", "maxItems", "uniqueItems", "contains",
+	"minProperties", "maxProperties", "patternProperties", "propertyNames", "unevaluatedProperties",
+}
+
+/*
+openAIStrictSchema reports whether the JSON schema is within OpenAI's strict mode subset: every
+object lists its properties, all of them required, and disallows additional ones, and none of
+the unsupported keywords is used. Objects used as maps, with additionalProperties schemas or no
+properties, are outside of it, as strict mode would force them to be empty.
+*/
+func openAIStrictSchema(schema string) bool {
+	var root map[string]any
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return false
+	}
+	return openAIStrictNode(root)
+}
+
+func openAIStrictNode(node map[string]any) bool {
+	for _, keyword := range openAIStrictUnsupported {
+		if _, ok := node[keyword]; ok {
+			return false
+		}
+	}
+
+	if node["type"] == "object" {
+		properties, _ := node["properties"].(map[string]any)
+		if len(properties) == 0 || node["additionalProperties"] != false {
+			return false
+		}
+		required := make(map[string]bool)
+		if list, ok := node["required"].([]any); ok {
+			for _, name := range list {
+				if name, ok := name.(string); ok {
+					required[name] = true
+				}
+			}
+		}
+		for name, property := range properties {
+			property, ok := property.(map[string]any)
+			if !required[name] || !ok || !openAIStrictNode(property) {
+				return false
+			}
+		}
+	}
+
+	if items, ok := node["items"].(map[string]any); ok && !openAIStrictNode(items) {
+		return false
+	}
+	for _, keyword := range []string{"anyOf", "allOf", "oneOf"} {
+		list, _ := node[keyword].([]any)
+		for _, sub := range list {
+			if sub, ok := sub.(map[string]any); !ok || !openAIStrictNode(sub) {
+				return false
+			}
+		}
+	}
+	for _, keyword := range []string{"$defs", "definitions"} {
+		defs, _ := node[keyword].(map[string]any)
+		for _, def := range defs {
+			if def, ok := def.(map[string]any); !ok || !openAIStrictNode(def) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GenerateText generates text using the OpenAI LLM based on the provided prompt and optional generation options.
+func (o *openAILLM) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := o.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata is GenerateText, also returning the model version and finish reason of the response.
+func (o *openAILLM) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	if opts != nil && len(opts.InlineData) > 0 {
+		return "", ResponseMeta{}, fmt.Errorf("%w by OpenAI LLM", ErrInlineDataNotSupported)
+	}
+	if len(opts.tools(o.tools)) > 0 {
+		return "", ResponseMeta{}, fmt.Errorf("error: tools are not supported by OpenAI LLM")
+	}
+
+	// System prompt goes first as a system message
+	messages := []OpenAIMessage{{Role: "user", Content: prompt}}
+	if opts != nil && opts.SystemPrompt != "" {
+		messages = append([]OpenAIMessage{{Role: "system", Content: opts.SystemPrompt}}, messages...)
+	}
+
+	// JSON responses conform to the response schema when one is set
+	var responseFormat *OpenAIResponseFormat
+	if opts != nil && opts.ResponseMIMEType == "application/json" {
+		responseFormat = &OpenAIResponseFormat{Type: "json_object"}
+		if o.responseSchema != nil {
+			responseFormat = &OpenAIResponseFormat{Type: "json_schema", JSONSchema: o.responseSchema}
+		}
+	}
+
+	resp, err := o.client.CreateChatCompletion(ctx, OpenAIChatRequest{
+		Model:          o.modelName,
+		Messages:       messages,
+		Temperature:    o.temperature,
+		TopP:           o.topP,
+		MaxTokens:      opts.maxTokens(o.maxTokens),
+		ResponseFormat: responseFormat,
+		Metadata:       o.metadata,
+		User:           o.metadata[RequestMetadataUserID],
+	})
+	if err != nil {
+		var statusErr *openAIStatusError
+		if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+			return "", ResponseMeta{}, fmt.Errorf("%w: error getting chat completion: %w", ErrAuthentication, err)
+		}
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusBadRequest {
+			return "", ResponseMeta{}, fmt.Errorf("%w: error getting chat completion: %w", ErrInvalidRequest, err)
+		}
+		return "", ResponseMeta{}, fmt.Errorf("error getting chat completion: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", ResponseMeta{}, fmt.Errorf("error: openai response has no choices")
+	}
+
+	// Return generated text
+	meta := ResponseMeta{
+		ModelVersion: resp.Model,
+		FinishReason: resp.Choices[0].FinishReason,
+		Reason:       openAIFinishReason(resp.Choices[0].FinishReason),
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+	}
+	return resp.Choices[0].Message.Content, meta, nil
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockOpenAIClient records the chat requests it receives.
+type mockOpenAIClient struct {
+	request  OpenAIChatRequest
+	response *OpenAIChatResponse
+	err      error
+}
+
+func (m *mockOpenAIClient) CreateChatCompletion(ctx context.Context, request OpenAIChatRequest) (*OpenAIChatResponse, error) {
+	m.request = request
+	return m.response, m.err
+}
+
+const testInsightsSchema = `{"type": "object", "properties": {"overall_assessment": {"type": "string"}}, "required": ["overall_assessment"], "additionalProperties": false}`
+
+func TestOpenAILLM_StrictResponseFormat(t *testing.T) {
+	client := &mockOpenAIClient{response: &OpenAIChatResponse{
+		Model:   "gpt-4o-mini-2024-07-18",
+		Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: `{"overall_assessment": "Good"}`}, FinishReason: "stop"}},
+		Usage:   OpenAIUsage{PromptTokens: 12, CompletionTokens: 5},
+	}}
+	llm := NewOpenAILLM(WithResponseFormatJSONSchema("insights", testInsightsSchema)).(*openAILLM)
+	llm.client = client
+
+	text, meta, err := llm.GenerateTextWithMetadata(context.Background(), "Assessment", &GenerateOptions{
+		SystemPrompt:     "You are an expert.",
+		ResponseMIMEType: "application/json",
+	})
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() returned error: %v", err)
+	}
+	assert.Equal(t, `{"overall_assessment": "Good"}`, text)
+	assert.Equal(t, ResponseMeta{ModelVersion: "gpt-4o-mini-2024-07-18", FinishReason: "stop", Reason: FinishReasonStop, InputTokens: 12, OutputTokens: 5}, meta)
+
+	// The insights schema is sent as a strict JSON schema response format
+	if client.request.ResponseFormat == nil || client.request.ResponseFormat.JSONSchema == nil {
+		t.Fatalf("Expected a JSON schema response format, got %+v", client.request.ResponseFormat)
+	}
+	assert.Equal(t, "json_schema", client.request.ResponseFormat.Type)
+	assert.Equal(t, "insights", client.request.ResponseFormat.JSONSchema.Name)
+	assert.True(t, client.request.ResponseFormat.JSONSchema.Strict)
+	assert.JSONEq(t, testInsightsSchema, string(client.request.ResponseFormat.JSONSchema.Schema))
+	assert.Equal(t, []OpenAIMessage{{Role: "system", Content: "You are an expert."}, {Role: "user", Content: "Assessment"}}, client.request.Messages)
+
+	// Text responses have no response format
+	_, err = llm.GenerateText(context.Background(), "Assessment", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, client.request.ResponseFormat)
+
+	// Without a schema, JSON responses use JSON mode
+	llm.responseSchema = nil
+	_, err = llm.GenerateText(context.Background(), "Assessment", &GenerateOptions{ResponseMIMEType: "application/json"})
+	assert.NoError(t, err)
+	assert.Equal(t, &OpenAIResponseFormat{Type: "json_object"}, client.request.ResponseFormat)
+}
+
+func TestOpenAILLM_InsightsSchemaResponseFormat(t *testing.T) {
+	schema, err := os.ReadFile("../insights_schema.json")
+	if err != nil {
+		t.Fatalf("Error reading the insights schema: %v", err)
+	}
+	client := &mockOpenAIClient{response: &OpenAIChatResponse{
+		Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "{}"}, FinishReason: "stop"}},
+	}}
+	llm := NewOpenAILLM(WithResponseFormatJSONSchema("insights", string(schema))).(*openAILLM)
+	llm.client = client
+
+	// The insights schema has maps (study_plans, actionable_feedback) and bounds outside of the
+	// strict subset, it is sent without strict mode rather than rejected by OpenAI
+	_, err = llm.GenerateText(context.Background(), "Assessment", &GenerateOptions{ResponseMIMEType: "application/json"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, client.request.ResponseFormat) && assert.NotNil(t, client.request.ResponseFormat.JSONSchema) {
+		assert.False(t, client.request.ResponseFormat.JSONSchema.Strict)
+		assert.JSONEq(t, string(schema), string(client.request.ResponseFormat.JSONSchema.Schema))
+	}
+}
+
+func TestOpenAIStrictSchema(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		schema string
+		want   bool
+	}{
+		{"closed object", testInsightsSchema, true},
+		{"optional property", `{"type": "object", "properties": {"a": {"type": "string"}}, "additionalProperties": false}`, false},
+		{"open object", `{"type": "object", "properties": {"a": {"type": "string"}}, "required": ["a"]}`, false},
+		{"map", `{"type": "object", "properties": {"a": {"type": "object", "additionalProperties": {"type": "string"}}}, "required": ["a"], "additionalProperties": false}`, false},
+		{"empty object", `{"type": "object", "properties": {"a": {"type": "object", "additionalProperties": false}}, "required": ["a"], "additionalProperties": false}`, false},
+		{"bound in items", `{"type": "array", "items": {"type": "number", "exclusiveMinimum": 0}}`, false},
+		{"closed items", `{"type": "array", "items": {"type": "object", "properties": {"a": {"type": "string"}}, "required": ["a"], "additionalProperties": false}}`, true},
+		{"invalid", `{`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, openAIStrictSchema(tc.schema))
+		})
+	}
+}
+
+func TestOpenAIHTTPClient_CreateChatCompletion(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, `{"error": {"message": "Incorrect API key provided"}}`, http.StatusUnauthorized)
+			return
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"model": "gpt-4o-mini", "choices": [{"message": {"role": "assistant", "content": "{}"}, "finish_reason": "length"}]}`))
+	}))
+	defer server.Close()
+
+	llm := &openAILLM{
+		modelName: "gpt-4o-mini",
+		maxTokens: 512,
+		topP:      1,
+		client:    &openAIHTTPClient{apiKey: "test-key", endpoint: server.URL, httpClient: server.Client()},
+	}
+	WithResponseFormatJSONSchema("insights", testInsightsSchema)(llm)
+
+	_, meta, err := llm.GenerateTextWithMetadata(context.Background(), "Assessment", &GenerateOptions{ResponseMIMEType: "application/json"})
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() returned error: %v", err)
+	}
+	assert.Equal(t, FinishReasonLength, meta.Reason)
+
+	// The strict schema is part of the request body
+	responseFormat := body["response_format"].(map[string]any)
+	assert.Equal(t, "json_schema", responseFormat["type"])
+	jsonSchema := responseFormat["json_schema"].(map[string]any)
+	assert.Equal(t, true, jsonSchema["strict"])
+	assert.Equal(t, "insights", jsonSchema["name"])
+	schema, _ := json.Marshal(jsonSchema["schema"])
+	assert.JSONEq(t, testInsightsSchema, string(schema))
+
+	// A rejected API key is an authentication error
+	llm.client.(*openAIHTTPClient).apiKey = "wrong-key"
+	_, err = llm.GenerateText(context.Background(), "Assessment", nil)
+	assert.True(t, IsAuthError(err), "Expected an authentication error, got %v", err)
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ProviderConfig holds the settings only one provider has, see WithProviderSpecificConfig.
+
+Values are held as strings, lists as JSON arrays of strings, so the LLMConfig of the DoFns can
+be encoded by Beam, which has no schema for interface{} values. In YAML they are written
+natively, e.g.:
+
+	provider_config:
+	  top_k: 8
+	  stop_sequences: ["\n\n\n"]
+*/
+type ProviderConfig map[string]string
+
+// UnmarshalYAML decodes the settings, keeping scalars as written and encoding lists of strings as JSON.
+func (c *ProviderConfig) UnmarshalYAML(value *yaml.Node) error {
+	var settings map[string]yaml.Node
+	if err := value.Decode(&settings); err != nil {
+		return err
+	}
+
+	config := make(ProviderConfig, len(settings))
+	for key, setting := range settings {
+		switch setting.Kind {
+		case yaml.ScalarNode:
+			config[key] = setting.Value
+		case yaml.SequenceNode:
+			var list []string
+			if err := setting.Decode(&list); err != nil {
+				return fmt.Errorf("provider_config.%s: %w", key, err)
+			}
+			encoded, err := json.Marshal(list)
+			if err != nil {
+				return fmt.Errorf("provider_config.%s: %w", key, err)
+			}
+			config[key] = string(encoded)
+		default:
+			return fmt.Errorf("provider_config.%s: expected a scalar or a list of strings", key)
+		}
+	}
+	*c = config
+	return nil
+}
+
+/*
+WithProviderSpecificConfig creates an lLMOption that applies the settings only one provider
+has, which LLMConfig has no field for. Each provider reads its own keys and ignores the others,
+so a single map can be shared across providers. Values of the wrong type are logged and ignored.
+
+Recognized keys:
+
+	gemini:
+	  top_k: int, overrides the top-k sampling limit (0 or less disables it).
+	  stop_sequences: list of strings that stop the generation.
+	  thinking_budget: int, the thinking budget of Gemini 2.5 models (see WithGeminiThinkingBudget).
+
+	anthropic:
+	  top_k: int, overrides the top-k sampling limit (0 or less leaves it unset).
+	  stop_sequences: list of strings that stop the generation.
+
+	mistral:
+	  safe_prompt: bool, prepends Mistral's guardrailing system prompt.
+	  random_seed: int, the seed used for sampling.
+*/
+func WithProviderSpecificConfig(cfg ProviderConfig) lLMOption {
+	return func(l interface{}) {
+		switch v := l.(type) {
+		case *geminiLLM:
+			if topK, ok := providerInt(cfg, "top_k"); ok {
+				v.topK = topK
+			}
+			if stop, ok := providerStrings(cfg, "stop_sequences"); ok {
+				v.stopSequences = stop
+			}
+			if budget, ok := providerInt(cfg, "thinking_budget"); ok {
+				WithGeminiThinkingBudget(budget)(v)
+			}
+		case *anthropicLLM:
+			if topK, ok := providerInt(cfg, "top_k"); ok {
+				v.topK = topK
+			}
+			if stop, ok := providerStrings(cfg, "stop_sequences"); ok {
+				v.stopSequences = stop
+			}
+		case *mistralLLM:
+			if safePrompt, ok := providerBool(cfg, "safe_prompt"); ok {
+				v.safePrompt = safePrompt
+			}
+			if seed, ok := providerInt(cfg, "random_seed"); ok {
+				v.randomSeed = seed
+			}
+		}
+	}
+}
+
+// providerInt reads an integer setting.
+func providerInt(cfg ProviderConfig, key string) (int, bool) {
+	value, ok := cfg[key]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Ignoring provider config %s: expected an integer, got %q", key, value)
+		return 0, false
+	}
+	return n, true
+}
+
+// providerBool reads a boolean setting.
+func providerBool(cfg ProviderConfig, key string) (bool, bool) {
+	value, ok := cfg[key]
+	if !ok {
+		return false, false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Ignoring provider config %s: expected a boolean, got %q", key, value)
+		return false, false
+	}
+	return b, true
+}
+
+// providerStrings reads a list of strings setting, held as a JSON array.
+func providerStrings(cfg ProviderConfig, key string) ([]string, bool) {
+	value, ok := cfg[key]
+	if !ok {
+		return nil, false
+	}
+
+	var strs []string
+	if err := json.Unmarshal([]byte(value), &strs); err != nil {
+		log.Printf("Ignoring provider config %s: expected a list of strings, got %q", key, value)
+		return nil, false
+	}
+	return strs, true
+}
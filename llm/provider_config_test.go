@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gage-technologies/mistral-go"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/google/go-cmp/cmp"
+	"github.com/liushuangls/go-anthropic/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// mockMistralRecordingClient records the parameters of the last request it received.
+type mockMistralRecordingClient struct {
+	mockMistralClient
+	params *mistral.ChatRequestParams
+}
+
+func (m *mockMistralRecordingClient) Chat(model string, messages []mistral.ChatMessage, params *mistral.ChatRequestParams) (*mistral.ChatCompletionResponse, error) {
+	m.params = params
+	return m.mockMistralClient.Chat(model, messages, params)
+}
+
+func TestWithProviderSpecificConfig_Gemini(t *testing.T) {
+	client := &mockGeminiClient{}
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 0.9, topK: 64, client: client}
+
+	WithConfig(LLMConfig{TopK: 20, ProviderConfig: ProviderConfig{"top_k": "8", "safe_prompt": "true", "thinking_budget": "512"}})(llm)
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(genai.Ptr[int32](8), client.model.TopK); diff != "" {
+		t.Errorf("GenerateText() top-k mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(genai.Ptr(512), llm.thinkingBudget); diff != "" {
+		t.Errorf("Thinking budget mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithProviderSpecificConfig_Anthropic(t *testing.T) {
+	client := &mockAnthropicRecordingClient{}
+	llm := &anthropicLLM{modelName: anthropic.ModelClaudeInstant1Dot2, maxTokens: 512, topP: 1, client: client}
+
+	// Lists are held as JSON arrays
+	WithProviderSpecificConfig(ProviderConfig{"stop_sequences": `["END"]`, "random_seed": "7"})(llm)
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"END"}, client.request.StopSequences); diff != "" {
+		t.Errorf("GenerateText() stop sequences mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithProviderSpecificConfig_Mistral(t *testing.T) {
+	client := &mockMistralRecordingClient{}
+	llm := &mistralLLM{modelName: "mistral-small-latest", client: client}
+
+	WithProviderSpecificConfig(ProviderConfig{"safe_prompt": "true", "top_k": "40"})(llm)
+
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !client.params.SafePrompt {
+		t.Errorf("Expected safe_prompt to be sent")
+	}
+}
+
+func TestWithMistralSafePrompt(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		client := &mockMistralRecordingClient{}
+		llm := NewMistralLLM(WithModelName("mistral-small-latest"), WithMistralSafePrompt(enabled)).(*mistralLLM)
+		llm.client = client
+
+		if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if client.params.SafePrompt != enabled {
+			t.Errorf("Expected safe_prompt %v to be forwarded, got %v", enabled, client.params.SafePrompt)
+		}
+	}
+
+	// Off by default
+	if llm := NewMistralLLM().(*mistralLLM); llm.safePrompt {
+		t.Errorf("Expected safe_prompt to be off by default")
+	}
+}
+
+func TestWithProviderSpecificConfig_InvalidValues(t *testing.T) {
+	llm := &geminiLLM{topK: 64}
+
+	// Values of the wrong type are ignored
+	WithProviderSpecificConfig(ProviderConfig{"top_k": "eight", "stop_sequences": "END"})(llm)
+
+	if llm.topK != 64 || llm.stopSequences != nil {
+		t.Errorf("Expected invalid values to be ignored, got top-k %d and stop sequences %v", llm.topK, llm.stopSequences)
+	}
+}
+
+func TestProviderConfig_UnmarshalYAML(t *testing.T) {
+	var cfg LLMConfig
+	data := "provider_config:\n  top_k: 8\n  safe_prompt: true\n  stop_sequences: [\"END\", \"\\n\\n\"]\n"
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+
+	expected := ProviderConfig{"top_k": "8", "safe_prompt": "true", "stop_sequences": `["END","\n\n"]`}
+	if diff := cmp.Diff(expected, cfg.ProviderConfig); diff != "" {
+		t.Errorf("ProviderConfig mismatch (-want +got):\n%s", diff)
+	}
+	if stop, ok := providerStrings(cfg.ProviderConfig, "stop_sequences"); !ok || !cmp.Equal(stop, []string{"END", "\n\n"}) {
+		t.Errorf("providerStrings() = %q, %v, want the decoded list", stop, ok)
+	}
+
+	// Maps aren't settings
+	if err := yaml.Unmarshal([]byte("provider_config:\n  top_k: {a: 1}\n"), &cfg); err == nil {
+		t.Errorf("Expected an error for a map setting")
+	}
+}
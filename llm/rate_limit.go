@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+/*
+TokenBucketStore persists token buckets shared by every worker of a pipeline (e.g. in Firestore
+or Redis), so the request rate can be bounded cluster-wide whatever the number of workers.
+
+Take must atomically refill the named bucket and take a token from it, typically by calling
+TokenBucket.Take inside a transaction. It returns how long to wait before trying again when
+the bucket is empty, or 0 when a token was taken.
+*/
+type TokenBucketStore interface {
+	Take(ctx context.Context, bucket string, rate float64, burst int) (time.Duration, error)
+}
+
+// TokenBucket is the state of a shared token bucket, as persisted by a TokenBucketStore.
+type TokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+/*
+Take refills the bucket with rate tokens per second since it was last updated, up to burst
+tokens, and takes a token from it. A new bucket starts full.
+
+It returns 0 when a token was taken, or how long to wait until the next token otherwise.
+Timestamps before the last update (clock skew between workers) don't refill the bucket.
+*/
+func (b *TokenBucket) Take(now time.Time, rate float64, burst int) time.Duration {
+	switch {
+	case b.Updated.IsZero():
+		b.Tokens = float64(burst)
+		b.Updated = now
+	case now.After(b.Updated):
+		b.Tokens = math.Min(float64(burst), b.Tokens+now.Sub(b.Updated).Seconds()*rate)
+		b.Updated = now
+	}
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return 0
+	}
+	return time.Duration((1 - b.Tokens) / rate * float64(time.Second))
+}
+
+/*
+clusterRateLimitedModel is a LanguageModel that takes a token from a shared bucket before each call.
+
+Fields:
+
+	model: The rate-limited model.
+
+	store: The store holding the bucket shared by every worker.
+
+	bucket: The name of the bucket, one per provider quota.
+
+	rate: The cluster-wide number of requests per second.
+
+	burst: The number of requests that can be sent at once after an idle period.
+
+	sleep: Waits for the given duration, replaced in tests by a fake clock.
+*/
+type clusterRateLimitedModel struct {
+	model  LanguageModel
+	store  TokenBucketStore
+	bucket string
+	rate   float64
+	burst  int
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+/*
+NewClusterRateLimitedModel creates a LanguageModel that bounds the request rate of the given model
+to rate requests per second across every worker sharing the store, allowing bursts of up to burst
+requests. Unlike per-worker limits, the bound holds however much the pipeline autoscales.
+
+	model := NewClusterRateLimitedModel(gemini, firestoreStore, "gemini", 10, 20)
+*/
+func NewClusterRateLimitedModel(model LanguageModel, store TokenBucketStore, bucket string, rate float64, burst int) LanguageModel {
+	return &clusterRateLimitedModel{
+		model:  model,
+		store:  store,
+		bucket: bucket,
+		rate:   rate,
+		burst:  max(burst, 1),
+		sleep:  sleepContext,
+	}
+}
+
+// GenerateText waits for a token of the shared bucket, then generates text with the wrapped model.
+func (c *clusterRateLimitedModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := c.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata waits for a token of the shared bucket, then generates text with the
+// wrapped model, returning the metadata of its response.
+func (c *clusterRateLimitedModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	if err := c.wait(ctx); err != nil {
+		return "", ResponseMeta{}, err
+	}
+	return GenerateTextWithMetadata(ctx, c.model, prompt, opts)
+}
+
+// CacheContent caches the content with the wrapped model, without taking a token: caching isn't
+// a generation request.
+func (c *clusterRateLimitedModel) CacheContent(ctx context.Context, text string) (string, error) {
+	return CacheContent(ctx, c.model, text)
+}
+
+// wait waits until a token of the shared bucket is taken.
+func (c *clusterRateLimitedModel) wait(ctx context.Context) error {
+	for {
+		wait, err := c.store.Take(ctx, c.bucket, c.rate, c.burst)
+		if err != nil {
+			return fmt.Errorf("error taking rate limit token: %w", err)
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return fmt.Errorf("error waiting for rate limit token: %w", err)
+		}
+	}
+}
+
+// sleepContext waits for the given duration, or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSharedStore is an in-memory TokenBucketStore shared by several workers, on a fake clock.
+type fakeSharedStore struct {
+	mu      sync.Mutex
+	now     time.Time
+	buckets map[string]*TokenBucket
+}
+
+func (s *fakeSharedStore) Take(ctx context.Context, bucket string, rate float64, burst int) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = &TokenBucket{}
+	}
+	return s.buckets[bucket].Take(s.now, rate, burst), nil
+}
+
+func (s *fakeSharedStore) advance(ctx context.Context, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = s.now.Add(d)
+	return nil
+}
+
+// callTimesModel records the fake time of each call.
+type callTimesModel struct {
+	store *fakeSharedStore
+	start time.Time
+	calls *[]time.Duration
+}
+
+func (m *callTimesModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	*m.calls = append(*m.calls, m.store.now.Sub(m.start))
+	return "Response", nil
+}
+
+func TestClusterRateLimitedModel(t *testing.T) {
+	start := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeSharedStore{now: start, buckets: map[string]*TokenBucket{}}
+
+	// Three workers, each with its own model, share the bucket
+	var calls []time.Duration
+	workers := make([]LanguageModel, 3)
+	for i := range workers {
+		model := NewClusterRateLimitedModel(&callTimesModel{store: store, start: start, calls: &calls}, store, "gemini", 2, 2)
+		model.(*clusterRateLimitedModel).sleep = store.advance
+		workers[i] = model
+	}
+
+	for i := 0; i < 8; i++ {
+		if _, err := workers[i%len(workers)].GenerateText(context.Background(), "Test prompt", nil); err != nil {
+			t.Fatalf("GenerateText() error = %v", err)
+		}
+	}
+
+	// The burst goes out at once, then 2 requests per second cluster-wide
+	want := []time.Duration{
+		0, 0,
+		500 * time.Millisecond, time.Second, 1500 * time.Millisecond,
+		2 * time.Second, 2500 * time.Millisecond, 3 * time.Second,
+	}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("Call times mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// metadataModel answers every call with the same text and metadata, and caches content.
+type metadataModel struct {
+	text string
+	meta ResponseMeta
+}
+
+func (m *metadataModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	return m.text, nil
+}
+
+func (m *metadataModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	return m.text, m.meta, nil
+}
+
+func (m *metadataModel) CacheContent(ctx context.Context, text string) (string, error) {
+	return "cachedContents/" + text, nil
+}
+
+func TestClusterRateLimitedModelMetadata(t *testing.T) {
+	store := &fakeSharedStore{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), buckets: map[string]*TokenBucket{}}
+	inner := &metadataModel{text: `{"overall`, meta: ResponseMeta{Reason: FinishReasonLength, InputTokens: 100, OutputTokens: 50}}
+	model := NewClusterRateLimitedModel(inner, store, "gemini", 1, 1)
+
+	// The metadata of the response goes through the rate limit
+	text, meta, err := GenerateTextWithMetadata(context.Background(), model, "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+	}
+	if text != inner.text || meta != inner.meta {
+		t.Errorf("GenerateTextWithMetadata() = %q, %+v, want %q, %+v", text, meta, inner.text, inner.meta)
+	}
+
+	// So does content caching
+	if name, err := CacheContent(context.Background(), model, "schema"); err != nil || name != "cachedContents/schema" {
+		t.Errorf("CacheContent() = %q, %v, want the handle of the wrapped model", name, err)
+	}
+}
+
+func TestClusterRateLimitedModelCanceled(t *testing.T) {
+	store := &fakeSharedStore{now: time.Now(), buckets: map[string]*TokenBucket{"gemini": {Updated: time.Now()}}}
+	model := NewClusterRateLimitedModel(&mockLanguageModel{response: "Response"}, store, "gemini", 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := model.GenerateText(ctx, "Test prompt", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	now := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	bucket := &TokenBucket{Tokens: 0.5, Updated: now}
+
+	// A worker with a late clock doesn't refill the bucket
+	if wait := bucket.Take(now.Add(-time.Second), 1, 5); wait != 500*time.Millisecond {
+		t.Errorf("Expected a 500ms wait, got %v", wait)
+	}
+
+	// Refills are capped at the burst
+	if wait := bucket.Take(now.Add(time.Hour), 1, 5); wait != 0 {
+		t.Errorf("Expected a token, got a %v wait", wait)
+	}
+	if bucket.Tokens != 4 {
+		t.Errorf("Expected 4 tokens left, got %v", bucket.Tokens)
+	}
+}
@@ -0,0 +1,35 @@
+package llm
+
+// RequestMetadataUserID is the request metadata key identifying the end user a request is made
+// for, forwarded as the user field of the providers supporting one.
+const RequestMetadataUserID = "user_id"
+
+/*
+WithRequestMetadata creates an lLMOption that tags every request with metadata, forwarded to the
+metadata or user field of the providers supporting one, for their abuse monitoring and billing
+attribution:
+
+  - Anthropic: metadata.user_id, from the RequestMetadataUserID key; Anthropic accepts no other key.
+  - OpenAI: metadata, every key, and user, from the RequestMetadataUserID key.
+
+Gemini and Mistral have no such field and ignore this option.
+*/
+func WithRequestMetadata(metadata map[string]string) lLMOption {
+	return func(l interface{}) {
+		switch v := l.(type) {
+		case *anthropicLLM:
+			v.metadata = metadata
+		case *openAILLM:
+			v.metadata = metadata
+		}
+	}
+}
+
+// anthropicMetadata returns the metadata of an Anthropic request, nil without a user ID.
+func anthropicMetadata(metadata map[string]string) map[string]any {
+	userID, ok := metadata[RequestMetadataUserID]
+	if !ok {
+		return nil
+	}
+	return map[string]any{RequestMetadataUserID: userID}
+}
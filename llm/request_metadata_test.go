@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRequestMetadata(t *testing.T) {
+	metadata := map[string]string{RequestMetadataUserID: "tenant-42", "team": "assessments"}
+
+	t.Run("Anthropic", func(t *testing.T) {
+		client := &mockAnthropicRecordingClient{}
+		llm := &anthropicLLM{modelName: anthropic.ModelClaudeInstant1Dot2, maxTokens: 512, topP: 1, client: client}
+
+		// Untagged by default
+		_, err := llm.GenerateText(context.Background(), "Test prompt", nil)
+		assert.NoError(t, err)
+		assert.Nil(t, client.request.Metadata)
+
+		// Only the user ID is accepted by Anthropic
+		WithRequestMetadata(metadata)(llm)
+		_, err = llm.GenerateText(context.Background(), "Test prompt", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"user_id": "tenant-42"}, client.request.Metadata)
+
+		// Without a user ID there is nothing to send
+		WithRequestMetadata(map[string]string{"team": "assessments"})(llm)
+		_, err = llm.GenerateText(context.Background(), "Test prompt", nil)
+		assert.NoError(t, err)
+		assert.Nil(t, client.request.Metadata)
+	})
+
+	t.Run("OpenAI", func(t *testing.T) {
+		client := &mockOpenAIClient{response: &OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "OpenAI Response"}, FinishReason: "stop"}},
+		}}
+		// Set through the configuration, as NewLanguageModel does
+		llm := NewOpenAILLM(WithConfig(LLMConfig{RequestMetadata: metadata})).(*openAILLM)
+		llm.client = client
+
+		_, err := llm.GenerateText(context.Background(), "Test prompt", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, metadata, client.request.Metadata)
+		assert.Equal(t, "tenant-42", client.request.User)
+	})
+
+	t.Run("Unsupported providers", func(t *testing.T) {
+		mistralModel := &mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}}
+		WithRequestMetadata(metadata)(mistralModel)
+		if diff := cmp.Diff(&mistralLLM{modelName: "mistral-small-latest", client: &mockMistralClient{}}, mistralModel, cmp.AllowUnexported(mistralLLM{})); diff != "" {
+			t.Errorf("WithRequestMetadata() changed Mistral LLM (-want +got):\n%s", diff)
+		}
+	})
+}
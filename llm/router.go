@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+routerModel is a LanguageModel that delegates each GenerateText call to one of
+several underlying models, picked per call by a caller-supplied route function.
+
+It allows cheap models to handle easy prompts and expensive models to handle hard ones.
+
+Fields:
+
+	route: Picks the LanguageModel to use for the given context and prompt.
+
+	contents: The content cached with the routed models.
+*/
+type routerModel struct {
+	route    func(ctx context.Context, prompt string) LanguageModel
+	contents contentHandles
+}
+
+/*
+NewRouterModel creates a LanguageModel that routes every call to the model returned by route.
+
+The route function receives the request context and the prompt, so it can decide based on
+the prompt length or on values the caller stored in the context (e.g. an assessment difficulty).
+For example, to send long prompts to a larger model:
+
+	model := NewRouterModel(func(ctx context.Context, prompt string) LanguageModel {
+		if len(prompt) > 4000 {
+			return largeModel
+		}
+		return smallModel
+	})
+*/
+func NewRouterModel(route func(ctx context.Context, prompt string) LanguageModel) LanguageModel {
+	return &routerModel{route: route}
+}
+
+// GenerateText generates text with the model selected by the route function.
+func (r *routerModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := r.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata generates text with the model selected by the route function,
+// returning the metadata of its response.
+func (r *routerModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	model := r.route(ctx, prompt)
+	if model == nil {
+		return "", ResponseMeta{}, fmt.Errorf("error: no model routed for prompt")
+	}
+
+	opts, err := r.contents.options(ctx, model, opts)
+	if err != nil {
+		return "", ResponseMeta{}, err
+	}
+	return GenerateTextWithMetadata(ctx, model, prompt, opts)
+}
+
+// CacheContent caches the content with the model routed for it. The prompts referencing it
+// that are routed to another model cache it with that model first.
+func (r *routerModel) CacheContent(ctx context.Context, text string) (string, error) {
+	model := r.route(ctx, text)
+	if model == nil {
+		return "", fmt.Errorf("error: no model routed for content")
+	}
+
+	return r.contents.cache(ctx, model, text)
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockLanguageModel struct {
+	response string
+	calls    int
+}
+
+func (m *mockLanguageModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	m.calls++
+	return m.response, nil
+}
+
+func TestRouterModel(t *testing.T) {
+	cheap := &mockLanguageModel{response: "cheap"}
+	expensive := &mockLanguageModel{response: "expensive"}
+
+	model := NewRouterModel(func(ctx context.Context, prompt string) LanguageModel {
+		if len(prompt) > 10 {
+			return expensive
+		}
+		return cheap
+	})
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{name: "Short prompt", prompt: "Easy", want: "cheap"},
+		{name: "Long prompt", prompt: "A much harder assessment", want: "expensive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := model.GenerateText(context.Background(), tt.prompt, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("GenerateText() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if cheap.calls != 1 || expensive.calls != 1 {
+		t.Errorf("Expected one call per model, got cheap=%d expensive=%d", cheap.calls, expensive.calls)
+	}
+}
+
+func TestRouterModelWithNoRoute(t *testing.T) {
+	model := NewRouterModel(func(ctx context.Context, prompt string) LanguageModel {
+		return nil
+	})
+
+	if _, err := model.GenerateText(context.Background(), "Test prompt", nil); err == nil {
+		t.Errorf("Expected error when no model is routed, got nil")
+	}
+}
+
+// handleModel caches content under its own name and records the cached content of its calls,
+// answering them with err if set.
+type handleModel struct {
+	name          string
+	err           error
+	cachedContent string
+}
+
+func (m *handleModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	if opts != nil {
+		m.cachedContent = opts.CachedContent
+	}
+	if m.err != nil {
+		return "", m.err
+	}
+	return m.name, nil
+}
+
+func (m *handleModel) CacheContent(ctx context.Context, text string) (string, error) {
+	return m.name + "/" + text, nil
+}
+
+func TestRouterModelMetadata(t *testing.T) {
+	inner := &metadataModel{text: `{"overall`, meta: ResponseMeta{Reason: FinishReasonLength, InputTokens: 100, OutputTokens: 50}}
+	model := NewRouterModel(func(ctx context.Context, prompt string) LanguageModel { return inner })
+
+	// The metadata of the response goes through the router
+	text, meta, err := GenerateTextWithMetadata(context.Background(), model, "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+	}
+	if text != inner.text || meta != inner.meta {
+		t.Errorf("GenerateTextWithMetadata() = %q, %+v, want %q, %+v", text, meta, inner.text, inner.meta)
+	}
+
+	// So does content caching
+	if name, err := CacheContent(context.Background(), model, "schema"); err != nil || name != "cachedContents/schema" {
+		t.Errorf("CacheContent() = %q, %v, want the handle of the routed model", name, err)
+	}
+}
+
+func TestRouterModelCachedContent(t *testing.T) {
+	cheap := &handleModel{name: "cheap"}
+	expensive := &handleModel{name: "expensive"}
+	model := NewRouterModel(func(ctx context.Context, prompt string) LanguageModel {
+		if len(prompt) > 10 {
+			return expensive
+		}
+		return cheap
+	})
+
+	handle, err := CacheContent(context.Background(), model, "schema")
+	if err != nil || handle != "cheap/schema" {
+		t.Fatalf("CacheContent() = %q, %v, want the handle of the routed model", handle, err)
+	}
+
+	// Each routed model references the content by its own handle
+	for _, prompt := range []string{"Easy", "A much harder assessment"} {
+		if _, err := model.GenerateText(context.Background(), prompt, &GenerateOptions{CachedContent: handle}); err != nil {
+			t.Fatalf("GenerateText() error = %v", err)
+		}
+	}
+	if cheap.cachedContent != "cheap/schema" || expensive.cachedContent != "expensive/schema" {
+		t.Errorf("Cached content = %q, %q, want the handle of each model", cheap.cachedContent, expensive.cachedContent)
+	}
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// SafetyRating is the rating of a harm category of a blocked prompt or response.
+type SafetyRating struct {
+	// Category is the harm category, e.g. HarmCategoryHarassment.
+	Category string `json:"category"`
+	// Probability is the probability of harm, e.g. HarmProbabilityHigh.
+	Probability string `json:"probability"`
+	// Blocked is set on the categories the content was blocked for.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// SafetyBlock describes why Gemini blocked a prompt or response for safety.
+type SafetyBlock struct {
+	// BlockReason is the reason the prompt was blocked, e.g. BlockReasonSafety, unset when the response was.
+	BlockReason string `json:"block_reason,omitempty"`
+	// FinishReason is the finish reason of the blocked response, unset when the prompt was blocked.
+	FinishReason string `json:"finish_reason,omitempty"`
+	// Ratings are the safety ratings of the blocked prompt or response.
+	Ratings []SafetyRating `json:"safety_ratings,omitempty"`
+}
+
+// SafetyBlockError is the error of a Gemini prompt or response blocked for safety, with the
+// block categories. It is wrapped by a refusal error, see WithGeminiSafetyBlockAsDeadLetter.
+type SafetyBlockError struct {
+	SafetyBlock
+	// Err is the genai.BlockedError of the block.
+	Err error
+}
+
+func (e *SafetyBlockError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SafetyBlockError) Unwrap() error {
+	return e.Err
+}
+
+// SafetyBlockOf returns the block categories of err, when it is a Gemini safety block.
+func SafetyBlockOf(err error) (SafetyBlock, bool) {
+	var blockErr *SafetyBlockError
+	if !errors.As(err, &blockErr) {
+		return SafetyBlock{}, false
+	}
+	return blockErr.SafetyBlock, true
+}
+
+/*
+WithGeminiSafetyBlockAsDeadLetter creates an lLMOption setting whether a Gemini prompt or
+response blocked for safety fails as a refusal (see IsRefused), carrying the block reason and
+safety ratings in a SafetyBlockError (see SafetyBlockOf), so the assessment is dead-lettered
+with its block categories rather than retried. This is the default; disabled, a safety block
+fails like any other error.
+
+Other providers ignore this option.
+*/
+func WithGeminiSafetyBlockAsDeadLetter(enabled bool) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.safetyBlockRetried = !enabled
+		}
+	}
+}
+
+// geminiSafetyBlockError returns the refusal error of a Gemini safety block, with its categories.
+func geminiSafetyBlockError(err error) error {
+	var blocked *genai.BlockedError
+	errors.As(err, &blocked)
+
+	var block SafetyBlock
+	var ratings []*genai.SafetyRating
+	if blocked.PromptFeedback != nil {
+		block.BlockReason = blocked.PromptFeedback.BlockReason.String()
+		ratings = blocked.PromptFeedback.SafetyRatings
+	}
+	if blocked.Candidate != nil {
+		block.FinishReason = blocked.Candidate.FinishReason.String()
+		ratings = append(ratings, blocked.Candidate.SafetyRatings...)
+	}
+	for _, rating := range ratings {
+		if rating == nil {
+			continue
+		}
+		block.Ratings = append(block.Ratings, SafetyRating{
+			Category:    rating.Category.String(),
+			Probability: rating.Probability.String(),
+			Blocked:     rating.Blocked,
+		})
+	}
+	return fmt.Errorf("%w: error sending message: %w", ErrRefused, &SafetyBlockError{SafetyBlock: block, Err: err})
+}
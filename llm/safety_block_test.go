@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockGeminiBlockClient blocks every prompt for safety.
+type mockGeminiBlockClient struct {
+	mockGeminiClient
+	calls int
+}
+
+func (m *mockGeminiBlockClient) SendMessage(ctx context.Context, model *genai.GenerativeModel, history []*genai.Content, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	m.calls++
+	return nil, &genai.BlockedError{PromptFeedback: &genai.PromptFeedback{
+		BlockReason: genai.BlockReasonSafety,
+		SafetyRatings: []*genai.SafetyRating{
+			{Category: genai.HarmCategoryHarassment, Probability: genai.HarmProbabilityHigh, Blocked: true},
+			{Category: genai.HarmCategoryHateSpeech, Probability: genai.HarmProbabilityNegligible},
+		},
+	}}
+}
+
+func TestWithGeminiSafetyBlockAsDeadLetter(t *testing.T) {
+	client := &mockGeminiBlockClient{}
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-exp-0801", topP: 1, client: client}
+
+	// By default, the block is a refusal carrying its categories
+	_, err := llm.GenerateText(context.Background(), "Test prompt", nil)
+	assert.True(t, IsRefused(err))
+	block, ok := SafetyBlockOf(err)
+	if assert.True(t, ok) {
+		assert.Equal(t, SafetyBlock{
+			BlockReason: "BlockReasonSafety",
+			Ratings: []SafetyRating{
+				{Category: "HarmCategoryHarassment", Probability: "HarmProbabilityHigh", Blocked: true},
+				{Category: "HarmCategoryHateSpeech", Probability: "HarmProbabilityNegligible"},
+			},
+		}, block)
+	}
+
+	// Disabled, the block fails like any other error
+	WithGeminiSafetyBlockAsDeadLetter(false)(llm)
+	_, err = llm.GenerateText(context.Background(), "Test prompt", nil)
+	assert.Error(t, err)
+	assert.False(t, IsRefused(err))
+	_, ok = SafetyBlockOf(err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, client.calls)
+}
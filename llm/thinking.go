@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// supportsThinking reports whether the Gemini model thinks before answering, and takes a
+// thinking budget.
+func supportsThinking(modelName string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(modelName, "models/"), "gemini-2.5")
+}
+
+/*
+WithGeminiThinkingBudget creates an lLMOption that sets the number of tokens Gemini 2.5 models
+may think with before answering, trading latency for quality: 0 disables thinking where the
+model allows it, -1 lets the model decide. Thinking content is never part of the generated text.
+
+The genai SDK has no thinking configuration, so the budget is added to the generateContent
+requests by the HTTP transport of the client. Older models don't think and ignore it.
+
+Other providers ignore this option.
+*/
+func WithGeminiThinkingBudget(budget int) lLMOption {
+	return func(l interface{}) {
+		if v, ok := l.(*geminiLLM); ok {
+			v.thinkingBudget = &budget
+		}
+	}
+}
+
+/*
+thinkingBudgetTransport is an http.RoundTripper setting the thinking budget of the Gemini
+generateContent (and streamGenerateContent) requests of the models supporting thinking, in their
+generation config, and removing the thought parts from their responses, so the final text only
+holds the answer. Other requests are sent as is.
+*/
+type thinkingBudgetTransport struct {
+	budget    int
+	transport http.RoundTripper
+}
+
+func (t *thinkingBudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// Chat sessions stream their responses, as a JSON array of generateContent responses
+	model, ok := strings.CutSuffix(req.URL.Path, ":generateContent")
+	if !ok {
+		model, ok = strings.CutSuffix(req.URL.Path, ":streamGenerateContent")
+	}
+	if !ok || !supportsThinking(model[strings.LastIndex(model, "/")+1:]) || req.Body == nil {
+		return transport.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading Gemini request: %w", err)
+	}
+	body, err = setThinkingBudget(body, t.budget)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading Gemini response: %w", err)
+	}
+	body = stripThoughts(body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// setThinkingBudget sets generationConfig.thinkingConfig.thinkingBudget in a generateContent
+// request body.
+func setThinkingBudget(body []byte, budget int) ([]byte, error) {
+	var request map[string]any
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("error decoding Gemini request: %w", err)
+	}
+	config, _ := request["generationConfig"].(map[string]any)
+	if config == nil {
+		config = make(map[string]any)
+	}
+	config["thinkingConfig"] = map[string]any{"thinkingBudget": budget}
+	request["generationConfig"] = config
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding Gemini request: %w", err)
+	}
+	return body, nil
+}
+
+// stripThoughts removes the parts flagged as thoughts from the candidates of a generateContent
+// response body, or of the responses of a streamGenerateContent one, which the genai SDK would
+// take for answer text. Bodies that can't be decoded are returned as is, for the SDK to report.
+func stripThoughts(body []byte) []byte {
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return body
+	}
+	responses, ok := decoded.([]any)
+	if !ok {
+		responses = []any{decoded}
+	}
+
+	stripped := false
+	for _, response := range responses {
+		response, _ := response.(map[string]any)
+		if stripCandidateThoughts(response) {
+			stripped = true
+		}
+	}
+	if !stripped {
+		return body
+	}
+
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// stripCandidateThoughts removes the thought parts of the candidates of a decoded response,
+// reporting whether there were any.
+func stripCandidateThoughts(response map[string]any) bool {
+	candidates, _ := response["candidates"].([]any)
+	stripped := false
+	for _, candidate := range candidates {
+		candidate, _ := candidate.(map[string]any)
+		content, _ := candidate["content"].(map[string]any)
+		parts, _ := content["parts"].([]any)
+		if len(parts) == 0 {
+			continue
+		}
+		kept := parts[:0]
+		for _, part := range parts {
+			part, _ := part.(map[string]any)
+			if thought, _ := part["thought"].(bool); thought {
+				stripped = true
+				continue
+			}
+			kept = append(kept, part)
+		}
+		content["parts"] = kept
+	}
+	return stripped
+}
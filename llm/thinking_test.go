@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// thinkingResponse is a streamGenerateContent response, as chat sessions get, holding a
+// thought part before the answer.
+const thinkingResponse = `[{"candidates": [{"content": {"role": "model", "parts": [
+	{"text": "Let me weigh the answers first.", "thought": true},
+	{"text": "{\"overall_assessment\": \"Good\"}"}
+]}, "finishReason": "STOP"}]}]`
+
+func TestWithGeminiThinkingBudget(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		requests = append(requests, request)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, thinkingResponse)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &thinkingBudgetTransport{budget: 1024}}
+
+	tests := []struct {
+		model      string
+		wantConfig any
+		wantParts  int
+	}{
+		{
+			model:      "gemini-2.5-flash",
+			wantConfig: map[string]any{"thinkingBudget": float64(1024)},
+			wantParts:  1,
+		},
+		{
+			// Older models don't get a budget, nor their responses stripped
+			model:     "gemini-1.5-pro-001",
+			wantParts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			requests = nil
+			url := server.URL + "/v1beta/models/" + tt.model + ":streamGenerateContent"
+			resp, err := client.Post(url, "application/json", strings.NewReader(`{"generationConfig": {"temperature": 0.7}}`))
+			if err != nil {
+				t.Fatalf("Post() returned error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if len(requests) != 1 {
+				t.Fatalf("Expected 1 request, got %d", len(requests))
+			}
+			config, _ := requests[0]["generationConfig"].(map[string]any)
+			if diff := cmp.Diff(tt.wantConfig, config["thinkingConfig"]); diff != "" {
+				t.Errorf("Thinking config mismatch (-want +got):\n%s", diff)
+			}
+			if config["temperature"] != 0.7 {
+				t.Errorf("Expected the generation config to be kept, got %v", config)
+			}
+
+			var responses []struct {
+				Candidates []struct {
+					Content struct {
+						Parts []map[string]any `json:"parts"`
+					} `json:"content"`
+				} `json:"candidates"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+				t.Fatalf("Invalid response body: %v", err)
+			}
+			parts := responses[0].Candidates[0].Content.Parts
+			if len(parts) != tt.wantParts {
+				t.Fatalf("Expected %d parts, got %v", tt.wantParts, parts)
+			}
+			if parts[len(parts)-1]["text"] != `{"overall_assessment": "Good"}` {
+				t.Errorf("Expected the answer to be kept, got %v", parts)
+			}
+		})
+	}
+}
+
+func TestStripThoughts(t *testing.T) {
+	// Responses without thoughts, or that aren't JSON, are left as is
+	for _, body := range []string{`{"candidates": [{"content": {"parts": [{"text": "Answer"}]}}]}`, "not json"} {
+		if got := string(stripThoughts([]byte(body))); got != body {
+			t.Errorf("stripThoughts(%q) = %q, want it unchanged", body, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gage-technologies/mistral-go"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/liushuangls/go-anthropic/v2"
+)
+
+// toolTypeNames names the ToolTypes in validation errors.
+var toolTypeNames = map[ToolType]string{
+	GeminiToolType:    "Gemini",
+	MistralToolType:   "Mistral",
+	AnthropicToolType: "Anthropic",
+}
+
+/*
+WithTools creates an lLMOption that sets the tools passed with every call whose
+GenerateOptions have no Tools of their own.
+
+NewLanguageModel validates the tools against the provider with ValidateTools, failing
+when the model is created rather than on its first call. Models created with the
+provider constructors are not validated: call ValidateTools before creating them.
+*/
+func WithTools(tools ...GenericTool) lLMOption {
+	return func(l interface{}) {
+		switch v := l.(type) {
+		case *geminiLLM:
+			v.tools = tools
+		case *mistralLLM:
+			v.tools = tools
+		case *anthropicLLM:
+			v.tools = tools
+		case *openAILLM:
+			v.tools = tools
+		}
+	}
+}
+
+// tools returns the tools of the call, or the model's default tools when the call has none.
+func (opts *GenerateOptions) tools(modelTools []GenericTool) []GenericTool {
+	if opts != nil && len(opts.Tools) > 0 {
+		return opts.Tools
+	}
+	return modelTools
+}
+
+/*
+ValidateTools checks that every tool can be passed to the models of the provider (an empty
+provider being Gemini), i.e. that its ToolType is the provider's and its Tool the provider's
+tool type. The returned error lists every offending tool, e.g.
+
+	error: tools not supported by the mistral LLM: tool 0 "get_weather" (Gemini *genai.Tool)
+*/
+func ValidateTools(provider string, tools []GenericTool) error {
+	var offending []string
+	for i, tool := range tools {
+		if toolMatches(provider, tool) {
+			continue
+		}
+		offending = append(offending, fmt.Sprintf("tool %d %q (%s %T)", i, toolName(tool), toolTypeNames[tool.Type], tool.Tool))
+	}
+	if len(offending) > 0 {
+		if provider == "" {
+			provider = ProviderGemini
+		}
+		return fmt.Errorf("error: tools not supported by the %s LLM: %s", provider, strings.Join(offending, ", "))
+	}
+	return nil
+}
+
+// toolMatches reports whether the tool is of the provider's type. OpenAI models take no tools.
+func toolMatches(provider string, tool GenericTool) bool {
+	switch provider {
+	case "", ProviderGemini:
+		_, ok := tool.Tool.(*genai.Tool)
+		return ok && tool.Type == GeminiToolType
+	case ProviderMistral:
+		_, ok := tool.Tool.(mistral.Tool)
+		return ok && tool.Type == MistralToolType
+	case ProviderAnthropic:
+		_, ok := tool.Tool.(anthropic.ToolDefinition)
+		return ok && tool.Type == AnthropicToolType
+	default:
+		return false
+	}
+}
+
+// toolName returns the name of the tool, the names of its functions for Gemini tools.
+func toolName(tool GenericTool) string {
+	switch t := tool.Tool.(type) {
+	case *genai.Tool:
+		if t == nil {
+			return ""
+		}
+		names := make([]string, 0, len(t.FunctionDeclarations))
+		for _, declaration := range t.FunctionDeclarations {
+			names = append(names, declaration.Name)
+		}
+		return strings.Join(names, ", ")
+	case mistral.Tool:
+		return t.Function.Name
+	case anthropic.ToolDefinition:
+		return t.Name
+	default:
+		return ""
+	}
+}
+
+// modelTools returns the default tools set with WithTools on a provider model.
+func modelTools(model LanguageModel) []GenericTool {
+	switch v := model.(type) {
+	case *geminiLLM:
+		return v.tools
+	case *mistralLLM:
+		return v.tools
+	case *anthropicLLM:
+		return v.tools
+	case *openAILLM:
+		return v.tools
+	default:
+		return nil
+	}
+}
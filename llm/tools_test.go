@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gage-technologies/mistral-go"
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestNewLanguageModelWithTools(t *testing.T) {
+	t.Setenv("MISTRAL_API_KEY", "mistral-key")
+
+	geminiTool := NewGeminiTool(&genai.Tool{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: "get_weather"}}})
+	mistralTool := NewMistralTool(mistral.Tool{Type: mistral.ToolTypeFunction, Function: mistral.Function{Name: "get_time"}})
+
+	// A Gemini tool fails the Mistral model when it is created, naming the tool
+	_, err := NewLanguageModel(LLMConfig{Provider: ProviderMistral}, WithTools(mistralTool, geminiTool))
+	if err == nil {
+		t.Fatalf("Expected an error for a Gemini tool on a Mistral model, got nil")
+	}
+	if want := `tools not supported by the mistral LLM: tool 1 "get_weather" (Gemini *genai.Tool)`; !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error to contain %q, got %v", want, err)
+	}
+
+	// Mistral tools are accepted
+	model, err := NewLanguageModel(LLMConfig{Provider: ProviderMistral}, WithTools(mistralTool))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tools := model.(*mistralLLM).tools; len(tools) != 1 {
+		t.Errorf("Expected the Mistral tool to be set, got %+v", tools)
+	}
+
+	// A tool whose type disagrees with the tool is rejected too
+	if err := ValidateTools(ProviderMistral, []GenericTool{{Type: MistralToolType, Tool: &genai.Tool{}}}); err == nil {
+		t.Errorf("Expected an error for a mistyped tool, got nil")
+	}
+}
+
+func TestWithToolsDefault(t *testing.T) {
+	client := &mockGeminiClient{}
+	llm := &geminiLLM{modelName: "gemini-1.5-pro-001", temperature: 0.7, maxTokens: 512, topP: 1, client: client}
+	defaultTool := &genai.Tool{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: "get_weather"}}}
+	WithTools(NewGeminiTool(defaultTool))(llm)
+
+	// Calls without tools get the default tools
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.model.Tools) != 1 || client.model.Tools[0] != defaultTool {
+		t.Errorf("Expected the default tool, got %+v", client.model.Tools)
+	}
+
+	// The tools of a call replace them
+	callTool := &genai.Tool{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: "get_time"}}}
+	if _, err := llm.GenerateText(context.Background(), "Test prompt", &GenerateOptions{Tools: []GenericTool{NewGeminiTool(callTool)}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.model.Tools) != 1 || client.model.Tools[0] != callTool {
+		t.Errorf("Expected the tool of the call, got %+v", client.model.Tools)
+	}
+}
@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+/*
+NewRetryingTransport creates an http.RoundTripper retrying the requests sent through base
+(http.DefaultTransport when nil) up to maxRetries times, waiting backoff, then twice as long
+before each further retry, on failures that are safe to retry:
+
+  - connection errors: resets, refused connections and closed idle connections;
+  - 5xx responses, the Retry-After header of a 503 replacing the wait.
+
+Requests whose body can't be replayed are sent once. Retries stop when the context of the
+request is done, returning the last error or response.
+
+Set it on the client shared by the providers, see SetHTTPClient, so every provider retries
+the same way. The retries happen within a single call of the LanguageModel: callers, e.g.
+with retries of their own, see one call, succeeding or failing after the last retry.
+*/
+func NewRetryingTransport(base http.RoundTripper, maxRetries int, backoff time.Duration) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryingTransport{base: base, maxRetries: maxRetries, backoff: backoff}
+}
+
+// retryingTransport is the http.RoundTripper of NewRetryingTransport.
+type retryingTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	wait := t.backoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.maxRetries || !replayable || !retriableTransportFailure(resp, err) {
+			return resp, err
+		}
+
+		delay := wait
+		if resp != nil {
+			if retryAfter, ok := retryAfterDelay(resp); ok {
+				delay = retryAfter
+			}
+			// The connection can only be reused once the body is drained
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			log.Printf("Retrying %s %s after status %d (retry %d of %d)", req.Method, req.URL.Path, resp.StatusCode, attempt+1, t.maxRetries)
+		} else {
+			log.Printf("Retrying %s %s after error: %v (retry %d of %d)", req.Method, req.URL.Path, err, attempt+1, t.maxRetries)
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		wait *= 2
+	}
+}
+
+// retriableTransportFailure reports whether a round trip failed at the connection or with a 5xx status.
+func retriableTransportFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF)
+	}
+	return resp.StatusCode >= 500
+}
+
+// retryAfterDelay returns the delay of the Retry-After header of a 503 response, in seconds.
+func retryAfterDelay(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	seconds, err := time.ParseDuration(resp.Header.Get("Retry-After") + "s")
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return seconds, true
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapts a function to an http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// response returns a response of the status, with body.
+func response(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestNewRetryingTransport(t *testing.T) {
+	connReset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		failures   []error
+		statuses   []int
+		wantStatus int
+		wantErr    bool
+		wantCalls  int
+	}{
+		{
+			name:       "Connection reset then success",
+			maxRetries: 2,
+			failures:   []error{connReset, nil},
+			statuses:   []int{0, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "5xx then success",
+			maxRetries: 2,
+			failures:   []error{nil, nil, nil},
+			statuses:   []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name:       "Retries exhausted",
+			maxRetries: 1,
+			failures:   []error{nil, nil},
+			statuses:   []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  2,
+		},
+		{
+			// Client errors are left to the caller
+			name:       "4xx not retried",
+			maxRetries: 2,
+			failures:   []error{nil},
+			statuses:   []int{http.StatusTooManyRequests},
+			wantStatus: http.StatusTooManyRequests,
+			wantCalls:  1,
+		},
+		{
+			name:       "Other errors not retried",
+			maxRetries: 2,
+			failures:   []error{errors.New("certificate signed by unknown authority")},
+			statuses:   []int{0},
+			wantErr:    true,
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				body, _ := io.ReadAll(req.Body)
+				bodies = append(bodies, string(body))
+				call := len(bodies) - 1
+				if tt.failures[call] != nil {
+					return nil, tt.failures[call]
+				}
+				return response(tt.statuses[call], "{}"), nil
+			})
+			client := &http.Client{Transport: NewRetryingTransport(base, tt.maxRetries, time.Millisecond)}
+
+			resp, err := client.Post("https://api.example.com/v1/messages", "application/json", strings.NewReader(`{"prompt": "Hello"}`))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got status %d", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Post() returned error: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+				}
+			}
+			if len(bodies) != tt.wantCalls {
+				t.Fatalf("Expected %d calls, got %d", tt.wantCalls, len(bodies))
+			}
+			// Every attempt sends the whole body again
+			for _, body := range bodies {
+				if body != `{"prompt": "Hello"}` {
+					t.Errorf("Expected the request body to be replayed, got %q", body)
+				}
+			}
+		})
+	}
+}
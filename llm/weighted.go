@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+/*
+weightedModel is a LanguageModel that spreads calls across several models by weight,
+picking the model of each GenerateText call at random.
+
+Fields:
+
+	models: The models to pick from, with a positive weight.
+
+	cumulative: The running total of the weights, cumulative[i] being the sum of the weights of models[0..i].
+
+	intn: Returns a random number in [0, n), replaced in tests by a seeded source.
+
+	contents: The content cached with the models.
+*/
+type weightedModel struct {
+	models     []LanguageModel
+	cumulative []int
+	intn       func(n int) int
+	contents   contentHandles
+}
+
+/*
+NewWeightedModel creates a LanguageModel that sends each call to one of the given models,
+picked with a probability proportional to its weight. Models with a weight of 0 or less are never picked.
+
+It spreads the load across providers according to their quota, e.g. 50% Gemini, 30% Mistral and
+20% Anthropic. The picked model's error is returned as is, so it combines with NewFallbackModel to
+retry failed calls on a last-resort model:
+
+	model := NewFallbackModel([]LanguageModel{
+		NewWeightedModel(map[LanguageModel]int{gemini: 50, mistral: 30, anthropic: 20}),
+		anthropic,
+	})
+*/
+func NewWeightedModel(weights map[LanguageModel]int) LanguageModel {
+	llm := &weightedModel{intn: rand.Intn}
+
+	total := 0
+	for model, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		total += weight
+		llm.models = append(llm.models, model)
+		llm.cumulative = append(llm.cumulative, total)
+	}
+
+	return llm
+}
+
+// GenerateText generates text with a model picked according to the weights.
+func (w *weightedModel) GenerateText(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	text, _, err := w.GenerateTextWithMetadata(ctx, prompt, opts)
+	return text, err
+}
+
+// GenerateTextWithMetadata generates text with a model picked according to the weights,
+// returning the metadata of its response.
+func (w *weightedModel) GenerateTextWithMetadata(ctx context.Context, prompt string, opts *GenerateOptions) (string, ResponseMeta, error) {
+	model := w.pick()
+	if model == nil {
+		return "", ResponseMeta{}, fmt.Errorf("error: no weighted model to pick")
+	}
+
+	opts, err := w.contents.options(ctx, model, opts)
+	if err != nil {
+		return "", ResponseMeta{}, err
+	}
+	return GenerateTextWithMetadata(ctx, model, prompt, opts)
+}
+
+// CacheContent caches the content with every model, so whichever is picked can answer the
+// prompts referencing it. It fails when one of them can't cache content.
+func (w *weightedModel) CacheContent(ctx context.Context, text string) (string, error) {
+	if len(w.models) == 0 {
+		return "", ErrContentCachingNotSupported
+	}
+
+	handle, err := w.contents.cache(ctx, w.models[0], text)
+	if err != nil {
+		return "", err
+	}
+	for _, model := range w.models[1:] {
+		if _, err := w.contents.options(ctx, model, &GenerateOptions{CachedContent: handle}); err != nil {
+			return "", err
+		}
+	}
+	return handle, nil
+}
+
+// pick returns a model with a probability proportional to its weight, nil when there is none.
+func (w *weightedModel) pick() LanguageModel {
+	if len(w.models) == 0 {
+		return nil
+	}
+
+	n := w.intn(w.cumulative[len(w.cumulative)-1])
+	return w.models[sort.SearchInts(w.cumulative, n+1)]
+}
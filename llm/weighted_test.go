@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestWeightedModel(t *testing.T) {
+	gemini := &mockLanguageModel{response: "gemini"}
+	mistral := &mockLanguageModel{response: "mistral"}
+	anthropic := &mockLanguageModel{response: "anthropic"}
+	unused := &mockLanguageModel{response: "unused"}
+
+	model := NewWeightedModel(map[LanguageModel]int{gemini: 50, mistral: 30, anthropic: 20, unused: 0})
+	model.(*weightedModel).intn = rand.New(rand.NewSource(1)).Intn
+
+	const calls = 10000
+	for i := 0; i < calls; i++ {
+		if _, err := model.GenerateText(context.Background(), "Test prompt", nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		model *mockLanguageModel
+		share float64
+	}{
+		{"Gemini", gemini, 0.5},
+		{"Mistral", mistral, 0.3},
+		{"Anthropic", anthropic, 0.2},
+		{"Zero weight", unused, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := float64(tt.model.calls) / calls
+			if math.Abs(got-tt.share) > 0.02 {
+				t.Errorf("Expected about %.0f%% of the calls, got %.1f%%", tt.share*100, got*100)
+			}
+		})
+	}
+	if unused.calls != 0 {
+		t.Errorf("Expected a model with a weight of 0 to never be picked, got %d calls", unused.calls)
+	}
+}
+
+func TestWeightedModelWithoutModels(t *testing.T) {
+	model := NewWeightedModel(map[LanguageModel]int{&mockLanguageModel{}: 0})
+
+	if _, err := model.GenerateText(context.Background(), "Test prompt", nil); err == nil {
+		t.Error("Expected an error without any model to pick")
+	}
+}
+
+func TestWeightedModelWithFallback(t *testing.T) {
+	failing := &failingModelWithError{err: errors.New("quota exceeded")}
+	lastResort := &mockLanguageModel{response: "last resort"}
+
+	model := NewFallbackModel([]LanguageModel{
+		NewWeightedModel(map[LanguageModel]int{failing: 1}),
+		lastResort,
+	})
+
+	got, err := model.GenerateText(context.Background(), "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "last resort" {
+		t.Errorf("Expected the fallback response, got %q", got)
+	}
+}
+
+func TestWeightedModelMetadata(t *testing.T) {
+	inner := &metadataModel{text: `{"overall`, meta: ResponseMeta{Reason: FinishReasonLength, InputTokens: 100, OutputTokens: 50}}
+	model := NewWeightedModel(map[LanguageModel]int{inner: 1})
+
+	// The metadata of the response goes through the picked model
+	text, meta, err := GenerateTextWithMetadata(context.Background(), model, "Test prompt", nil)
+	if err != nil {
+		t.Fatalf("GenerateTextWithMetadata() error = %v", err)
+	}
+	if text != inner.text || meta != inner.meta {
+		t.Errorf("GenerateTextWithMetadata() = %q, %+v, want %q, %+v", text, meta, inner.text, inner.meta)
+	}
+
+	// So does content caching
+	if name, err := CacheContent(context.Background(), model, "schema"); err != nil || name != "cachedContents/schema" {
+		t.Errorf("CacheContent() = %q, %v, want the handle of the model", name, err)
+	}
+
+	// Unless one of the models can't cache content
+	model = NewWeightedModel(map[LanguageModel]int{inner: 1, &mockLanguageModel{}: 1})
+	if _, err := CacheContent(context.Background(), model, "schema"); !errors.Is(err, ErrContentCachingNotSupported) {
+		t.Errorf("CacheContent() error = %v, want %v", err, ErrContentCachingNotSupported)
+	}
+}
+
+func TestWeightedModelCachedContent(t *testing.T) {
+	gemini := &handleModel{name: "gemini"}
+	mistral := &handleModel{name: "mistral"}
+	model := NewWeightedModel(map[LanguageModel]int{gemini: 1, mistral: 1})
+
+	handle, err := CacheContent(context.Background(), model, "schema")
+	if err != nil {
+		t.Fatalf("CacheContent() error = %v", err)
+	}
+
+	// Whichever model is picked references the content by its own handle
+	for _, pick := range []func(n int) int{func(n int) int { return 0 }, func(n int) int { return n - 1 }} {
+		model.(*weightedModel).intn = pick
+		if _, err := model.GenerateText(context.Background(), "Test prompt", &GenerateOptions{CachedContent: handle}); err != nil {
+			t.Fatalf("GenerateText() error = %v", err)
+		}
+	}
+	if gemini.cachedContent != "gemini/schema" || mistral.cachedContent != "mistral/schema" {
+		t.Errorf("Cached content = %q, %q, want the handle of each model", gemini.cachedContent, mistral.cachedContent)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// outputKeyMaps maps the JSON keys of the insights to their localized names, by locale.
+// Keys missing from the map of a locale keep their English name.
+var outputKeyMaps = map[string]map[string]string{
+	"es": {
+		"overall_assessment":            "evaluacion_general",
+		"questions_answered_correctly":  "preguntas_respondidas_correctamente",
+		"strengths":                     "fortalezas",
+		"weaknesses":                    "debilidades",
+		"actionable_feedback":           "retroalimentacion_accionable",
+		"business_case_impact_analysis": "analisis_de_impacto_en_el_negocio",
+		"skill_gaps":                    "brechas_de_habilidades",
+		"study_plans":                   "planes_de_estudio",
+		"ranked_weaknesses":             "debilidades_clasificadas",
+		"completed_at":                  "completado_en",
+		"generated_at":                  "generado_en",
+		"degraded":                      "degradado",
+		"model_version":                 "version_del_modelo",
+		"finish_reason":                 "motivo_de_finalizacion",
+		"assessment_id":                 "id_de_evaluacion",
+		"quality_score":                 "puntuacion_de_calidad",
+	},
+}
+
+// RegisterOutputLocale makes the localized names of the JSON keys of the insights available
+// to the sinks by locale, keys being the English JSON keys. Locales are registered in init,
+// next to the serializers they rename the keys of.
+func RegisterOutputLocale(locale string, keys map[string]string) {
+	outputKeyMaps[locale] = keys
+}
+
+/*
+LocalizedSerializer renames the top-level keys of the JSON objects encoded by Serializer with
+Keys, for the downstream systems of international deployments expecting localized keys. The
+insights stay English internally, and the keys keep their order. Nested keys, e.g. those of
+the skill gaps, are left untouched, as are the keys of the maps (skills, weaknesses).
+*/
+type LocalizedSerializer struct {
+	Serializer Serializer[InsightsResult]
+	Keys       map[string]string
+}
+
+func (s LocalizedSerializer) Serialize(insights InsightsResult) ([]byte, error) {
+	encoded, err := s.Serializer.Serialize(insights)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("error localizing keys: the serialized insights aren't a JSON object")
+	}
+	var localized bytes.Buffer
+	localized.WriteByte('{')
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error localizing keys: %w", err)
+		}
+		key := token.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("error localizing keys: %w", err)
+		}
+		if name, ok := s.Keys[key]; ok {
+			key = name
+		}
+		if localized.Len() > 1 {
+			localized.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		localized.Write(name)
+		localized.WriteByte(':')
+		localized.Write(value)
+	}
+	localized.WriteByte('}')
+	return localized.Bytes(), nil
+}
+
+// localizedInsightsSerializer returns the serializer registered as name, its keys localized for
+// locale unless locale is empty.
+func localizedInsightsSerializer(name, locale string) (Serializer[InsightsResult], error) {
+	serializer, err := insightsSerializer(name)
+	if err != nil || locale == "" {
+		return serializer, err
+	}
+	keys, ok := outputKeyMaps[locale]
+	if !ok {
+		return nil, fmt.Errorf("error: unknown output locale %q", locale)
+	}
+	return LocalizedSerializer{Serializer: serializer, Keys: keys}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalizedSerializer(t *testing.T) {
+	RegisterOutputLocale("de", map[string]string{
+		"overall_assessment":  "gesamtbewertung",
+		"strengths":           "staerken",
+		"actionable_feedback": "handlungsempfehlungen",
+	})
+	t.Cleanup(func() { delete(outputKeyMaps, "de") })
+
+	fn := &serializeInsightsFn{Locale: "de"}
+	assert.NoError(t, fn.Setup())
+	var lines []string
+	fn.ProcessElement(InsightsResult{
+		OverallAssessment:  "Gut",
+		Strengths:          []string{"IAM"},
+		ActionableFeedback: map[string]string{"strengths": "Weiter so"},
+		AssessmentID:       "a",
+	}, func(line string) { lines = append(lines, line) })
+	if !assert.Len(t, lines, 1) {
+		return
+	}
+
+	// Mapped keys are localized in place, the others and the keys of the maps stay English
+	var localized map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &localized))
+	assert.JSONEq(t, `"Gut"`, string(localized["gesamtbewertung"]))
+	assert.JSONEq(t, `["IAM"]`, string(localized["staerken"]))
+	assert.JSONEq(t, `{"strengths": "Weiter so"}`, string(localized["handlungsempfehlungen"]))
+	assert.JSONEq(t, `"a"`, string(localized["assessment_id"]))
+	assert.NotContains(t, localized, "overall_assessment")
+	assert.True(t, strings.HasPrefix(lines[0], `{"gesamtbewertung":"Gut","questions_answered_correctly":0,"staerken":["IAM"]`), lines[0])
+
+	// The built-in Spanish keys cover every key
+	data, err := LocalizedSerializer{Serializer: JSONSerializer[InsightsResult]{}, Keys: outputKeyMaps["es"]}.Serialize(InsightsResult{Degraded: true, ModelVersion: "v", FinishReason: "STOP", AssessmentID: "a"})
+	assert.NoError(t, err)
+	localized = nil
+	assert.NoError(t, json.Unmarshal(data, &localized))
+	spanish := map[string]bool{}
+	for _, name := range outputKeyMaps["es"] {
+		spanish[name] = true
+	}
+	for key := range localized {
+		assert.True(t, spanish[key], "Expected %q to be localized", key)
+	}
+
+	// Only JSON objects can be localized, and locales must be known
+	_, err = LocalizedSerializer{Serializer: csvSerializer{}, Keys: outputKeyMaps["es"]}.Serialize(InsightsResult{AssessmentID: "a"})
+	assert.Error(t, err)
+	assert.Error(t, (&serializeInsightsFn{Locale: "tlh"}).Setup())
+}
@@ -6,26 +6,71 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/textio"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/x/beamx"
 	"github.com/luillyfe/assessment-data-pipeline/firestoreio"
 )
 
 type Assessment struct {
-	Result string `firestore:"assessment_result"`
+	Result      string    `firestore:"assessment_result" json:"assessment_result"`
+	CompletedAt time.Time `firestore:"completed_at" json:"completed_at"`
+	// PreferredModel is the model the assessment asks to be processed with, if any.
+	PreferredModel string `firestore:"preferred_model" json:"preferred_model,omitempty"`
+	// Priority is PriorityHigh for time-sensitive assessments, processed first with
+	// ExtractInsights.Prioritize. Any other value is normal priority.
+	Priority string `firestore:"priority" json:"priority,omitempty"`
+	// TenantID is the tenant the assessment belongs to in multi-tenant deployments, tagging
+	// the audit records, logs and metrics of its model calls.
+	TenantID string `firestore:"tenant_id" json:"tenant_id,omitempty"`
+	// UserID is the user who took the assessment, whose history enriches the prompt with
+	// ExtractInsights.HistoryTable.
+	UserID string `firestore:"user_id" json:"user_id,omitempty"`
+	// ID is the ID of the assessment document, set by the read.
+	ID string `firestore:"-" json:"id,omitempty"`
+	// Database is the database the assessment was read from, set by the read, empty for the
+	// (default) database.
+	Database string `firestore:"-" json:"database,omitempty"`
+	// Failure is why no insights were extracted, set on the skipped, refused and blocked assessments written out.
+	Failure *Failure `firestore:"-" json:"failure,omitempty"`
 }
 
+// PriorityHigh is the Priority of time-sensitive assessments.
+const PriorityHigh = "high"
+
 func init() {
 	beam.RegisterType(reflect.TypeOf((*Assessment)(nil)).Elem())
 	beam.RegisterFunction(insightsToJSON)
+	beam.RegisterFunction(deadLetterToJSON)
+	beam.RegisterFunction(assessmentToJSON)
+	beam.RegisterFunction(evalRecordToJSON)
+	beam.RegisterFunction(insightsByAssessment)
+	register.DoFn1x1[Assessment, Assessment](&tagDatabaseFn{})
+	register.DoFn2x0[InsightsResult, func(InsightsResult)](&filterDatabaseFn{})
 }
 
 func main() {
-	// Handling os-environment variables
-	projectID, assessmentCollection := handleOSEnvironmentVariables()
+	// Validating the insights schema only, when requested
+	if os.Getenv("VALIDATE_SCHEMA") == "true" {
+		runSchemaValidation()
+		return
+	}
+
+	// Diffing the outputs of two runs only, when requested
+	if baseline, candidate := os.Getenv("DIFF_BASELINE"), os.Getenv("DIFF_CANDIDATE"); baseline != "" && candidate != "" {
+		runDiff(baseline, candidate)
+		return
+	}
+
+	// Loading the configuration, from config.yaml (or CONFIG_FILE) and os-environment variables
+	cfg, err := loadConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize Beam
 	beam.Init()
@@ -33,55 +78,396 @@ func main() {
 	// Create a new Beam pipeline
 	pipeline, scope := beam.NewPipelineWithRoot()
 
-	// Reading data from the source
-	documents := readDataFromSource(scope, projectID, assessmentCollection)
+	// Reading data from the source, a single document of the first database in a smoke test
+	databases, limit := cfg.Databases, 0
+	if cfg.SmokeTest {
+		databases, limit = smokeTestSource(cfg.Databases)
+	}
+	documents, malformed := readDataFromSource(scope, cfg.Project, cfg.Collection, databases, cfg.Watch, cfg.ValidateAssessments, limit)
+
+	// Keeping the malformed assessment documents, with their raw data, apart for review
+	if cfg.ValidateAssessments {
+		textio.Write(scope, malformedPath, beam.ParDo(scope, deadLetterToJSON, malformed))
+	}
+
+	// Skipping the assessments processed by a previous run, when resuming from a checkpoint
+	if cfg.Checkpoint.Location != "" {
+		documents = skipCheckpointed(scope, cfg.Project, cfg.Checkpoint, documents)
+	}
+
+	// Processing a sample of the assessments only, when SAMPLE_RATE is set (never the smoke test document)
+	if cfg.SampleRate > 0 && cfg.SampleRate < 1 && !cfg.SmokeTest {
+		documents = sampleAssessments(scope, cfg.SampleRate, int64(cfg.SampleSeed), documents)
+	}
+
+	// Loading the rubric referenced by every prompt once, when RUBRIC_FILE is set
+	var rubric string
+	if cfg.Rubric != "" {
+		if rubric, err = readFile(cfg.Rubric); err != nil {
+			log.Fatalf("Error loading rubric: %v", err)
+		}
+	}
+
+	// Comparing the providers on the assessments instead of extracting their insights, in benchmark mode
+	if len(cfg.Benchmark) > 0 {
+		comparisons := benchmarkProviders(scope, cfg, rubric, documents)
+		textio.Write(scope, benchmarkPath, beam.ParDo(scope, comparisonToJSON, comparisons))
+		if err := beamx.Run(context.Background(), pipeline); err != nil {
+			log.Fatalf("Failed to execute benchmark: %v", err)
+		}
+		return
+	}
+
+	// Counting the assessments read for the run manifest, when requested
+	if cfg.Manifest != "" {
+		beam.ParDo0(scope, countManifestInputs, documents)
+	}
 
 	// Transforming the data
-	processed := transformData(scope, documents)
+	processed, skipped, refused, recited, evals, raw := transformData(scope, cfg, documents, rubric)
+
+	// Counting the insights extracted for the run manifest, when requested
+	if cfg.Manifest != "" {
+		beam.ParDo0(scope, countManifestOutputs, processed)
+	}
 
 	// Loading the data into the destination
-	loadDataIntoDestination(scope, processed)
+	loadDataIntoDestination(scope, cfg.Output, processed)
+
+	// Recording the processed assessments, so a failed run can be resumed without reprocessing them
+	if cfg.Checkpoint.Location != "" {
+		recordCheckpoint(scope, cfg.Project, cfg.Checkpoint, processed)
+	}
+
+	// Counting the insights of the smoke test document, to report whether it went through
+	if cfg.SmokeTest {
+		beam.ParDo0(scope, countSmokeTestInsights, processed)
+	}
+
+	// Writing the insights to Firestore too, skipping the unchanged ones on reruns, when requested
+	if cfg.Output.FirestoreCollection != "" {
+		writeInsightsToFirestore(scope, cfg.Project, cfg.Output.FirestoreCollection, databases, processed)
+	}
+
+	// Keeping the assessments skipped once the call or cost budget was spent, to process them in a later run
+	if cfg.MaxTotalCalls > 0 || cfg.MaxCost > 0 {
+		textio.Write(scope, skippedBudgetPath, beam.ParDo(scope, assessmentToJSON, skipped))
+	}
+
+	// Keeping the assessments the model refused to answer (e.g. for safety), for review
+	textio.Write(scope, refusedPath, beam.ParDo(scope, assessmentToJSON, refused))
+
+	// Keeping the assessments whose response was blocked for recitation apart, when requested
+	if cfg.Recitation == RecitationOutput {
+		textio.Write(scope, recitationPath, beam.ParDo(scope, assessmentToJSON, recited))
+	}
+
+	// Keeping the prompts and raw responses of the model calls, for prompt-engineering experiments
+	if cfg.Eval {
+		textio.Write(scope, evalPath, beam.ParDo(scope, evalRecordToJSON, evals))
+	}
+
+	// Keeping the raw responses that failed to parse, with their assessment, for manual repair
+	if cfg.RawFailures {
+		textio.Write(scope, rawFailuresPath, beam.ParDo(scope, rawFailureToJSON, evals))
+	}
+
+	// Keeping the insights as parsed, before post-processing, for auditability
+	if cfg.EmitRaw {
+		textio.Write(scope, rawInsightsPath, beam.ParDo(scope, insightsToJSON, raw))
+	}
+
+	// Aggregating the cohort insights, weighted by recency, when cohort.half_life is set
+	if halfLife := cfg.Cohort.HalfLife; halfLife != nil {
+		combine := NewCombineInsights(*halfLife)
+		if cfg.Cohort.Trigger != nil {
+			combine.WithGlobalWindowTrigger(*cfg.Cohort.Trigger)
+		}
+		cohort := combineCohortInsights(scope, combine, processed)
+		textio.Write(scope, "cohort_insights.json", beam.ParDo(scope, cohortToJSON, cohort))
+	}
+
+	// Pushing snapshots of the running cohort counts, for live dashboards, when cohort.snapshot_interval is set
+	if cfg.Cohort.SnapshotInterval > 0 {
+		pushCohortSnapshots(scope, cfg.Cohort.SnapshotInterval, cfg.Cohort.SnapshotPushURL, processed)
+	}
 
 	// Run the pipeline
+	if cfg.SmokeTest {
+		runSmokeTest(pipeline)
+		return
+	}
+	if cfg.Manifest != "" {
+		runWithManifest(pipeline, cfg)
+		return
+	}
 	if err := beamx.Run(context.Background(), pipeline); err != nil {
 		log.Fatalf("Failed to execute job: %v", err)
 	}
 }
 
-func handleOSEnvironmentVariables() (string, string) {
-	// Parse os-environment variables
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
-	if projectID == "" {
-		log.Fatal("Please set the GOOGLE_CLOUD_PROJECT environment variable.")
+// runSchemaValidation validates insights_schema.json against InsightsResult and exits
+// with a non-zero status if it is invalid.
+func runSchemaValidation() {
+	schema, err := readFile("insights_schema.json")
+	if err != nil {
+		log.Fatalf("Failed to read insights schema: %v", err)
+	}
+	if err := validateSchema(schema); err != nil {
+		log.Fatalf("Invalid insights schema: %v", err)
+	}
+	log.Println("Insights schema is valid.")
+}
+
+// readDataFromSource reads the assessments of every database, tailing their changes
+// as they are created or updated when watch is set. A limit bounds the assessments read
+// from each database. With validate, the malformed documents are returned apart as
+// firestoreio.DeadLetters (see WithAssessmentSchemaValidation), batch reads only.
+func readDataFromSource(scope beam.Scope, project, assessmentCollection string, databases []string, watch, validate bool, limit int) (beam.PCollection, beam.PCollection) {
+	// Define the element type
+	elemType := reflect.TypeOf(Assessment{})
+
+	// Read from the (default) database when no database is given
+	if len(databases) == 0 {
+		databases = []string{""}
 	}
 
-	assessmentCollection := os.Getenv("ASSESSMENT_COLLECTION")
-	if assessmentCollection == "" {
-		log.Fatal("Please set the ASSESSMENT_COLLECTION environment variable.")
+	// Read data from every database using firestoreio.Read
+	reads := make([]beam.PCollection, 0, len(databases))
+	var deadLetters []beam.PCollection
+	for _, database := range databases {
+		cfg := firestoreio.ReadConfig{
+			Project:    project,
+			DatabaseID: database,
+			Collection: assessmentCollection,
+			IDField:    "ID",
+			Limit:      limit,
+		}
+		if watch {
+			reads = append(reads, tagDatabase(scope, database, firestoreio.Watch(scope, firestoreio.WatchConfig{ReadConfig: cfg}, elemType)))
+			continue
+		}
+		if validate {
+			cfg = WithAssessmentSchemaValidation(cfg)
+		}
+		read, deadLetter := firestoreio.ReadWithDeadLetter(scope, cfg, elemType)
+		reads = append(reads, tagDatabase(scope, database, read))
+		deadLetters = append(deadLetters, deadLetter)
 	}
 
-	// Return the values of the flags
-	return projectID, assessmentCollection
+	// Flatten the reads into a single collection of assessments
+	if len(reads) == 1 {
+		return reads[0], firstOrFlatten(scope, deadLetters)
+	}
+	return beam.Flatten(scope, reads...), firstOrFlatten(scope, deadLetters)
 }
 
-func readDataFromSource(scope beam.Scope, project, assessmentCollection string) beam.PCollection {
-	// Define the ReadConfig
-	cfg := firestoreio.ReadConfig{
-		Project:    project,
-		Collection: assessmentCollection,
+// tagDatabase sets the database of the assessments read from it, left empty for the (default) one.
+func tagDatabase(scope beam.Scope, database string, assessments beam.PCollection) beam.PCollection {
+	if database == "" {
+		return assessments
 	}
+	return beam.ParDo(scope.Scope("TagDatabase"), &tagDatabaseFn{Database: database}, assessments)
+}
 
-	// Define the element type
-	elemType := reflect.TypeOf(Assessment{})
+// tagDatabaseFn is a DoFn setting the Database of the assessments.
+type tagDatabaseFn struct {
+	Database string
+}
 
-	// Read data from the source using firestoreio.Read
-	return firestoreio.Read(scope, cfg, elemType)
+func (fn *tagDatabaseFn) ProcessElement(assessment Assessment) Assessment {
+	assessment.Database = fn.Database
+	return assessment
 }
 
-func transformData(scope beam.Scope, assessments beam.PCollection) beam.PCollection {
-	extractInsights := NewExtractInsights(3, 10*time.Second)
+// firstOrFlatten flattens the collections, returning the only one as is, and none when empty.
+func firstOrFlatten(scope beam.Scope, collections []beam.PCollection) beam.PCollection {
+	switch len(collections) {
+	case 0:
+		return beam.PCollection{}
+	case 1:
+		return collections[0]
+	}
+	return beam.Flatten(scope, collections...)
+}
+
+// malformedPath is where the malformed assessment documents are written with validate_assessments.
+const malformedPath = "malformed_assessments.jsonl"
+
+// assessmentRequiredFields are the fields of an assessment document no insights can be extracted without.
+var assessmentRequiredFields = []string{"assessment_result"}
+
+// WithAssessmentSchemaValidation validates the assessment documents read with cfg: the ones
+// whose fields don't decode into an Assessment (e.g. a number as assessment_result), or
+// without an assessment_result, are sent to the dead-letter output of the read, with their
+// raw data, instead of failing it or going through as empty assessments.
+func WithAssessmentSchemaValidation(cfg firestoreio.ReadConfig) firestoreio.ReadConfig {
+	cfg.RequiredFields = assessmentRequiredFields
+	cfg.DeadLetter = true
+	return cfg
+}
+
+// deadLetterToJSON converts a firestoreio.DeadLetter to a JSON string
+func deadLetterToJSON(deadLetter firestoreio.DeadLetter) string {
+	jsonBytes, err := json.Marshal(deadLetter)
+	if err != nil {
+		log.Printf("Error marshaling dead letter to JSON: %v", err)
+		return ""
+	}
+	return string(jsonBytes)
+}
+
+// skippedBudgetPath is where the assessments skipped once the call or cost budget was spent are written.
+const skippedBudgetPath = "skipped_budget.jsonl"
+
+// refusedPath is where the assessments the model refused to answer are written.
+const refusedPath = "refused.jsonl"
+
+// recitationPath is where the assessments blocked for recitation are written with the RecitationOutput policy.
+const recitationPath = "recitation.jsonl"
+
+// evalPath is where the eval records of the model calls are written in eval mode.
+const evalPath = "eval.jsonl"
+
+// rawInsightsPath is where the insights are written before post-processing, when requested.
+const rawInsightsPath = "raw_insights.jsonl"
+
+// transformData extracts the insights of the assessments, also returning the assessments
+// skipped once the call budget was spent, the ones the model refused to answer, the ones
+// blocked for recitation, in eval mode, the eval records of the model calls (and, with
+// raw_failures, those of the responses that failed to parse) and, with emit_raw, the
+// insights before post-processing.
+// The rubric, if any, is passed to every ExtractInsights as a side input.
+func transformData(scope beam.Scope, cfg Config, assessments beam.PCollection, rubric string) (beam.PCollection, beam.PCollection, beam.PCollection, beam.PCollection, beam.PCollection, beam.PCollection) {
+	extractInsights := NewExtractInsights(cfg.MaxRetries, cfg.RetryDelay)
+	extractInsights.RetryJitter = cfg.RetryJitter
+	extractInsights.WithRetryOnSchemaValidationFailure(cfg.MaxValidationRetries)
+	extractInsights.MaxTransientRetries = cfg.MaxTransientRetries
+	extractInsights.RetryPredicateName = cfg.RetryPredicate
+	extractInsights.ErrorRateBackoff = cfg.ErrorRateBackoff
+	extractInsights.Timeout = cfg.Timeout
+	extractInsights.LLM = cfg.LLM
+	extractInsights.PreferredModels = cfg.PreferredModels
+	extractInsights.Project = cfg.Project
+	extractInsights.RateLimit = cfg.RateLimit
+	extractInsights.Audit = cfg.Audit
+	extractInsights.MaxTotalCalls = int64(cfg.MaxTotalCalls)
+	extractInsights.WithCostBudgetEnforcement(cfg.MaxCost)
+	extractInsights.WithTransportRetries(cfg.TransportRetries.MaxRetries, cfg.TransportRetries.Backoff)
+	extractInsights.PromptCompressorName = cfg.PromptCompressor
+	extractInsights.PostProcessorNames = cfg.PostProcessors
+	extractInsights.QualityScorerName = cfg.QualityScorer
+	extractInsights.WithAdaptiveMaxTokens(cfg.AdaptiveMaxTokens.Ceiling, cfg.AdaptiveMaxTokens.TruncationRate)
+	extractInsights.WithProviderHealthGate(cfg.HealthGate.Fallback, cfg.HealthGate.Timeout)
+	extractInsights.Eval = cfg.Eval
+	extractInsights.RawFailures = cfg.RawFailures
+	extractInsights.Recitation = cfg.Recitation
+	extractInsights.MinAvgLogprob = cfg.MinAvgLogprob
+	extractInsights.Metrics = cfg.Metrics
+	extractInsights.MaxAssessmentChars = cfg.MaxAssessmentChars
+	extractInsights.Truncation = cfg.Truncation
+	extractInsights.ChunkSize = cfg.ChunkSize
+	extractInsights.ChunkOverlap = cfg.ChunkOverlap
+	extractInsights.EmitRaw = cfg.EmitRaw
+	extractInsights.CacheResponses = cfg.CacheResponses
+	extractInsights.CacheNegativeTTL = cfg.CacheNegativeTTL
+	extractInsights.RepairFields = cfg.RepairFields
+	extractInsights.CacheSchema = cfg.CacheSchema
+	extractInsights.EmitDegraded = cfg.EmitDegraded
+	extractInsights.DeferFailures = cfg.DeferFailures
+	extractInsights.RetryOnEmptyResponse = cfg.RetryOnEmptyResponse
+	extractInsights.RecordResponseMeta = cfg.RecordResponseMeta
+	extractInsights.StructuredTools = cfg.StructuredTools
+	if cfg.GeminiResponseSchema {
+		extractInsights.WithGeminiResponseSchemaFromInsightsResult()
+	}
+	if cfg.HistoryTable != "" {
+		extractInsights.WithContextEnrichmentFromBigQuery(cfg.HistoryTable)
+	}
+	extractInsights.Prioritize = cfg.Prioritize
+	rubrics := beam.CreateList(scope, []string{})
+	if rubric != "" {
+		rubrics = beam.Create(scope, rubric)
+	}
+
+	// Identical, or near-duplicate, assessments share a single model call, whose insights are fanned out to all of them
+	if cfg.DedupePrompts || cfg.DedupeSimilarity > 0 {
+		extractInsights.DedupePrompts = true
+		var representatives, keyed beam.PCollection
+		if cfg.DedupeSimilarity > 0 {
+			representatives, keyed = clusterNearDuplicates(scope, cfg.DedupeSimilarity, assessments)
+		} else {
+			representatives, keyed = dedupeAssessments(scope, assessments)
+		}
+		processed, skipped, refused, recited, evals, raw := beam.ParDo6(scope, extractInsights, representatives, beam.SideInput{Input: rubrics})
+		return fanOutDeduplicated(scope, keyed, processed),
+			fanOutDeduplicatedDeadLetters(scope, keyed, skipped),
+			fanOutDeduplicatedDeadLetters(scope, keyed, refused),
+			fanOutDeduplicatedDeadLetters(scope, keyed, recited),
+			evals,
+			fanOutDeduplicated(scope, keyed, raw)
+	}
+
 	// Process the Firestore documents
-	return beam.ParDo(scope, extractInsights, assessments)
+	return beam.ParDo6(scope, extractInsights, assessments, beam.SideInput{Input: rubrics})
+}
+
+// assessmentToJSON converts an Assessment to a JSON string
+func assessmentToJSON(assessment Assessment) string {
+	jsonBytes, err := json.Marshal(assessment)
+	if err != nil {
+		log.Printf("Error marshaling assessment to JSON: %v", err)
+		return ""
+	}
+	return string(jsonBytes)
+}
+
+// evalRecordToJSON converts an EvalRecord to a JSON string
+func evalRecordToJSON(record EvalRecord) string {
+	jsonBytes, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Error marshaling eval record to JSON: %v", err)
+		return ""
+	}
+	return string(jsonBytes)
+}
+
+// writeInsightsToFirestore writes the insights to the collection of the database their assessment
+// was read from, the (default) one when no database is given.
+func writeInsightsToFirestore(scope beam.Scope, project, collection string, databases []string, insights beam.PCollection) {
+	if len(databases) == 0 {
+		databases = []string{""}
+	}
+
+	for _, database := range databases {
+		databaseInsights := insights
+		if len(databases) > 1 {
+			databaseInsights = beam.ParDo(scope.Scope("FilterDatabase"), &filterDatabaseFn{Database: database}, insights)
+		}
+		firestoreio.Write(scope, firestoreio.WriteConfig{
+			Project:      project,
+			DatabaseID:   database,
+			Collection:   collection,
+			HashField:    "ContentHash",
+			IgnoreFields: []string{"GeneratedAt"},
+		}, beam.ParDo(scope, insightsByAssessment, databaseInsights))
+	}
+}
+
+// filterDatabaseFn is a DoFn keeping the insights of the assessments of Database.
+type filterDatabaseFn struct {
+	Database string
+}
+
+func (fn *filterDatabaseFn) ProcessElement(insights InsightsResult, emit func(InsightsResult)) {
+	if insights.Database == fn.Database {
+		emit(insights)
+	}
+}
+
+// insightsByAssessment keys the insights with the ID of their assessment document.
+func insightsByAssessment(insights InsightsResult) (string, InsightsResult) {
+	return insights.AssessmentID, insights
 }
 
 // insightsToJSON converts InsightsResult to JSON string
@@ -94,9 +480,37 @@ func insightsToJSON(insight InsightsResult) string {
 	return string(jsonBytes)
 }
 
-func loadDataIntoDestination(scope beam.Scope, processed beam.PCollection) {
-	// Convert insights to JSON strings
-	jsonInsights := beam.ParDo(scope, insightsToJSON, processed)
+// loadDataIntoDestination writes the insights to the sink of the output config, each sink
+// serializing them with the serializer it declares: length-prefixed protobuf records for
+// output.format proto, lines encoded with the serializer of output.format otherwise.
+func loadDataIntoDestination(scope beam.Scope, output OutputConfig, processed beam.PCollection) {
+	// Write length-prefixed protobuf records when output.format is proto
+	if output.Format == OutputFormatProto {
+		writeProtoRecords(scope, output.Path, processed)
+		return
+	}
+
+	// Write the insights partitioned by generation date when output.partitioned is set
+	if output.Partitioned {
+		writePartitionedJSONL(scope, output.Path, output.Format, output.Locale, processed)
+		return
+	}
+
+	// Serialize the insights into the lines of the line-oriented sinks
+	lines := serializeInsights(scope, output.Format, output.Locale, processed)
+
+	// Append each insight to a local file as soon as it is extracted when output.append is set
+	if output.Append {
+		appendJSONL(scope, output.Path, output.SyncInterval, lines)
+		return
+	}
+
+	// Write incrementally when output.flush_every is set, so partial results are durable
+	if output.FlushEvery > 0 {
+		writeJSONLIncrementally(scope, strings.TrimSuffix(output.Path, ".jsonl"), output.FlushEvery, output.Window, lines)
+		return
+	}
+
 	// Write the processed data to the destination
-	textio.Write(scope, "processed.jsonl", jsonInsights)
+	textio.Write(scope, output.Path, lines)
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/x/beamx"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	register.Function2x0(countManifestInputs)
+	register.Function2x0(countManifestOutputs)
+}
+
+// manifestNamespace is the namespace of the Beam counters summed up into the run manifest.
+const manifestNamespace = "manifest"
+
+// Beam counters of the run, summed up across workers into the run manifest once it completes.
+var (
+	// manifestInputs counts the assessments sent to the extraction.
+	manifestInputs = beam.NewCounter(manifestNamespace, "inputs")
+	// manifestOutputs counts the insights extracted, degraded ones excluded.
+	manifestOutputs = beam.NewCounter(manifestNamespace, "outputs")
+	// manifestInputTokens and manifestOutputTokens count the tokens of the model calls.
+	manifestInputTokens  = beam.NewCounter(manifestNamespace, "input_tokens")
+	manifestOutputTokens = beam.NewCounter(manifestNamespace, "output_tokens")
+)
+
+// RunManifest is the auditable summary of a run, written to the manifest path once it completes.
+type RunManifest struct {
+	InputCount int64 `json:"input_count"`
+	// OutputCount is the number of insights extracted, degraded ones excluded.
+	OutputCount int64 `json:"output_count"`
+	// FailureCount is the number of assessments left without insights, refused and skipped
+	// ones included.
+	FailureCount int64 `json:"failure_count"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
+	// TotalCost is computed from the token counts, with the prices of the metrics config.
+	TotalCost float64   `json:"total_cost"`
+	Providers []string  `json:"providers"`
+	Models    []string  `json:"models"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// ConfigHash is the hex-encoded SHA-256 of the configuration of the run, as YAML.
+	ConfigHash string `json:"config_hash"`
+}
+
+// countManifestInputs counts an assessment sent to the extraction.
+func countManifestInputs(ctx context.Context, _ Assessment) {
+	manifestInputs.Inc(ctx, 1)
+}
+
+// countManifestOutputs counts the extracted insights, unless they are degraded.
+func countManifestOutputs(ctx context.Context, insights InsightsResult) {
+	if !insights.Degraded {
+		manifestOutputs.Inc(ctx, 1)
+	}
+}
+
+// manifestCounter returns the sum of the manifest counter of the given name across steps and workers.
+func manifestCounter(results metrics.Results, name string) int64 {
+	var sum int64
+	counters := results.Query(func(r metrics.SingleResult) bool {
+		return r.Namespace() == manifestNamespace && r.Name() == name
+	}).Counters()
+	for _, counter := range counters {
+		sum += counter.Result()
+	}
+	return sum
+}
+
+// configHash returns the hex-encoded SHA-256 of the configuration, marshaled as YAML.
+func configHash(cfg Config) (string, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newRunManifest summarizes the run of cfg from the manifest counters of its metrics results.
+func newRunManifest(cfg Config, results metrics.Results, start, end time.Time) (RunManifest, error) {
+	hash, err := configHash(cfg)
+	if err != nil {
+		return RunManifest{}, err
+	}
+
+	manifest := RunManifest{
+		InputCount:   manifestCounter(results, "inputs"),
+		OutputCount:  manifestCounter(results, "outputs"),
+		InputTokens:  manifestCounter(results, "input_tokens"),
+		OutputTokens: manifestCounter(results, "output_tokens"),
+		Providers:    []string{cfg.LLM.Provider},
+		Models:       append([]string{cfg.LLM.Model}, cfg.PreferredModels...),
+		StartTime:    start,
+		EndTime:      end,
+		ConfigHash:   hash,
+	}
+	// Deduplicated assessments are fanned out, so every input has its insights or failed
+	manifest.FailureCount = max(manifest.InputCount-manifest.OutputCount, 0)
+	manifest.TotalTokens = manifest.InputTokens + manifest.OutputTokens
+	manifest.TotalCost = (float64(manifest.InputTokens)*cfg.Metrics.InputTokenCost + float64(manifest.OutputTokens)*cfg.Metrics.OutputTokenCost) / 1e6
+	return manifest, nil
+}
+
+// writeManifest writes the manifest as indented JSON to path, on any Beam filesystem.
+func writeManifest(ctx context.Context, path string, manifest RunManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling manifest: %w", err)
+	}
+
+	fs, err := filesystem.New(ctx, path)
+	if err != nil {
+		return fmt.Errorf("error initializing filesystem: %w", err)
+	}
+	defer fs.Close()
+	if err := filesystem.Write(ctx, fs, path, append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing manifest %s: %w", path, err)
+	}
+	return nil
+}
+
+// runWithManifest runs the pipeline, then writes the manifest of the run to cfg.Manifest.
+func runWithManifest(pipeline *beam.Pipeline, cfg Config) {
+	ctx := context.Background()
+	start := time.Now().UTC()
+	result, err := beamx.RunWithMetrics(ctx, pipeline)
+	if err != nil {
+		log.Fatalf("Failed to execute job: %v", err)
+	}
+
+	var results metrics.Results
+	if result != nil {
+		results = result.Metrics()
+	} else {
+		log.Println("Warning: the runner reported no metrics, the manifest counts are zero")
+	}
+	manifest, err := newRunManifest(cfg, results, start, time.Now().UTC())
+	if err != nil {
+		log.Fatalf("Error creating run manifest: %v", err)
+	}
+	if err := writeManifest(ctx, cfg.Manifest, manifest); err != nil {
+		log.Fatalf("Error writing run manifest: %v", err)
+	}
+	log.Printf("Run manifest written to %s", cfg.Manifest)
+}
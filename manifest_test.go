@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	_ "github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunManifest(t *testing.T) {
+	counter := func(step, name string, value int64) metrics.CounterResult {
+		return metrics.CounterResult{Attempted: value, Key: metrics.StepKey{Step: step, Name: name, Namespace: manifestNamespace}}
+	}
+	results := metrics.NewResults([]metrics.CounterResult{
+		counter("countManifestInputs", "inputs", 10),
+		counter("ExtractInsights", "input_tokens", 600_000),
+		counter("ExtractInsights", "output_tokens", 100_000),
+		// Counters of the same name are summed up across steps
+		counter("countManifestOutputs", "outputs", 5),
+		counter("countManifestOutputs-2", "outputs", 3),
+		{Attempted: 99, Key: metrics.StepKey{Step: "SmokeTest", Name: "inputs", Namespace: "smoke_test"}},
+	}, nil, nil, nil, nil)
+
+	cfg := defaultConfig()
+	cfg.LLM = llm.LLMConfig{Provider: llm.ProviderAnthropic, Model: "claude-3-5-sonnet-20240620"}
+	cfg.PreferredModels = []string{"claude-3-haiku-20240307"}
+	cfg.Metrics = MetricsConfig{InputTokenCost: 3, OutputTokenCost: 15}
+	start := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	manifest, err := newRunManifest(cfg, *results, start, end)
+	if !assert.NoError(t, err) {
+		return
+	}
+	hash, _ := configHash(cfg)
+	assert.Equal(t, RunManifest{
+		InputCount:   10,
+		OutputCount:  8,
+		FailureCount: 2,
+		InputTokens:  600_000,
+		OutputTokens: 100_000,
+		TotalTokens:  700_000,
+		TotalCost:    3.3,
+		Providers:    []string{llm.ProviderAnthropic},
+		Models:       []string{"claude-3-5-sonnet-20240620", "claude-3-haiku-20240307"},
+		StartTime:    start,
+		EndTime:      end,
+		ConfigHash:   hash,
+	}, manifest)
+	assert.Len(t, manifest.ConfigHash, 64)
+
+	// The hash changes with the configuration
+	cfg.MaxRetries++
+	otherHash, _ := configHash(cfg)
+	assert.NotEqual(t, hash, otherHash)
+
+	// The manifest is written as JSON
+	path := "memfs://runs/manifest.json"
+	ctx := context.Background()
+	if !assert.NoError(t, writeManifest(ctx, path, manifest)) {
+		return
+	}
+	fs, err := filesystem.New(ctx, path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := filesystem.Read(ctx, fs, path)
+	assert.NoError(t, err)
+	var written RunManifest
+	assert.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, manifest, written)
+}
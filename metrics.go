@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// Beam distributions of the model calls, reported by the runner (e.g. in the Dataflow UI)
+// with their count, min, max and mean, to diagnose tail latency and oversized prompts.
+var (
+	// llmLatency is the latency of each model call, in milliseconds.
+	llmLatency = beam.NewDistribution("extract_insights", "llm_latency_ms")
+	// promptSize is the size of each prompt sent, in bytes.
+	promptSize = beam.NewDistribution("extract_insights", "prompt_bytes")
+	// providerErrorRateGauge is the rolling error rate of the provider on the worker, in per mille.
+	providerErrorRateGauge = beam.NewGauge("extract_insights", "provider_error_rate_permille")
+)
+
+// tenantLatency is the latency of the model calls of a tenant, in milliseconds, reported under
+// the "tenant/<tenant ID>" namespace so each tenant's calls can be told apart.
+func tenantLatency(tenantID string) beam.Distribution {
+	return beam.NewDistribution("tenant/"+tenantID, "llm_latency_ms")
+}
+
+// modelTokens returns the distributions of the prompt and completion tokens of the calls to a
+// model, reported under the "tokens/<provider>/<model>" namespace for capacity planning.
+func modelTokens(provider, model string) (prompt, completion beam.Distribution) {
+	if model == "" {
+		model = "default"
+	}
+	namespace := "tokens/" + provider + "/" + model
+	return beam.NewDistribution(namespace, "prompt_tokens"), beam.NewDistribution(namespace, "completion_tokens")
+}
+
+// recordTokens updates the token distributions of the model from the usage of a call, when
+// the provider reported it.
+func (ei *ExtractInsights) recordTokens(ctx context.Context, model string, meta llm.ResponseMeta) {
+	if meta.InputTokens == 0 && meta.OutputTokens == 0 {
+		return
+	}
+	prompt, completion := modelTokens(ei.provider(), model)
+	prompt.Update(ctx, int64(meta.InputTokens))
+	completion.Update(ctx, int64(meta.OutputTokens))
+}
+
+// pipelineMetrics counts the work of every ExtractInsights of the worker, exported with MetricsConfig.
+type pipelineMetrics struct {
+	// processed counts the assessments whose insights were extracted.
+	processed atomic.Int64
+	// failed counts the assessments left without insights, refused ones included.
+	failed atomic.Int64
+	// retries counts the model calls made after the first attempt of an assessment.
+	retries      atomic.Int64
+	inputTokens  atomic.Int64
+	outputTokens atomic.Int64
+}
+
+// workerMetrics are the metrics of the worker, shared like totalCalls.
+var workerMetrics pipelineMetrics
+
+// reset zeroes every counter.
+func (m *pipelineMetrics) reset() {
+	for _, counter := range []*atomic.Int64{&m.processed, &m.failed, &m.retries, &m.inputTokens, &m.outputTokens} {
+		counter.Store(0)
+	}
+}
+
+/*
+writeOpenMetrics writes the counters in the OpenMetrics text format, ending with "# EOF".
+The total cost is computed from the token counts, with the prices of a million tokens of cfg.
+*/
+func (m *pipelineMetrics) writeOpenMetrics(w io.Writer, cfg MetricsConfig) error {
+	inputTokens, outputTokens := m.inputTokens.Load(), m.outputTokens.Load()
+	cost := (float64(inputTokens)*cfg.InputTokenCost + float64(outputTokens)*cfg.OutputTokenCost) / 1e6
+
+	var b strings.Builder
+	counter := func(name, help string, samples ...string) {
+		fmt.Fprintf(&b, "# TYPE %s counter\n# HELP %s %s\n", name, name, help)
+		for _, sample := range samples {
+			fmt.Fprintf(&b, "%s_total%s\n", name, sample)
+		}
+	}
+	counter("assessment_pipeline_processed", "Assessments whose insights were extracted.", fmt.Sprintf(" %d", m.processed.Load()))
+	counter("assessment_pipeline_failed", "Assessments left without insights, refused ones included.", fmt.Sprintf(" %d", m.failed.Load()))
+	counter("assessment_pipeline_retries", "Model calls made after the first attempt of an assessment.", fmt.Sprintf(" %d", m.retries.Load()))
+	counter("assessment_pipeline_tokens", "Tokens billed for the model calls.",
+		fmt.Sprintf(`{direction="input"} %d`, inputTokens),
+		fmt.Sprintf(`{direction="output"} %d`, outputTokens),
+	)
+	counter("assessment_pipeline_cost", "Cost of the model calls, from the configured token prices.", " "+strconv.FormatFloat(cost, 'g', -1, 64))
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMetricsFile replaces the OpenMetrics file at path with the current counters,
+// through a temporary file so readers never see it half written.
+func (m *pipelineMetrics) writeMetricsFile(path string, cfg MetricsConfig) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating metrics file: %w", err)
+	}
+
+	if err := m.writeOpenMetrics(f, cfg); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing metrics file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error renaming metrics file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExtractInsights_Metrics(t *testing.T) {
+	workerMetrics.reset()
+	t.Cleanup(workerMetrics.reset)
+
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	mockLLM := new(MockMetadataLanguageModel)
+	ei := &ExtractInsights{
+		model:      mockLLM,
+		MaxRetries: 2,
+		RetryDelay: time.Millisecond,
+		Metrics:    MetricsConfig{Path: path, InputTokenCost: 3, OutputTokenCost: 15},
+	}
+
+	// The first assessment succeeds after a retry, the second one fails both attempts
+	usage := llm.ResponseMeta{Reason: llm.FinishReasonStop, InputTokens: 1000, OutputTokens: 200}
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": `, usage, nil).Once()
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, usage, nil).Once()
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`not json`, usage, nil).Twice()
+
+	emit := func(InsightsResult) {}
+	for _, result := range []string{"First assessment.", "Second assessment."} {
+		ei.ProcessElement(context.Background(), Assessment{Result: result}, noRubric, emit, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+	ei.FinishBundle(noRubric, emit, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read metrics file: %v", err)
+	}
+
+	// 4 calls: 4000 input tokens at 3 and 800 output tokens at 15 per million
+	expected := `# TYPE assessment_pipeline_processed counter
+# HELP assessment_pipeline_processed Assessments whose insights were extracted.
+assessment_pipeline_processed_total 1
+# TYPE assessment_pipeline_failed counter
+# HELP assessment_pipeline_failed Assessments left without insights, refused ones included.
+assessment_pipeline_failed_total 1
+# TYPE assessment_pipeline_retries counter
+# HELP assessment_pipeline_retries Model calls made after the first attempt of an assessment.
+assessment_pipeline_retries_total 2
+# TYPE assessment_pipeline_tokens counter
+# HELP assessment_pipeline_tokens Tokens billed for the model calls.
+assessment_pipeline_tokens_total{direction="input"} 4000
+assessment_pipeline_tokens_total{direction="output"} 800
+# TYPE assessment_pipeline_cost counter
+# HELP assessment_pipeline_cost Cost of the model calls, from the configured token prices.
+assessment_pipeline_cost_total 0.024
+# EOF
+`
+	assert.Equal(t, expected, string(content))
+	mockLLM.AssertExpectations(t)
+
+	// No temporary file is left behind
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err), "Expected no temporary metrics file")
+}
+
+func TestExtractInsights_Distributions(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, InsightsSchema: `{"type": "object"}`, MaxRetries: 2, RetryDelay: time.Millisecond}
+
+	// The first call is slow and unparseable, the retry succeeds
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		After(20*time.Millisecond).Return(`not json`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+
+	ctx := metrics.SetPTransformID(metrics.SetBundleID(context.Background(), "bundle"), "ExtractInsights")
+	ei.ProcessElement(ctx, Assessment{Result: "User performance data."}, noRubric, func(InsightsResult) {}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	mockLLM.AssertExpectations(t)
+
+	type distribution struct{ count, sum, min, max int64 }
+	distributions := make(map[string]distribution)
+	err := metrics.Extractor{
+		DistributionInt64: func(labels metrics.Labels, count, sum, min, max int64) {
+			distributions[labels.Name()] = distribution{count, sum, min, max}
+		},
+	}.ExtractFrom(metrics.GetStore(ctx))
+	if err != nil {
+		t.Fatalf("Failed to extract metrics: %v", err)
+	}
+
+	// Both distributions are updated once per call
+	latency := distributions["llm_latency_ms"]
+	assert.Equal(t, int64(2), latency.count)
+	assert.GreaterOrEqual(t, latency.max, int64(20))
+
+	size := distributions["prompt_bytes"]
+	assert.Equal(t, int64(2), size.count)
+	assert.Greater(t, size.min, int64(len("User performance data.")))
+	assert.Equal(t, size.min, size.max)
+}
+
+func TestExtractInsights_TokenDistributions(t *testing.T) {
+	mockLLM := new(MockMetadataLanguageModel)
+	ei := &ExtractInsights{
+		model:      mockLLM,
+		MaxRetries: 1,
+		LLM:        llm.LLMConfig{Provider: llm.ProviderAnthropic, Model: "claude-3-5-sonnet-20240620"},
+	}
+
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good"}`, llm.ResponseMeta{InputTokens: 1200, OutputTokens: 300}, nil).Once()
+	mockLLM.On("GenerateTextWithMetadata", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good"}`, llm.ResponseMeta{InputTokens: 800, OutputTokens: 500}, nil).Once()
+
+	ctx := metrics.SetPTransformID(metrics.SetBundleID(context.Background(), "bundle"), "ExtractInsights")
+	for range 2 {
+		ei.ProcessElement(ctx, Assessment{Result: "User performance data."}, noRubric, func(InsightsResult) {}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	}
+	mockLLM.AssertExpectations(t)
+
+	type distribution struct{ count, sum, min, max int64 }
+	distributions := make(map[string]distribution)
+	err := metrics.Extractor{
+		DistributionInt64: func(labels metrics.Labels, count, sum, min, max int64) {
+			distributions[labels.Namespace()+"/"+labels.Name()] = distribution{count, sum, min, max}
+		},
+	}.ExtractFrom(metrics.GetStore(ctx))
+	if err != nil {
+		t.Fatalf("Failed to extract metrics: %v", err)
+	}
+
+	// Both distributions are labeled with the provider and model, updated from the usage of every call
+	namespace := "tokens/anthropic/claude-3-5-sonnet-20240620/"
+	assert.Equal(t, distribution{count: 2, sum: 2000, min: 800, max: 1200}, distributions[namespace+"prompt_tokens"])
+	assert.Equal(t, distribution{count: 2, sum: 800, min: 300, max: 500}, distributions[namespace+"completion_tokens"])
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	RegisterKeyExtractor("preferred_model", preferredModelKey)
+	register.DoFn4x0[string, func(*Assessment) bool, func(Assessment), func(string, Assessment)](&clusterNearDuplicatesFn{})
+	register.DoFn1x2[Assessment, string, Assessment](&nearDuplicateBlockFn{})
+	register.Emitter2[string, Assessment]()
+}
+
+// preferredModelKey is the key extractor registered as "preferred_model": the model the
+// assessment asks to be processed with, empty for the configured model.
+func preferredModelKey(assessment Assessment) string {
+	return assessment.PreferredModel
+}
+
+/*
+similarity is the normalized edit similarity of two texts: 1 minus their Levenshtein distance,
+in runes, over the length of the longer one: 1 for identical texts, 0 for texts with nothing in
+common. Texts whose lengths alone put them below threshold aren't compared, and get 0.
+*/
+func similarity(a, b string, threshold float64) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(ra) == 0 {
+		return 1
+	}
+	// The distance is at least the difference of the lengths
+	if float64(len(rb))/float64(len(ra)) < threshold {
+		return 0
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			substitution := previous[j-1]
+			if ra[i-1] != rb[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(len(ra))
+}
+
+/*
+lengthBand is the band of the length of a result, in runes, for the threshold: bands are
+geometric, of ratio 1/threshold, so the lengths of a band are always close enough for their
+similarity to reach threshold, and the lengths of two near-duplicates fall in the same or
+adjacent bands. A threshold of 1 bands the lengths one by one.
+*/
+func lengthBand(result string, threshold float64) int {
+	length := len([]rune(result))
+	if length == 0 || threshold >= 1 {
+		return length
+	}
+	return int(math.Log(float64(length)) / math.Log(1/threshold))
+}
+
+/*
+nearDuplicateBlockFn is a DoFn keying the assessments with their block, within which near-
+duplicates are looked for: their preferred model and the lengthBand of their result, so the
+pairwise comparisons stay within groups of similar lengths, clustered in parallel, rather than
+spanning the whole run. Near-duplicates whose lengths straddle two bands aren't collapsed: they
+are extracted separately, costing a model call more.
+*/
+type nearDuplicateBlockFn struct {
+	Threshold float64
+}
+
+func (fn *nearDuplicateBlockFn) ProcessElement(assessment Assessment) (string, Assessment) {
+	return assessment.PreferredModel + "\x00" + strconv.Itoa(lengthBand(assessment.Result, fn.Threshold)), assessment
+}
+
+/*
+clusterNearDuplicatesFn is a DoFn clustering the assessments of a block (see
+nearDuplicateBlockFn), sharing a preferred model and a length band, whose results are at least
+Threshold similar (see similarity). Assessments are clustered greedily, in (result, ID) order so
+reruns form the same clusters: each one joins the cluster of the first representative it is
+similar enough to, or becomes the representative of a new one.
+
+Representatives are emitted to the first output, and every assessment to the second one keyed
+with the prompt key of its representative, from which fanOutDeduplicated fans the insights out.
+*/
+type clusterNearDuplicatesFn struct {
+	Threshold float64
+}
+
+func (fn *clusterNearDuplicatesFn) ProcessElement(_ string, assessments func(*Assessment) bool, emitRepresentative func(Assessment), emitKeyed func(string, Assessment)) {
+	var group []Assessment
+	var assessment Assessment
+	for assessments(&assessment) {
+		group = append(group, assessment)
+	}
+	slices.SortStableFunc(group, func(a, b Assessment) int {
+		return cmp.Or(cmp.Compare(a.Result, b.Result), cmp.Compare(a.ID, b.ID))
+	})
+
+	var representatives []Assessment
+	for _, assessment := range group {
+		representative := -1
+		for i, candidate := range representatives {
+			if similarity(candidate.Result, assessment.Result, fn.Threshold) >= fn.Threshold {
+				representative = i
+				break
+			}
+		}
+		if representative < 0 {
+			representative = len(representatives)
+			representatives = append(representatives, assessment)
+			emitRepresentative(assessment)
+		}
+		emitKeyed(promptKey(representatives[representative]), assessment)
+	}
+}
+
+/*
+clusterNearDuplicates collapses the near-duplicate assessments of the run (e.g. template answers
+differing in a name or a typo), whose results are at least threshold similar, into clusters of
+which a single representative is extracted. Like dedupeAssessments, it returns the
+representatives and the assessments keyed with the prompt key of their representative.
+
+Assessments are compared pairwise within the groups of a GroupByKey by block, their preferred
+model and length band (see nearDuplicateBlockFn), i.e. within the window of the assessments: it
+suits batches of short assessments.
+*/
+func clusterNearDuplicates(scope beam.Scope, threshold float64, assessments beam.PCollection) (representatives, keyed beam.PCollection) {
+	scope = scope.Scope("ClusterNearDuplicates")
+	grouped := beam.GroupByKey(scope, beam.ParDo(scope, &nearDuplicateBlockFn{Threshold: threshold}, assessments))
+	return beam.ParDo2(scope, &clusterNearDuplicatesFn{Threshold: threshold}, grouped)
+}
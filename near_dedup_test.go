@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSimilarity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a, b     string
+		expected float64
+	}{
+		{name: "Identical", a: "BigQuery", b: "BigQuery", expected: 1},
+		{name: "Empty", a: "", b: "", expected: 1},
+		{name: "One substitution", a: "kitten", b: "sitten", expected: 1 - 1.0/6},
+		{name: "Classic example", a: "kitten", b: "sitting", expected: 1 - 3.0/7},
+		{name: "Lengths too far apart", a: "a", b: "a much longer answer", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, similarity(tc.a, tc.b, 0.5), 1e-9)
+		})
+	}
+}
+
+func TestNearDuplicateBlockFn(t *testing.T) {
+	fn := &nearDuplicateBlockFn{Threshold: 0.9}
+	key := func(assessment Assessment) string {
+		key, _ := fn.ProcessElement(assessment)
+		return key
+	}
+	short := Assessment{Result: "Template answer from Ann: 7 of 10 correct, weak on IAM."}
+
+	// Close lengths share a block
+	assert.Equal(t, key(short), key(Assessment{Result: "Template answer from Cid: 7 of 10 correct, weak on IAN."}))
+	// Near-duplicates straddling two bands are extracted separately
+	assert.NotEqual(t, key(short), key(Assessment{Result: "Template answer from Cid: 7 of 10 corect, weak on IAM."}))
+	// Lengths too far apart to reach the threshold don't
+	assert.NotEqual(t, key(short), key(Assessment{Result: "A free-form answer, much longer than the template: strong on BigQuery, 10 of 10 correct."}))
+	// Neither do different preferred models
+	assert.NotEqual(t, key(short), key(Assessment{Result: short.Result, PreferredModel: "gpt-4o"}))
+	// The lengths of a band always pass the length check of similarity
+	for length := 1; length < 500; length++ {
+		for other := length + 1; lengthBand(string(make([]rune, other)), 0.9) == lengthBand(string(make([]rune, length)), 0.9); other++ {
+			assert.GreaterOrEqual(t, float64(length)/float64(other), 0.9)
+		}
+	}
+	assert.Equal(t, 0, lengthBand("", 0.9))
+	assert.Equal(t, 3, lengthBand("abc", 1))
+}
+
+func TestClusterNearDuplicates(t *testing.T) {
+	base := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	nearDuplicates := []Assessment{
+		{ID: "b", Result: "Template answer from Bob: 7 of 10 correct, weak on IAM.", CompletedAt: base.Add(time.Hour)},
+		{ID: "a", Result: "Template answer from Ann: 7 of 10 correct, weak on IAM.", CompletedAt: base},
+		{ID: "c", Result: "Template answer from Cid: 7 of 10 corect, weak on IAM.", CompletedAt: base.Add(2 * time.Hour)},
+	}
+	different := Assessment{ID: "d", Result: "Free-form answer: strong on BigQuery, 10 of 10 correct."}
+
+	// The near-duplicates are collapsed around a single representative
+	fn := &clusterNearDuplicatesFn{Threshold: 0.9}
+	var (
+		representatives []Assessment
+		keys            = make(map[string]string)
+	)
+	fn.ProcessElement("", iterate(append(nearDuplicates, different)...), func(assessment Assessment) {
+		representatives = append(representatives, assessment)
+	}, func(key string, assessment Assessment) {
+		keys[assessment.ID] = key
+	})
+	assert.Equal(t, []Assessment{different, nearDuplicates[1]}, representatives)
+	assert.Equal(t, map[string]string{
+		"a": promptKey(nearDuplicates[1]),
+		"b": promptKey(nearDuplicates[1]),
+		"c": promptKey(nearDuplicates[1]),
+		"d": promptKey(different),
+	}, keys)
+
+	// A single model call serves the whole cluster
+	mockLLM := new(MockLanguageModel)
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+	ei := &ExtractInsights{model: mockLLM, MaxRetries: 1, RetryDelay: time.Millisecond, DedupePrompts: true}
+
+	var extracted []InsightsResult
+	ei.ProcessElement(context.Background(), representatives[1], noRubric, func(insights InsightsResult) {
+		extracted = append(extracted, insights)
+	}, noSkipped(t), noRefused(t), noRecited(t), noEvals(t), noRaw(t))
+	mockLLM.AssertExpectations(t)
+
+	var results []InsightsResult
+	fanOutInsights(keys["a"], iterate(extracted...), iterate(nearDuplicates...), func(insights InsightsResult) {
+		results = append(results, insights)
+	})
+	if assert.Len(t, results, 3) {
+		for i, insights := range results {
+			assert.Equal(t, "Good performance", insights.OverallAssessment)
+			assert.Equal(t, nearDuplicates[i].ID, insights.AssessmentID)
+		}
+	}
+
+	// A stricter threshold keeps them apart
+	representatives = nil
+	(&clusterNearDuplicatesFn{Threshold: 0.99}).ProcessElement("", iterate(nearDuplicates...), func(assessment Assessment) {
+		representatives = append(representatives, assessment)
+	}, func(string, Assessment) {})
+	assert.Len(t, representatives, 3)
+
+	// The clustering is wired into the pipeline
+	_, scope := beam.NewPipelineWithRoot()
+	assessments := beam.Create(scope, nearDuplicates[0], nearDuplicates[1])
+	assert.NotPanics(t, func() { transformData(scope, Config{MaxRetries: 1, DedupeSimilarity: 0.9}, assessments, "") })
+}
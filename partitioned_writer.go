@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	_ "github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/gcs"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn2x1[context.Context, InsightsResult, error](&writePartitionedJSONLFn{})
+}
+
+// unknownPartition is the date partition of insights without a generation time.
+const unknownPartition = "unknown"
+
+// partitionPath returns the date partition directory of insights generated at generatedAt,
+// e.g. "gs://bucket/insights/dt=2024-01-01". Dates are taken in UTC.
+func partitionPath(base string, generatedAt time.Time) string {
+	dt := unknownPartition
+	if !generatedAt.IsZero() {
+		dt = generatedAt.UTC().Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s/dt=%s", strings.TrimSuffix(base, "/"), dt)
+}
+
+// writePartitionedJSONLFn is a DoFn that writes insights as JSON lines partitioned by the
+// date they were generated at, as "<Base>/dt=YYYY-MM-DD/part-<shard>.jsonl" files.
+// Each bundle writes its own shard, so insights arriving late are added to the partition
+// of their date in a new file rather than to the partition being written. Lines are encoded
+// with the Serializer it names, JSON when empty, their keys localized for Locale unless empty.
+type writePartitionedJSONLFn struct {
+	Base       string
+	Serializer string
+	Locale     string
+	serializer Serializer[InsightsResult]
+	fs         filesystem.Interface
+	shard      string
+	partitions map[string][]string
+}
+
+func (fn *writePartitionedJSONLFn) Setup(ctx context.Context) error {
+	serializer, err := localizedInsightsSerializer(fn.Serializer, fn.Locale)
+	if err != nil {
+		return err
+	}
+	fn.serializer = serializer
+	fs, err := filesystem.New(ctx, fn.Base)
+	if err != nil {
+		return fmt.Errorf("error initializing filesystem: %w", err)
+	}
+	fn.fs = fs
+	return nil
+}
+
+func (fn *writePartitionedJSONLFn) StartBundle(_ context.Context) {
+	fn.shard = strconv.FormatInt(rand.Int63(), 36)
+	fn.partitions = make(map[string][]string)
+}
+
+func (fn *writePartitionedJSONLFn) ProcessElement(_ context.Context, insights InsightsResult) error {
+	line, err := fn.serializer.Serialize(insights)
+	if err != nil {
+		return fmt.Errorf("error serializing insights: %w", err)
+	}
+
+	partition := partitionPath(fn.Base, insights.GeneratedAt)
+	fn.partitions[partition] = append(fn.partitions[partition], string(line))
+	return nil
+}
+
+func (fn *writePartitionedJSONLFn) FinishBundle(ctx context.Context) error {
+	for partition, lines := range fn.partitions {
+		part := fmt.Sprintf("%s/part-%s.jsonl", partition, fn.shard)
+		data := []byte(strings.Join(lines, "\n") + "\n")
+		if err := filesystem.Write(ctx, fn.fs, part, data); err != nil {
+			return fmt.Errorf("error writing part file %s: %w", part, err)
+		}
+	}
+	fn.partitions = nil
+	return nil
+}
+
+func (fn *writePartitionedJSONLFn) Teardown() error {
+	if fn.fs == nil {
+		return nil
+	}
+	if err := fn.fs.Close(); err != nil {
+		return fmt.Errorf("error closing filesystem: %w", err)
+	}
+	return nil
+}
+
+// writePartitionedJSONL writes the insights as date-partitioned, sharded files under base, of
+// lines encoded with the named serializer (JSON when empty), localized for locale.
+func writePartitionedJSONL(scope beam.Scope, base, serializer, locale string, insights beam.PCollection) {
+	scope = scope.Scope("writePartitionedJSONL")
+	beam.ParDo0(scope, &writePartitionedJSONLFn{Base: base, Serializer: serializer, Locale: locale}, insights)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/filesystem/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionPath(t *testing.T) {
+	testCases := []struct {
+		name        string
+		base        string
+		generatedAt time.Time
+		expected    string
+	}{
+		{
+			name:        "GCS base",
+			base:        "gs://bucket/insights",
+			generatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			expected:    "gs://bucket/insights/dt=2024-01-01",
+		},
+		{
+			name:        "Trailing slash",
+			base:        "gs://bucket/insights/",
+			generatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			expected:    "gs://bucket/insights/dt=2024-01-01",
+		},
+		{
+			name:        "Date taken in UTC",
+			base:        "gs://bucket/insights",
+			generatedAt: time.Date(2023, 12, 31, 22, 0, 0, 0, time.FixedZone("UTC-5", -5*60*60)),
+			expected:    "gs://bucket/insights/dt=2024-01-01",
+		},
+		{
+			name:     "Unknown generation time",
+			base:     "gs://bucket/insights",
+			expected: "gs://bucket/insights/dt=unknown",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, partitionPath(tc.base, tc.generatedAt))
+		})
+	}
+}
+
+func TestWritePartitionedJSONLFn_LateData(t *testing.T) {
+	ctx := context.Background()
+	fs := memfs.New(ctx)
+	fn := &writePartitionedJSONLFn{Base: "memfs://partitioned/insights", serializer: JSONSerializer[InsightsResult]{}, fs: fs}
+
+	day1 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	// The second bundle holds an insight of the first day, arriving late
+	for _, bundle := range [][]InsightsResult{
+		{{OverallAssessment: "a", GeneratedAt: day1}, {OverallAssessment: "b", GeneratedAt: day2}},
+		{{OverallAssessment: "c", GeneratedAt: day1}},
+	} {
+		fn.StartBundle(ctx)
+		for _, insights := range bundle {
+			assert.NoError(t, fn.ProcessElement(ctx, insights))
+		}
+		assert.NoError(t, fn.FinishBundle(ctx))
+	}
+
+	day1Parts, err := fs.List(ctx, "memfs://partitioned/insights/dt=2024-01-01/part-*.jsonl")
+	assert.NoError(t, err)
+	assert.Len(t, day1Parts, 2, "Expected the late insight in its own shard of the first day")
+
+	day2Parts, err := fs.List(ctx, "memfs://partitioned/insights/dt=2024-01-02/part-*.jsonl")
+	assert.NoError(t, err)
+	if assert.Len(t, day2Parts, 1) {
+		data, err := filesystem.Read(ctx, fs, day2Parts[0])
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"overall_assessment":"b"`)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// TruncationStrategy selects the part of an oversized assessment kept in the prompt.
+type TruncationStrategy string
+
+const (
+	// TruncateHead keeps the start of the assessment.
+	TruncateHead TruncationStrategy = "head"
+	// TruncateTail keeps the end of the assessment.
+	TruncateTail TruncationStrategy = "tail"
+	// TruncateMiddle keeps both ends and drops the middle, so a transcript keeps its
+	// opening questions and its final answers. It is the default.
+	TruncateMiddle TruncationStrategy = "middle"
+)
+
+// truncationMarker replaces the removed content, with the number of characters removed.
+const truncationMarker = "[... %d characters removed ...]"
+
+/*
+truncateAssessment shortens text to limit characters (runes) with the given strategy, putting
+a marker where content was removed. The marker isn't counted in the limit. Text within the
+limit, or a limit of 0 or less, leaves text unchanged.
+*/
+func truncateAssessment(text string, limit int, strategy TruncationStrategy) string {
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+	marker := fmt.Sprintf(truncationMarker, len(runes)-limit)
+
+	switch strategy {
+	case TruncateHead:
+		return string(runes[:limit]) + "\n" + marker
+	case TruncateTail:
+		return marker + "\n" + string(runes[len(runes)-limit:])
+	default:
+		head := (limit + 1) / 2
+		tail := limit - head
+		return string(runes[:head]) + "\n" + marker + "\n" + string(runes[len(runes)-tail:])
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTruncateAssessment(t *testing.T) {
+	text := "Q1: right. Q2: wrong. Q3: right."
+
+	testCases := []struct {
+		name     string
+		limit    int
+		strategy TruncationStrategy
+		expected string
+	}{
+		{
+			name:     "Head",
+			limit:    10,
+			strategy: TruncateHead,
+			expected: "Q1: right.\n[... 22 characters removed ...]",
+		},
+		{
+			name:     "Tail",
+			limit:    10,
+			strategy: TruncateTail,
+			expected: "[... 22 characters removed ...]\nQ3: right.",
+		},
+		{
+			name:     "Middle",
+			limit:    21,
+			strategy: TruncateMiddle,
+			expected: "Q1: right. \n[... 11 characters removed ...]\nQ3: right.",
+		},
+		{
+			name:     "Middle by default",
+			limit:    21,
+			expected: "Q1: right. \n[... 11 characters removed ...]\nQ3: right.",
+		},
+		{
+			name:     "Within the limit",
+			limit:    len(text),
+			strategy: TruncateHead,
+			expected: text,
+		},
+		{
+			name:     "Disabled",
+			strategy: TruncateTail,
+			expected: text,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, truncateAssessment(text, tc.limit, tc.strategy))
+		})
+	}
+
+	// Characters are never split
+	assert.Equal(t, "été\n[... 3 characters removed ...]", truncateAssessment("étéété", 3, TruncateHead))
+}
+
+func TestExtractInsights_MaxAssessmentChars(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, MaxAssessmentChars: 10, Truncation: TruncateTail}
+
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, "[... 22 characters removed ...]\nQ3: right.\n") && !strings.Contains(prompt, "Q1")
+	}), mock.Anything).Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+
+	_, err := ei.generateInsights(context.Background(), Assessment{Result: "Q1: right. Q2: wrong. Q3: right."}, 0)
+	assert.NoError(t, err)
+	mockLLM.AssertExpectations(t)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// QualityScorer scores the quality of insights from 0 to 1, given whether they passed validation.
+type QualityScorer func(insights InsightsResult, valid bool) float64
+
+// defaultQualityScorer is the scorer of ExtractInsights when QualityScorerName is unset.
+const defaultQualityScorer = "heuristic"
+
+// qualityScorers holds the quality scorers that can be referenced by name.
+var qualityScorers = map[string]QualityScorer{
+	defaultQualityScorer: heuristicQualityScore,
+}
+
+// RegisterQualityScorer makes a quality scorer available by name to ExtractInsights.QualityScorerName,
+// to be called from an init function as the workers resolve the name in Setup.
+func RegisterQualityScorer(name string, scorer QualityScorer) {
+	qualityScorers[name] = scorer
+}
+
+// Weights of the heuristic quality score, summing to 1.
+const (
+	completenessWeight = 0.4
+	specificityWeight  = 0.4
+	validationWeight   = 0.2
+)
+
+// specificFeedbackWords is the number of words from which feedback counts as fully specific.
+const specificFeedbackWords = 20
+
+// concreteTerms are the terms, lowercased, that make feedback concrete: the services the
+// Professional Data Engineer certification covers.
+var concreteTerms = []string{
+	"bigquery", "dataflow", "pub/sub", "pubsub", "dataproc", "bigtable", "spanner", "cloud storage",
+	"cloud sql", "composer", "vertex ai", "looker", "dataplex", "data fusion", "datastream", "firestore", "iam",
+}
+
+/*
+heuristicQualityScore is the default quality scorer, registered as "heuristic". It weighs:
+
+  - completeness: the fraction of the insights fields populated;
+  - specificity: how long the feedback (the overall assessment, the actionable feedback and
+    the recommended resources) is, up to specificFeedbackWords words on average, and the
+    fraction of it naming concrete terms, i.e. services or figures;
+  - validation: whether the insights passed validation.
+*/
+func heuristicQualityScore(insights InsightsResult, valid bool) float64 {
+	populated := []bool{
+		insights.OverallAssessment != "",
+		insights.CorrectAnswers > 0,
+		len(insights.Strengths) > 0,
+		len(insights.Weaknesses) > 0,
+		len(insights.ActionableFeedback) > 0,
+		len(insights.BusinessImpact) > 0,
+		len(insights.SkillGaps) > 0,
+		len(insights.StudyPlans) > 0,
+		len(insights.RankedWeaknesses) > 0,
+	}
+	var completeness float64
+	for _, ok := range populated {
+		if ok {
+			completeness++
+		}
+	}
+	completeness /= float64(len(populated))
+
+	score := completenessWeight*completeness + specificityWeight*specificity(feedback(insights))
+	if valid {
+		score += validationWeight
+	}
+	return min(max(score, 0), 1)
+}
+
+// feedback returns the free-text feedback of the insights.
+func feedback(insights InsightsResult) []string {
+	var texts []string
+	if insights.OverallAssessment != "" {
+		texts = append(texts, insights.OverallAssessment)
+	}
+	for _, key := range sortedKeys(insights.ActionableFeedback) {
+		texts = append(texts, insights.ActionableFeedback[key])
+	}
+	for _, gap := range insights.SkillGaps {
+		if gap.RecommendedResource != "" {
+			texts = append(texts, gap.RecommendedResource)
+		}
+	}
+	return texts
+}
+
+// specificity scores feedback from 0 to 1, equally on its average length in words, up to
+// specificFeedbackWords, and on the fraction of its texts naming a concrete term or a figure.
+func specificity(texts []string) float64 {
+	if len(texts) == 0 {
+		return 0
+	}
+	var words, concrete int
+	for _, text := range texts {
+		words += len(strings.Fields(text))
+		if isConcrete(text) {
+			concrete++
+		}
+	}
+	length := min(float64(words)/float64(len(texts))/specificFeedbackWords, 1)
+	return (length + float64(concrete)/float64(len(texts))) / 2
+}
+
+// isConcrete reports whether the text names a concrete term or holds a figure.
+func isConcrete(text string) bool {
+	if strings.IndexFunc(text, unicode.IsDigit) >= 0 {
+		return true
+	}
+	text = strings.ToLower(text)
+	for _, term := range concreteTerms {
+		if strings.Contains(text, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveQualityScorer sets the registered quality scorer named in QualityScorerName, the
+// heuristic one when unset.
+func (ei *ExtractInsights) resolveQualityScorer() error {
+	name := ei.QualityScorerName
+	if name == "" {
+		name = defaultQualityScorer
+	}
+	scorer, ok := qualityScorers[name]
+	if !ok {
+		return fmt.Errorf("error: unknown quality scorer %q", name)
+	}
+	ei.qualityScorer = scorer
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHeuristicQualityScore(t *testing.T) {
+	complete := InsightsResult{
+		OverallAssessment: "Strong on BigQuery partitioning and clustering, 8 of 10 design questions answered correctly.",
+		CorrectAnswers:    8,
+		Strengths:         []string{"BigQuery"},
+		Weaknesses:        []string{"Dataflow windowing"},
+		ActionableFeedback: map[string]string{
+			"Dataflow": "Practice fixed, sliding and session windows in Dataflow with late data and allowed lateness triggers.",
+		},
+		BusinessImpact:   map[string]string{"Streaming": "Late data is dropped from real-time dashboards."},
+		SkillGaps:        []SkillGap{{Skill: "Dataflow", Severity: SeverityMedium, RecommendedResource: "Dataflow streaming pipelines course, module 3 on windowing and triggers"}},
+		StudyPlans:       map[string]StudyPlan{"Dataflow windowing": {Topic: "Dataflow", EstimatedHours: 4}},
+		RankedWeaknesses: []RankedWeakness{{Topic: "Dataflow windowing", Severity: 0.6}},
+	}
+	vague := InsightsResult{
+		OverallAssessment:  "Needs work.",
+		ActionableFeedback: map[string]string{"General": "Study more."},
+	}
+
+	tests := []struct {
+		name     string
+		insights InsightsResult
+		valid    bool
+		min, max float64
+	}{
+		{name: "Complete and specific", insights: complete, valid: true, min: 0.8, max: 1},
+		{name: "Complete but invalid", insights: complete, valid: false, min: 0.6, max: 0.8},
+		{name: "Sparse and vague", insights: vague, valid: true, min: 0.2, max: 0.4},
+		{name: "Empty and invalid", insights: InsightsResult{}, valid: false, min: 0, max: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := heuristicQualityScore(tt.insights, tt.valid)
+			assert.GreaterOrEqual(t, score, tt.min)
+			assert.LessOrEqual(t, score, tt.max)
+		})
+	}
+}
+
+func TestExtractInsights_QualityScorer(t *testing.T) {
+	RegisterQualityScorer("test_constant", func(insights InsightsResult, valid bool) float64 {
+		if !valid {
+			return 0.1
+		}
+		return 0.5
+	})
+	defer delete(qualityScorers, "test_constant")
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, InsightsSchema: `{"type": "object"}`, MaxRetries: 1, QualityScorerName: "test_constant"}
+	assert.NoError(t, ei.resolveQualityScorer())
+
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good performance"}`, nil).Once()
+
+	insights, err := ei.extract(context.Background(), Assessment{Result: "User performance data."})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, insights.QualityScore)
+	mockLLM.AssertExpectations(t)
+
+	// Unset, the heuristic scorer is used
+	ei = &ExtractInsights{}
+	assert.NoError(t, ei.resolveQualityScorer())
+	assert.NotNil(t, ei.qualityScorer)
+
+	ei = &ExtractInsights{QualityScorerName: "stars"}
+	assert.Error(t, ei.resolveQualityScorer())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+firestoreTokenBucketStore is an llm.TokenBucketStore keeping each bucket in shards documents,
+updated in a transaction so workers never take the same token.
+
+A document sustains about one transaction per second, so the rate and burst of a bucket are
+split across its shards, each call taking a token from a random one. There are at most burst
+shards, so that every shard holds at least a token.
+*/
+type firestoreTokenBucketStore struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+	shards     int
+}
+
+// Take takes a token from a shard document of the bucket, creating it full when it doesn't exist yet.
+func (s *firestoreTokenBucketStore) Take(ctx context.Context, bucket string, rate float64, burst int) (time.Duration, error) {
+	shard, rate, burst := s.shard(bucket, rate, burst)
+	ref := s.collection.Doc(shard)
+
+	var wait time.Duration
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var state llm.TokenBucket
+		doc, err := tx.Get(ref)
+		switch {
+		case err == nil:
+			if err := doc.DataTo(&state); err != nil {
+				return fmt.Errorf("error decoding token bucket %s: %w", bucket, err)
+			}
+		case status.Code(err) != codes.NotFound:
+			return err
+		}
+
+		wait = state.Take(time.Now(), rate, burst)
+		return tx.Set(ref, state)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error updating token bucket %s: %w", bucket, err)
+	}
+
+	return wait, nil
+}
+
+// shard picks a random shard of the bucket, returning its document ID, rate and burst.
+func (s *firestoreTokenBucketStore) shard(bucket string, rate float64, burst int) (string, float64, int) {
+	shards := max(min(s.shards, burst), 1)
+	if shards == 1 {
+		return bucket, rate, burst
+	}
+	return fmt.Sprintf("%s-%d", bucket, rand.IntN(shards)), rate / float64(shards), burst / shards
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestFirestoreTokenBucketStore_shard(t *testing.T) {
+	tests := []struct {
+		name      string
+		shards    int
+		burst     int
+		wantIDs   []string
+		wantRate  float64
+		wantBurst int
+	}{
+		{name: "Sharded", shards: 4, burst: 20, wantIDs: []string{"gemini-0", "gemini-1", "gemini-2", "gemini-3"}, wantRate: 2.5, wantBurst: 5},
+		{name: "At most burst shards", shards: 4, burst: 2, wantIDs: []string{"gemini-0", "gemini-1"}, wantRate: 5, wantBurst: 1},
+		{name: "Single shard", shards: 1, burst: 20, wantIDs: []string{"gemini"}, wantRate: 10, wantBurst: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &firestoreTokenBucketStore{shards: tt.shards}
+			for range 50 {
+				id, rate, burst := store.shard("gemini", 10, tt.burst)
+				assert.Contains(t, tt.wantIDs, id)
+				assert.Equal(t, tt.wantRate, rate)
+				assert.Equal(t, tt.wantBurst, burst)
+			}
+		})
+	}
+}
+
+func TestExtractInsights_rateLimitModel(t *testing.T) {
+	// Real clients talk to the emulator address, which is never dialed by rateLimitModel
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:8080")
+
+	defaultNewFirestoreDatabaseClient := newFirestoreDatabaseClient
+	t.Cleanup(func() { newFirestoreDatabaseClient = defaultNewFirestoreDatabaseClient })
+
+	var gotProject, gotDatabase string
+	newFirestoreDatabaseClient = func(ctx context.Context, project, database string, opts ...option.ClientOption) (*firestore.Client, error) {
+		gotProject, gotDatabase = project, database
+		return defaultNewFirestoreDatabaseClient(ctx, project, database, opts...)
+	}
+
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:     mockLLM,
+		Project:   "test-project",
+		RateLimit: RateLimitConfig{RequestsPerSecond: 10, Burst: 20, Collection: "rate_limits", Database: "assessments-eu"},
+	}
+
+	assert.NoError(t, ei.rateLimitModel(context.Background(), ""))
+	assert.Equal(t, "test-project", gotProject)
+	assert.Equal(t, "assessments-eu", gotDatabase)
+	assert.NotNil(t, ei.rateLimitClient)
+	assert.NotSame(t, mockLLM, ei.model, "Expected the model to be wrapped by the rate limit")
+	assert.NoError(t, ei.Teardown())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.Function2x0(rawFailureToJSON)
+	register.Emitter1[string]()
+}
+
+// rawFailuresPath is where the raw responses that failed to parse are written, when requested.
+const rawFailuresPath = "raw_failures.jsonl"
+
+// maxRawFailureChars is the number of characters of a raw response kept in its RawFailure,
+// enough to repair a complete insights object while keeping runaway responses out of the output.
+const maxRawFailureChars = 16000
+
+// RawFailure is a raw response that failed to parse as insights, with the ID of its
+// assessment, for manual repair.
+type RawFailure struct {
+	AssessmentID string `json:"assessment_id"`
+	// Raw is the raw response, truncated to maxRawFailureChars characters.
+	Raw string `json:"raw"`
+	// RawLength is the length of the whole raw response in bytes, telling truncated ones apart.
+	RawLength int    `json:"raw_length"`
+	Error     string `json:"error"`
+}
+
+// isUnmarshalError reports whether the error is a failure to parse the response as JSON
+// insights, as opposed to a generation or validation failure.
+func isUnmarshalError(err error) bool {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// newRawFailure returns the RawFailure of an eval record, truncating its raw response.
+func newRawFailure(record EvalRecord) RawFailure {
+	return RawFailure{
+		AssessmentID: record.AssessmentID,
+		Raw:          truncateText(record.RawResponse, maxRawFailureChars),
+		RawLength:    len(record.RawResponse),
+		Error:        record.Error,
+	}
+}
+
+// rawFailureToJSON converts the eval records of the responses that failed to parse to
+// RawFailure JSON strings, dropping the other records.
+func rawFailureToJSON(record EvalRecord, emit func(string)) {
+	if !record.Unparseable {
+		return
+	}
+	jsonBytes, err := json.Marshal(newRawFailure(record))
+	if err != nil {
+		log.Printf("Error marshaling raw failure to JSON: %v", err)
+		return
+	}
+	emit(string(jsonBytes))
+}
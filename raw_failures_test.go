@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExtractInsights_RawFailures(t *testing.T) {
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{
+		model:          mockLLM,
+		InsightsSchema: "{}",
+		MaxRetries:     2,
+		RetryDelay:     time.Millisecond,
+		RawFailures:    true,
+	}
+
+	// A malformed response, retried, then a valid one
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good"`, nil).Once()
+	mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).
+		Return(`{"overall_assessment": "Good"}`, nil).Once()
+
+	var lines []string
+	ei.ProcessElement(context.Background(), Assessment{ID: "assessment-1", Result: "User performance data."}, noRubric, func(InsightsResult) {}, noSkipped(t), noRefused(t), noRecited(t), func(record EvalRecord) {
+		// Outside eval mode, only the raw failures are recorded
+		assert.True(t, record.Unparseable)
+		rawFailureToJSON(record, func(line string) { lines = append(lines, line) })
+	}, noRaw(t))
+
+	if assert.Len(t, lines, 1) {
+		var failure RawFailure
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &failure))
+		assert.Equal(t, "assessment-1", failure.AssessmentID)
+		assert.Equal(t, `{"overall_assessment": "Good"`, failure.Raw)
+		assert.Equal(t, len(`{"overall_assessment": "Good"`), failure.RawLength)
+		assert.Contains(t, failure.Error, "error unmarshaling insights")
+	}
+	mockLLM.AssertExpectations(t)
+}
+
+func TestRawFailureToJSON(t *testing.T) {
+	// Parsed responses are dropped
+	rawFailureToJSON(EvalRecord{RawResponse: `{}`}, func(line string) {
+		t.Errorf("Unexpected raw failure: %s", line)
+	})
+
+	// Long responses are truncated, keeping their length
+	long := strings.Repeat("x", maxRawFailureChars+100)
+	var failure RawFailure
+	rawFailureToJSON(EvalRecord{AssessmentID: "a", RawResponse: long, Unparseable: true}, func(line string) {
+		assert.NoError(t, json.Unmarshal([]byte(line), &failure))
+	})
+	assert.Equal(t, maxRawFailureChars+100, failure.RawLength)
+	assert.Equal(t, strings.Repeat("x", maxRawFailureChars)+"…", failure.Raw)
+}
+
+func TestIsUnmarshalError(t *testing.T) {
+	var insights InsightsResult
+	assert.True(t, isUnmarshalError(unmarshalError(json.Unmarshal([]byte(`{"overall_assessment": `), &insights), `{"overall_assessment": `)))
+	assert.True(t, isUnmarshalError(unmarshalError(json.Unmarshal([]byte(`{"questions_answered_correctly": "8"}`), &insights), `{"questions_answered_correctly": "8"}`)))
+	assert.False(t, isUnmarshalError(errEmptyResponse))
+	assert.False(t, isUnmarshalError(nil))
+}
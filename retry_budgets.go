@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// isValidationFailure reports whether a failed attempt got a response the model may correct on
+// a retry: unparseable JSON, an invalid field or tool input not matching the schema.
+func isValidationFailure(err error) bool {
+	var fieldErr *fieldError
+	return isUnmarshalError(err) || errors.As(err, &fieldErr) || errors.Is(err, errInvalidToolInput)
+}
+
+// isTransientFailure reports whether a failed attempt got no usable response from the
+// provider, e.g. a network error, a timeout or a response stopped by a provider error.
+// Truncations, empty responses and refusals are neither transient nor validation failures.
+func isTransientFailure(err error) bool {
+	return err != nil && !isValidationFailure(err) && !llm.IsTruncated(err) && !llm.IsRefused(err) &&
+		!errors.Is(err, errEmptyResponse) && !errors.Is(err, errLowConfidence)
+}
+
+/*
+WithRetryOnSchemaValidationFailure gives the retries of the responses failing schema validation
+(unparseable JSON, invalid fields or tool inputs), where the model gets a chance to correct
+itself, a budget of maxRetries of their own, so a stubborn model doesn't use up the attempts
+transient failures could have used. See MaxValidationRetries.
+*/
+func (ei *ExtractInsights) WithRetryOnSchemaValidationFailure(maxRetries int) *ExtractInsights {
+	ei.MaxValidationRetries = maxRetries
+	return ei
+}
+
+// retryBudgets counts the validation and transient retries of an extraction, against
+// MaxValidationRetries and MaxTransientRetries.
+type retryBudgets struct {
+	validation, transient int
+}
+
+// spend records the failed attempt against its budget, reporting whether it may still be retried.
+func (b *retryBudgets) spend(ei *ExtractInsights, err error) bool {
+	switch {
+	case isValidationFailure(err):
+		b.validation++
+		if ei.MaxValidationRetries > 0 && b.validation > ei.MaxValidationRetries {
+			log.Printf("Validation retry budget of %d spent: %v", ei.MaxValidationRetries, err)
+			return false
+		}
+	case isTransientFailure(err):
+		b.transient++
+		if ei.MaxTransientRetries > 0 && b.transient > ei.MaxTransientRetries {
+			log.Printf("Transient retry budget of %d spent: %v", ei.MaxTransientRetries, err)
+			return false
+		}
+	}
+	return true
+}
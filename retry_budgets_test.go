@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExtractInsights_RetryBudgets(t *testing.T) {
+	invalid := `{"overall_assessment": "Good"`
+	valid := `{"overall_assessment": "Good"}`
+	networkErr := errors.New("connection reset by peer")
+
+	type response struct {
+		text string
+		err  error
+	}
+	tests := []struct {
+		name                 string
+		maxValidationRetries int
+		maxTransientRetries  int
+		responses            []response
+		wantErr              bool
+	}{
+		{
+			name:                 "Validation budget spent",
+			maxValidationRetries: 1,
+			responses:            []response{{text: invalid}, {text: invalid}},
+			wantErr:              true,
+		},
+		{
+			name:                "Transient budget spent",
+			maxTransientRetries: 1,
+			responses:           []response{{err: networkErr}, {err: networkErr}},
+			wantErr:             true,
+		},
+		{
+			// Each budget only counts its own kind of failure
+			name:                 "Independent budgets",
+			maxValidationRetries: 1,
+			maxTransientRetries:  1,
+			responses:            []response{{text: invalid}, {err: networkErr}, {text: valid}},
+		},
+		{
+			name:      "Unset budgets use MaxRetries",
+			responses: []response{{text: invalid}, {text: invalid}, {err: networkErr}, {err: networkErr}, {text: valid}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLM := new(MockLanguageModel)
+			ei := (&ExtractInsights{
+				model:               mockLLM,
+				MaxRetries:          5,
+				RetryDelay:          time.Millisecond,
+				MaxTransientRetries: tt.maxTransientRetries,
+			}).WithRetryOnSchemaValidationFailure(tt.maxValidationRetries)
+
+			for _, resp := range tt.responses {
+				mockLLM.On("GenerateText", mock.Anything, mock.Anything, mock.Anything).Return(resp.text, resp.err).Once()
+			}
+
+			insights, err := ei.extract(context.Background(), Assessment{Result: "User performance data."})
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "Good", insights.OverallAssessment)
+			}
+			// No call is made beyond the budgets
+			mockLLM.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIsValidationFailure(t *testing.T) {
+	assert.True(t, isValidationFailure(&fieldError{Field: "skill_gaps", Err: errors.New("invalid severity")}))
+	assert.True(t, isValidationFailure(errInvalidToolInput))
+	assert.False(t, isValidationFailure(errors.New("connection reset by peer")))
+	assert.True(t, isTransientFailure(errors.New("connection reset by peer")))
+	assert.False(t, isTransientFailure(errEmptyResponse))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn2x0[Assessment, func(Assessment)](&sampleFn{})
+}
+
+// sampleFn is a DoFn keeping a fraction Rate of the assessments. Each assessment is picked by
+// hashing its document ID with Seed rather than drawing a random number, so the sample doesn't
+// depend on how the assessments are split across workers, reruns with the same seed pick the same
+// subset and an assessment stays in or out of it when its document is updated.
+type sampleFn struct {
+	Rate float64
+	Seed int64
+}
+
+func (fn *sampleFn) ProcessElement(assessment Assessment, emit func(Assessment)) {
+	if sampled(assessment, fn.Rate, fn.Seed) {
+		emit(assessment)
+	}
+}
+
+// sampled reports whether the assessment belongs to the sample of the given rate and seed.
+func sampled(assessment Assessment, rate float64, seed int64) bool {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, seed)
+	h.Write([]byte(assessment.ID))
+
+	// The top 53 bits of the hash, as a uniform float64 in [0, 1)
+	return float64(binary.BigEndian.Uint64(h.Sum(nil))>>11)/(1<<53) < rate
+}
+
+// sampleAssessments keeps a deterministic sample of rate of the assessments.
+func sampleAssessments(scope beam.Scope, rate float64, seed int64, assessments beam.PCollection) beam.PCollection {
+	return beam.ParDo(scope.Scope("SampleAssessments"), &sampleFn{Rate: rate, Seed: seed}, assessments)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSampled(t *testing.T) {
+	const total = 10000
+	base := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	assessments := make([]Assessment, total)
+	for i := range assessments {
+		assessments[i] = Assessment{
+			ID:          fmt.Sprintf("assessment-%d", i),
+			Result:      "Question 1: correct",
+			CompletedAt: base.Add(time.Duration(i) * time.Minute),
+		}
+	}
+
+	sample := func(rate float64, seed int64) map[int]bool {
+		picked := make(map[int]bool)
+		for i, assessment := range assessments {
+			if sampled(assessment, rate, seed) {
+				picked[i] = true
+			}
+		}
+		return picked
+	}
+
+	// Roughly the requested fraction is kept
+	first := sample(0.1, 42)
+	if n := len(first); n < 900 || n > 1100 {
+		t.Errorf("Expected about 1000 sampled assessments, got %d", n)
+	}
+
+	// The same seed picks the same subset
+	second := sample(0.1, 42)
+	if len(second) != len(first) {
+		t.Fatalf("Expected the same sample for the same seed, got %d and %d assessments", len(first), len(second))
+	}
+	for i := range first {
+		if !second[i] {
+			t.Fatalf("Expected assessment %d to be sampled again with the same seed", i)
+		}
+	}
+
+	// Updating a document doesn't move its assessment in or out of the sample
+	for i := range assessments {
+		assessments[i].Result = "Question 1: incorrect"
+		assessments[i].CompletedAt = assessments[i].CompletedAt.Add(time.Hour)
+	}
+	updated := sample(0.1, 42)
+	if len(updated) != len(first) {
+		t.Fatalf("Expected the same sample after updating the documents, got %d and %d assessments", len(first), len(updated))
+	}
+	for i := range first {
+		if !updated[i] {
+			t.Fatalf("Expected assessment %d to stay sampled after its update", i)
+		}
+	}
+
+	// Another seed picks another subset
+	other := sample(0.1, 7)
+	shared := 0
+	for i := range other {
+		if first[i] {
+			shared++
+		}
+	}
+	if shared > 200 {
+		t.Errorf("Expected mostly different samples for different seeds, %d assessments are shared", shared)
+	}
+
+	// Every assessment is kept at rate 1, none at rate 0
+	if n := len(sample(1, 42)); n != total {
+		t.Errorf("Expected every assessment at rate 1, got %d", n)
+	}
+	if n := len(sample(0, 42)); n != 0 {
+		t.Errorf("Expected no assessment at rate 0, got %d", n)
+	}
+}
+
+func TestSampleFn(t *testing.T) {
+	fn := &sampleFn{Rate: 0.5, Seed: 1}
+	assessment := Assessment{ID: "assessment-1", Result: "Test assessment"}
+
+	var emitted []Assessment
+	for i := 0; i < 3; i++ {
+		fn.ProcessElement(assessment, func(a Assessment) { emitted = append(emitted, a) })
+	}
+
+	// The decision only depends on the assessment and the seed
+	if len(emitted) != 0 && len(emitted) != 3 {
+		t.Errorf("Expected the assessment to be always or never sampled, got %d of 3", len(emitted))
+	}
+	if len(emitted) != 0 != sampled(assessment, 0.5, 1) {
+		t.Errorf("Expected sampleFn to follow sampled()")
+	}
+}
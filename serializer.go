@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+)
+
+func init() {
+	register.DoFn2x0[InsightsResult, func(string)](&serializeInsightsFn{})
+}
+
+// Serializer encodes the elements a sink writes, e.g. as JSON for files or as protobuf records.
+type Serializer[T any] interface {
+	Serialize(v T) ([]byte, error)
+}
+
+// JSONSerializer encodes the elements as JSON, one line of a JSON Lines file each.
+type JSONSerializer[T any] struct{}
+
+func (JSONSerializer[T]) Serialize(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// ProtoSerializer encodes the insights as InsightsResult messages of insights.proto.
+type ProtoSerializer struct{}
+
+func (ProtoSerializer) Serialize(insights InsightsResult) ([]byte, error) {
+	return encodeInsightsProto(insights)
+}
+
+// insightsSerializers holds the serializers of the insights the sinks can declare, by output format.
+var insightsSerializers = map[string]Serializer[InsightsResult]{
+	OutputFormatJSON:  JSONSerializer[InsightsResult]{},
+	OutputFormatProto: ProtoSerializer{},
+}
+
+// RegisterInsightsSerializer makes a serializer of the insights available to the sinks by name.
+// Register serializers in init, the sinks look them up when they start on a worker.
+func RegisterInsightsSerializer(name string, serializer Serializer[InsightsResult]) {
+	insightsSerializers[name] = serializer
+}
+
+// insightsSerializer returns the serializer registered as name, the JSON one when name is empty.
+func insightsSerializer(name string) (Serializer[InsightsResult], error) {
+	if name == "" {
+		name = OutputFormatJSON
+	}
+	serializer, ok := insightsSerializers[name]
+	if !ok {
+		return nil, fmt.Errorf("error: unknown serializer %q", name)
+	}
+	return serializer, nil
+}
+
+// serializeInsightsFn is a DoFn that serializes the insights into the lines written by the
+// line-oriented sinks (text files, appended and incrementally flushed files) with the
+// serializer they declare, by name, their keys localized for Locale unless it is empty (see
+// LocalizedSerializer). Insights failing to serialize are logged and dropped.
+type serializeInsightsFn struct {
+	Serializer string
+	Locale     string
+	serializer Serializer[InsightsResult]
+}
+
+func (fn *serializeInsightsFn) Setup() error {
+	var err error
+	fn.serializer, err = localizedInsightsSerializer(fn.Serializer, fn.Locale)
+	return err
+}
+
+func (fn *serializeInsightsFn) ProcessElement(insights InsightsResult, emit func(string)) {
+	line, err := fn.serializer.Serialize(insights)
+	if err != nil {
+		log.Printf("Error serializing insights of assessment %s: %v", insights.AssessmentID, err)
+		return
+	}
+	emit(string(line))
+}
+
+// serializeInsights serializes the insights into lines with the named serializer, localized for locale.
+func serializeInsights(scope beam.Scope, serializer, locale string, insights beam.PCollection) beam.PCollection {
+	scope = scope.Scope("serializeInsights")
+	return beam.ParDo(scope, &serializeInsightsFn{Serializer: serializer, Locale: locale}, insights)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// csvSerializer is a serializer registered by a test, writing a CSV row per insight.
+type csvSerializer struct{}
+
+func (csvSerializer) Serialize(insights InsightsResult) ([]byte, error) {
+	return []byte(insights.AssessmentID + "," + insights.OverallAssessment), nil
+}
+
+func TestJSONSerializer(t *testing.T) {
+	data, err := JSONSerializer[InsightsResult]{}.Serialize(InsightsResult{OverallAssessment: "Good", CorrectAnswers: 7})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"overall_assessment":"Good","questions_answered_correctly":7`)
+
+	// Values JSON can't represent fail to serialize
+	_, err = JSONSerializer[InsightsResult]{}.Serialize(InsightsResult{QualityScore: math.NaN()})
+	assert.Error(t, err)
+}
+
+func TestProtoSerializer(t *testing.T) {
+	insights := InsightsResult{
+		OverallAssessment:  "Good",
+		Weaknesses:         []string{"IAM"},
+		ActionableFeedback: map[string]string{"IAM": "Review the roles"},
+		AssessmentID:       "a",
+	}
+	data, err := ProtoSerializer{}.Serialize(insights)
+	assert.NoError(t, err)
+
+	decoded, err := decodeInsightsProto(data)
+	assert.NoError(t, err)
+	assert.Equal(t, insights, decoded)
+}
+
+func TestInsightsSerializer(t *testing.T) {
+	RegisterInsightsSerializer("csv", csvSerializer{})
+	t.Cleanup(func() { delete(insightsSerializers, "csv") })
+
+	tests := []struct {
+		name    string
+		want    Serializer[InsightsResult]
+		wantErr bool
+	}{
+		{name: "", want: JSONSerializer[InsightsResult]{}},
+		{name: OutputFormatJSON, want: JSONSerializer[InsightsResult]{}},
+		{name: OutputFormatProto, want: ProtoSerializer{}},
+		{name: "csv", want: csvSerializer{}},
+		{name: "avro", wantErr: true},
+	}
+	for _, tt := range tests {
+		serializer, err := insightsSerializer(tt.name)
+		if tt.wantErr {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, serializer, tt.name)
+	}
+}
+
+func TestSerializeInsightsFn(t *testing.T) {
+	RegisterInsightsSerializer("csv", csvSerializer{})
+	t.Cleanup(func() { delete(insightsSerializers, "csv") })
+
+	fn := &serializeInsightsFn{Serializer: "csv"}
+	assert.NoError(t, fn.Setup())
+	var lines []string
+	fn.ProcessElement(InsightsResult{AssessmentID: "a", OverallAssessment: "Good"}, func(line string) { lines = append(lines, line) })
+	assert.Equal(t, []string{"a,Good"}, lines)
+
+	// Insights failing to serialize are dropped
+	fn = &serializeInsightsFn{}
+	assert.NoError(t, fn.Setup())
+	lines = nil
+	fn.ProcessElement(InsightsResult{QualityScore: math.NaN()}, func(line string) { lines = append(lines, line) })
+	assert.Empty(t, lines)
+
+	assert.Error(t, (&serializeInsightsFn{Serializer: "avro"}).Setup())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/x/beamx"
+)
+
+func init() {
+	register.Function2x0(countSmokeTestInsights)
+}
+
+// smokeTestInsights counts the insights extracted in a smoke test.
+var smokeTestInsights = beam.NewCounter("smoke_test", "insights")
+
+// smokeTestSource returns the databases and the limit of the smoke test read: a single
+// document of the first database, the (default) one when none is given.
+func smokeTestSource(databases []string) ([]string, int) {
+	return databases[:min(len(databases), 1)], 1
+}
+
+// countSmokeTestInsights counts the insights of the smoke test document.
+func countSmokeTestInsights(ctx context.Context, _ InsightsResult) {
+	smokeTestInsights.Inc(ctx, 1)
+}
+
+// runSmokeTest runs the smoke test pipeline and reports whether the insights of its document
+// were extracted and written, exiting with a non-zero status when they weren't.
+func runSmokeTest(pipeline *beam.Pipeline) {
+	result, err := beamx.RunWithMetrics(context.Background(), pipeline)
+	if err != nil {
+		log.Fatalf("Smoke test failed: %v", err)
+	}
+	if result == nil {
+		log.Println("Smoke test passed: the pipeline ran end to end, the runner reported no metrics to check its insights")
+		return
+	}
+
+	if insights := smokeTestInsightsCount(result.Metrics()); insights == 0 {
+		log.Fatalf("Smoke test failed: no insights were extracted, the collection may be empty or the document was refused or skipped (see the logs and %s)", refusedPath)
+	}
+	log.Println("Smoke test passed: the insights of one assessment were extracted and written")
+}
+
+// smokeTestInsightsCount returns the insights counted by countSmokeTestInsights.
+func smokeTestInsightsCount(results metrics.Results) int64 {
+	var count int64
+	counters := results.Query(func(r metrics.SingleResult) bool {
+		return r.Namespace() == "smoke_test" && r.Name() == "insights"
+	}).Counters()
+	for _, counter := range counters {
+		count += counter.Result()
+	}
+	return count
+}
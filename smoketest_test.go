@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmokeTestSource(t *testing.T) {
+	testCases := []struct {
+		name              string
+		databases         []string
+		expectedDatabases []string
+	}{
+		{
+			name:              "Default database",
+			expectedDatabases: nil,
+		},
+		{
+			name:              "First of several databases",
+			databases:         []string{"assessments-eu", "assessments-us"},
+			expectedDatabases: []string{"assessments-eu"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			databases, limit := smokeTestSource(tc.databases)
+
+			// A single document of a single database is read
+			assert.Equal(t, tc.expectedDatabases, databases)
+			assert.Equal(t, 1, limit)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+streamInsights decodes the insights JSON object of a response streamed in chunks over tokens,
+e.g. by a provider streaming API, emitting the insights decoded so far every time one of their
+top-level fields completes, so overall_assessment can be shown before the rest is generated.
+
+It returns the insights once the object is complete, or the insights decoded so far and an
+error when the response is not a JSON object or the stream ends before the object does.
+The tokens channel is always drained.
+*/
+func streamInsights(tokens <-chan string, emit func(InsightsResult)) (InsightsResult, error) {
+	reader, writer := io.Pipe()
+	defer reader.Close()
+
+	// Writing the chunks as they come, the decoder blocks until the next one
+	go func() {
+		var err error
+		for token := range tokens {
+			if err == nil {
+				_, err = io.WriteString(writer, token)
+			}
+		}
+		writer.Close()
+	}()
+
+	var insights InsightsResult
+	dec := json.NewDecoder(reader)
+	token, err := dec.Token()
+	if err != nil {
+		return insights, fmt.Errorf("error decoding insights stream: %w", err)
+	}
+	if token != json.Delim('{') {
+		return insights, errors.New("error decoding insights stream: response is not a JSON object")
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return insights, fmt.Errorf("error decoding insights stream: %w", err)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return insights, fmt.Errorf("error decoding insights stream field %v: %w", token, err)
+		}
+
+		setInsightsField(&insights, token.(string), value)
+		emit(cloneInsights(insights))
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return insights, fmt.Errorf("error decoding insights stream: %w", err)
+	}
+	return insights, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// streamChunks sends the chunks over a channel, closing it after the last one.
+func streamChunks(chunks ...string) <-chan string {
+	tokens := make(chan string)
+	go func() {
+		defer close(tokens)
+		for _, chunk := range chunks {
+			tokens <- chunk
+		}
+	}()
+	return tokens
+}
+
+func TestStreamInsights(t *testing.T) {
+	var emitted []InsightsResult
+	emit := func(insights InsightsResult) {
+		emitted = append(emitted, insights)
+	}
+
+	insights, err := streamInsights(streamChunks(
+		`{"overall_as`, `sessment": "Good`, ` performance", "stre`,
+		`ngths": ["Quick`, ` learner"], "questions_answered_correctly"`, `: 8`, `}`,
+	), emit)
+	if err != nil {
+		t.Fatalf("streamInsights() returned error: %v", err)
+	}
+
+	// Every field is emitted as soon as it completes, on top of the previous ones
+	expected := []InsightsResult{
+		{OverallAssessment: "Good performance"},
+		{OverallAssessment: "Good performance", Strengths: []string{"Quick learner"}},
+		{OverallAssessment: "Good performance", Strengths: []string{"Quick learner"}, CorrectAnswers: 8},
+	}
+	assert.Equal(t, expected, emitted)
+	assert.Equal(t, expected[2], insights)
+
+	// A stream ending before the object returns the fields decoded so far
+	emitted = nil
+	insights, err = streamInsights(streamChunks(`{"overall_assessment": "Good", "strengths": ["Qui`), emit)
+	assert.Error(t, err)
+	assert.Equal(t, InsightsResult{OverallAssessment: "Good"}, insights)
+	assert.Equal(t, []InsightsResult{{OverallAssessment: "Good"}}, emitted)
+
+	// Other values are not insights
+	_, err = streamInsights(streamChunks(`["Good"]`), emit)
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/luillyfe/assessment-data-pipeline/llm"
+)
+
+// defaultTransportBackoff is the wait before the first transport retry when TransportRetriesConfig.Backoff is unset.
+const defaultTransportBackoff = 500 * time.Millisecond
+
+// TransportRetriesConfig holds the settings of the transport retries, see ExtractInsights.WithTransportRetries.
+type TransportRetriesConfig struct {
+	// MaxRetries is the number of retries of a failed HTTP request, 0 disables them.
+	MaxRetries int `yaml:"max_retries"`
+	// Backoff is the wait before the first retry, doubled for every other one,
+	// defaultTransportBackoff when unset.
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+// transportRetriesOnce installs the retrying HTTP client of the worker, shared by every provider.
+var transportRetriesOnce sync.Once
+
+/*
+WithTransportRetries retries the HTTP requests of the model calls failing with a connection
+error or a 5xx status up to maxRetries times, waiting backoff then twice as long before each
+further retry (see llm.NewRetryingTransport). The retrying client is shared by every provider
+of the worker.
+
+Transport retries happen within a single model call: a call retried by the transport counts
+once towards MaxTotalCalls, the retries metric and the provider error rate, and only fails,
+to be retried by ExtractInsights, once its transport retries are spent.
+*/
+func (ei *ExtractInsights) WithTransportRetries(maxRetries int, backoff time.Duration) *ExtractInsights {
+	ei.TransportRetries = TransportRetriesConfig{MaxRetries: maxRetries, Backoff: backoff}
+	return ei
+}
+
+// installTransportRetries sets the retrying HTTP client shared by the providers of the worker,
+// once, before the models are created.
+func (ei *ExtractInsights) installTransportRetries() {
+	if ei.TransportRetries.MaxRetries <= 0 {
+		return
+	}
+	transportRetriesOnce.Do(func() {
+		backoff := ei.TransportRetries.Backoff
+		if backoff <= 0 {
+			backoff = defaultTransportBackoff
+		}
+		llm.SetHTTPClient(&http.Client{Transport: llm.NewRetryingTransport(nil, ei.TransportRetries.MaxRetries, backoff)})
+	})
+}
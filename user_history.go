@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/bigquery/v2"
+)
+
+// historyTablePattern matches the BigQuery tables of the user history, as project.dataset.table.
+var historyTablePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\.[A-Za-z0-9_]+\.[A-Za-z0-9_]+$`)
+
+// UserHistory summarizes the past assessments of a user.
+type UserHistory struct {
+	Assessments int
+	// AvgCorrectAnswers is the average number of questions answered correctly.
+	AvgCorrectAnswers float64
+	// LastCompletedAt is the date of the last assessment, as YYYY-MM-DD.
+	LastCompletedAt string
+}
+
+// summary describes the history in the prompt, nothing for a user without past assessments.
+func (h UserHistory) summary() string {
+	if h.Assessments == 0 {
+		return ""
+	}
+	return fmt.Sprintf("The user has completed %d previous assessments, answering %.1f questions correctly on average, the last one on %s.", h.Assessments, h.AvgCorrectAnswers, h.LastCompletedAt)
+}
+
+// userHistoryClient looks up the history of a user, e.g. in BigQuery.
+type userHistoryClient interface {
+	UserHistory(ctx context.Context, userID string) (UserHistory, error)
+}
+
+/*
+bigQueryHistoryClient looks up the history of the users in a BigQuery table of past insights,
+with a user_id, a completed_at timestamp and a questions_answered_correctly column, as
+project.dataset.table. The queries are billed to the project of the table.
+*/
+type bigQueryHistoryClient struct {
+	service *bigquery.Service
+	project string
+	table   string
+}
+
+// newBigQueryHistoryClient creates a client of the history table, with the default credentials.
+func newBigQueryHistoryClient(ctx context.Context, table string) (*bigQueryHistoryClient, error) {
+	if !historyTablePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid history table %q, expected project.dataset.table", table)
+	}
+	service, err := bigquery.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing BigQuery client: %w", err)
+	}
+	project, _, _ := strings.Cut(table, ".")
+	return &bigQueryHistoryClient{service: service, project: project, table: table}, nil
+}
+
+func (c *bigQueryHistoryClient) UserHistory(ctx context.Context, userID string) (UserHistory, error) {
+	useLegacySQL := false
+	request := &bigquery.QueryRequest{
+		Query: fmt.Sprintf("SELECT COUNT(*), AVG(questions_answered_correctly), FORMAT_TIMESTAMP('%%Y-%%m-%%d', MAX(completed_at)) "+
+			"FROM `%s` WHERE user_id = @user_id", c.table),
+		UseLegacySql:  &useLegacySQL,
+		ParameterMode: "NAMED",
+		QueryParameters: []*bigquery.QueryParameter{{
+			Name:           "user_id",
+			ParameterType:  &bigquery.QueryParameterType{Type: "STRING"},
+			ParameterValue: &bigquery.QueryParameterValue{Value: userID},
+		}},
+	}
+	response, err := c.service.Jobs.Query(c.project, request).Context(ctx).Do()
+	if err != nil {
+		return UserHistory{}, fmt.Errorf("error querying user history: %w", err)
+	}
+	if !response.JobComplete {
+		return UserHistory{}, fmt.Errorf("error querying user history: query of user %s timed out", userID)
+	}
+	if len(response.Rows) == 0 || len(response.Rows[0].F) < 3 {
+		return UserHistory{}, nil
+	}
+	return parseUserHistory(response.Rows[0].F)
+}
+
+// parseUserHistory parses the cells of the history query, whose values are strings, nil
+// for a user without past assessments.
+func parseUserHistory(cells []*bigquery.TableCell) (UserHistory, error) {
+	var history UserHistory
+	if count, ok := cells[0].V.(string); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return UserHistory{}, fmt.Errorf("error parsing user history count %q: %w", count, err)
+		}
+		history.Assessments = n
+	}
+	if avg, ok := cells[1].V.(string); ok {
+		f, err := strconv.ParseFloat(avg, 64)
+		if err != nil {
+			return UserHistory{}, fmt.Errorf("error parsing user history average %q: %w", avg, err)
+		}
+		history.AvgCorrectAnswers = f
+	}
+	history.LastCompletedAt, _ = cells[2].V.(string)
+	return history, nil
+}
+
+// WithContextEnrichmentFromBigQuery enriches the prompts with a summary of the user's past
+// assessments, looked up in the BigQuery table (as project.dataset.table) once per user and
+// worker. Assessments without a user ID aren't enriched.
+func (ei *ExtractInsights) WithContextEnrichmentFromBigQuery(table string) *ExtractInsights {
+	ei.HistoryTable = table
+	return ei
+}
+
+// userHistory returns the summary of the history of the user of the assessment, looking it up
+// the first time the worker sees the user. A failed lookup isn't cached, the prompt goes without.
+func (ei *ExtractInsights) userHistory(ctx context.Context, assessment Assessment) string {
+	if ei.historyClient == nil || assessment.UserID == "" {
+		return ""
+	}
+	if summary, ok := ei.histories[assessment.UserID]; ok {
+		return summary
+	}
+	history, err := ei.historyClient.UserHistory(ctx, assessment.UserID)
+	if err != nil {
+		log.Printf("Warning: %v, extracting the insights of assessment %s without the user history", err, assessment.ID)
+		return ""
+	}
+	if ei.histories == nil {
+		ei.histories = make(map[string]string)
+	}
+	ei.histories[assessment.UserID] = history.summary()
+	return ei.histories[assessment.UserID]
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/api/bigquery/v2"
+)
+
+// fakeHistoryClient is a userHistoryClient answering from a map, counting the lookups.
+type fakeHistoryClient struct {
+	histories map[string]UserHistory
+	lookups   int
+}
+
+func (c *fakeHistoryClient) UserHistory(ctx context.Context, userID string) (UserHistory, error) {
+	c.lookups++
+	history, ok := c.histories[userID]
+	if !ok {
+		return UserHistory{}, errors.New("user not found")
+	}
+	return history, nil
+}
+
+func TestExtractInsights_UserHistory(t *testing.T) {
+	response := `{"overall_assessment": "Good performance"}`
+	history := &fakeHistoryClient{histories: map[string]UserHistory{
+		"user-1": {Assessments: 3, AvgCorrectAnswers: 7.5, LastCompletedAt: "2024-05-01"},
+	}}
+	mockLLM := new(MockLanguageModel)
+	ei := &ExtractInsights{model: mockLLM, InsightsSchema: `{"type": "object"}`, historyClient: history}
+
+	summary := "The user has completed 3 previous assessments, answering 7.5 questions correctly on average, the last one on 2024-05-01."
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return strings.Contains(prompt, summary)
+	}), mock.Anything).Return(response, nil).Twice()
+	mockLLM.On("GenerateText", mock.Anything, mock.MatchedBy(func(prompt string) bool {
+		return !strings.Contains(prompt, "history of the user")
+	}), mock.Anything).Return(response, nil).Twice()
+
+	// The history of a user is looked up once
+	for _, assessment := range []Assessment{
+		{ID: "a1", UserID: "user-1", Result: "First assessment."},
+		{ID: "a2", UserID: "user-1", Result: "Second assessment."},
+		{ID: "a3", Result: "Anonymous assessment."},
+		{ID: "a4", UserID: "user-2", Result: "Unknown user assessment."},
+	} {
+		_, err := ei.generateInsights(context.Background(), assessment, 0)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, history.lookups)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestParseUserHistory(t *testing.T) {
+	got, err := parseUserHistory([]*bigquery.TableCell{{V: "4"}, {V: "6.25"}, {V: "2024-05-01"}})
+	assert.NoError(t, err)
+	assert.Equal(t, UserHistory{Assessments: 4, AvgCorrectAnswers: 6.25, LastCompletedAt: "2024-05-01"}, got)
+
+	// A user without past assessments has no average nor last date
+	got, err = parseUserHistory([]*bigquery.TableCell{{V: "0"}, {V: nil}, {V: nil}})
+	assert.NoError(t, err)
+	assert.Equal(t, UserHistory{}, got)
+	assert.Empty(t, got.summary())
+
+	_, err = parseUserHistory([]*bigquery.TableCell{{V: "many"}, {V: nil}, {V: nil}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+)
+
+// SkillGapSeverity is the severity of a skill gap.
+type SkillGapSeverity string
+
+const (
+	SeverityLow    SkillGapSeverity = "low"
+	SeverityMedium SkillGapSeverity = "medium"
+	SeverityHigh   SkillGapSeverity = "high"
+)
+
+// fieldError is an invalid top-level field of the insights, by its JSON name.
+type fieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *fieldError) Error() string { return e.Err.Error() }
+
+func (e *fieldError) Unwrap() error { return e.Err }
+
+// validateInsights checks the parsed insights against the constraints that JSON
+// unmarshaling can't enforce, such as enum values, positive study hours and ranked
+// weaknesses sorted by descending severity within [0, 1]. Errors are *fieldError, naming the
+// invalid field.
+func validateInsights(insights InsightsResult) error {
+	for i, weakness := range insights.RankedWeaknesses {
+		if weakness.Severity < 0 || weakness.Severity > 1 {
+			return &fieldError{Field: "ranked_weaknesses", Err: fmt.Errorf("ranked weakness %d (%s): severity must be between 0 and 1, got %v", i, weakness.Topic, weakness.Severity)}
+		}
+		if i > 0 && weakness.Severity > insights.RankedWeaknesses[i-1].Severity {
+			return &fieldError{Field: "ranked_weaknesses", Err: fmt.Errorf("ranked weakness %d (%s): severity %v is above the previous one, %v", i, weakness.Topic, weakness.Severity, insights.RankedWeaknesses[i-1].Severity)}
+		}
+	}
+
+	for i, gap := range insights.SkillGaps {
+		switch gap.Severity {
+		case SeverityLow, SeverityMedium, SeverityHigh:
+		default:
+			return &fieldError{Field: "skill_gaps", Err: fmt.Errorf("skill gap %d (%s): invalid severity %q", i, gap.Skill, gap.Severity)}
+		}
+	}
+
+	for weakness, plan := range insights.StudyPlans {
+		if plan.EstimatedHours <= 0 {
+			return &fieldError{Field: "study_plans", Err: fmt.Errorf("study plan for %q: estimated hours must be positive, got %v", weakness, plan.EstimatedHours)}
+		}
+	}
+
+	return nil
+}
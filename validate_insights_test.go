@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestValidateInsights tests the validateInsights function.
+func TestValidateInsights(t *testing.T) {
+	testCases := []struct {
+		name        string
+		insights    InsightsResult
+		expectError bool
+	}{
+		{
+			name: "Valid skill gaps",
+			insights: InsightsResult{
+				SkillGaps: []SkillGap{
+					{Skill: "Cloud security", Severity: SeverityHigh, RecommendedResource: "Cloud IAM documentation"},
+					{Skill: "Data warehousing", Severity: SeverityLow, RecommendedResource: "BigQuery best practices"},
+				},
+			},
+		},
+		{
+			name: "No skill gaps",
+		},
+		{
+			name: "Out of enum severity",
+			insights: InsightsResult{
+				SkillGaps: []SkillGap{
+					{Skill: "Cloud security", Severity: "critical", RecommendedResource: "Cloud IAM documentation"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid study plans",
+			insights: InsightsResult{
+				StudyPlans: map[string]StudyPlan{
+					"IAM":       {Topic: "Cloud IAM roles", EstimatedHours: 4, Resources: []string{"IAM overview"}},
+					"Streaming": {Topic: "Dataflow windowing", EstimatedHours: 1.5},
+				},
+			},
+		},
+		{
+			name: "Negative study hours",
+			insights: InsightsResult{
+				StudyPlans: map[string]StudyPlan{
+					"IAM": {Topic: "Cloud IAM roles", EstimatedHours: -2},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Missing study hours",
+			insights: InsightsResult{
+				StudyPlans: map[string]StudyPlan{"IAM": {Topic: "Cloud IAM roles"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "Missing severity",
+			insights: InsightsResult{
+				SkillGaps: []SkillGap{{Skill: "Cloud security"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid ranked weaknesses",
+			insights: InsightsResult{
+				RankedWeaknesses: []RankedWeakness{{Topic: "IAM", Severity: 1}, {Topic: "Pub/Sub", Severity: 0.4}, {Topic: "Bigtable", Severity: 0.4}, {Topic: "Dataproc", Severity: 0}},
+			},
+		},
+		{
+			name: "Severity above 1",
+			insights: InsightsResult{
+				RankedWeaknesses: []RankedWeakness{{Topic: "IAM", Severity: 1.2}},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative severity",
+			insights: InsightsResult{
+				RankedWeaknesses: []RankedWeakness{{Topic: "IAM", Severity: 0.5}, {Topic: "Pub/Sub", Severity: -0.1}},
+			},
+			expectError: true,
+		},
+		{
+			name: "Unsorted ranked weaknesses",
+			insights: InsightsResult{
+				RankedWeaknesses: []RankedWeakness{{Topic: "Pub/Sub", Severity: 0.4}, {Topic: "IAM", Severity: 0.9}},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateInsights(tc.insights)
+			if (err != nil) != tc.expectError {
+				t.Errorf("validateInsights() error = %v, expectError %v", err, tc.expectError)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// pipelineFields are the InsightsResult fields filled in by the pipeline rather than
+// the model, so they don't need a property in the insights schema.
+var pipelineFields = map[string]bool{
+	"completed_at":  true,
+	"generated_at":  true,
+	"degraded":      true,
+	"model_version": true,
+	"finish_reason": true,
+	"assessment_id": true,
+	"quality_score": true,
+}
+
+// validateSchema checks that the schema compiles as a JSON Schema and that every
+// InsightsResult field produced by the model maps to one of its top-level properties.
+func validateSchema(schema string) error {
+	if _, err := jsonschema.CompileString("insights_schema.json", schema); err != nil {
+		return fmt.Errorf("error compiling schema: %w", err)
+	}
+
+	var document struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(schema), &document); err != nil {
+		return fmt.Errorf("error reading schema properties: %w", err)
+	}
+
+	var missing []string
+	resultType := reflect.TypeOf(InsightsResult{})
+	for i := 0; i < resultType.NumField(); i++ {
+		name, _, _ := strings.Cut(resultType.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" || pipelineFields[name] {
+			continue
+		}
+		if _, ok := document.Properties[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("schema has no properties for InsightsResult fields: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
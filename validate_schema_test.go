@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	validSchema, err := readFile("insights_schema.json")
+	if err != nil {
+		t.Fatalf("Failed to read insights schema: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		schema        string
+		expectedError string
+	}{
+		{
+			name:   "Valid schema",
+			schema: validSchema,
+		},
+		{
+			name: "Mismatched schema",
+			schema: `{
+				"type": "object",
+				"properties": {
+					"overall_assessment": {"type": "string"},
+					"questions_answered_correctly": {"type": "integer"},
+					"strengths": {"type": "array", "items": {"type": "string"}},
+					"weaknesses": {"type": "array", "items": {"type": "string"}}
+				}
+			}`,
+			expectedError: "actionable_feedback, business_case_impact_analysis, skill_gaps",
+		},
+		{
+			name:          "Invalid JSON Schema",
+			schema:        `{"type": "object", "properties": {"strengths": {"type": "list"}}}`,
+			expectedError: "error compiling schema",
+		},
+		{
+			name:          "Malformed JSON",
+			schema:        `{"type": "object"`,
+			expectedError: "error compiling schema",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSchema(tc.schema)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}